@@ -0,0 +1,19 @@
+package cash
+
+import "own-1Pixel/backend/go/events"
+
+// LedgerPosted 会计分录已登记（事务提交后发布）
+type LedgerPosted struct {
+	Entry JournalEntry
+}
+
+func (LedgerPosted) EventName() string { return "ledger.posted" }
+
+// 将已登记的分录转换为事件
+func ledgerPostedEvents(entries []*JournalEntry) []events.Event {
+	posted := make([]events.Event, 0, len(entries))
+	for _, entry := range entries {
+		posted = append(posted, LedgerPosted{Entry: *entry})
+	}
+	return posted
+}
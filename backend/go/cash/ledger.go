@@ -0,0 +1,318 @@
+package cash
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 账户类型
+const (
+	AccountTypeUserCash = "user_cash" // 玩家现金账户
+	AccountTypeSystem   = "system"    // 系统账户
+)
+
+// 系统账户编码
+const (
+	AccountExternal    = "system:external"     // 外部资金，手工录入和历史数据导入的对方账户
+	AccountMarket      = "system:market"       // 萌铺子市场，市场买卖的对方账户
+	AccountEscrow      = "system:escrow"       // 拍卖保证金，英式拍卖领先出价冻结的资金
+	AccountWorkshop    = "system:workshop"     // 园区工坊，制作物品费用的收款账户
+	AccountOrderEscrow = "system:order_escrow" // 挂单冻结资金，订单簿买单未成交部分冻结的资金
+)
+
+// 分录类型
+const (
+	EntryKindManual            = "manual"             // 手工录入
+	EntryKindMarketBuy         = "market_buy"         // 市场买入
+	EntryKindMarketSell        = "market_sell"        // 市场卖出
+	EntryKindAuctionSettlement = "auction_settlement" // 拍卖成交结算
+	EntryKindAuctionHold       = "auction_hold"       // 拍卖出价冻结
+	EntryKindAuctionRelease    = "auction_release"    // 拍卖出价解冻退还
+	EntryKindCrafting          = "crafting"           // 制作物品费用
+	EntryKindOrderHold         = "order_hold"         // 买单资金冻结
+	EntryKindOrderRelease      = "order_release"      // 买单资金解冻退还
+	EntryKindOrderSettlement   = "order_settlement"   // 订单成交结算
+	EntryKindLegacy            = "legacy"             // 历史交易记录导入
+	EntryKindLegacyAdjustment  = "legacy_adjustment"  // 历史余额校准
+)
+
+// 账本相关错误
+var (
+	ErrInsufficientFunds = errors.New("余额不足")
+	ErrUnbalancedEntry   = errors.New("分录借贷不平衡")
+	ErrAccountNotFound   = errors.New("账户不存在")
+)
+
+// 账户
+type Account struct {
+	ID            int         `json:"id"`
+	Code          string      `json:"code"`           // 账户编码
+	Name          string      `json:"name"`           // 账户名称
+	Type          string      `json:"type"`           // 账户类型
+	UserID        *int        `json:"user_id"`        // 所属玩家，系统账户为空
+	AllowNegative bool        `json:"allow_negative"` // 是否允许余额为负
+	Balance       money.Money `json:"balance"`        // 余额（借方 - 贷方）
+	CreatedAt     time.Time   `json:"created_at"`     // 创建时间
+	UpdatedAt     time.Time   `json:"updated_at"`     // 更新时间
+}
+
+// 分录明细，借方和贷方只能填写一个
+type Posting struct {
+	ID             int         `json:"id"`
+	JournalEntryID int         `json:"journal_entry_id"`
+	AccountID      int         `json:"account_id"`
+	Debit          money.Money `json:"debit"`         // 借方金额
+	Credit         money.Money `json:"credit"`        // 贷方金额
+	BalanceAfter   money.Money `json:"balance_after"` // 记账后账户余额
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// 会计分录
+type JournalEntry struct {
+	ID        int       `json:"id"`
+	EntryTime time.Time `json:"entry_time"` // 记账时间
+	Kind      string    `json:"kind"`       // 分录类型
+	Note      string    `json:"note"`       // 摘要
+	CreatedAt time.Time `json:"created_at"`
+	Postings  []Posting `json:"postings"`
+}
+
+// 流水附言，描述玩家交易记录中的双方信息
+type Memo struct {
+	OurBankAccountName string // 己方银行户名
+	CounterpartyAlias  string // 对手方别名
+	OurBankName        string // 己方开户行
+	CounterpartyBank   string // 对手方开户行
+	Note               string // 附言（用途）
+}
+
+// Swapped 返回对手方视角的附言
+func (m Memo) Swapped() Memo {
+	return Memo{
+		OurBankAccountName: m.CounterpartyAlias,
+		CounterpartyAlias:  m.OurBankAccountName,
+		OurBankName:        m.CounterpartyBank,
+		CounterpartyBank:   m.OurBankName,
+		Note:               m.Note,
+	}
+}
+
+// 转账请求
+type TransferRequest struct {
+	Kind          string      // 分录类型
+	FromAccountID int         // 付款账户（贷方）
+	ToAccountID   int         // 收款账户（借方）
+	Amount        money.Money // 金额
+	Memo          Memo        // 付款方视角的附言，收款方流水自动使用对手方视角
+}
+
+// 玩家现金账户编码
+func userCashAccountCode(userID int) string {
+	return fmt.Sprintf("user:%d:cash", userID)
+}
+
+// EnsureSystemAccounts 开立系统账户（已存在则跳过）
+func EnsureSystemAccounts(ledger LedgerStore) error {
+	for _, account := range []Account{
+		{Code: AccountExternal, Name: "外部资金"},
+		{Code: AccountMarket, Name: "萌铺子市场"},
+		{Code: AccountEscrow, Name: "拍卖保证金"},
+		{Code: AccountWorkshop, Name: "园区工坊"},
+		{Code: AccountOrderEscrow, Name: "挂单冻结资金"},
+	} {
+		account.Type = AccountTypeSystem
+		account.AllowNegative = true
+		if err := ledger.EnsureAccount(&account); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureUserAccount 开立玩家现金账户（已存在则跳过）
+func EnsureUserAccount(ledger LedgerStore, userID int) error {
+	err := ledger.EnsureAccount(&Account{
+		Code:   userCashAccountCode(userID),
+		Name:   fmt.Sprintf("玩家%d现金账户", userID),
+		Type:   AccountTypeUserCash,
+		UserID: &userID,
+	})
+	if err != nil {
+		logger.Info("cash", fmt.Sprintf("初始化玩家 %d 现金账户失败: %v\n", userID, err))
+	}
+	return err
+}
+
+// 初始化玩家现金账户（事务版本，已存在则跳过）
+func InitUserAccount(tx *sql.Tx, userID int) error {
+	return EnsureUserAccount(NewSQLLedgerStore(tx), userID)
+}
+
+// 按编码获取账户ID
+func AccountIDByCode(ledger LedgerStore, code string) (int, error) {
+	account, err := ledger.AccountByCode(code)
+	if err != nil {
+		return 0, err
+	}
+	return account.ID, nil
+}
+
+// 获取玩家现金账户ID
+func UserCashAccountID(ledger LedgerStore, userID int) (int, error) {
+	return AccountIDByCode(ledger, userCashAccountCode(userID))
+}
+
+// 获取玩家现金账户
+func GetUserCashAccount(ledger LedgerStore, userID int) (*Account, error) {
+	return ledger.AccountByCode(userCashAccountCode(userID))
+}
+
+// PostEntry 在事务中登记一笔会计分录，借贷必须平衡，不允许透支的账户余额不能为负
+func PostEntry(ledger LedgerStore, kind string, note string, postings []Posting) (*JournalEntry, error) {
+	return postEntry(ledger, kind, note, postings, true)
+}
+
+func postEntry(ledger LedgerStore, kind string, note string, postings []Posting, enforceLimits bool) (*JournalEntry, error) {
+	if len(postings) < 2 {
+		return nil, ErrUnbalancedEntry
+	}
+	totalDebit, totalCredit := money.Zero, money.Zero
+	for _, posting := range postings {
+		if posting.Debit.IsNegative() || posting.Credit.IsNegative() || posting.Debit.IsPositive() == posting.Credit.IsPositive() {
+			return nil, fmt.Errorf("%w: 每条明细必须且只能填写借方或贷方金额", ErrUnbalancedEntry)
+		}
+		var err error
+		if totalDebit, err = totalDebit.Add(posting.Debit); err != nil {
+			return nil, fmt.Errorf("计算借方合计失败: %w", err)
+		}
+		if totalCredit, err = totalCredit.Add(posting.Credit); err != nil {
+			return nil, fmt.Errorf("计算贷方合计失败: %w", err)
+		}
+	}
+	if !totalDebit.Equal(totalCredit) {
+		return nil, fmt.Errorf("%w: 借方 %s，贷方 %s", ErrUnbalancedEntry, totalDebit, totalCredit)
+	}
+
+	currentTime := timeservice.SyncNow()
+	entry := &JournalEntry{
+		EntryTime: currentTime,
+		Kind:      kind,
+		Note:      note,
+		CreatedAt: currentTime,
+	}
+	if err := ledger.InsertJournalEntry(entry); err != nil {
+		return nil, fmt.Errorf("插入会计分录失败: %v", err)
+	}
+
+	for _, posting := range postings {
+		// 余额在同一事务中由明细累加得出
+		amount, err := posting.Debit.Sub(posting.Credit)
+		if err != nil {
+			return nil, fmt.Errorf("计算账户 %d 记账金额失败: %w", posting.AccountID, err)
+		}
+		account, err := ledger.AddToBalance(posting.AccountID, amount, currentTime)
+		if err == ErrAccountNotFound {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("更新账户 %d 余额失败: %v", posting.AccountID, err)
+		}
+		if enforceLimits && !account.AllowNegative && account.Balance.IsNegative() {
+			return nil, ErrInsufficientFunds
+		}
+
+		posting.JournalEntryID = entry.ID
+		posting.BalanceAfter = account.Balance
+		posting.CreatedAt = currentTime
+		if err = ledger.InsertPosting(&posting); err != nil {
+			return nil, fmt.Errorf("插入分录明细失败: %v", err)
+		}
+		entry.Postings = append(entry.Postings, posting)
+	}
+
+	return entry, nil
+}
+
+// Transfer 在事务中从付款账户向收款账户转账，并为涉及的玩家写入交易记录
+func Transfer(ledger LedgerStore, req TransferRequest) (*JournalEntry, error) {
+	return transfer(ledger, req, true)
+}
+
+func transfer(ledger LedgerStore, req TransferRequest, enforceLimits bool) (*JournalEntry, error) {
+	if !req.Amount.IsPositive() {
+		return nil, fmt.Errorf("转账金额必须大于0")
+	}
+	if req.FromAccountID == req.ToAccountID {
+		return nil, fmt.Errorf("付款账户和收款账户不能相同")
+	}
+
+	entry, err := postEntry(ledger, req.Kind, req.Memo.Note, []Posting{
+		{AccountID: req.ToAccountID, Debit: req.Amount},
+		{AccountID: req.FromAccountID, Credit: req.Amount},
+	}, enforceLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	// 为玩家账户写入交易记录
+	for _, posting := range entry.Postings {
+		account, err := ledger.AccountByID(posting.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		if account.UserID == nil {
+			continue
+		}
+		memo := req.Memo
+		if posting.AccountID == req.ToAccountID {
+			memo = memo.Swapped()
+		}
+		err = insertStatementLine(ledger, *account.UserID, entry.ID, posting.Credit, posting.Debit, posting.BalanceAfter, memo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+// AddStatementNote 写入一条不涉及资金变动的交易记录（如制作物品）
+func AddStatementNote(ledger LedgerStore, userID int, memo Memo) error {
+	account, err := GetUserCashAccount(ledger, userID)
+	if err != nil {
+		return err
+	}
+	return insertStatementLine(ledger, userID, 0, money.Zero, money.Zero, account.Balance, memo)
+}
+
+// 写入玩家交易记录
+func insertStatementLine(ledger LedgerStore, userID int, entryID int, expense, income, balanceAfter money.Money, memo Memo) error {
+	// 隐私数据
+	currentTime := timeservice.SyncNow()
+	t := Transaction{
+		UserID:             userID,
+		TransactionTime:    currentTime,
+		OurBankAccountName: memo.OurBankAccountName,
+		CounterpartyAlias:  memo.CounterpartyAlias,
+		OurBankName:        memo.OurBankName,
+		CounterpartyBank:   memo.CounterpartyBank,
+		ExpenseAmount:      expense,
+		IncomeAmount:       income,
+		Balance:            &balanceAfter,
+		Note:               memo.Note,
+		CreatedAt:          currentTime,
+	}
+	if entryID > 0 {
+		t.JournalEntryID = &entryID
+	}
+	if err := ledger.InsertTransaction(&t); err != nil {
+		return fmt.Errorf("添加交易记录失败: %v", err)
+	}
+	return nil
+}
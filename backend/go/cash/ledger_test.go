@@ -0,0 +1,241 @@
+package cash
+
+import (
+	"errors"
+	"testing"
+
+	"own-1Pixel/backend/go/money"
+)
+
+// 创建带两个玩家账户的内存账本
+func newTestLedger(t *testing.T) (*MemoryLedger, map[string]int) {
+	t.Helper()
+	ledger := NewMemoryLedger()
+	accounts := make(map[string]int)
+	for _, userID := range []int{1, 2} {
+		if err := EnsureUserAccount(ledger, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, code := range map[string]string{
+		"user1":    userCashAccountCode(1),
+		"user2":    userCashAccountCode(2),
+		"external": AccountExternal,
+		"market":   AccountMarket,
+	} {
+		id, err := AccountIDByCode(ledger, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts[name] = id
+	}
+	return ledger, accounts
+}
+
+// 所有账户余额之和，复式记账下始终为0
+func ledgerTotal(ledger *MemoryLedger) money.Money {
+	total := money.Zero
+	for _, account := range ledger.accounts {
+		var err error
+		if total, err = total.Add(account.Balance); err != nil {
+			panic(err)
+		}
+	}
+	return total
+}
+
+func TestPostEntry(t *testing.T) {
+	type line struct {
+		account       string
+		debit, credit int64
+	}
+	tests := []struct {
+		name     string
+		lines    []line
+		err      error
+		balances map[string]int64
+	}{
+		{
+			name:     "借贷平衡",
+			lines:    []line{{"user1", 500, 0}, {"external", 0, 500}},
+			balances: map[string]int64{"user1": 500, "external": -500},
+		},
+		{
+			name:     "一借多贷",
+			lines:    []line{{"user1", 300, 0}, {"external", 0, 100}, {"market", 0, 200}},
+			balances: map[string]int64{"user1": 300, "external": -100, "market": -200},
+		},
+		{
+			name:  "借贷不平衡",
+			lines: []line{{"user1", 500, 0}, {"external", 0, 400}},
+			err:   ErrUnbalancedEntry,
+		},
+		{
+			name:  "只有一条明细",
+			lines: []line{{"user1", 0, 0}},
+			err:   ErrUnbalancedEntry,
+		},
+		{
+			name:  "同时填写借方和贷方",
+			lines: []line{{"user1", 100, 100}, {"external", 0, 0}},
+			err:   ErrUnbalancedEntry,
+		},
+		{
+			name:  "负数金额",
+			lines: []line{{"user1", -100, 0}, {"external", -100, 0}},
+			err:   ErrUnbalancedEntry,
+		},
+		{
+			name:  "玩家账户透支",
+			lines: []line{{"external", 100, 0}, {"user1", 0, 100}},
+			err:   ErrInsufficientFunds,
+		},
+		{
+			name:  "账户不存在",
+			lines: []line{{"user1", 100, 0}, {"missing", 0, 100}},
+			err:   ErrAccountNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger, accounts := newTestLedger(t)
+			accounts["missing"] = 999
+			var postings []Posting
+			for _, l := range tt.lines {
+				postings = append(postings, Posting{AccountID: accounts[l.account], Debit: money.New(l.debit), Credit: money.New(l.credit)})
+			}
+
+			entry, err := PostEntry(ledger, EntryKindManual, tt.name, postings)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("错误 = %v，期望 %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(entry.Postings) != len(tt.lines) {
+				t.Errorf("明细数 = %d，期望 %d", len(entry.Postings), len(tt.lines))
+			}
+			for name, want := range tt.balances {
+				account, _ := ledger.AccountByID(accounts[name])
+				if account.Balance.Minor() != want {
+					t.Errorf("%s 余额 = %d，期望 %d", name, account.Balance.Minor(), want)
+				}
+			}
+			if total := ledgerTotal(ledger); !total.IsZero() {
+				t.Errorf("账户余额合计 = %s，期望 0", total)
+			}
+		})
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	storage := NewMemoryStorage()
+	accounts := make(map[string]int)
+	for _, userID := range []int{1, 2} {
+		if err := EnsureUserAccount(storage.ledger, userID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, code := range map[string]string{
+		"user1":    userCashAccountCode(1),
+		"user2":    userCashAccountCode(2),
+		"external": AccountExternal,
+		"market":   AccountMarket,
+	} {
+		accounts[name], _ = AccountIDByCode(storage.ledger, code)
+	}
+
+	// 每一步在独立事务中执行，失败时回滚，和服务层一致
+	steps := []struct {
+		from, to string
+		amount   int64
+		err      bool
+		balance1 int64 // 转账后玩家1余额
+		balance2 int64 // 转账后玩家2余额
+	}{
+		{"external", "user1", 1000, false, 1000, 0},
+		{"user1", "user2", 250, false, 750, 250},
+		{"user2", "market", 250, false, 750, 0},
+		{"user2", "user1", 1, true, 750, 0}, // 余额不足
+		{"user1", "user1", 100, true, 750, 0},
+		{"user1", "user2", 0, true, 750, 0},
+	}
+	for i, step := range steps {
+		tx, _ := storage.Begin()
+		_, err := Transfer(tx.Ledger(), TransferRequest{
+			Kind:          EntryKindManual,
+			FromAccountID: accounts[step.from],
+			ToAccountID:   accounts[step.to],
+			Amount:        money.New(step.amount),
+			Memo:          Memo{OurBankAccountName: step.from, CounterpartyAlias: step.to},
+		})
+		if (err != nil) != step.err {
+			t.Fatalf("第%d步 错误 = %v，期望出错 %v", i+1, err, step.err)
+		}
+		if err != nil {
+			tx.Rollback()
+		} else {
+			tx.Commit()
+		}
+
+		user1, _ := storage.ledger.AccountByID(accounts["user1"])
+		user2, _ := storage.ledger.AccountByID(accounts["user2"])
+		if user1.Balance.Minor() != step.balance1 || user2.Balance.Minor() != step.balance2 {
+			t.Errorf("第%d步 余额 = %d/%d，期望 %d/%d", i+1, user1.Balance.Minor(), user2.Balance.Minor(), step.balance1, step.balance2)
+		}
+		if total := ledgerTotal(storage.ledger); !total.IsZero() {
+			t.Errorf("第%d步 账户余额合计 = %s，期望 0", i+1, total)
+		}
+	}
+
+	// 玩家之间的转账为双方各写一条交易记录，收款方使用对手方视角的附言
+	lines, err := storage.ledger.ListTransactions(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("玩家2交易记录数 = %d，期望 2", len(lines))
+	}
+	for _, line := range lines {
+		if line.IncomeAmount.Minor() == 250 && (line.OurBankAccountName != "user2" || line.CounterpartyAlias != "user1") {
+			t.Errorf("收款记录附言 = %s/%s，期望 user2/user1", line.OurBankAccountName, line.CounterpartyAlias)
+		}
+	}
+}
+
+func TestPostManualTransaction(t *testing.T) {
+	tests := []struct {
+		name            string
+		income, expense int64
+		entries         int
+		balance         int64
+		err             error
+	}{
+		{"收入", 1000, 0, 1, 1000, nil},
+		{"收入和支出", 1000, 300, 2, 700, nil},
+		{"只记附言", 0, 0, 0, 0, nil},
+		{"支出超过余额", 0, 1, 0, 0, ErrInsufficientFunds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger, accounts := newTestLedger(t)
+			entries, err := postManualTransaction(ledger, 1, money.New(tt.income), money.New(tt.expense), Memo{Note: tt.name})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("错误 = %v，期望 %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(entries) != tt.entries {
+				t.Errorf("分录数 = %d，期望 %d", len(entries), tt.entries)
+			}
+			account, _ := ledger.AccountByID(accounts["user1"])
+			if account.Balance.Minor() != tt.balance {
+				t.Errorf("余额 = %d，期望 %d", account.Balance.Minor(), tt.balance)
+			}
+			if total := ledgerTotal(ledger); !total.IsZero() {
+				t.Errorf("账户余额合计 = %s，期望 0", total)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package cash
+
+import (
+	"database/sql"
+	"fmt"
+
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/migrate"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+	"own-1Pixel/backend/go/user"
+)
+
+// Migrations 现金模块的数据库迁移
+func Migrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 3, Package: "cash", Name: "创建交易记录表", Up: createTransactionsTable},
+		{Version: 4, Package: "cash", Name: "创建复式记账账本", Up: createLedgerTables},
+		{Version: 7, Package: "cash", Name: "为已有玩家开立现金账户并导入历史交易记录", Up: importLegacyData},
+		{Version: 11, Package: "cash", Name: "开立拍卖保证金账户", Up: createEscrowAccount},
+		{Version: 19, Package: "cash", Name: "开立园区工坊账户", Up: createWorkshopAccount},
+		{Version: 21, Package: "cash", Name: "开立挂单冻结资金账户", Up: createOrderEscrowAccount},
+	}
+}
+
+// 创建交易记录表，旧版表缺少的列逐一补充，不再删除重建数据库
+func createTransactionsTable(tx *sql.Tx) error {
+	err := migrate.Exec(tx, `
+		CREATE TABLE IF NOT EXISTS transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			journal_entry_id INTEGER,
+			transaction_time DATETIME NOT NULL,
+			our_bank_account_name TEXT,
+			counterparty_alias TEXT,
+			our_bank_name TEXT,
+			counterparty_bank TEXT,
+			expense_amount INTEGER DEFAULT 0,
+			income_amount INTEGER DEFAULT 0,
+			balance INTEGER,
+			note TEXT,
+			created_at DATETIME
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 已有数据归属默认玩家
+	for _, column := range []struct{ name, definition string }{
+		{"user_id", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", user.DefaultUserID)},
+		{"journal_entry_id", "INTEGER"},
+		{"our_bank_account_name", "TEXT"},
+		{"counterparty_alias", "TEXT"},
+		{"our_bank_name", "TEXT"},
+		{"counterparty_bank", "TEXT"},
+		{"expense_amount", "INTEGER DEFAULT 0"},
+		{"income_amount", "INTEGER DEFAULT 0"},
+		{"balance", "INTEGER"},
+		{"note", "TEXT"},
+		{"created_at", "DATETIME"},
+	} {
+		if err = migrate.AddColumn(tx, "transactions", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	if err = migrate.ConvertMoneyColumns(tx, "transactions", "expense_amount", "income_amount", "balance"); err != nil {
+		return err
+	}
+
+	// 旧版余额表只保留用于导入账本
+	hasLegacyBalance, err := migrate.TableExists(tx, "balance")
+	if err != nil {
+		return err
+	}
+	if hasLegacyBalance {
+		err = migrate.AddColumn(tx, "balance", "user_id", fmt.Sprintf("INTEGER NOT NULL DEFAULT %d", user.DefaultUserID))
+		if err != nil {
+			return err
+		}
+		if err = migrate.ConvertMoneyColumns(tx, "balance", "amount"); err != nil {
+			return err
+		}
+	}
+
+	return migrate.Exec(tx, "CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id)")
+}
+
+// 创建账户、会计分录、分录明细表和系统账户
+func createLedgerTables(tx *sql.Tx) error {
+	err := migrate.Exec(tx, `
+		CREATE TABLE IF NOT EXISTS ledger_accounts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			user_id INTEGER,
+			allow_negative INTEGER NOT NULL DEFAULT 0,
+			balance INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME,
+			updated_at DATETIME
+		)
+	`, `
+		CREATE TABLE IF NOT EXISTS journal_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entry_time DATETIME NOT NULL,
+			kind TEXT NOT NULL,
+			note TEXT,
+			created_at DATETIME
+		)
+	`, `
+		CREATE TABLE IF NOT EXISTS postings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			journal_entry_id INTEGER NOT NULL,
+			account_id INTEGER NOT NULL,
+			debit INTEGER NOT NULL DEFAULT 0,
+			credit INTEGER NOT NULL DEFAULT 0,
+			balance_after INTEGER NOT NULL,
+			created_at DATETIME,
+			FOREIGN KEY (journal_entry_id) REFERENCES journal_entries(id),
+			FOREIGN KEY (account_id) REFERENCES ledger_accounts(id)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	if err = migrate.ConvertMoneyColumns(tx, "ledger_accounts", "balance"); err != nil {
+		return err
+	}
+	if err = migrate.ConvertMoneyColumns(tx, "postings", "debit", "credit", "balance_after"); err != nil {
+		return err
+	}
+
+	err = migrate.Exec(tx,
+		"CREATE INDEX IF NOT EXISTS idx_ledger_accounts_user_id ON ledger_accounts(user_id)",
+		"CREATE INDEX IF NOT EXISTS idx_postings_journal_entry_id ON postings(journal_entry_id)",
+		"CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings(account_id)",
+	)
+	if err != nil {
+		return err
+	}
+
+	// 只写入此版本已有的系统账户，之后新增的系统账户由各自的迁移开立
+	if err = insertSystemAccount(tx, "system:external", "外部资金"); err != nil {
+		return err
+	}
+	return insertSystemAccount(tx, "system:market", "萌铺子市场")
+}
+
+// 开立允许负余额的系统账户，编码已存在时跳过。迁移写入固定的字面值，不依赖当前的账户定义；
+// turso 不支持 INSERT OR IGNORE 和 NOT EXISTS，先查询再写入
+func insertSystemAccount(tx *sql.Tx, code, name string) error {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM ledger_accounts WHERE code = ?", code).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	currentTime := timeservice.SyncNow()
+	_, err := tx.Exec("INSERT INTO ledger_accounts (code, name, type, allow_negative, balance, created_at, updated_at) VALUES (?, ?, 'system', 1, 0, ?, ?)",
+		code, name, currentTime, currentTime)
+	return err
+}
+
+// 为已有玩家开立现金账户，并把旧版交易记录和余额导入账本（新玩家由 InitUserAccount 开户）
+func importLegacyData(tx *sql.Tx) error {
+	userIDs, err := user.GetUserIDs(tx)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err = InitUserAccount(tx, userID); err != nil {
+			return err
+		}
+		if err = importLegacyTransactions(tx, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 将旧版交易记录和余额导入账本（仅对尚无分录的玩家账户执行）
+func importLegacyTransactions(tx *sql.Tx, userID int) error {
+	ledger := NewSQLLedgerStore(tx)
+	accountID, err := UserCashAccountID(ledger, userID)
+	if err != nil {
+		return err
+	}
+	postingCount, err := ledger.CountPostings(accountID)
+	if err != nil {
+		return err
+	}
+	if postingCount > 0 {
+		return nil
+	}
+	externalID, err := AccountIDByCode(ledger, AccountExternal)
+	if err != nil {
+		return err
+	}
+
+	// 按时间顺序重放旧交易记录
+	rows, err := tx.Query("SELECT id, expense_amount, income_amount, note FROM transactions WHERE user_id = ? AND journal_entry_id IS NULL AND balance IS NULL ORDER BY transaction_time ASC, id ASC", userID)
+	if err != nil {
+		return err
+	}
+	type legacyRow struct {
+		id              int
+		expense, income money.Money
+		note            sql.NullString
+	}
+	var legacyRows []legacyRow
+	for rows.Next() {
+		var row legacyRow
+		if err := rows.Scan(&row.id, &row.expense, &row.income, &row.note); err != nil {
+			rows.Close()
+			return err
+		}
+		legacyRows = append(legacyRows, row)
+	}
+	rows.Close()
+
+	runningBalance := money.Zero
+	for _, row := range legacyRows {
+		net, err := row.income.Sub(row.expense)
+		if err != nil {
+			return err
+		}
+		var entryID interface{}
+		if !net.IsZero() {
+			postings := []Posting{{AccountID: accountID, Debit: net}, {AccountID: externalID, Credit: net}}
+			if net.IsNegative() {
+				postings = []Posting{{AccountID: externalID, Debit: net.Neg()}, {AccountID: accountID, Credit: net.Neg()}}
+			}
+			entry, err := postEntry(ledger, EntryKindLegacy, row.note.String, postings, false)
+			if err != nil {
+				return err
+			}
+			entryID = entry.ID
+		}
+		if runningBalance, err = runningBalance.Add(net); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE transactions SET journal_entry_id = ?, balance = ? WHERE id = ?", entryID, runningBalance, row.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 与旧余额表核对，不一致时登记校准分录
+	legacyBalance := money.Zero
+	hasLegacyBalance, err := migrate.TableExists(tx, "balance")
+	if err != nil {
+		return err
+	}
+	if hasLegacyBalance {
+		err = tx.QueryRow("SELECT amount FROM balance WHERE user_id = ?", userID).Scan(&legacyBalance)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		diff, err := legacyBalance.Sub(runningBalance)
+		if err != nil {
+			return err
+		}
+		if !diff.IsZero() {
+			postings := []Posting{{AccountID: accountID, Debit: diff}, {AccountID: externalID, Credit: diff}}
+			if diff.IsNegative() {
+				postings = []Posting{{AccountID: externalID, Debit: diff.Neg()}, {AccountID: accountID, Credit: diff.Neg()}}
+			}
+			if _, err = postEntry(ledger, EntryKindLegacyAdjustment, "历史余额校准", postings, false); err != nil {
+				return err
+			}
+			logger.Info("cash", fmt.Sprintf("玩家 %d 历史余额校准: 交易记录合计 %s，余额表 %s\n", userID, runningBalance, legacyBalance))
+		}
+	}
+
+	if len(legacyRows) > 0 {
+		logger.Info("cash", fmt.Sprintf("玩家 %d 已导入 %d 条历史交易记录\n", userID, len(legacyRows)))
+	}
+	return nil
+}
+
+// 开立拍卖保证金系统账户，已有的系统账户跳过
+func createEscrowAccount(tx *sql.Tx) error {
+	return insertSystemAccount(tx, "system:escrow", "拍卖保证金")
+}
+
+// 开立园区工坊系统账户，收取制作物品的费用，已有的系统账户跳过
+func createWorkshopAccount(tx *sql.Tx) error {
+	return insertSystemAccount(tx, "system:workshop", "园区工坊")
+}
+
+// 开立挂单冻结资金系统账户，冻结订单簿买单的资金，已有的系统账户跳过
+func createOrderEscrowAccount(tx *sql.Tx) error {
+	return insertSystemAccount(tx, "system:order_escrow", "挂单冻结资金")
+}
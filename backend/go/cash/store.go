@@ -0,0 +1,60 @@
+package cash
+
+import (
+	"errors"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+)
+
+// 交易记录不存在
+var ErrTransactionNotFound = errors.New("交易记录不存在")
+
+// LedgerStore 账本存储：账户、会计分录、分录明细和玩家交易记录
+type LedgerStore interface {
+	// EnsureAccount 创建账户，编码已存在则跳过
+	EnsureAccount(account *Account) error
+	// AccountByCode 按编码获取账户，不存在时返回 ErrAccountNotFound
+	AccountByCode(code string) (*Account, error)
+	// AccountByID 按ID获取账户，不存在时返回 ErrAccountNotFound
+	AccountByID(accountID int) (*Account, error)
+	// AddToBalance 将金额（借方为正，贷方为负）计入账户余额，返回记账后的账户
+	AddToBalance(accountID int, amount money.Money, updatedAt time.Time) (*Account, error)
+	// InsertJournalEntry 写入会计分录（不含明细），回填ID
+	InsertJournalEntry(entry *JournalEntry) error
+	// InsertPosting 写入分录明细，回填ID
+	InsertPosting(posting *Posting) error
+	// CountPostings 统计账户的分录明细数量
+	CountPostings(accountID int) (int, error)
+	// JournalEntries 按分录类型和摘要获取会计分录（含明细），按ID升序
+	JournalEntries(kind string, note string) ([]JournalEntry, error)
+
+	// InsertTransaction 写入玩家交易记录，回填ID
+	InsertTransaction(t *Transaction) error
+	// ListTransactions 获取玩家的交易记录，最新的在前
+	ListTransactions(userID int) ([]Transaction, error)
+	// LatestTransaction 获取玩家最后写入的交易记录，没有时返回 ErrTransactionNotFound
+	LatestTransaction(userID int) (*Transaction, error)
+}
+
+// Tx 账本事务，提交前的写入对其他事务不可见
+type Tx interface {
+	Ledger() LedgerStore
+	Commit() error
+	Rollback() error
+}
+
+// Storage 账本存储后端，所有读写都在事务中进行
+type Storage interface {
+	Begin() (Tx, error)
+}
+
+// 在只读事务中执行查询
+func view(storage Storage, fn func(ledger LedgerStore) error) error {
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx.Ledger())
+}
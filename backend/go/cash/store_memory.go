@@ -0,0 +1,219 @@
+package cash
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// MemoryLedger 内存账本，实现 LedgerStore。自身不加锁，由所属存储后端的事务保证互斥
+type MemoryLedger struct {
+	accounts     map[int]*Account
+	accountCodes map[string]int // 编码 -> 账户ID
+	entries      []JournalEntry
+	postings     []Posting
+	transactions []Transaction
+}
+
+// NewMemoryLedger 创建内存账本，并开立系统账户
+func NewMemoryLedger() *MemoryLedger {
+	ledger := &MemoryLedger{
+		accounts:     make(map[int]*Account),
+		accountCodes: make(map[string]int),
+	}
+	// 内存账本不会出错
+	EnsureSystemAccounts(ledger)
+	return ledger
+}
+
+// Clone 深拷贝账本，用于事务隔离
+func (l *MemoryLedger) Clone() *MemoryLedger {
+	clone := &MemoryLedger{
+		accounts:     make(map[int]*Account, len(l.accounts)),
+		accountCodes: make(map[string]int, len(l.accountCodes)),
+		entries:      append([]JournalEntry(nil), l.entries...),
+		postings:     append([]Posting(nil), l.postings...),
+		transactions: append([]Transaction(nil), l.transactions...),
+	}
+	for id, account := range l.accounts {
+		copied := *account
+		clone.accounts[id] = &copied
+	}
+	for code, id := range l.accountCodes {
+		clone.accountCodes[code] = id
+	}
+	return clone
+}
+
+func (l *MemoryLedger) EnsureAccount(account *Account) error {
+	if _, exists := l.accountCodes[account.Code]; exists {
+		return nil
+	}
+	currentTime := timeservice.SyncNow()
+	created := *account
+	created.ID = len(l.accounts) + 1
+	created.Balance = money.Zero
+	created.CreatedAt = currentTime
+	created.UpdatedAt = currentTime
+	if account.UserID != nil {
+		userID := *account.UserID
+		created.UserID = &userID
+	}
+	l.accounts[created.ID] = &created
+	l.accountCodes[created.Code] = created.ID
+	return nil
+}
+
+func (l *MemoryLedger) AccountByCode(code string) (*Account, error) {
+	accountID, exists := l.accountCodes[code]
+	if !exists {
+		return nil, ErrAccountNotFound
+	}
+	return l.AccountByID(accountID)
+}
+
+func (l *MemoryLedger) AccountByID(accountID int) (*Account, error) {
+	account, exists := l.accounts[accountID]
+	if !exists {
+		return nil, ErrAccountNotFound
+	}
+	copied := *account
+	return &copied, nil
+}
+
+func (l *MemoryLedger) AddToBalance(accountID int, amount money.Money, updatedAt time.Time) (*Account, error) {
+	account, exists := l.accounts[accountID]
+	if !exists {
+		return nil, ErrAccountNotFound
+	}
+	balance, err := account.Balance.Add(amount)
+	if err != nil {
+		return nil, err
+	}
+	account.Balance = balance
+	account.UpdatedAt = updatedAt
+	copied := *account
+	return &copied, nil
+}
+
+func (l *MemoryLedger) InsertJournalEntry(entry *JournalEntry) error {
+	entry.ID = len(l.entries) + 1
+	stored := *entry
+	stored.Postings = nil
+	l.entries = append(l.entries, stored)
+	return nil
+}
+
+func (l *MemoryLedger) InsertPosting(posting *Posting) error {
+	posting.ID = len(l.postings) + 1
+	l.postings = append(l.postings, *posting)
+	return nil
+}
+
+func (l *MemoryLedger) CountPostings(accountID int) (int, error) {
+	count := 0
+	for _, posting := range l.postings {
+		if posting.AccountID == accountID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (l *MemoryLedger) JournalEntries(kind string, note string) ([]JournalEntry, error) {
+	entries := make([]JournalEntry, 0)
+	for _, entry := range l.entries {
+		if entry.Kind != kind || entry.Note != note {
+			continue
+		}
+		for _, posting := range l.postings {
+			if posting.JournalEntryID == entry.ID {
+				entry.Postings = append(entry.Postings, posting)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (l *MemoryLedger) InsertTransaction(t *Transaction) error {
+	t.ID = len(l.transactions) + 1
+	l.transactions = append(l.transactions, *t)
+	return nil
+}
+
+func (l *MemoryLedger) ListTransactions(userID int) ([]Transaction, error) {
+	transactions := make([]Transaction, 0)
+	for _, t := range l.transactions {
+		if t.UserID == userID {
+			transactions = append(transactions, t)
+		}
+	}
+	// 与数据库实现一致：按交易时间倒序，时间相同时按ID倒序
+	sort.SliceStable(transactions, func(i, j int) bool {
+		if !transactions[i].TransactionTime.Equal(transactions[j].TransactionTime) {
+			return transactions[i].TransactionTime.After(transactions[j].TransactionTime)
+		}
+		return transactions[i].ID > transactions[j].ID
+	})
+	return transactions, nil
+}
+
+func (l *MemoryLedger) LatestTransaction(userID int) (*Transaction, error) {
+	for i := len(l.transactions) - 1; i >= 0; i-- {
+		if l.transactions[i].UserID == userID {
+			t := l.transactions[i]
+			return &t, nil
+		}
+	}
+	return nil, ErrTransactionNotFound
+}
+
+// MemoryStorage 内存账本存储后端，不需要数据库文件。
+// 事务开始时复制整个账本，提交时替换；同一时间只有一个事务，其余事务在 Begin 处等待
+type MemoryStorage struct {
+	mutex  sync.Mutex
+	ledger *MemoryLedger
+}
+
+// NewMemoryStorage 创建内存账本存储后端
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{ledger: NewMemoryLedger()}
+}
+
+func (s *MemoryStorage) Begin() (Tx, error) {
+	s.mutex.Lock()
+	return &memoryTx{storage: s, ledger: s.ledger.Clone()}, nil
+}
+
+// 内存事务
+type memoryTx struct {
+	storage *MemoryStorage
+	ledger  *MemoryLedger
+	done    bool
+}
+
+func (t *memoryTx) Ledger() LedgerStore { return t.ledger }
+
+func (t *memoryTx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.storage.ledger = t.ledger
+	t.storage.mutex.Unlock()
+	return nil
+}
+
+func (t *memoryTx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.storage.mutex.Unlock()
+	return nil
+}
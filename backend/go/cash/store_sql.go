@@ -0,0 +1,266 @@
+package cash
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// Querier 数据库执行接口，*sql.DB 和 *sql.Tx 均实现
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// 基于 turso/sqlite 的账本存储
+type sqlLedgerStore struct {
+	q Querier
+}
+
+// NewSQLLedgerStore 在数据库连接或事务上创建账本存储
+func NewSQLLedgerStore(q Querier) LedgerStore {
+	return &sqlLedgerStore{q: q}
+}
+
+// 账户查询列
+const accountColumns = "id, code, name, type, user_id, allow_negative, balance, created_at, updated_at"
+
+// 扫描账户
+func scanAccount(scanner interface{ Scan(...interface{}) error }) (*Account, error) {
+	var account Account
+	var userID sql.NullInt64
+	var allowNegative int
+	err := scanner.Scan(&account.ID, &account.Code, &account.Name, &account.Type, &userID,
+		&allowNegative, &account.Balance, &account.CreatedAt, &account.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		account.UserID = &id
+	}
+	account.AllowNegative = allowNegative == 1
+	return &account, nil
+}
+
+func (s *sqlLedgerStore) EnsureAccount(account *Account) error {
+	var count int
+	err := s.q.QueryRow("SELECT COUNT(*) FROM ledger_accounts WHERE code = ?", account.Code).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	allowNegative := 0
+	if account.AllowNegative {
+		allowNegative = 1
+	}
+	currentTime := timeservice.SyncNow()
+	_, err = s.q.Exec("INSERT INTO ledger_accounts (code, name, type, user_id, allow_negative, balance, created_at, updated_at) VALUES (?, ?, ?, ?, ?, 0, ?, ?)",
+		account.Code, account.Name, account.Type, account.UserID, allowNegative, currentTime, currentTime)
+	return err
+}
+
+func (s *sqlLedgerStore) AccountByCode(code string) (*Account, error) {
+	return scanAccount(s.q.QueryRow("SELECT "+accountColumns+" FROM ledger_accounts WHERE code = ?", code))
+}
+
+func (s *sqlLedgerStore) AccountByID(accountID int) (*Account, error) {
+	return scanAccount(s.q.QueryRow("SELECT "+accountColumns+" FROM ledger_accounts WHERE id = ?", accountID))
+}
+
+func (s *sqlLedgerStore) AddToBalance(accountID int, amount money.Money, updatedAt time.Time) (*Account, error) {
+	// 账户余额按默认货币的最小货币单位保存
+	if amount.Currency() != money.DefaultCurrency {
+		return nil, fmt.Errorf("%w: 账户余额不接受 %s", money.ErrCurrency, amount.Currency())
+	}
+	// 余额在同一语句中累加，避免读写之间被其他连接修改
+	return scanAccount(s.q.QueryRow("UPDATE ledger_accounts SET balance = balance + ?, updated_at = ? WHERE id = ? RETURNING "+accountColumns,
+		amount, updatedAt, accountID))
+}
+
+func (s *sqlLedgerStore) InsertJournalEntry(entry *JournalEntry) error {
+	result, err := s.q.Exec("INSERT INTO journal_entries (entry_time, kind, note, created_at) VALUES (?, ?, ?, ?)",
+		entry.EntryTime, entry.Kind, entry.Note, entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	entryID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(entryID)
+	return nil
+}
+
+func (s *sqlLedgerStore) InsertPosting(posting *Posting) error {
+	result, err := s.q.Exec("INSERT INTO postings (journal_entry_id, account_id, debit, credit, balance_after, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		posting.JournalEntryID, posting.AccountID, posting.Debit, posting.Credit, posting.BalanceAfter, posting.CreatedAt)
+	if err != nil {
+		return err
+	}
+	postingID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	posting.ID = int(postingID)
+	return nil
+}
+
+func (s *sqlLedgerStore) CountPostings(accountID int) (int, error) {
+	var count int
+	err := s.q.QueryRow("SELECT COUNT(*) FROM postings WHERE account_id = ?", accountID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlLedgerStore) JournalEntries(kind string, note string) ([]JournalEntry, error) {
+	rows, err := s.q.Query(`
+		SELECT e.id, e.entry_time, e.kind, e.note, e.created_at,
+			p.id, p.account_id, p.debit, p.credit, p.balance_after, p.created_at
+		FROM journal_entries e JOIN postings p ON p.journal_entry_id = e.id
+		WHERE e.kind = ? AND e.note = ?
+		ORDER BY e.id, p.id`, kind, note)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]JournalEntry, 0)
+	for rows.Next() {
+		var entry JournalEntry
+		var posting Posting
+		var entryNote sql.NullString
+		var entryCreatedAt, postingCreatedAt sql.NullTime
+		err = rows.Scan(&entry.ID, &entry.EntryTime, &entry.Kind, &entryNote, &entryCreatedAt,
+			&posting.ID, &posting.AccountID, &posting.Debit, &posting.Credit, &posting.BalanceAfter, &postingCreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		posting.JournalEntryID = entry.ID
+		posting.CreatedAt = postingCreatedAt.Time
+		if n := len(entries); n > 0 && entries[n-1].ID == entry.ID {
+			entries[n-1].Postings = append(entries[n-1].Postings, posting)
+			continue
+		}
+		entry.Note = entryNote.String
+		entry.CreatedAt = entryCreatedAt.Time
+		entry.Postings = []Posting{posting}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlLedgerStore) InsertTransaction(t *Transaction) error {
+	var journalEntryID, balance interface{}
+	if t.JournalEntryID != nil {
+		journalEntryID = *t.JournalEntryID
+	}
+	if t.Balance != nil {
+		balance = *t.Balance
+	}
+	result, err := s.q.Exec(
+		"INSERT INTO transactions (user_id, journal_entry_id, transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, balance, note, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		t.UserID, journalEntryID, t.TransactionTime, t.OurBankAccountName, t.CounterpartyAlias, t.OurBankName, t.CounterpartyBank,
+		t.ExpenseAmount, t.IncomeAmount, balance, t.Note, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+	transactionID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = int(transactionID)
+	return nil
+}
+
+func (s *sqlLedgerStore) ListTransactions(userID int) ([]Transaction, error) {
+	rows, err := s.q.Query("SELECT "+transactionColumns+" FROM transactions WHERE user_id = ? ORDER BY transaction_time DESC, id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := make([]Transaction, 0)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+func (s *sqlLedgerStore) LatestTransaction(userID int) (*Transaction, error) {
+	t, err := scanTransaction(s.q.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE user_id = ? ORDER BY id DESC LIMIT 1", userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// 扫描交易记录
+func scanTransaction(scanner interface{ Scan(...interface{}) error }) (Transaction, error) {
+	var t Transaction
+	var journalEntryID sql.NullInt64
+	var balance money.NullMoney
+	var ourBankAccountName, counterpartyAlias, ourBankName, counterpartyBank, note sql.NullString
+	err := scanner.Scan(&t.ID, &t.UserID, &journalEntryID, &t.TransactionTime, &ourBankAccountName, &counterpartyAlias,
+		&ourBankName, &counterpartyBank, &t.ExpenseAmount, &t.IncomeAmount, &balance, &note, &t.CreatedAt)
+	if err != nil {
+		return t, err
+	}
+	if journalEntryID.Valid {
+		id := int(journalEntryID.Int64)
+		t.JournalEntryID = &id
+	}
+	if balance.Valid {
+		t.Balance = &balance.Money
+	}
+	t.OurBankAccountName = ourBankAccountName.String
+	t.CounterpartyAlias = counterpartyAlias.String
+	t.OurBankName = ourBankName.String
+	t.CounterpartyBank = counterpartyBank.String
+	t.Note = note.String
+	return t, nil
+}
+
+// 交易记录查询列
+const transactionColumns = "id, user_id, journal_entry_id, transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, balance, note, created_at"
+
+// 基于 turso/sqlite 的账本存储后端
+type sqlStorage struct {
+	db *sql.DB
+}
+
+// NewSQLStorage 创建基于数据库连接的账本存储后端
+func NewSQLStorage(db *sql.DB) Storage {
+	return &sqlStorage{db: db}
+}
+
+func (s *sqlStorage) Begin() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx, ledger: NewSQLLedgerStore(tx)}, nil
+}
+
+// 数据库事务
+type sqlTx struct {
+	tx     *sql.Tx
+	ledger LedgerStore
+}
+
+func (t *sqlTx) Ledger() LedgerStore { return t.ledger }
+func (t *sqlTx) Commit() error       { return t.tx.Commit() }
+func (t *sqlTx) Rollback() error     { return t.tx.Rollback() }
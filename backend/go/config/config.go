@@ -13,6 +13,7 @@ type Config struct {
 	Main             MainConfig             `json:"main"`             // 服务配置
 	ConfigPath       string                 `json:"configPath"`       // 配置文件路径
 	Logger           LoggerConfig           `json:"logger"`           // 日志系统配置
+	Auth             AuthConfig             `json:"auth"`             // 登录认证配置
 	Cash             CashConfig             `json:"cash"`             // 现金系统配置
 	Market           MarketConfig           `json:"market"`           // 市场系统配置
 	AuctionWebSocket AuctionWebSocketConfig `json:"auctionWebSocket"` // 拍卖系统WebSocket配置
@@ -30,6 +31,14 @@ type LoggerConfig struct {
 	Path string `json:"path"` // 日志文件路径
 }
 
+// AuthConfig 登录认证配置
+type AuthConfig struct {
+	SessionSecret       string        `json:"sessionSecret"`       // 会话Cookie签名密钥，为空时每次启动随机生成
+	SessionTTL          time.Duration `json:"sessionTTL"`          // 会话有效期
+	PasswordIterations  int           `json:"passwordIterations"`  // 密码哈希迭代次数
+	InitialPasswordPath string        `json:"initialPasswordPath"` // 生成的初始密码写入的文件，仅所有者可读
+}
+
 // CashConfig 现金系统配置
 type CashConfig struct {
 	DbPath string `json:"dbPath"` // 数据库路径
@@ -37,11 +46,16 @@ type CashConfig struct {
 
 // MarketConfig 市场系统配置
 type MarketConfig struct {
-	InitialApplePrice  float64 `json:"initialApplePrice"`  // 苹果初始价格
-	InitialWoodPrice   float64 `json:"initialWoodPrice"`   // 木材初始价格
-	DefaultBalance     float64 `json:"defaultBalance"`     // 默认平衡系数
-	DefaultFluctuation float64 `json:"defaultFluctuation"` // 默认波动系数
-	DefaultMaxChange   float64 `json:"defaultMaxChange"`   // 默认最大变动系数
+	InitialApplePrice    float64 `json:"initialApplePrice"`    // 苹果初始价格
+	InitialWoodPrice     float64 `json:"initialWoodPrice"`     // 木材初始价格
+	DefaultBalance       float64 `json:"defaultBalance"`       // 默认平衡系数
+	DefaultFluctuation   float64 `json:"defaultFluctuation"`   // 默认波动系数
+	DefaultMaxChange     float64 `json:"defaultMaxChange"`     // 默认最大变动系数
+	DefaultPriceModel    string  `json:"defaultPriceModel"`    // 默认定价模型
+	DefaultLiquidity     float64 `json:"defaultLiquidity"`     // 默认流动性参数
+	DefaultSmoothing     float64 `json:"defaultSmoothing"`     // 默认平滑系数
+	DefaultMinPriceRatio float64 `json:"defaultMinPriceRatio"` // 默认价格下限比例
+	DefaultMaxPriceRatio float64 `json:"defaultMaxPriceRatio"` // 默认价格上限比例
 }
 
 // AuctionWebSocketConfig 拍卖系统WebSocket配置
@@ -82,15 +96,26 @@ var config = Config{
 	Logger: LoggerConfig{
 		Path: "./backend/logs/app.log", // 日志文件路径
 	},
+	Auth: AuthConfig{
+		SessionSecret:       "",                                     // 会话Cookie签名密钥
+		SessionTTL:          24 * time.Hour,                         // 会话有效期
+		PasswordIterations:  100000,                                 // 密码哈希迭代次数
+		InitialPasswordPath: "./backend/data/initial_passwords.txt", // 初始密码文件
+	},
 	Cash: CashConfig{
 		DbPath: "./backend/data/cash.db", // 数据库路径
 	},
 	Market: MarketConfig{
-		InitialApplePrice:  1.0, // 苹果初始价格
-		InitialWoodPrice:   5.0, // 木材初始价格
-		DefaultBalance:     1.0, // 默认平衡系数
-		DefaultFluctuation: 1.0, // 默认波动系数
-		DefaultMaxChange:   1.0, // 默认最大变动系数
+		InitialApplePrice:    1.0,      // 苹果初始价格
+		InitialWoodPrice:     5.0,      // 木材初始价格
+		DefaultBalance:       1.0,      // 默认平衡系数
+		DefaultFluctuation:   1.0,      // 默认波动系数
+		DefaultMaxChange:     1.0,      // 默认最大变动系数
+		DefaultPriceModel:    "linear", // 默认定价模型
+		DefaultLiquidity:     10.0,     // 默认流动性参数
+		DefaultSmoothing:     0.3,      // 默认平滑系数
+		DefaultMinPriceRatio: 0.5,      // 默认价格下限比例
+		DefaultMaxPriceRatio: 2.0,      // 默认价格上限比例
 	},
 	AuctionWebSocket: AuctionWebSocketConfig{
 		ReadLimit:         512,              // 读取消息大小限制
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"own-1Pixel/backend/go/logger"
+)
+
+// Event 领域事件，由业务代码在事务提交后发布
+type Event interface {
+	// EventName 事件名称，如 auction.started
+	EventName() string
+}
+
+// Bus 进程内发布/订阅总线。订阅者按订阅顺序同步执行，
+// 单个订阅者出错（panic）只记录日志，不影响其他订阅者和发布者
+type Bus struct {
+	mutex    sync.RWMutex
+	handlers map[reflect.Type][]func(Event)
+	all      []func(Event)
+}
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[reflect.Type][]func(Event))}
+}
+
+// Default 全局事件总线
+var Default = NewBus()
+
+// On 在总线上订阅某一类事件
+func On[T Event](bus *Bus, handler func(T)) {
+	eventType := reflect.TypeFor[T]()
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.handlers[eventType] = append(bus.handlers[eventType], func(event Event) {
+		handler(event.(T))
+	})
+}
+
+// OnAll 订阅总线上的所有事件
+func (bus *Bus) OnAll(handler func(Event)) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.all = append(bus.all, handler)
+}
+
+// Publish 依次发布事件
+func (bus *Bus) Publish(events ...Event) {
+	for _, event := range events {
+		bus.mutex.RLock()
+		handlers := append([]func(Event){}, bus.handlers[reflect.TypeOf(event)]...)
+		handlers = append(handlers, bus.all...)
+		bus.mutex.RUnlock()
+
+		for _, handler := range handlers {
+			dispatch(handler, event)
+		}
+	}
+}
+
+// 调用单个订阅者，捕获其 panic
+func dispatch(handler func(Event), event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Info("events", fmt.Sprintf("处理事件 %s 失败: %v\n", event.EventName(), r))
+		}
+	}()
+	handler(event)
+}
+
+// Subscribe 在全局总线上订阅某一类事件
+func Subscribe[T Event](handler func(T)) {
+	On(Default, handler)
+}
+
+// SubscribeAll 在全局总线上订阅所有事件
+func SubscribeAll(handler func(Event)) {
+	Default.OnAll(handler)
+}
+
+// Publish 在全局总线上发布事件
+func Publish(events ...Event) {
+	Default.Publish(events...)
+}
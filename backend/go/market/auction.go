@@ -1,57 +1,97 @@
 package market
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
-	"sync"
 	"time"
 
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
 	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
 	"own-1Pixel/backend/go/timeservice"
-	"own-1Pixel/backend/go/timeservice/clock"
 )
 
-// 全局变量，用于存储每个拍卖的定时器
-var auctionTimers = make(map[int]*AuctionTimerItem) // key: auctionID
-var timersMutex sync.Mutex
-
-// 全局WebSocket管理器引用
-var GlobalAuctionWSManager *AuctionWSManager
-
-// SetGlobalAuctionWSManager 设置全局WebSocket管理器
-func SetGlobalAuctionWSManager(wsManager *AuctionWSManager) {
-	GlobalAuctionWSManager = wsManager
-}
+// 拍卖类型
+const (
+	AuctionTypeDutch            = "dutch"        // 荷兰钟拍卖：价格从初始价格按间隔递减，先到先得
+	AuctionTypeEnglish          = "english"      // 英式拍卖：价格由出价逐次抬高，结束时最高出价者整批买下
+	AuctionTypeSealedFirstPrice = "sealed_first" // 密封一价拍卖：出价不公开，开标后最高出价者按自己的出价买下
+	AuctionTypeVickrey          = "vickrey"      // 维克里拍卖（密封二价）：出价不公开，开标后最高出价者按第二高出价买下
+)
 
-// 拍卖定时器项
-type AuctionTimerItem struct {
-	Timer     *time.Timer
-	AuctionID int
-	Interval  int // 递减间隔(秒)
-}
+// 竞价记录状态
+const (
+	BidStatusAccepted = "accepted" // 已成交
+	BidStatusLeading  = "leading"  // 英式拍卖当前最高出价，资金已冻结
+	BidStatusOutbid   = "outbid"   // 出价已被超越（英式拍卖）或开标落选（密封拍卖），资金已退还
+	BidStatusRejected = "rejected" // 拍卖取消或未达到保留价，资金已退还；荷兰钟竞价未成交（原因见 Reason）
+	BidStatusSealed   = "sealed"   // 密封拍卖尚未开标的出价，资金已冻结
+)
 
-// 荷兰钟拍卖结构
+// 拍卖结构
 type Auction struct {
 	ID                int           `json:"id"`
+	AuctionType       string        `json:"auctionType"`       // 拍卖类型：dutch, english, sealed_first, vickrey
 	ItemType          string        `json:"itemType"`          // 物品类型
-	InitialPrice      float64       `json:"initialPrice"`      // 初始价格
-	CurrentPrice      float64       `json:"currentPrice"`      // 当前价格
-	MinPrice          float64       `json:"minPrice"`          // 最低价格
-	PriceDecrement    float64       `json:"priceDecrement"`    // 价格递减量
+	InitialPrice      money.Money   `json:"initialPrice"`      // 初始价格
+	CurrentPrice      money.Money   `json:"currentPrice"`      // 当前价格
+	MinPrice          money.Money   `json:"minPrice"`          // 最低价格（公开的底价，钟面价格降到此处结束）
+	ReservePrice      money.Money   `json:"-"`                 // 保留价（只对卖家可见），低于保留价不成交，0 表示不设
+	PriceDecrement    money.Money   `json:"priceDecrement"`    // 价格递减量
 	DecrementInterval int           `json:"decrementInterval"` // 价格递减间隔（秒）
+	DecayCurve        string        `json:"decayCurve"`        // 荷兰钟价格曲线：linear（默认）, exponential, stepwise, accelerating
+	DecayRate         float64       `json:"decayRate"`         // 曲线百分比：指数曲线每个间隔的降幅，加速曲线每个间隔降幅的增长
+	DecaySteps        []DecayStep   `json:"decaySteps"`        // 阶梯曲线的点位
+	MinIncrement      money.Money   `json:"minIncrement"`      // 英式拍卖最低加价
+	Duration          int           `json:"duration"`          // 英式拍卖和密封拍卖的持续时长（秒），密封拍卖到时开标
+	ExtensionSeconds  int           `json:"extensionSeconds"`  // 英式拍卖防狙击延长时长（秒），0 表示不延长
 	Quantity          int           `json:"quantity"`          // 数量
+	RemainingQuantity int           `json:"remainingQuantity"` // 剩余未成交的数量
 	StartTime         *time.Time    `json:"startTime"`         // 开始时间
 	EndTime           *time.Time    `json:"endTime"`           // 结束时间
-	Status            string        `json:"status"`            // 状态：pending, active, completed, cancelled
-	WinnerID          sql.NullInt64 `json:"winnerId"`          // 中标者ID（用户ID）
+	ScheduledStart    *time.Time    `json:"scheduled_start"`   // 预定开始时间，到时自动启动，为空时由卖家手动启动
+	ScheduledEnd      *time.Time    `json:"scheduled_end"`     // 预定结束时间，到时自动结束，为空时按拍卖规则结束
+	PausedAt          *time.Time    `json:"pausedAt"`          // 暂停时刻，未暂停时为空
+	PausedDuration    int64         `json:"pausedDuration"`    // 累计暂停时长（毫秒），钟面价格按扣除暂停后的时长计算
+	Status            AuctionStatus `json:"status"`            // 状态：pending, active, paused, completed, cancelled，只能经 transitionAuction 修改
+	WinnerID          sql.NullInt64 `json:"winnerId"`          // 最近一次成交的买家ID（用户ID）
+	SellerID          int           `json:"sellerId"`          // 卖家ID（用户ID）
 	CreatedAt         sql.NullTime  `json:"created_at"`        // 创建时间
 	UpdatedAt         sql.NullTime  `json:"updated_at"`        // 更新时间
 }
 
-// MarshalJSON 自定义JSON序列化，处理sql.NullTime和sql.NullInt64类型
+// MarshalJSON 自定义JSON序列化，处理sql.NullTime和sql.NullInt64类型。
+// 保留价只对卖家可见，公开的序列化结果中不包含保留价
 func (a Auction) MarshalJSON() ([]byte, error) {
+	return marshalAuction(a, nil)
+}
+
+// SellerAuction 卖家视角的拍卖，序列化时包含保留价，只能返回给卖家本人
+type SellerAuction struct {
+	Auction
+}
+
+// MarshalJSON 序列化拍卖并附带保留价
+func (a SellerAuction) MarshalJSON() ([]byte, error) {
+	return marshalAuction(a.Auction, &a.ReservePrice)
+}
+
+// 转换为卖家视角的拍卖列表
+func sellerAuctions(auctions []Auction) []SellerAuction {
+	views := make([]SellerAuction, 0, len(auctions))
+	for _, auction := range auctions {
+		views = append(views, SellerAuction{Auction: auction})
+	}
+	return views
+}
+
+// 序列化拍卖，reservePrice 为空时不输出保留价
+func marshalAuction(a Auction, reservePrice *money.Money) ([]byte, error) {
 	type Alias Auction
 	var createdAt, updatedAt interface{} = nil, nil
 	if a.CreatedAt.Valid {
@@ -65,27 +105,32 @@ func (a Auction) MarshalJSON() ([]byte, error) {
 		winnerId = a.WinnerID.Int64
 	}
 	return json.Marshal(&struct {
-		CreatedAt interface{} `json:"created_at"`
-		UpdatedAt interface{} `json:"updated_at"`
-		WinnerId  interface{} `json:"winnerId"`
+		CreatedAt    interface{}  `json:"created_at"`
+		UpdatedAt    interface{}  `json:"updated_at"`
+		WinnerId     interface{}  `json:"winnerId"`
+		ReservePrice *money.Money `json:"reservePrice,omitempty"`
 		*Alias
 	}{
-		CreatedAt: createdAt,
-		UpdatedAt: updatedAt,
-		WinnerId:  winnerId,
-		Alias:     (*Alias)(&a),
+		CreatedAt:    createdAt,
+		UpdatedAt:    updatedAt,
+		WinnerId:     winnerId,
+		ReservePrice: reservePrice,
+		Alias:        (*Alias)(&a),
 	})
 }
 
-// 荷兰钟竞价记录
+// 竞价记录。荷兰钟拍卖每条记录即一次分配：买家以成交价买入 Quantity 个；
+// 英式拍卖和密封拍卖每条记录为一次整批出价，出价资金冻结到结束
 type AuctionBid struct {
-	ID        int          `json:"id"`
-	AuctionID int          `json:"auctionId"`
-	UserID    int          `json:"userId"`
-	Price     float64      `json:"price"`
-	Quantity  int          `json:"quantity"`
-	Status    string       `json:"status"` // 状态：pending, accepted, rejected
-	CreatedAt sql.NullTime `json:"created_at"`
+	ID                int          `json:"id"`
+	AuctionID         int          `json:"auctionId"`
+	UserID            int          `json:"userId"`
+	Price             money.Money  `json:"price"`             // 成交单价（竞价时的钟面价格）
+	Quantity          int          `json:"quantity"`          // 分配数量
+	RequestedQuantity int          `json:"requestedQuantity"` // 请求数量，剩余不足时只分配剩余部分
+	Status            string       `json:"status"`            // 状态：pending, accepted, rejected, leading, outbid, sealed
+	Reason            string       `json:"reason,omitempty"`  // 荷兰钟竞价被拒绝的原因
+	CreatedAt         sql.NullTime `json:"created_at"`        // 到达时间（荷兰钟竞价）或写入时间
 }
 
 // MarshalJSON 自定义JSON序列化，处理sql.NullTime类型
@@ -104,169 +149,20 @@ func (ab AuctionBid) MarshalJSON() ([]byte, error) {
 	})
 }
 
-// 初始化荷兰钟拍卖数据库表
-func InitAuctionDatabase(dbConn *sql.DB) error {
-	logger.Info("auction", "初始化荷兰钟拍卖数据库表\n")
-
-	// 创建荷兰钟拍卖表
-	_, err := dbConn.Exec(`
-		CREATE TABLE IF NOT EXISTS auctions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			item_type TEXT NOT NULL,
-			initial_price REAL NOT NULL,
-			current_price REAL NOT NULL,
-			min_price REAL NOT NULL,
-			price_decrement REAL NOT NULL,
-			decrement_interval INTEGER NOT NULL,
-			quantity INTEGER NOT NULL,
-			start_time DATETIME,
-			end_time DATETIME,
-			status TEXT NOT NULL DEFAULT 'pending',
-			winner_id INTEGER,
-			created_at DATETIME,
-			updated_at DATETIME
-		)
-	`)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("创建荷兰钟拍卖表失败: %v\n", err))
-		return err
-	}
-
-	// 创建荷兰钟竞价记录表
-	_, err = dbConn.Exec(`
-		CREATE TABLE IF NOT EXISTS auction_bids (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			auction_id INTEGER NOT NULL,
-			user_id INTEGER NOT NULL,
-			price REAL NOT NULL,
-			quantity INTEGER NOT NULL,
-			status TEXT NOT NULL DEFAULT 'pending',
-			created_at DATETIME,
-			FOREIGN KEY (auction_id) REFERENCES auctions(id)
-		)
-	`)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("创建荷兰钟竞价记录表失败: %v\n", err))
-		return err
-	}
-
-	logger.Info("auction", "荷兰钟拍卖数据库表初始化完成\n")
-
-	// 恢复进行中的拍卖
-	recoverActiveAuctions(dbConn)
-
-	return nil
-}
-
-// 启动单个拍卖的价格递减定时器
-func StartAuctionPriceDecrementTimer(db *sql.DB, auctionID int) {
-	timersMutex.Lock()
-
-	// 检查是否已经存在定时器
-	if _, exists := auctionTimers[auctionID]; exists {
-		timersMutex.Unlock()
-		logger.Info("auction", fmt.Sprintf("拍卖ID %d 的定时器已存在\n", auctionID))
-		return
-	}
-
-	// 获取拍卖的递减间隔
-	var decrementInterval int
-	err := db.QueryRow("SELECT decrement_interval FROM auctions WHERE id = ?", auctionID).Scan(&decrementInterval)
-	if err != nil {
-		timersMutex.Unlock()
-		logger.Info("auction", fmt.Sprintf("获取拍卖ID %d 的递减间隔失败: %v\n", auctionID, err))
-		return
-	}
-
-	// 创建定时器,等待第一个间隔后再执行更新
-	timer := time.AfterFunc(time.Duration(decrementInterval)*time.Second, func() {
-		// 执行价格更新
-		updateSingleAuctionPrice(db, auctionID)
-
-		// 检查拍卖是否还是活跃状态
-		timersMutex.Lock()
-		var status string
-		checkErr := db.QueryRow("SELECT status FROM auctions WHERE id = ?", auctionID).Scan(&status)
-		if checkErr == nil && status == "active" {
-			// 从map中删除旧的定时器引用
-			delete(auctionTimers, auctionID)
-			timersMutex.Unlock()
-
-			// 递归调用,启动新的定时器
-			StartAuctionPriceDecrementTimer(db, auctionID)
-		} else {
-			// 拍卖已结束或出错,清理定时器
-			delete(auctionTimers, auctionID)
-			timersMutex.Unlock()
-			logger.Info("auction", fmt.Sprintf("拍卖ID %d 已结束,清理定时器\n", auctionID))
-		}
-	})
-
-	// 保存定时器
-	auctionTimers[auctionID] = &AuctionTimerItem{
-		Timer:     timer,
-		AuctionID: auctionID,
-		Interval:  decrementInterval,
-	}
-	timersMutex.Unlock()
-
-	logger.Info("auction", fmt.Sprintf("为拍卖ID %d 启动定时器,递减间隔: %d 秒\n", auctionID, decrementInterval))
-}
-
-// 停止单个拍卖的价格递减定时器
-func StopAuctionPriceDecrementTimerByID(auctionID int) {
-	timersMutex.Lock()
-	defer timersMutex.Unlock()
-
-	if timerItem, exists := auctionTimers[auctionID]; exists {
-		if timerItem.Timer != nil {
-			timerItem.Timer.Stop()
-		}
-		delete(auctionTimers, auctionID)
-		logger.Info("auction", fmt.Sprintf("停止拍卖ID %d 的定时器\n", auctionID))
-	}
-}
-
-// 更新单个拍卖的价格
-func updateSingleAuctionPrice(db *sql.DB, auctionID int) {
-	// 查询拍卖信息
-	var auction Auction
-	var startTime, endTime sql.NullTime
-
-	err := db.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement,
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at
-		FROM auctions WHERE id = ?`, auctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("查询拍卖ID %d 失败: %v\n", auctionID, err))
-		// 停止定时器
-		StopAuctionPriceDecrementTimerByID(auctionID)
-		return
-	}
-
-	// 处理可能为NULL的时间字段
-	if startTime.Valid {
-		auction.StartTime = &startTime.Time
-	}
-	if endTime.Valid {
-		auction.EndTime = &endTime.Time
+// 荷兰钟从开始时间到 now 实际走过的时长，扣除累计暂停时长；暂停中的拍卖停在暂停时刻
+func clockElapsed(auction *Auction, now time.Time) time.Duration {
+	if auction.PausedAt != nil {
+		now = *auction.PausedAt
 	}
-
-	// 调用通用的价格更新函数
-	updateAuctionPrice(db, auction)
+	return now.Sub(*auction.StartTime) - time.Duration(auction.PausedDuration)*time.Millisecond
 }
 
-// 恢复进行中的拍卖
-func recoverActiveAuctions(db *sql.DB) {
+// RecoverActiveAuctions 服务启动时把进行中拍卖的价格变化和结束时间，以及待启动和进行中拍卖的预定时间重新加入拍卖时钟
+func RecoverActiveAuctions(storage Storage) {
 	logger.Info("auction", "检查并恢复进行中的拍卖...\n")
 
 	// 获取所有活跃拍卖
-	activeAuctions, err := GetActiveAuctions(db)
+	activeAuctions, err := NewAuctionService(storage).Active(context.Background())
 	if err != nil {
 		logger.Info("auction", fmt.Sprintf("获取活跃拍卖失败: %v\n", err))
 		return
@@ -279,2038 +175,450 @@ func recoverActiveAuctions(db *sql.DB) {
 
 	logger.Info("auction", fmt.Sprintf("发现 %d 个进行中的拍卖，开始恢复...\n", len(activeAuctions)))
 
-	// 为每个活跃拍卖启动独立的价格递减定时器
+	// 进行中的拍卖和有预定时间的拍卖加入拍卖时钟
 	for _, auction := range activeAuctions {
-		if auction.Status == "active" {
-			StartAuctionPriceDecrementTimer(db, auction.ID)
+		if auction.Status == AuctionStatusActive {
+			startAuctionTimer(&auction)
 		}
+		scheduleAuction(&auction)
 	}
-	logger.Info("auction", "所有活跃拍卖的价格递减定时器已启动\n")
+	logger.Info("auction", "所有活跃拍卖已加入拍卖时钟\n")
+}
+
+// 按价格曲线计算荷兰钟拍卖在 now 的价格：价格降低时返回价格更新，降到最低价格时返回 true，
+// 价格没有变化时都不返回
+func dutchPriceUpdate(auction *Auction, now time.Time) (*AuctionPriceUpdateMessage, bool) {
+	// 钟面从开始时间到现在走过的时长，暂停期间钟面不走
+	duration := clockElapsed(auction, now)
+	strategy := decayStrategy(auction)
+	newPrice := strategy.Price(duration)
+	if !newPrice.GreaterThan(auction.MinPrice) {
+		return nil, true
+	}
+
+	// 只有价格递减时才更新，防止价格波动
+	if !newPrice.LessThan(auction.CurrentPrice) {
+		if newPrice.GreaterThan(auction.CurrentPrice) {
+			logger.Info("auction", fmt.Sprintf("价格更新异常：拍卖ID %d 计算价格 %s 高于当前价格 %s，跳过更新\n", auction.ID, newPrice, auction.CurrentPrice))
+		}
+		return nil, false
+	}
+
+	// 按价格曲线计算降到最低价格的剩余时间
+	remaining := max(strategy.FloorAt()-duration, 0)
+	return &AuctionPriceUpdateMessage{
+		AuctionID:     auction.ID,
+		OldPrice:      auction.CurrentPrice,
+		NewPrice:      newPrice,
+		TimeRemaining: int(math.Ceil(remaining.Seconds())),
+	}, false
 }
 
-// 更新活跃拍卖的价格
-func updateActiveAuctionPrices(db *sql.DB) {
-	// 查询所有活跃的拍卖
-	rows, err := db.Query(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE status = 'active'`)
+// 在同一事务中保存一批拍卖的当前价格，并合并写入一条价格更新通知
+func saveAuctionPrices(storage Storage, updates []AuctionPriceUpdateMessage) error {
+	tx, err := storage.Begin()
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("查询活跃拍卖失败: %v\n", err))
-		return
+		return err
 	}
-	defer rows.Close()
-
-	var auctions []Auction
-	for rows.Next() {
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err := rows.Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("扫描拍卖数据失败: %v\n", err))
-			continue
-		}
+	defer tx.Rollback()
 
-		// 处理可能为NULL的时间字段
-		if startTime.Valid {
-			auction.StartTime = &startTime.Time
+	for _, update := range updates {
+		if err = tx.Auctions().UpdateAuctionPrice(update.AuctionID, update.NewPrice); err != nil {
+			return err
 		}
-		if endTime.Valid {
-			auction.EndTime = &endTime.Time
-		}
-
-		auctions = append(auctions, auction)
 	}
-
-	// 更新每个活跃拍卖的价格
-	for _, auction := range auctions {
-		updateAuctionPrice(db, auction)
+	if err = enqueueOutbox(tx, OutboxAuctionPriceBatch, AuctionPriceBatchMessage{Updates: updates}); err != nil {
+		return fmt.Errorf("写入价格通知失败: %v", err)
 	}
+	return tx.Commit()
 }
 
-// 更新单个拍卖的价格
-func updateAuctionPrice(db *sql.DB, auction Auction) {
-	if auction.StartTime == nil {
-		return
+// 结束降到最低价的拍卖并把剩余物品退还卖家：已有成交的拍卖标记为已完成，无人竞价的标记为已取消。
+// 拍卖在事务中重新读取，若已售完或已取消则不做修改并返回 false；reason 记入状态变化记录
+func cancelUnsoldAuction(storage Storage, auctionID int, price money.Money, reason string) (bool, error) {
+	tx, err := storage.Begin()
+	if err != nil {
+		return false, err
 	}
+	defer tx.Rollback()
 
-	var currentTime time.Time
-
-	// 计算从开始时间到现在经过了多少个递减间隔
-	duration := time.Since(*auction.StartTime)
-	intervalsPassed := int(duration.Seconds()) / auction.DecrementInterval
-
-	// 添加详细调试日志
-	currentTime = timeservice.SyncNow()
-	now := clock.Now()
-	logger.Info("auction", fmt.Sprintf("拍卖ID %d 时间详情: currentTime=%v, now=%v, startTime=%v, duration=%.2fs, intervalsPassed=%d, priceDecrement=%.2f, currentPrice=%.2f\n",
-		auction.ID, currentTime.Format("15:04:05.000"), now.Format("15:04:05.000"), auction.StartTime.Format("15:04:05.000"), duration.Seconds(), intervalsPassed, auction.PriceDecrement, auction.CurrentPrice))
-
-	// 使用拍卖自身配置的价格递减量
-	totalDecrement := float64(intervalsPassed) * auction.PriceDecrement
-
-	// 计算新的当前价格
-	newPrice := auction.InitialPrice - totalDecrement
-
-	// 如果新价格低于最低价格，则设置为最低价格
-	if newPrice < auction.MinPrice {
-		newPrice = auction.MinPrice
+	auction, err := tx.Auctions().GetAuction(auctionID)
+	if err != nil {
+		return false, err
 	}
-
-	// 如果价格已经达到最低价格，则取消拍卖并退还物品
-	if newPrice <= auction.MinPrice {
-		// 开始事务
-		tx, err := db.Begin()
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("开始事务失败: %v\n", err))
-			return
-		}
-
-		// 更新拍卖状态为已取消
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE auctions SET status = 'cancelled', current_price = ?, updated_at = ? WHERE id = ?",
-			newPrice, currentTime, auction.ID)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("更新拍卖状态失败: %v\n", err))
-			tx.Rollback()
-			return
-		}
-
-		// 退还物品至背包
-		err = UnlockBackpackItems(tx, auction.ItemType, auction.Quantity)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("退还物品至背包失败: %v\n", err))
-			tx.Rollback()
-			return
-		}
-
-		// 提交事务
-		err = tx.Commit()
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("提交事务失败: %v\n", err))
-			return
-		}
-
-		logger.Info("auction", fmt.Sprintf("拍卖ID %d 已达到最低价格但无人竞价，拍卖已取消并退还物品\n", auction.ID))
-
-		// 停止该拍卖的定时器
-		StopAuctionPriceDecrementTimerByID(auction.ID)
-
-		return
+	if auction.Status != AuctionStatusActive {
+		return false, nil
 	}
 
-	// 只有当价格有变化且变化方向正确（递减）时，才更新数据库
-	// 添加价格变化方向检查，防止价格波动
-	if newPrice != auction.CurrentPrice && newPrice <= auction.CurrentPrice {
-		oldPrice := auction.CurrentPrice
-		currentTime = timeservice.SyncNow()
-		_, err := db.Exec("UPDATE auctions SET current_price = ?, updated_at = ? WHERE id = ?",
-			newPrice, currentTime, auction.ID)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("更新拍卖价格失败: %v\n", err))
-			return
-		}
-		logger.Info("auction", fmt.Sprintf("拍卖ID %d 价格已更新: %.2f -> %.2f\n", auction.ID, oldPrice, newPrice))
-
-		// 计算剩余时间
-		remainingDecrementSteps := int((newPrice-auction.MinPrice)/auction.PriceDecrement) + 1
-		timeRemaining := remainingDecrementSteps * auction.DecrementInterval
-
-		// 通过WebSocket广播价格更新
-		if GlobalAuctionWSManager != nil {
-			GlobalAuctionWSManager.BroadcastAuctionWSPriceUpdate(auction.ID, oldPrice, newPrice, timeRemaining)
-			logger.Info("auction", fmt.Sprintf("已广播价格更新: 拍卖ID %d, 旧价格 %.2f, 新价格 %.2f, 剩余时间 %d秒\n",
-				auction.ID, oldPrice, newPrice, timeRemaining))
-		} else {
-			logger.Info("auction", "WebSocket管理器未初始化，跳过价格广播\n")
-		}
-	} else if newPrice > auction.CurrentPrice {
-		// 记录价格异常上涨的情况
-		logger.Info("auction", fmt.Sprintf("价格更新异常：计算价格 %.2f 高于当前价格 %.2f，跳过更新\n", newPrice, auction.CurrentPrice))
+	// 退还剩余物品至卖家背包
+	unsold := auction.RemainingQuantity
+	if err = UnlockBackpackItems(tx.Inventory(), auction.SellerID, auction.ItemType, unsold); err != nil {
+		return false, fmt.Errorf("退还物品至背包失败: %v", err)
 	}
-}
 
-// 检查并锁定背包中的物品（事务版本）
-func LockBackpackItems(tx *sql.Tx, itemType string, quantity int) error {
-	// 获取当前背包
-	var backpack struct {
-		ID        int       `json:"id"`
-		Apple     int       `json:"apple"`
-		Wood      int       `json:"wood"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
+	// 部分成交的拍卖以已完成结束，无人竞价的取消
+	action := AuctionStatusCancelled
+	if unsold < auction.Quantity {
+		action = AuctionStatusCompleted
 	}
-
-	var currentTime time.Time
-
-	err := tx.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
-	if err != nil {
-		return fmt.Errorf("获取背包状态失败: %v", err)
+	if err = transitionAuction(tx, auction, action, ActorSystem, reason); err != nil {
+		return false, err
 	}
-
-	// 检查背包中是否有足够的物品
-	switch itemType {
-	case "apple":
-		if backpack.Apple < quantity {
-			return fmt.Errorf("背包中的苹果数量不足，需要 %d 个，当前 %d 个", quantity, backpack.Apple)
-		}
-		// 更新背包中的苹果数量
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE backpack SET apple = apple - ?, updated_at = ? WHERE id = ?",
-			quantity, currentTime, backpack.ID)
-	case "wood":
-		if backpack.Wood < quantity {
-			return fmt.Errorf("背包中的木材数量不足，需要 %d 个，当前 %d 个", quantity, backpack.Wood)
-		}
-		// 更新背包中的木材数量
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE backpack SET wood = wood - ?, updated_at = ? WHERE id = ?",
-			quantity, currentTime, backpack.ID)
-	default:
-		return fmt.Errorf("无效的物品类型: %s", itemType)
+	auction.CurrentPrice = price
+	auction.RemainingQuantity = 0
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return false, fmt.Errorf("更新拍卖状态失败: %v", err)
 	}
-
-	if err != nil {
-		return fmt.Errorf("更新背包失败: %v", err)
+	if err = enqueueAuctionUpdate(tx, auction, string(action)); err != nil {
+		return false, fmt.Errorf("写入拍卖通知失败: %v", err)
 	}
 
-	return nil
-}
-
-// 解锁背包中的物品（事务版本，当拍卖被取消时调用）
-func UnlockBackpackItems(tx *sql.Tx, itemType string, quantity int) error {
-	// 获取当前背包
-	var backpack struct {
-		ID        int       `json:"id"`
-		Apple     int       `json:"apple"`
-		Wood      int       `json:"wood"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
+	if err = tx.Commit(); err != nil {
+		return false, err
 	}
+	if action == AuctionStatusCancelled {
+		events.Publish(AuctionCancelled{Auction: *auction})
+	} else {
+		events.Publish(AuctionClosed{Auction: *auction, Unsold: unsold})
+	}
+	return true, nil
+}
 
-	var currentTime time.Time
-
-	err := tx.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
+// 检查并锁定背包中的物品，物品不足时返回业务错误。已到完成时间的制作任务先放入背包，
+// 返回这些任务的完成事件，由调用方在事务提交后发布
+func LockBackpackItems(tx Tx, userID int, code string, quantity int) ([]events.Event, error) {
+	completed, err := collectCraftingJobs(tx, userID, timeservice.SyncNow())
 	if err != nil {
-		return fmt.Errorf("获取背包状态失败: %v", err)
+		return nil, internalError("完成制作任务失败", err)
 	}
-
-	// 更新背包中的物品数量
-	switch itemType {
-	case "apple":
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE backpack SET apple = apple + ?, updated_at = ? WHERE id = ?",
-			quantity, currentTime, backpack.ID)
-	case "wood":
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE backpack SET wood = wood + ?, updated_at = ? WHERE id = ?",
-			quantity, currentTime, backpack.ID)
-	default:
-		return fmt.Errorf("无效的物品类型: %s", itemType)
+	if err = consumeItems(tx, userID, code, quantity); err != nil {
+		return nil, err
 	}
+	return craftingCompleted(completed), nil
+}
 
-	if err != nil {
+// 解锁背包中的物品（当拍卖被取消时调用）
+func UnlockBackpackItems(inventory InventoryStore, userID int, code string, quantity int) error {
+	if err := inventory.AddItems(userID, code, quantity); err != nil {
 		return fmt.Errorf("更新背包失败: %v", err)
 	}
-
 	return nil
 }
 
-// 创建荷兰钟拍卖
-func CreateAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	logger.Info("auction", "创建荷兰钟拍卖请求\n")
-
-	var currentTime time.Time
-
-	// 设置响应头为JSON格式
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("创建荷兰钟拍卖请求失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	var auction Auction
-	err := json.NewDecoder(r.Body).Decode(&auction)
+// 结算拍卖成交款，买家直接向卖家转账并写入双方交易记录，返回登记的分录
+func settleAuctionPayment(ledger cash.LedgerStore, buyerID, sellerID int, itemType string, totalPrice money.Money) (*cash.JournalEntry, error) {
+	buyerAccountID, err := cash.UserCashAccountID(ledger, buyerID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("解析荷兰钟拍卖JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("解析请求数据失败: %v", err),
-		})
-		return
-	}
-
-	// 验证输入
-	if auction.ItemType != "apple" && auction.ItemType != "wood" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "无效的物品类型",
-		})
-		return
-	}
-
-	if auction.InitialPrice <= 0 || auction.MinPrice < 0 || auction.PriceDecrement <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "初始价格、最低价格和价格递减量必须为正数",
-		})
-		return
+		return nil, err
 	}
-
-	if auction.InitialPrice < auction.MinPrice {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "初始价格必须大于或等于最低价格",
-		})
-		return
+	sellerAccountID, err := cash.UserCashAccountID(ledger, sellerID)
+	if err != nil {
+		return nil, err
 	}
 
-	if auction.Quantity <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "数量必须为正数",
-		})
-		return
-	}
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindAuctionSettlement,
+		FromAccountID: buyerAccountID,
+		ToAccountID:   sellerAccountID,
+		Amount:        totalPrice,
+		Memo: cash.Memo{
+			OurBankAccountName: "玩家",
+			CounterpartyAlias:  "拍卖卖家",
+			OurBankName:        "玩家银行",
+			CounterpartyBank:   "萌铺子拍卖行",
+			Note:               fmt.Sprintf("荷兰钟拍卖买入%s", itemType),
+		},
+	})
+}
 
-	if auction.DecrementInterval <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "价格递减间隔必须为正数",
-		})
-		return
+// 解析请求中的拍卖ID
+func decodeAuctionID(w http.ResponseWriter, r *http.Request, action string) (int, bool) {
+	var data struct {
+		AuctionID int `json:"auction_id"`
 	}
-
-	// 设置默认值
-	auction.Status = "pending"
-	auction.CurrentPrice = auction.InitialPrice
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("启动事务失败: %v", err),
-		})
-		return
-	}
-
-	// 检查并锁定背包中的物品
-	err = LockBackpackItems(tx, auction.ItemType, auction.Quantity)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("锁定背包物品失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": err.Error(),
-		})
-		return
+	if !decodeBody(w, r, "auction", action, &data) {
+		return 0, false
 	}
+	return data.AuctionID, true
+}
 
-	// 插入拍卖记录
-	currentTime = timeservice.SyncNow()
-	result, err := tx.Exec(`
-		INSERT INTO auctions 
-		(item_type, initial_price, current_price, min_price, price_decrement, decrement_interval, quantity, start_time, end_time, status, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		auction.ItemType, auction.InitialPrice, auction.CurrentPrice, auction.MinPrice,
-		auction.PriceDecrement, auction.DecrementInterval, auction.Quantity,
-		nil, nil, auction.Status, currentTime, currentTime)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("插入拍卖记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("插入拍卖记录失败: %v", err),
-		})
-		return
-	}
+// 创建荷兰钟拍卖
+func CreateAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
+	logger.Info("auction", "创建荷兰钟拍卖请求\n")
 
-	// 获取新插入的拍卖ID
-	auctionID, err := result.LastInsertId()
-	if err != nil {
-		tx.Rollback()
-		logger.Info("auction", fmt.Sprintf("获取拍卖ID失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("获取拍卖ID失败: %v", err),
-		})
+	if !requirePost(w, r, "auction", "创建荷兰钟拍卖") {
 		return
 	}
 
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("提交事务失败: %v", err),
-		})
+	var req CreateAuctionRequest
+	if !decodeBody(w, r, "auction", "创建荷兰钟拍卖", &req) {
 		return
 	}
 
-	// 获取完整的拍卖信息
-	var newAuction Auction
-	var startTime, endTime sql.NullTime
-	err = db.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, auctionID).Scan(
-		&newAuction.ID, &newAuction.ItemType, &newAuction.InitialPrice, &newAuction.CurrentPrice,
-		&newAuction.MinPrice, &newAuction.PriceDecrement, &newAuction.DecrementInterval,
-		&newAuction.Quantity, &startTime, &endTime, &newAuction.Status,
-		&newAuction.WinnerID, &newAuction.CreatedAt, &newAuction.UpdatedAt)
+	auction, err := service.Create(r.Context(), userID, req)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("查询拍卖信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("查询拍卖信息失败: %v", err),
-		})
+		writeError(w, "auction", "创建荷兰钟拍卖", err)
 		return
 	}
 
-	// 处理可能为NULL的时间字段
-	if startTime.Valid {
-		newAuction.StartTime = &startTime.Time
-	}
-	if endTime.Valid {
-		newAuction.EndTime = &endTime.Time
-	}
-
-	logger.Info("auction", fmt.Sprintf("创建荷兰钟拍卖成功，ID: %d，物品类型: %s，数量: %d\n", newAuction.ID, newAuction.ItemType, newAuction.Quantity))
-
-	// 返回成功的JSON响应
-	response := map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "拍卖创建成功",
-		"auction": newAuction,
-	}
-	json.NewEncoder(w).Encode(response)
+		"auction": SellerAuction{Auction: *auction},
+	})
 }
 
 // 获取所有荷兰钟拍卖
-func GetAuctions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func GetAuctions(service *AuctionService, w http.ResponseWriter, r *http.Request) {
 	logger.Info("auction", "获取荷兰钟拍卖列表请求\n")
 
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	rows, err := db.Query(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions ORDER BY created_at DESC`)
+	auctions, err := service.List(r.Context())
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("获取荷兰钟拍卖列表失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "数据库查询失败",
-		})
+		writeError(w, "auction", "获取荷兰钟拍卖列表", err)
 		return
 	}
-	defer rows.Close()
-
-	var auctions []Auction
-	for rows.Next() {
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err := rows.Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("处理数据扫描失败: %v\n", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "处理数据失败",
-			})
-			return
-		}
-
-		// 处理可能为NULL的时间字段
-		if startTime.Valid {
-			auction.StartTime = &startTime.Time
-		}
-		if endTime.Valid {
-			auction.EndTime = &endTime.Time
-		}
-
-		auctions = append(auctions, auction)
-	}
 
-	// 创建一个自定义的拍卖结构用于JSON序列化，处理WinnerID的NULL值
-	type JSONAuction struct {
-		ID                int        `json:"id"`
-		ItemType          string     `json:"itemType"`
-		InitialPrice      float64    `json:"initialPrice"`
-		CurrentPrice      float64    `json:"currentPrice"`
-		MinPrice          float64    `json:"minPrice"`
-		PriceDecrement    float64    `json:"priceDecrement"`
-		DecrementInterval int        `json:"decrementInterval"`
-		Quantity          int        `json:"quantity"`
-		StartTime         *time.Time `json:"startTime"`
-		EndTime           *time.Time `json:"endTime"`
-		Status            string     `json:"status"`
-		WinnerID          *int       `json:"winnerId"`
-		CreatedAt         time.Time  `json:"created_at"`
-		UpdatedAt         time.Time  `json:"updated_at"`
-	}
-
-	var jsonAuctions []JSONAuction
-	for _, auction := range auctions {
-		var winnerIDPtr *int
-		if auction.WinnerID.Valid {
-			winnerID := int(auction.WinnerID.Int64)
-			winnerIDPtr = &winnerID
-		}
-
-		jsonAuction := JSONAuction{
-			ID:                auction.ID,
-			ItemType:          auction.ItemType,
-			InitialPrice:      auction.InitialPrice,
-			CurrentPrice:      auction.CurrentPrice,
-			MinPrice:          auction.MinPrice,
-			PriceDecrement:    auction.PriceDecrement,
-			DecrementInterval: auction.DecrementInterval,
-			Quantity:          auction.Quantity,
-			StartTime:         auction.StartTime,
-			EndTime:           auction.EndTime,
-			Status:            auction.Status,
-			WinnerID:          winnerIDPtr,
-			CreatedAt:         auction.CreatedAt.Time,
-			UpdatedAt:         auction.UpdatedAt.Time,
-		}
-
-		jsonAuctions = append(jsonAuctions, jsonAuction)
-	}
-
-	logger.Info("auction", fmt.Sprintf("获取荷兰钟拍卖列表成功，共 %d 条记录\n", len(jsonAuctions)))
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	logger.Info("auction", fmt.Sprintf("获取荷兰钟拍卖列表成功，共 %d 条记录\n", len(auctions)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
-		"auctions": jsonAuctions,
+		"auctions": auctions,
 	})
 }
 
 // 获取单个荷兰钟拍卖
-func GetAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func GetAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
 	logger.Info("auction", "获取单个荷兰钟拍卖请求\n")
 
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("获取单个荷兰钟拍卖失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
+	if !requirePost(w, r, "auction", "获取单个荷兰钟拍卖") {
 		return
 	}
-
-	// 解析请求数据
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("获取单个荷兰钟拍卖，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "获取单个荷兰钟拍卖")
+	if !ok {
 		return
 	}
 
-	// 验证输入
-	if data.AuctionID <= 0 {
-		logger.Info("auction", "获取单个荷兰钟拍卖，拍卖ID无效\n")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
+	auction, err := service.Get(r.Context(), auctionID)
+	if err != nil {
+		writeError(w, "auction", "获取单个荷兰钟拍卖", err)
 		return
 	}
-
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = db.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
+	bids, err := service.Bids(r.Context(), auctionID, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			logger.Info("auction", fmt.Sprintf("获取单个荷兰钟拍卖失败，拍卖ID %d 不存在\n", data.AuctionID))
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖不存在",
-			})
-		} else {
-			logger.Info("auction", fmt.Sprintf("获取单个荷兰钟拍卖失败，数据库查询错误: %v\n", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "数据库查询失败",
-			})
-		}
+		writeError(w, "auction", "获取单个荷兰钟拍卖", err)
 		return
 	}
 
-	// 处理可能为NULL的时间字段
-	if startTime.Valid {
-		auction.StartTime = &startTime.Time
-	}
-	if endTime.Valid {
-		auction.EndTime = &endTime.Time
-	}
-
-	// 创建一个自定义的拍卖结构用于JSON序列化，处理WinnerID的NULL值
-	type JSONAuction struct {
-		ID                int        `json:"id"`
-		ItemType          string     `json:"itemType"`
-		InitialPrice      float64    `json:"initialPrice"`
-		CurrentPrice      float64    `json:"currentPrice"`
-		MinPrice          float64    `json:"minPrice"`
-		PriceDecrement    float64    `json:"priceDecrement"`
-		DecrementInterval int        `json:"decrementInterval"`
-		Quantity          int        `json:"quantity"`
-		StartTime         *time.Time `json:"startTime"`
-		EndTime           *time.Time `json:"endTime"`
-		Status            string     `json:"status"`
-		WinnerID          *int       `json:"winnerId"`
-		CreatedAt         time.Time  `json:"created_at"`
-		UpdatedAt         time.Time  `json:"updated_at"`
-	}
-
-	var winnerIDPtr *int
-	if auction.WinnerID.Valid {
-		winnerID := int(auction.WinnerID.Int64)
-		winnerIDPtr = &winnerID
-	}
-
-	jsonAuction := JSONAuction{
-		ID:                auction.ID,
-		ItemType:          auction.ItemType,
-		InitialPrice:      auction.InitialPrice,
-		CurrentPrice:      auction.CurrentPrice,
-		MinPrice:          auction.MinPrice,
-		PriceDecrement:    auction.PriceDecrement,
-		DecrementInterval: auction.DecrementInterval,
-		Quantity:          auction.Quantity,
-		StartTime:         auction.StartTime,
-		EndTime:           auction.EndTime,
-		Status:            auction.Status,
-		WinnerID:          winnerIDPtr,
-		CreatedAt:         auction.CreatedAt.Time,
-		UpdatedAt:         auction.UpdatedAt.Time,
-	}
-
-	logger.Info("auction", fmt.Sprintf("获取单个荷兰钟拍卖成功，ID: %d，物品类型: %s\n", auction.ID, auction.ItemType))
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	// 卖家本人可以看到保留价
+	var view interface{} = auction
+	if auction.SellerID == userID {
+		view = SellerAuction{Auction: *auction}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "获取拍卖成功",
-		"auction": jsonAuction,
+		"auction": view,
+		"bids":    bids,
 	})
 }
 
-// 开始荷兰钟拍卖
-func StartAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	logger.Info("auction", "启动荷兰钟拍卖请求\n")
-
-	var currentTime time.Time
-
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	// 解析请求数据
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
-		return
-	}
+// 获取拍卖的状态变化记录
+func GetAuctionHistory(service *AuctionService, w http.ResponseWriter, r *http.Request) {
+	logger.Info("auction", "获取拍卖状态记录请求\n")
 
-	// 验证输入
-	if data.AuctionID <= 0 {
-		logger.Info("auction", "启动荷兰钟拍卖失败，拍卖ID无效\n")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
+	if !requirePost(w, r, "auction", "获取拍卖状态记录") {
 		return
 	}
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，事务开始失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务开始失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "获取拍卖状态记录")
+	if !ok {
 		return
 	}
 
-	// 检查拍卖是否存在
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = tx.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
+	history, err := service.History(r.Context(), auctionID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖失败，拍卖ID %d 不存在\n", data.AuctionID))
-			tx.Rollback()
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖不存在",
-			})
-		} else {
-			logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，查询拍卖信息失败: %v\n", err))
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "数据库查询失败",
-			})
-		}
+		writeError(w, "auction", "获取拍卖状态记录", err)
 		return
 	}
 
-	// 检查拍卖状态
-	if auction.Status != "pending" {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖失败，拍卖ID %d 状态不是待启动状态\n", data.AuctionID))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖状态不是待启动状态",
-		})
-		return
-	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "获取拍卖状态记录成功",
+		"events":  history,
+	})
+}
 
-	// 设置开始时间和状态
-	currentTime = timeservice.SyncNow()
-	startTimeValue := currentTime
-	endTimeValue := currentTime.Add(time.Duration(auction.DecrementInterval) * time.Second * time.Duration(int((auction.InitialPrice-auction.MinPrice)/auction.PriceDecrement)))
+// 开始荷兰钟拍卖
+func StartAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
+	logger.Info("auction", "启动荷兰钟拍卖请求\n")
 
-	// 更新拍卖状态
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(`
-		UPDATE auctions
-		SET status = 'active', start_time = ?, end_time = ?, current_price = ?, updated_at = ?
-		WHERE id = ?`,
-		startTimeValue, endTimeValue, auction.InitialPrice, currentTime, data.AuctionID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，更新拍卖状态失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新拍卖状态失败",
-		})
+	if !requirePost(w, r, "auction", "启动荷兰钟拍卖") {
 		return
 	}
-
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，事务提交失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务提交失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "启动荷兰钟拍卖")
+	if !ok {
 		return
 	}
 
-	// 获取更新后的拍卖信息
-	var updatedAuction Auction
-	var startTime2, endTime2 sql.NullTime
-	err = db.QueryRow(`
-	SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-	decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-	FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-		&updatedAuction.ID, &updatedAuction.ItemType, &updatedAuction.InitialPrice, &updatedAuction.CurrentPrice,
-		&updatedAuction.MinPrice, &updatedAuction.PriceDecrement, &updatedAuction.DecrementInterval,
-		&updatedAuction.Quantity, &startTime2, &endTime2, &updatedAuction.Status,
-		&updatedAuction.WinnerID, &updatedAuction.CreatedAt, &updatedAuction.UpdatedAt)
+	auction, err := service.Start(r.Context(), userID, auctionID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖，获取更新后的拍卖信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取更新后的拍卖信息失败",
-		})
+		writeError(w, "auction", "启动荷兰钟拍卖", err)
 		return
 	}
 
-	// 处理可能为NULL的时间字段
-	if startTime2.Valid {
-		updatedAuction.StartTime = &startTime2.Time
-	}
-	if endTime2.Valid {
-		updatedAuction.EndTime = &endTime2.Time
-	}
-
-	// 创建一个自定义的拍卖结构用于JSON序列化，处理WinnerID的NULL值
-	type JSONAuction struct {
-		ID                int        `json:"id"`
-		ItemType          string     `json:"itemType"`
-		InitialPrice      float64    `json:"initialPrice"`
-		CurrentPrice      float64    `json:"currentPrice"`
-		MinPrice          float64    `json:"minPrice"`
-		PriceDecrement    float64    `json:"priceDecrement"`
-		DecrementInterval int        `json:"decrementInterval"`
-		Quantity          int        `json:"quantity"`
-		StartTime         *time.Time `json:"startTime"`
-		EndTime           *time.Time `json:"endTime"`
-		Status            string     `json:"status"`
-		WinnerID          *int       `json:"winnerId"`
-		CreatedAt         time.Time  `json:"created_at"`
-		UpdatedAt         time.Time  `json:"updated_at"`
-	}
-
-	var winnerIDPtr *int
-	if updatedAuction.WinnerID.Valid {
-		winnerID := int(updatedAuction.WinnerID.Int64)
-		winnerIDPtr = &winnerID
-	}
-
-	jsonAuction := JSONAuction{
-		ID:                updatedAuction.ID,
-		ItemType:          updatedAuction.ItemType,
-		InitialPrice:      updatedAuction.InitialPrice,
-		CurrentPrice:      updatedAuction.CurrentPrice,
-		MinPrice:          updatedAuction.MinPrice,
-		PriceDecrement:    updatedAuction.PriceDecrement,
-		DecrementInterval: updatedAuction.DecrementInterval,
-		Quantity:          updatedAuction.Quantity,
-		StartTime:         updatedAuction.StartTime,
-		EndTime:           updatedAuction.EndTime,
-		Status:            updatedAuction.Status,
-		WinnerID:          winnerIDPtr,
-		CreatedAt:         updatedAuction.CreatedAt.Time,
-		UpdatedAt:         updatedAuction.UpdatedAt.Time,
-	}
-
-	logger.Info("auction", fmt.Sprintf("启动荷兰钟拍卖成功，ID: %d，物品类型: %s，数量: %d\n", updatedAuction.ID, updatedAuction.ItemType, updatedAuction.Quantity))
-
-	// 为该拍卖启动独立的价格递减定时器
-	StartAuctionPriceDecrementTimer(db, data.AuctionID)
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"auction": jsonAuction,
+		"auction": SellerAuction{Auction: *auction},
 		"message": "拍卖已开始",
 	})
 }
 
-// 提交荷兰钟竞价
-func CommitAuctionBid(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+// 提交荷兰钟竞价，买下拍卖的全部物品
+func CommitAuctionBid(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
 	logger.Info("auction", "提交荷兰钟竞价请求\n")
 
-	var currentTime time.Time
-
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	// 解析竞价数据
-	var bid struct {
-		AuctionID int `json:"auction_id"`
-		BidAmount int `json:"bid_amount"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&bid)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
-		return
-	}
-
-	// 验证输入
-	if bid.AuctionID <= 0 {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，拍卖ID %d 无效\n", bid.AuctionID))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
+	if !requirePost(w, r, "auction", "提交荷兰钟竞价") {
 		return
 	}
 
-	if bid.BidAmount <= 0 {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，竞价金额 %d 无效\n", bid.BidAmount))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "竞价金额必须为正数",
-		})
-		return
-	}
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，事务开始失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务开始失败",
-		})
-		return
-	}
-
-	// 获取拍卖信息
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = tx.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, bid.AuctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价失败，拍卖ID %d 不存在\n", bid.AuctionID))
-			tx.Rollback()
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖不存在",
-			})
-		} else {
-			logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，获取拍卖信息失败: %v\n", err))
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "数据库查询失败",
-			})
-		}
-		return
-	}
-
-	// 检查拍卖状态
-	if auction.Status != "active" {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价失败，拍卖ID %d 未启动\n", bid.AuctionID))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖未启动",
-		})
-		return
-	}
-
-	// 检查拍卖是否已结束
-	if auction.EndTime != nil && timeservice.SyncNow().After(*auction.EndTime) {
-		// 更新拍卖状态为已完成
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE auctions SET status = 'completed', updated_at = ? WHERE id = ?", currentTime, bid.AuctionID)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，更新拍卖状态失败: %v\n", err))
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "更新拍卖状态失败",
-			})
-			return
-		}
-
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，拍卖ID %d 已结束，更新状态为已完成\n", bid.AuctionID))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖已结束",
-		})
-		return
-	}
-
-	// 检查竞价金额是否在有效范围内
-	if float64(bid.BidAmount) > auction.CurrentPrice || float64(bid.BidAmount) < auction.MinPrice {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价失败，竞价金额 %d 不在有效价格范围内\n", bid.BidAmount))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "竞价金额不在有效价格范围内",
-		})
-		return
-	}
-
-	// 获取当前价格
-	currentPrice := float64(bid.BidAmount)
-
-	// 插入竞价记录
-	result, err := tx.Exec(`
-		INSERT INTO auction_bids (auction_id, user_id, price, quantity, status) 
-		VALUES (?, ?, ?, ?, 'accepted')`,
-		bid.AuctionID, 1, currentPrice, auction.Quantity)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，插入竞价记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "插入竞价记录失败",
-		})
-		return
-	}
-
-	// 获取竞价ID
-	bidID, err := result.LastInsertId()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，获取竞价ID失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取竞价ID失败",
-		})
-		return
-	}
-
-	// 更新拍卖状态为已完成
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(`
-		UPDATE auctions 
-		SET status = 'completed', winner_id = ?, updated_at = ? 
-		WHERE id = ?`,
-		1, currentTime, bid.AuctionID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，更新拍卖状态失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新拍卖状态失败",
-		})
-		return
-	}
-
-	// 更新用户背包
-	var backpack Backpack
-	err = tx.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，获取用户背包失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取用户背包失败",
-		})
-		return
-	}
-
-	// 根据物品类型更新背包
-	switch auction.ItemType {
-	case "apple":
-		backpack.Apple += auction.Quantity
-	case "wood":
-		backpack.Wood += auction.Quantity
-	}
-
-	// 更新背包
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE backpack SET apple = ?, wood = ?, updated_at = ? WHERE id = ?",
-		backpack.Apple, backpack.Wood, currentTime, backpack.ID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，更新用户背包失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新用户背包失败",
-		})
-		return
-	}
-
-	// 获取当前余额
-	var balance struct {
-		ID        int       `json:"id"`
-		Amount    float64   `json:"amount"`
-		UpdatedAt time.Time `json:"updated_at"`
-	}
-	err = tx.QueryRow("SELECT id, amount, updated_at FROM balance ORDER BY id DESC LIMIT 1").Scan(&balance.ID, &balance.Amount, &balance.UpdatedAt)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，获取当前余额失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取当前余额失败",
-		})
-		return
-	}
-
-	// 计算总价格
-	totalPrice := currentPrice * float64(auction.Quantity)
-
-	// 检查余额是否足够
-	if balance.Amount < totalPrice {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，余额不足: %v\n", totalPrice))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "余额不足",
-		})
-		return
+	var data struct {
+		AuctionID int         `json:"auction_id"`
+		BidAmount money.Money `json:"bid_amount"`
+		Quantity  int         `json:"quantity"` // 买入数量，省略时买下全部剩余
 	}
-
-	// 更新余额
-	currentTime = timeservice.SyncNow()
-	newBalance := balance.Amount - totalPrice
-	_, err = tx.Exec("UPDATE balance SET amount = ?, updated_at = ? WHERE id = ?",
-		newBalance, currentTime, balance.ID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，更新余额失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新余额失败",
-		})
+	if !decodeBody(w, r, "auction", "提交荷兰钟竞价", &data) {
 		return
 	}
 
-	// 添加交易记录
-	// 隐私数据
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(
-		"INSERT INTO transactions (transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, note, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		currentTime, "玩家", "萌铺子市场", "玩家银行", "萌铺子市场银行", totalPrice, 0, fmt.Sprintf("荷兰钟拍卖买入%s", auction.ItemType), currentTime)
+	bid, auction, err := service.Bid(r.Context(), BidRequest{AuctionID: data.AuctionID, BidderID: userID, Price: data.BidAmount, Quantity: data.Quantity})
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，添加交易记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "添加交易记录失败",
-		})
+		writeError(w, "auction", "提交荷兰钟竞价", err)
 		return
 	}
 
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，事务提交失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务提交失败",
-		})
-		return
+	message := fmt.Sprintf("成功以 %s 的价格买入 %d 个%s", bid.Price, bid.Quantity, auction.ItemType)
+	switch {
+	case auction.AuctionType == AuctionTypeEnglish:
+		message = fmt.Sprintf("出价 %s 已成为最高出价，资金已冻结至拍卖结束", bid.Price)
+	case sealedAuction(auction):
+		message = fmt.Sprintf("密封出价 %s 已提交，资金已冻结至开标", bid.Price)
 	}
-
-	// 获取竞价记录
-	var newBid AuctionBid
-	err = db.QueryRow(`
-		SELECT id, auction_id, user_id, price, quantity, status, created_at 
-		FROM auction_bids WHERE id = ?`, bidID).Scan(
-		&newBid.ID, &newBid.AuctionID, &newBid.UserID, &newBid.Price,
-		&newBid.Quantity, &newBid.Status, &newBid.CreatedAt)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价，获取竞价记录失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取竞价记录失败",
-		})
-		return
-	}
-
-	logger.Info("auction", fmt.Sprintf("提交荷兰钟竞价成功，ID: %d，价格: %.2f，物品类型: %s，数量: %d\n", newBid.ID, currentPrice, auction.ItemType, auction.Quantity))
-
-	// 停止该拍卖的价格递减定时器
-	StopAuctionPriceDecrementTimerByID(bid.AuctionID)
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
-		"bid":     newBid,
-		"message": fmt.Sprintf("成功以 %.2f 的价格买入 %d 个%s", currentPrice, auction.Quantity, auction.ItemType),
+		"bid":     bid,
+		"auction": auction,
+		"message": message,
 	})
 }
 
 // 取消荷兰钟拍卖
-func CancelAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func CancelAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
 	logger.Info("auction", "取消荷兰钟拍卖请求\n")
 
-	var currentTime time.Time
-
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	// 解析请求数据
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
-		return
-	}
-
-	// 验证输入
-	if data.AuctionID <= 0 {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖失败，拍卖ID %d 无效\n", data.AuctionID))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
-		return
-	}
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，事务开始失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务开始失败",
-		})
-		return
-	}
-
-	// 检查拍卖是否存在
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = tx.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，获取拍卖信息失败: %v\n", err))
-		if err == sql.ErrNoRows {
-			logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖失败，拍卖ID %d 不存在\n", data.AuctionID))
-			tx.Rollback()
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖不存在",
-			})
-		} else {
-			logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，获取拍卖信息失败: %v\n", err))
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "数据库查询失败",
-			})
-		}
-		return
-	}
-
-	// 检查拍卖状态
-	if auction.Status == "completed" {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖失败，拍卖ID %d 已完成\n", data.AuctionID))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "无法取消已完成的拍卖",
-		})
-		return
-	}
-
-	// 更新拍卖状态为已取消
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE auctions SET status = 'cancelled', updated_at = ? WHERE id = ?", currentTime, data.AuctionID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，更新拍卖状态失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新拍卖状态失败",
-		})
+	if !requirePost(w, r, "auction", "取消荷兰钟拍卖") {
 		return
 	}
-
-	// 解锁背包中的物品
-	err = UnlockBackpackItems(tx, auction.ItemType, auction.Quantity)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，解锁背包物品失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "解锁背包物品失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "取消荷兰钟拍卖")
+	if !ok {
 		return
 	}
 
-	// 提交事务
-	err = tx.Commit()
+	_, err := service.Cancel(r.Context(), userID, auctionID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖，事务提交失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务提交失败",
-		})
+		writeError(w, "auction", "取消荷兰钟拍卖", err)
 		return
 	}
 
-	logger.Info("auction", fmt.Sprintf("取消荷兰钟拍卖成功，ID: %d，物品类型: %s，数量: %d\n", auction.ID, auction.ItemType, auction.Quantity))
-
-	// 停止该拍卖的价格递减定时器
-	StopAuctionPriceDecrementTimerByID(data.AuctionID)
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "拍卖已取消，物品已返还到背包",
 	})
 }
 
-// 获取卖家荷兰钟拍卖列表
-func GetSellerAuctions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+// 获取卖家荷兰钟拍卖列表（当前玩家发布的拍卖）
+func GetSellerAuctions(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
 	logger.Info("auction", "获取卖家荷兰钟拍卖列表请求\n")
 
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	rows, err := db.Query(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions ORDER BY created_at DESC`)
+	auctions, err := service.ListBySeller(r.Context(), userID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("获取卖家荷兰钟拍卖列表失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "数据库查询失败",
-		})
+		writeError(w, "auction", "获取卖家荷兰钟拍卖列表", err)
 		return
 	}
-	defer rows.Close()
-
-	var auctions []Auction
-	for rows.Next() {
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err := rows.Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("获取卖家荷兰钟拍卖列表，处理数据失败: %v\n", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "处理数据失败",
-			})
-			return
-		}
-
-		// 处理可能为NULL的时间字段
-		if startTime.Valid {
-			auction.StartTime = &startTime.Time
-		}
-		if endTime.Valid {
-			auction.EndTime = &endTime.Time
-		}
-
-		auctions = append(auctions, auction)
-	}
-
-	// 创建一个自定义的拍卖结构用于JSON序列化，处理WinnerID的NULL值
-	type JSONAuction struct {
-		ID                int        `json:"id"`
-		ItemType          string     `json:"itemType"`
-		InitialPrice      float64    `json:"initialPrice"`
-		CurrentPrice      float64    `json:"currentPrice"`
-		MinPrice          float64    `json:"minPrice"`
-		PriceDecrement    float64    `json:"priceDecrement"`
-		DecrementInterval int        `json:"decrementInterval"`
-		Quantity          int        `json:"quantity"`
-		StartTime         *time.Time `json:"startTime"`
-		EndTime           *time.Time `json:"endTime"`
-		Status            string     `json:"status"`
-		WinnerID          *int       `json:"winnerId"`
-		CreatedAt         time.Time  `json:"created_at"`
-		UpdatedAt         time.Time  `json:"updated_at"`
-	}
-
-	var jsonAuctions []JSONAuction
-	for _, auction := range auctions {
-		var winnerIDPtr *int
-		if auction.WinnerID.Valid {
-			winnerID := int(auction.WinnerID.Int64)
-			winnerIDPtr = &winnerID
-		}
-
-		jsonAuction := JSONAuction{
-			ID:                auction.ID,
-			ItemType:          auction.ItemType,
-			InitialPrice:      auction.InitialPrice,
-			CurrentPrice:      auction.CurrentPrice,
-			MinPrice:          auction.MinPrice,
-			PriceDecrement:    auction.PriceDecrement,
-			DecrementInterval: auction.DecrementInterval,
-			Quantity:          auction.Quantity,
-			StartTime:         auction.StartTime,
-			EndTime:           auction.EndTime,
-			Status:            auction.Status,
-			WinnerID:          winnerIDPtr,
-			CreatedAt:         auction.CreatedAt.Time,
-			UpdatedAt:         auction.UpdatedAt.Time,
-		}
-
-		jsonAuctions = append(jsonAuctions, jsonAuction)
-	}
 
-	logger.Info("auction", fmt.Sprintf("获取卖家荷兰钟拍卖列表成功，共 %d 条记录\n", len(jsonAuctions)))
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	logger.Info("auction", fmt.Sprintf("获取卖家荷兰钟拍卖列表成功，共 %d 条记录\n", len(auctions)))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
-		"auctions": jsonAuctions,
+		"auctions": sellerAuctions(auctions),
 	})
 }
 
 // 暂停荷兰钟拍卖（下架）
-func PauseAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+func PauseAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
 	logger.Info("auction", "暂停荷兰钟拍卖请求\n")
 
-	var currentTime time.Time
-
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
+	if !requirePost(w, r, "auction", "暂停荷兰钟拍卖") {
 		return
 	}
-
-	// 解析请求数据
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "暂停荷兰钟拍卖")
+	if !ok {
 		return
 	}
 
-	// 验证输入
-	if data.AuctionID <= 0 {
-		logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖失败，拍卖ID %d 无效\n", data.AuctionID))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
-		return
-	}
-
-	// 添加重试机制，最多重试3次
-	maxRetries := 3
-	for retry := 0; retry < maxRetries; retry++ {
-		// 开始事务
-		tx, err := db.Begin()
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖，事务开始失败: %v\n", err))
-			if retry == maxRetries-1 {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"message": "事务开始失败",
-				})
-				return
-			}
-			time.Sleep(time.Duration(retry+1) * 100 * time.Millisecond) // 指数退避
-			continue
-		}
-
-		// 检查拍卖是否存在
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err = tx.QueryRow(`
-			SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-			decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-			FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			tx.Rollback()
-			if err == sql.ErrNoRows {
-				logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖失败，拍卖ID %d 不存在\n", data.AuctionID))
-				w.WriteHeader(http.StatusNotFound)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"message": "拍卖不存在",
-				})
-			} else {
-				logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖，获取拍卖信息失败: %v\n", err))
-				if retry == maxRetries-1 {
-					w.WriteHeader(http.StatusInternalServerError)
-					json.NewEncoder(w).Encode(map[string]interface{}{
-						"success": false,
-						"message": "数据库查询失败",
-					})
-					return
-				}
-				time.Sleep(time.Duration(retry+1) * 100 * time.Millisecond) // 指数退避
-				continue
-			}
-			return
-		}
-
-		// 检查拍卖状态
-		if auction.Status != "active" {
-			tx.Rollback()
-			logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖失败，拍卖ID %d 状态不是活跃状态\n", data.AuctionID))
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖ID不是活跃状态",
-			})
-			return
-		}
-
-		// 更新拍卖状态为待开始
-		currentTime = timeservice.SyncNow()
-		_, err = tx.Exec("UPDATE auctions SET status = 'pending', start_time = NULL, end_time = NULL, updated_at = ? WHERE id = ?", currentTime, data.AuctionID)
-		if err != nil {
-			tx.Rollback()
-			logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖，更新拍卖状态失败: %v\n", err))
-			if retry == maxRetries-1 {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"message": "更新拍卖状态失败",
-				})
-				return
-			}
-			time.Sleep(time.Duration(retry+1) * 100 * time.Millisecond) // 指数退避
-			continue
-		}
-
-		// 提交事务
-		err = tx.Commit()
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖，事务提交失败: %v\n", err))
-			if retry == maxRetries-1 {
-				w.WriteHeader(http.StatusInternalServerError)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"success": false,
-					"message": "事务提交失败",
-				})
-				return
-			}
-			time.Sleep(time.Duration(retry+1) * 200 * time.Millisecond) // 指数退避，时间稍长
-			continue
-		}
-
-		// 事务成功提交，退出重试循环
-		logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖成功，ID: %d，物品类型: %s，数量: %d\n", auction.ID, auction.ItemType, auction.Quantity))
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "拍卖已成功暂停",
-		})
-		return
-	}
-}
-
-// 更新荷兰钟拍卖价格（定时任务调用）
-func UpdateAuctionPrices(db *sql.DB) {
-	logger.Info("auction", "开始更新荷兰钟拍卖价格\n")
-
-	var currentTime time.Time
-
-	// 获取所有活跃的拍卖
-	rows, err := db.Query(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE status = 'active'`)
+	_, err := service.Pause(r.Context(), userID, auctionID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("更新荷兰钟拍卖价格，获取活跃拍卖失败: %v\n", err))
-		fmt.Printf("获取活跃拍卖失败: %v\n", err)
+		writeError(w, "auction", "暂停荷兰钟拍卖", err)
 		return
 	}
-	defer rows.Close()
-
-	currentTime = timeservice.SyncNow()
-	updatedCount := 0
-
-	for rows.Next() {
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err := rows.Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			logger.Info("auction", fmt.Sprintf("更新荷兰钟拍卖价格，扫描拍卖数据失败: %v\n", err))
-			fmt.Printf("扫描拍卖数据失败: %v\n", err)
-			continue
-		}
-
-		// 处理可能为NULL的时间字段
-		if startTime.Valid {
-			auction.StartTime = &startTime.Time
-		}
-		if endTime.Valid {
-			auction.EndTime = &endTime.Time
-		}
 
-		// 检查拍卖是否已结束
-		if auction.EndTime != nil && currentTime.After(*auction.EndTime) {
-			// 更新拍卖状态为已完成
-			currentTime = timeservice.SyncNow()
-			_, err = db.Exec("UPDATE auctions SET status = 'completed', updated_at = ? WHERE id = ?", currentTime, auction.ID)
-			if err != nil {
-				logger.Info("auction", fmt.Sprintf("更新荷兰钟拍卖价格，更新拍卖状态为已完成失败: %v\n", err))
-				fmt.Printf("更新拍卖状态为已完成失败: %v\n", err)
-			} else {
-				logger.Info("auction", fmt.Sprintf("拍卖ID %d 已自动结束\n", auction.ID))
-				updatedCount++
-			}
-			continue
-		}
-
-		// 计算应该减少的价格
-		if auction.StartTime == nil {
-			continue
-		}
-		duration := currentTime.Sub(*auction.StartTime)
-		intervals := int(duration.Seconds()) / auction.DecrementInterval
-		newPrice := auction.InitialPrice - float64(intervals)*auction.PriceDecrement
-
-		// 确保价格不低于最低价格
-		if newPrice < auction.MinPrice {
-			newPrice = auction.MinPrice
-		}
-
-		// 只有当价格有变化且变化方向正确（递减）时，才更新数据库
-		// 添加价格变化方向检查，防止价格波动
-		if newPrice != auction.CurrentPrice && newPrice <= auction.CurrentPrice {
-			currentTime = timeservice.SyncNow()
-			_, err = db.Exec("UPDATE auctions SET current_price = ?, updated_at = ? WHERE id = ?", newPrice, currentTime, auction.ID)
-			if err != nil {
-				logger.Info("auction", fmt.Sprintf("更新荷兰钟拍卖价格，更新拍卖价格失败: %v\n", err))
-				fmt.Printf("更新拍卖价格失败: %v\n", err)
-			} else {
-				logger.Info("auction", fmt.Sprintf("拍卖ID %d 价格已更新: %.2f -> %.2f\n", auction.ID, auction.CurrentPrice, newPrice))
-				updatedCount++
-			}
-		} else if newPrice > auction.CurrentPrice {
-			// 记录价格异常上涨的情况
-			logger.Info("auction", fmt.Sprintf("价格更新异常：计算价格 %.2f 高于当前价格 %.2f，跳过更新\n", newPrice, auction.CurrentPrice))
-		}
-	}
-
-	logger.Info("auction", fmt.Sprintf("荷兰钟拍卖价格更新完成，共更新 %d 个拍卖\n", updatedCount))
-}
-
-// 获取活跃的荷兰钟拍卖列表（WebSocket使用）
-func GetActiveAuctions(db *sql.DB) ([]Auction, error) {
-	rows, err := db.Query(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE status IN ('pending', 'active') ORDER BY created_at DESC`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var auctions []Auction
-	for rows.Next() {
-		var auction Auction
-		var startTime, endTime sql.NullTime
-		err := rows.Scan(
-			&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-			&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-			&auction.Quantity, &startTime, &endTime, &auction.Status,
-			&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-
-		// 处理可能为NULL的时间字段
-		if startTime.Valid {
-			auction.StartTime = &startTime.Time
-		}
-		if endTime.Valid {
-			auction.EndTime = &endTime.Time
-		}
-
-		auctions = append(auctions, auction)
-	}
-
-	return auctions, nil
-}
-
-// 根据ID获取荷兰钟拍卖详情（WebSocket使用）
-func GetAuctionID(db *sql.DB, auctionID int) (*Auction, error) {
-	var auction Auction
-	var startTime, endTime sql.NullTime
-
-	err := db.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, auctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-	if err != nil {
-		return nil, err
-	}
-
-	// 处理可能为NULL的时间字段
-	if startTime.Valid {
-		auction.StartTime = &startTime.Time
-	}
-	if endTime.Valid {
-		auction.EndTime = &endTime.Time
-	}
-
-	return &auction, nil
-}
-
-// 处理荷兰钟竞价（WebSocket使用）
-func ProcessAuctionBid(db *sql.DB, auctionID, userID int, price float64, quantity int) (bool, string, error) {
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		return false, "事务开始失败", err
-	}
-
-	var currentTime time.Time
-
-	// 检查拍卖是否存在且处于活跃状态
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = tx.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, auctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-	if err != nil {
-		tx.Rollback()
-		return false, "拍卖不存在", err
-	}
-
-	// 检查拍卖状态
-	if auction.Status != "active" {
-		tx.Rollback()
-		return false, "拍卖未开始或已结束", nil
-	}
-
-	// 检查价格是否有效
-	if price < auction.CurrentPrice {
-		tx.Rollback()
-		return false, "竞价价格低于当前价格", nil
-	}
-
-	// 检查数量是否有效
-	if quantity <= 0 || quantity > auction.Quantity {
-		tx.Rollback()
-		return false, "竞价数量无效", nil
-	}
-
-	// 记录竞价
-	currentTime = timeservice.SyncNow()
-	result, err := tx.Exec(`
-		INSERT INTO auction_bids (auction_id, user_id, price, quantity, status, created_at) 
-		VALUES (?, ?, ?, ?, 'accepted', ?)`,
-		auctionID, userID, price, quantity, currentTime)
-	if err != nil {
-		tx.Rollback()
-		return false, "记录竞价失败", err
-	}
-
-	bidID, err := result.LastInsertId()
-	if err != nil {
-		tx.Rollback()
-		return false, "获取竞价ID失败", err
-	}
-
-	// 更新拍卖状态为已完成，设置中标者
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(`
-		UPDATE auctions 
-		SET status = 'completed', winner_id = ?, end_time = ?, updated_at = ? 
-		WHERE id = ?`, userID, currentTime, currentTime, auctionID)
-	if err != nil {
-		tx.Rollback()
-		return false, "更新拍卖状态失败", err
-	}
-
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		return false, "事务提交失败", err
-	}
-
-	logger.Info("auction", fmt.Sprintf("荷兰钟竞价成功，拍卖ID: %d，用户ID: %d，价格: %.2f，数量: %d，竞价ID: %d\n",
-		auctionID, userID, price, quantity, bidID))
-
-	return true, "竞价成功", nil
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "拍卖已成功暂停",
+	})
 }
 
-// 重新激活拍卖 - 允许卖家将已完成、已取消的拍卖状态更新为pending
-func ReactivateAuction(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	logger.Info("auction", "重新激活拍卖请求\n")
-
-	var currentTime time.Time
-
-	// 统一设置响应头
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
+// 恢复已暂停的荷兰钟拍卖（重新上架），价格从暂停时的价格继续递减
+func ResumeAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
+	logger.Info("auction", "恢复荷兰钟拍卖请求\n")
 
-	// 解析请求数据
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，解析JSON失败: %v\n", err))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "请求数据解析失败",
-		})
+	if !requirePost(w, r, "auction", "恢复荷兰钟拍卖") {
 		return
 	}
-
-	// 验证输入
-	if data.AuctionID <= 0 {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖失败，拍卖ID %d 无效\n", data.AuctionID))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "拍卖ID无效",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "恢复荷兰钟拍卖")
+	if !ok {
 		return
 	}
 
-	// 开始事务
-	tx, err := db.Begin()
+	_, err := service.Resume(r.Context(), userID, auctionID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，事务开始失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务开始失败",
-		})
+		writeError(w, "auction", "恢复荷兰钟拍卖", err)
 		return
 	}
 
-	// 检查拍卖是否存在
-	var auction Auction
-	var startTime, endTime sql.NullTime
-	err = tx.QueryRow(`
-		SELECT id, item_type, initial_price, current_price, min_price, price_decrement, 
-		decrement_interval, quantity, start_time, end_time, status, winner_id, created_at, updated_at 
-		FROM auctions WHERE id = ?`, data.AuctionID).Scan(
-		&auction.ID, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
-		&auction.MinPrice, &auction.PriceDecrement, &auction.DecrementInterval,
-		&auction.Quantity, &startTime, &endTime, &auction.Status,
-		&auction.WinnerID, &auction.CreatedAt, &auction.UpdatedAt)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，获取拍卖信息失败: %v\n", err))
-		if err == sql.ErrNoRows {
-			logger.Info("auction", fmt.Sprintf("重新激活拍卖失败，拍卖ID %d 不存在\n", data.AuctionID))
-			tx.Rollback()
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "拍卖不存在",
-			})
-		} else {
-			tx.Rollback()
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "数据库查询失败",
-			})
-		}
-		return
-	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "拍卖已恢复，价格从暂停时继续递减",
+	})
+}
 
-	// 检查拍卖状态，只允许重新激活已完成或已取消的拍卖
-	if auction.Status != "completed" && auction.Status != "cancelled" {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖失败，拍卖ID %d 状态为 %s，不允许重新激活\n", data.AuctionID, auction.Status))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "只能重新激活已完成或已取消的拍卖",
-		})
-		return
-	}
+// 重新激活拍卖 - 允许卖家将已完成、已取消的拍卖状态更新为pending
+func ReactivateAuction(service *AuctionService, w http.ResponseWriter, r *http.Request, userID int) {
+	logger.Info("auction", "重新激活拍卖请求\n")
 
-	// 检查背包中是否有足够的物品
-	err = LockBackpackItems(tx, auction.ItemType, auction.Quantity)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，锁定背包物品失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": err.Error(),
-		})
+	if !requirePost(w, r, "auction", "重新激活拍卖") {
 		return
 	}
-
-	// 重置拍卖状态为pending，并重置当前价格为初始价格
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(`
-		UPDATE auctions 
-		SET status = 'pending', current_price = initial_price, start_time = NULL, end_time = NULL, winner_id = NULL, updated_at = ? 
-		WHERE id = ?`, currentTime, data.AuctionID)
-	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，更新拍卖状态失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新拍卖状态失败",
-		})
+	auctionID, ok := decodeAuctionID(w, r, "重新激活拍卖")
+	if !ok {
 		return
 	}
 
-	// 提交事务
-	err = tx.Commit()
+	_, err := service.Reactivate(r.Context(), userID, auctionID)
 	if err != nil {
-		logger.Info("auction", fmt.Sprintf("重新激活拍卖，事务提交失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "事务提交失败",
-		})
+		writeError(w, "auction", "重新激活拍卖", err)
 		return
 	}
 
-	logger.Info("auction", fmt.Sprintf("重新激活拍卖成功，ID: %d，物品类型: %s，数量: %d\n", auction.ID, auction.ItemType, auction.Quantity))
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "拍卖已重新激活，可以再次开始",
 	})
@@ -0,0 +1,248 @@
+package market
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 荷兰钟竞价的仲裁窗口：竞价在到达时间之后等待这段时间再处理，
+// 取到达时间到进入队列之间的延迟落在窗口内的竞价，都能按到达时间排到正确的位置
+const bidArbitrationWindow = 20 * time.Millisecond
+
+// 被拒绝的荷兰钟竞价在竞价记录中的原因，内部错误的详情只写入日志
+const (
+	bidRejectReasonInternal  = "竞价处理失败，请稍后重试"
+	bidRejectReasonCancelled = "竞价请求已取消"
+)
+
+// 等待仲裁的荷兰钟竞价
+type pendingBid struct {
+	ctx      context.Context
+	req      BidRequest
+	received time.Time // 到达时间（时间服务时间）
+	seq      uint64    // 到达序号，到达时间和玩家都相同时按序号
+	result   chan bidResult
+}
+
+type bidResult struct {
+	bid     *AuctionBid
+	auction *Auction
+	err     error
+}
+
+// 荷兰钟竞价仲裁：HTTP 和 WebSocket 竞价都经过这里。每个拍卖同一时刻只有一个协程处理竞价，
+// 排队的竞价按到达时间、玩家ID、到达序号排序，队首的竞价过了到达时间加仲裁窗口后才处理，
+// 到达时间相差不超过窗口的竞价即使进入队列的先后相反，也按到达时间得到确定的处理顺序
+type dutchBidArbiter struct {
+	mutex    sync.Mutex
+	pending  map[int][]*pendingBid // key: auctionID
+	draining map[int]bool          // 正在处理竞价的拍卖
+	seq      uint64
+}
+
+var bidArbiter = &dutchBidArbiter{pending: make(map[int][]*pendingBid), draining: make(map[int]bool)}
+
+// 提交竞价并等待仲裁结果。请求取消时还在排队的竞价撤回并记为拒绝，
+// 已开始处理的竞价等待其事务结束，保证返回的结果与竞价记录一致
+func (a *dutchBidArbiter) submit(ctx context.Context, service *AuctionService, req BidRequest, received time.Time) (*AuctionBid, *Auction, error) {
+	pending := &pendingBid{ctx: ctx, req: req, received: received, result: make(chan bidResult, 1)}
+
+	a.mutex.Lock()
+	a.seq++
+	pending.seq = a.seq
+	a.pending[req.AuctionID] = append(a.pending[req.AuctionID], pending)
+	start := !a.draining[req.AuctionID]
+	a.draining[req.AuctionID] = true
+	a.mutex.Unlock()
+
+	// 没有正在处理的竞价时由本次竞价启动处理协程
+	if start {
+		go a.drain(service, req.AuctionID)
+	}
+
+	select {
+	case result := <-pending.result:
+		return result.bid, result.auction, result.err
+	case <-ctx.Done():
+	}
+	if a.withdraw(pending) {
+		service.rejectDutchBid(req, received, ctx.Err())
+		return nil, nil, ctx.Err()
+	}
+	result := <-pending.result
+	return result.bid, result.auction, result.err
+}
+
+// 从队列中撤回还没开始处理的竞价
+func (a *dutchBidArbiter) withdraw(pending *pendingBid) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	queue := a.pending[pending.req.AuctionID]
+	for i, queued := range queue {
+		if queued == pending {
+			a.pending[pending.req.AuctionID] = append(queue[:i:i], queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// 处理一个拍卖排队的竞价，直到队列为空：先到达的先处理，到达时间相同时玩家ID小的优先。
+// 队首的竞价未过仲裁窗口时等待，期间进入队列的竞价重新参与排序
+func (a *dutchBidArbiter) drain(service *AuctionService, auctionID int) {
+	earlierAccepted := false
+	for {
+		a.mutex.Lock()
+		queue := a.pending[auctionID]
+		if len(queue) == 0 {
+			delete(a.pending, auctionID)
+			delete(a.draining, auctionID)
+			a.mutex.Unlock()
+			return
+		}
+		sort.Slice(queue, func(i, j int) bool {
+			if !queue[i].received.Equal(queue[j].received) {
+				return queue[i].received.Before(queue[j].received)
+			}
+			if queue[i].req.BidderID != queue[j].req.BidderID {
+				return queue[i].req.BidderID < queue[j].req.BidderID
+			}
+			return queue[i].seq < queue[j].seq
+		})
+		next := queue[0]
+		if wait := next.received.Add(bidArbitrationWindow).Sub(timeservice.SyncNow()); wait > 0 {
+			a.mutex.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		a.pending[auctionID] = queue[1:]
+		a.mutex.Unlock()
+
+		if len(queue) > 1 {
+			logger.Info("auction", fmt.Sprintf("荷兰钟拍卖ID %d 仲裁 %d 个排队的竞价，先处理玩家 %d 的竞价\n", auctionID, len(queue), next.req.BidderID))
+		}
+		bid, auction, err := service.acceptDutchBid(next.ctx, next.req, next.received, earlierAccepted)
+		if err == nil {
+			earlierAccepted = true
+		}
+		next.result <- bidResult{bid: bid, auction: auction, err: err}
+	}
+}
+
+// 在独立事务中处理一个荷兰钟竞价，被拒绝的竞价（包括内部错误）也写入竞价记录。
+// earlierAccepted 表示本轮排队中已有更早到达的竞价成交
+func (s *AuctionService) acceptDutchBid(ctx context.Context, req BidRequest, received time.Time, earlierAccepted bool) (*AuctionBid, *Auction, error) {
+	bid, auction, published, err := s.fillDutchBidTx(ctx, req, received)
+	if err != nil {
+		// 落后于同一批中已成交竞价的冲突，告知玩家是被更早到达的竞价抢先
+		var serviceErr *ServiceError
+		if earlierAccepted && errors.Is(err, ErrConflict) && errors.As(err, &serviceErr) {
+			err = serviceError(ErrConflict, "有更早到达的竞价先成交，%s", serviceErr.Message)
+		}
+		s.rejectDutchBid(req, received, err)
+		return nil, nil, err
+	}
+
+	events.Publish(published...)
+	logger.Info("auction", fmt.Sprintf("%s竞价成功，拍卖ID: %d，玩家ID: %d，价格: %s，数量: %d/%d，剩余: %d，竞价ID: %d\n",
+		auctionTypeName(auction), auction.ID, req.BidderID, bid.Price, bid.Quantity, bid.RequestedQuantity, auction.RemainingQuantity, bid.ID))
+
+	// 售完后停止该拍卖的价格变化
+	if auction.Status == AuctionStatusCompleted {
+		stopAuctionTimer(auction.ID)
+	}
+	return bid, auction, nil
+}
+
+func (s *AuctionService) fillDutchBidTx(ctx context.Context, req BidRequest, received time.Time) (*AuctionBid, *Auction, []events.Event, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, req.AuctionID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err = checkBidOpen(auction, req, received); err != nil {
+		return nil, nil, nil, err
+	}
+	bid, published, err := fillDutchBid(tx, auction, req, received)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, nil, nil, err
+	}
+	return bid, auction, published, nil
+}
+
+// 记录被拒绝的荷兰钟竞价，价格为玩家的出价。竞价记录对所有玩家公开：业务错误的原因为返回给玩家的信息，
+// 内部错误和请求取消记录固定的原因，完整的错误只写入日志。拍卖不存在或不是荷兰钟拍卖时不记录
+func (s *AuctionService) rejectDutchBid(req BidRequest, received time.Time, reason error) {
+	var message string
+	var serviceErr *ServiceError
+	switch {
+	case errors.As(reason, &serviceErr) && serviceErr.Kind != nil:
+		message = serviceErr.Message
+	case errors.Is(reason, context.Canceled) || errors.Is(reason, context.DeadlineExceeded):
+		message = bidRejectReasonCancelled
+	default:
+		message = bidRejectReasonInternal
+	}
+	bid := &AuctionBid{
+		AuctionID:         req.AuctionID,
+		UserID:            req.BidderID,
+		Price:             req.Price,
+		RequestedQuantity: req.Quantity,
+		Status:            BidStatusRejected,
+		Reason:            message,
+		CreatedAt:         sql.NullTime{Time: received, Valid: true},
+	}
+	recorded, err := s.saveRejectedBid(bid)
+	if err != nil {
+		logger.Info("auction", fmt.Sprintf("记录被拒绝的竞价失败，拍卖ID: %d，玩家ID: %d: %v\n", req.AuctionID, req.BidderID, err))
+		return
+	}
+	if !recorded {
+		logger.Info("auction", fmt.Sprintf("竞价被拒绝，拍卖ID %d 不存在或不是荷兰钟拍卖，不写入竞价记录，玩家ID: %d，原因: %v\n", req.AuctionID, req.BidderID, reason))
+		return
+	}
+	logger.Info("auction", fmt.Sprintf("荷兰钟竞价被拒绝，拍卖ID: %d，玩家ID: %d，出价: %s，原因: %v，竞价ID: %d\n",
+		req.AuctionID, req.BidderID, req.Price, reason, bid.ID))
+}
+
+// 在确认拍卖存在且为荷兰钟拍卖的同一事务中写入被拒绝的竞价，避免任意拍卖ID写入竞价记录
+func (s *AuctionService) saveRejectedBid(bid *AuctionBid) (bool, error) {
+	tx, err := s.storage.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	auction, err := tx.Auctions().GetAuction(bid.AuctionID)
+	if errors.Is(err, ErrAuctionNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if timedAuction(auction) {
+		return false, nil
+	}
+	if err = tx.Auctions().CreateBid(bid); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
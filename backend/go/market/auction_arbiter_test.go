@@ -0,0 +1,292 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 创建并启动一个数量为 quantity、初始价格 10.00 的荷兰钟拍卖，卖家为玩家1
+func startTestDutchAuction(t *testing.T, storage *MemoryStorage, quantity int) *Auction {
+	t.Helper()
+	giveItems(t, storage, 1, "apple", quantity)
+	service := NewAuctionService(storage)
+	auction, err := service.Create(context.Background(), 1, CreateAuctionRequest{
+		ItemType:          "apple",
+		InitialPrice:      money.New(1000),
+		MinPrice:          money.New(500),
+		PriceDecrement:    money.New(100),
+		DecrementInterval: 60,
+		Quantity:          quantity,
+	})
+	checkErrorKind(t, err, nil)
+	auction, err = service.Start(context.Background(), 1, auction.ID)
+	checkErrorKind(t, err, nil)
+	t.Cleanup(func() { stopAuctionTimer(auction.ID) })
+	return auction
+}
+
+// 同一批竞价按到达时间、玩家ID、到达序号处理，与进入队列的先后无关
+func TestArbiterOrdering(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000, 3: 10000, 4: 10000})
+	auction := startTestDutchAuction(t, storage, 2)
+	service := NewAuctionService(storage)
+
+	received := time.Now()
+	queued := []struct {
+		bidderID int
+		offset   time.Duration // 相对 received 的到达时间
+	}{
+		{4, 0},
+		{3, time.Millisecond},
+		{2, 0},
+		{2, 0},
+	}
+	arbiter := &dutchBidArbiter{pending: make(map[int][]*pendingBid), draining: map[int]bool{auction.ID: true}}
+	var pendings []*pendingBid
+	for _, q := range queued {
+		arbiter.seq++
+		pending := &pendingBid{
+			ctx:      context.Background(),
+			req:      BidRequest{AuctionID: auction.ID, BidderID: q.bidderID, Price: money.New(1000), Quantity: 1},
+			received: received.Add(q.offset),
+			seq:      arbiter.seq,
+			result:   make(chan bidResult, 1),
+		}
+		arbiter.pending[auction.ID] = append(arbiter.pending[auction.ID], pending)
+		pendings = append(pendings, pending)
+	}
+	arbiter.drain(service, auction.ID)
+
+	if arbiter.draining[auction.ID] || len(arbiter.pending) != 0 {
+		t.Fatal("处理完后队列没有清空")
+	}
+
+	// 拍卖只有2个物品：玩家2的两个竞价先成交，同一时刻到达的玩家4和更晚到达的玩家3被拒绝
+	wantAccepted := []bool{false, false, true, true}
+	for i, pending := range pendings {
+		result := <-pending.result
+		if (result.err == nil) != wantAccepted[i] {
+			t.Errorf("第%d个竞价 错误 = %v，期望成交 %v", i+1, result.err, wantAccepted[i])
+		}
+		if result.err != nil && !strings.Contains(result.err.Error(), "有更早到达的竞价先成交") {
+			t.Errorf("第%d个竞价 拒绝原因 = %v", i+1, result.err)
+		}
+	}
+
+	// 竞价记录的写入顺序即处理顺序
+	bids, err := service.Bids(context.Background(), auction.ID, 1)
+	checkErrorKind(t, err, nil)
+	want := []struct {
+		bidderID int
+		status   string
+	}{
+		{2, BidStatusAccepted},
+		{2, BidStatusAccepted},
+		{4, BidStatusRejected},
+		{3, BidStatusRejected},
+	}
+	if len(bids) != len(want) {
+		t.Fatalf("竞价记录数 = %d，期望 %d", len(bids), len(want))
+	}
+	for i, bid := range bids {
+		if bid.UserID != want[i].bidderID || bid.Status != want[i].status {
+			t.Errorf("第%d条竞价记录 = 玩家%d %s，期望 玩家%d %s", i+1, bid.UserID, bid.Status, want[i].bidderID, want[i].status)
+		}
+	}
+	if got := quantityOf(t, storage, 2, "apple"); got != 2 {
+		t.Errorf("玩家2的苹果 = %d，期望 2", got)
+	}
+}
+
+// 到达时间更早的竞价即使在仲裁窗口内更晚进入队列，也先处理
+func TestArbiterWindow(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000, 3: 10000})
+	auction := startTestDutchAuction(t, storage, 1)
+	service := NewAuctionService(storage)
+	arbiter := &dutchBidArbiter{pending: make(map[int][]*pendingBid), draining: make(map[int]bool)}
+
+	received := timeservice.SyncNow()
+	later := make(chan error, 1)
+	go func() {
+		_, _, err := arbiter.submit(context.Background(), service,
+			BidRequest{AuctionID: auction.ID, BidderID: 3, Price: money.New(1000), Quantity: 1}, received.Add(time.Millisecond))
+		later <- err
+	}()
+	// 等玩家3的竞价进入队列后再提交到达时间更早的玩家2的竞价
+	for {
+		arbiter.mutex.Lock()
+		queued := len(arbiter.pending[auction.ID])
+		arbiter.mutex.Unlock()
+		if queued > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, _, err := arbiter.submit(context.Background(), service,
+		BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(1000), Quantity: 1}, received)
+	checkErrorKind(t, err, nil)
+	if err := <-later; err == nil || !strings.Contains(err.Error(), "有更早到达的竞价先成交") {
+		t.Errorf("后到达的竞价 错误 = %v，期望因更早的竞价成交而被拒绝", err)
+	}
+	if got := quantityOf(t, storage, 2, "apple"); got != 1 {
+		t.Errorf("玩家2的苹果 = %d，期望 1", got)
+	}
+}
+
+func TestArbiterWithdraw(t *testing.T) {
+	arbiter := &dutchBidArbiter{pending: make(map[int][]*pendingBid), draining: make(map[int]bool)}
+	first := &pendingBid{req: BidRequest{AuctionID: 1, BidderID: 2}}
+	second := &pendingBid{req: BidRequest{AuctionID: 1, BidderID: 3}}
+	arbiter.pending[1] = []*pendingBid{first, second}
+
+	if !arbiter.withdraw(first) {
+		t.Fatal("排队中的竞价没有撤回")
+	}
+	if arbiter.withdraw(first) {
+		t.Fatal("已撤回的竞价再次撤回")
+	}
+	if queue := arbiter.pending[1]; len(queue) != 1 || queue[0] != second {
+		t.Fatalf("撤回后的队列 = %v，期望只剩第二个竞价", queue)
+	}
+}
+
+// 参数无效和请求已取消的荷兰钟竞价也写入竞价记录；拍卖不存在或不是荷兰钟拍卖时不写
+func TestBidRejectionsRecorded(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000})
+	auction := startTestDutchAuction(t, storage, 1)
+	giveItems(t, storage, 1, "apple", 2)
+	english, err := NewAuctionService(storage).Create(context.Background(), 1, CreateAuctionRequest{
+		AuctionType: AuctionTypeEnglish, ItemType: "apple", InitialPrice: money.New(100), MinIncrement: money.New(10), Duration: 60, Quantity: 1,
+	})
+	checkErrorKind(t, err, nil)
+	service := NewAuctionService(storage)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		req       BidRequest
+		err       error
+		auctionID int    // 检查竞价记录的拍卖
+		reason    string // 写入的拒绝原因，为空表示不写竞价记录
+	}{
+		{"价格为0", context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.Zero, Quantity: 1}, ErrInvalidArgument, auction.ID, "竞价金额必须为正数"},
+		{"数量为负", context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(1000), Quantity: -1}, ErrInvalidArgument, auction.ID, "竞价数量无效"},
+		{"低于当前价格", context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(999), Quantity: 1}, ErrInvalidArgument, auction.ID, "竞价金额低于当前价格 10.00"},
+		{"卖家竞拍", context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 1, Price: money.New(1000), Quantity: 1}, ErrInvalidArgument, auction.ID, "不能竞拍自己发布的拍卖"},
+		{"请求已取消", cancelled, BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(1000), Quantity: 1}, context.Canceled, auction.ID, bidRejectReasonCancelled},
+		{"拍卖不存在", context.Background(), BidRequest{AuctionID: 999, BidderID: 2, Price: money.New(1000), Quantity: 1}, ErrAuctionNotFound, 999, ""},
+		{"拍卖ID无效", context.Background(), BidRequest{AuctionID: -1, BidderID: 2, Price: money.New(1000), Quantity: 1}, ErrInvalidArgument, -1, ""},
+		{"不存在的拍卖请求已取消", cancelled, BidRequest{AuctionID: 999, BidderID: 2, Price: money.New(1000), Quantity: 1}, context.Canceled, 999, ""},
+		{"英式拍卖请求已取消", cancelled, BidRequest{AuctionID: english.ID, BidderID: 2, Price: money.New(100)}, context.Canceled, english.ID, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := countBids(t, storage, tt.auctionID)
+			_, _, err := service.Bid(tt.ctx, tt.req)
+			checkErrorKind(t, err, tt.err)
+			bids := listBids(t, storage, tt.auctionID)
+			if tt.reason == "" {
+				if len(bids) != before {
+					t.Errorf("竞价记录数 = %d，期望 %d", len(bids), before)
+				}
+				return
+			}
+			if len(bids) != before+1 {
+				t.Fatalf("竞价记录数 = %d，期望 %d", len(bids), before+1)
+			}
+			if got := bids[len(bids)-1]; got.Status != BidStatusRejected || got.Reason != tt.reason {
+				t.Errorf("竞价记录 = %s %q，期望 %s %q", got.Status, got.Reason, BidStatusRejected, tt.reason)
+			}
+		})
+	}
+	if got := quantityOf(t, storage, 2, "apple"); got != 0 {
+		t.Errorf("被拒绝的竞价得到了 %d 个苹果", got)
+	}
+}
+
+// 内部错误的详情不写入公开的竞价记录
+func TestBidRejectionHidesInternalError(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000})
+	auction := startTestDutchAuction(t, storage, 1)
+	service := NewAuctionService(storage)
+
+	service.rejectDutchBid(BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(1000)}, time.Now(),
+		internalError("数据库查询失败", errors.New("SQL logic error: no such column: secret")))
+	bids := listBids(t, storage, auction.ID)
+	if len(bids) != 1 || bids[0].Reason != bidRejectReasonInternal {
+		t.Fatalf("竞价记录 = %+v，期望原因 %q", bids, bidRejectReasonInternal)
+	}
+}
+
+// 钟面价格低于保留价时的拒绝原因与拍卖结束相同，不透露设有保留价
+func TestDutchBidBelowReserve(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000})
+	giveItems(t, storage, 1, "apple", 1)
+	service := NewAuctionService(storage)
+	auction, err := service.Create(context.Background(), 1, CreateAuctionRequest{
+		AuctionType: AuctionTypeDutch, ItemType: "apple", InitialPrice: money.New(1000), MinPrice: money.New(500), ReservePrice: money.New(800),
+		PriceDecrement: money.New(100), DecrementInterval: 60, Quantity: 1,
+	})
+	checkErrorKind(t, err, nil)
+	auction, err = service.Start(context.Background(), 1, auction.ID)
+	checkErrorKind(t, err, nil)
+	t.Cleanup(func() { stopAuctionTimer(auction.ID) })
+	withTx(t, storage, func(tx Tx) error {
+		auction.CurrentPrice = money.New(700)
+		return tx.Auctions().UpdateAuction(auction)
+	})
+
+	_, _, err = service.Bid(context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(700), Quantity: 1})
+	checkErrorKind(t, err, ErrConflict)
+	if err.Error() != "拍卖已结束" {
+		t.Errorf("错误 = %q，期望 %q", err, "拍卖已结束")
+	}
+	if bids := listBids(t, storage, auction.ID); len(bids) != 1 || strings.Contains(bids[0].Reason, "保留价") {
+		t.Errorf("竞价记录 = %+v，拒绝原因不能提到保留价", bids)
+	}
+}
+
+// 荷兰钟拍卖的最低价格可以为0，不能为负数
+func TestValidateDutchMinPrice(t *testing.T) {
+	tests := []struct {
+		minPrice int64
+		err      error
+	}{
+		{500, nil},
+		{0, nil},
+		{-1, ErrInvalidArgument},
+	}
+	for _, tt := range tests {
+		err := validateDutchAuction(CreateAuctionRequest{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(tt.minPrice),
+			PriceDecrement: money.New(100), DecrementInterval: 60})
+		checkErrorKind(t, err, tt.err)
+	}
+}
+
+// 拍卖的竞价记录数
+func countBids(t *testing.T, storage Storage, auctionID int) int {
+	t.Helper()
+	return len(listBids(t, storage, auctionID))
+}
+
+// 拍卖的竞价记录，按写入顺序
+func listBids(t *testing.T, storage Storage, auctionID int) []AuctionBid {
+	t.Helper()
+	var bids []AuctionBid
+	view(storage, func(tx Tx) error {
+		var err error
+		if bids, err = tx.Auctions().ListBids(auctionID); err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+	return bids
+}
@@ -0,0 +1,185 @@
+package market
+
+import (
+	"fmt"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 按结束时间结算的拍卖（英式拍卖和密封拍卖），出价资金冻结到拍卖结束
+func timedAuction(auction *Auction) bool {
+	return auction.AuctionType == AuctionTypeEnglish || sealedAuction(auction)
+}
+
+// 结束到期的拍卖，按拍卖类型结算：英式拍卖由最高出价成交，密封拍卖开标后按一价或二价成交。
+// 拍卖在事务中重新读取，若已结束或结束时间已被延长则不做修改并返回 false
+func closeAuction(storage Storage, auctionID int) (bool, error) {
+	tx, err := storage.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	auction, err := tx.Auctions().GetAuction(auctionID)
+	if err != nil {
+		return false, err
+	}
+	if auction.Status != AuctionStatusActive || (auction.EndTime != nil && timeservice.SyncNow().Before(*auction.EndTime)) {
+		return false, nil
+	}
+
+	var action string
+	var published []events.Event
+	if sealedAuction(auction) {
+		action, published, err = settleSealedAuction(tx, auction)
+	} else {
+		action, published, err = settleEnglishAuction(tx, auction)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	auction.RemainingQuantity = 0
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return false, fmt.Errorf("更新拍卖状态失败: %v", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, action); err != nil {
+		return false, fmt.Errorf("写入拍卖通知失败: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	events.Publish(published...)
+	return true, nil
+}
+
+// 解冻出价资金并更新竞价记录状态
+func releaseBid(tx Tx, auction *Auction, bid *AuctionBid, status string) (*cash.JournalEntry, error) {
+	amount, err := bid.Price.Mul(int64(bid.Quantity))
+	if err != nil {
+		return nil, internalError("计算出价资金失败", err)
+	}
+	entry, err := releaseBidFunds(tx.Ledger(), bid.UserID, auction, amount)
+	if err != nil {
+		return nil, internalError("退还出价资金失败", err)
+	}
+	if err = tx.Auctions().UpdateBidStatus(bid.ID, status); err != nil {
+		return nil, internalError("更新竞价记录失败", err)
+	}
+	bid.Status = status
+	return entry, nil
+}
+
+// 退还拍卖所有仍冻结资金的出价（英式拍卖的最高出价、密封拍卖未开标的出价），竞价记录标记为 status
+func releaseHeldBids(tx Tx, auction *Auction, status string) ([]events.Event, error) {
+	bids, err := tx.Auctions().ListBids(auction.ID)
+	if err != nil {
+		return nil, internalError("获取竞价记录失败", err)
+	}
+	var published []events.Event
+	if sealedAuction(auction) {
+		if published, err = sealedHoldEvents(tx, auction); err != nil {
+			return nil, err
+		}
+	}
+	for i := range bids {
+		if bids[i].Status != BidStatusLeading && bids[i].Status != BidStatusSealed {
+			continue
+		}
+		entry, err := releaseBid(tx, auction, &bids[i], status)
+		if err != nil {
+			return nil, err
+		}
+		published = append(published, ledgerPosted(entry))
+	}
+	return published, nil
+}
+
+// 冻结出价资金：从出价者现金账户转入拍卖保证金账户
+func holdBidFunds(ledger cash.LedgerStore, bidderID int, auction *Auction, amount money.Money) (*cash.JournalEntry, error) {
+	bidderAccountID, err := cash.UserCashAccountID(ledger, bidderID)
+	if err != nil {
+		return nil, err
+	}
+	escrowID, err := cash.AccountIDByCode(ledger, cash.AccountEscrow)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindAuctionHold,
+		FromAccountID: bidderAccountID,
+		ToAccountID:   escrowID,
+		Amount:        amount,
+		Memo: cash.Memo{
+			OurBankAccountName: "玩家",
+			CounterpartyAlias:  "拍卖保证金",
+			OurBankName:        "玩家银行",
+			CounterpartyBank:   "萌铺子拍卖行",
+			Note:               bidHoldNote(auction),
+		},
+	})
+}
+
+// 出价冻结分录的摘要，同一拍卖的所有冻结分录摘要相同
+func bidHoldNote(auction *Auction) string {
+	return fmt.Sprintf("%s #%d 出价冻结", auctionTypeName(auction), auction.ID)
+}
+
+// 解冻出价资金：从拍卖保证金账户退还出价者
+func releaseBidFunds(ledger cash.LedgerStore, bidderID int, auction *Auction, amount money.Money) (*cash.JournalEntry, error) {
+	bidderAccountID, err := cash.UserCashAccountID(ledger, bidderID)
+	if err != nil {
+		return nil, err
+	}
+	escrowID, err := cash.AccountIDByCode(ledger, cash.AccountEscrow)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindAuctionRelease,
+		FromAccountID: escrowID,
+		ToAccountID:   bidderAccountID,
+		Amount:        amount,
+		Memo: cash.Memo{
+			OurBankAccountName: "拍卖保证金",
+			CounterpartyAlias:  "玩家",
+			OurBankName:        "萌铺子拍卖行",
+			CounterpartyBank:   "玩家银行",
+			Note:               fmt.Sprintf("%s #%d 出价退还", auctionTypeName(auction), auction.ID),
+		},
+	})
+}
+
+// 拍卖成交：冻结的出价资金从拍卖保证金账户付给卖家
+func settleEscrow(ledger cash.LedgerStore, buyerID int, auction *Auction, amount money.Money) (*cash.JournalEntry, error) {
+	escrowID, err := cash.AccountIDByCode(ledger, cash.AccountEscrow)
+	if err != nil {
+		return nil, err
+	}
+	sellerAccountID, err := cash.UserCashAccountID(ledger, auction.SellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindAuctionSettlement,
+		FromAccountID: escrowID,
+		ToAccountID:   sellerAccountID,
+		Amount:        amount,
+		Memo: cash.Memo{
+			OurBankAccountName: "拍卖保证金",
+			CounterpartyAlias:  "拍卖卖家",
+			OurBankName:        "萌铺子拍卖行",
+			CounterpartyBank:   "玩家银行",
+			Note:               fmt.Sprintf("%s #%d 成交，玩家%d买入%s", auctionTypeName(auction), auction.ID, buyerID, auction.ItemType),
+		},
+	})
+}
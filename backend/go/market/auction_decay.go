@@ -0,0 +1,172 @@
+package market
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+)
+
+// 荷兰钟价格曲线
+const (
+	DecayCurveLinear       = "linear"       // 线性：每个间隔降低固定的递减价格（默认）
+	DecayCurveExponential  = "exponential"  // 指数：每个间隔按当前价格的固定百分比降低
+	DecayCurveStepwise     = "stepwise"     // 阶梯：按卖家给出的（时间偏移，价格）点位变化
+	DecayCurveAccelerating = "accelerating" // 加速：每个间隔的降幅比上一个间隔多固定百分比，越接近最低价降得越快
+)
+
+// 按间隔跳动的曲线最多计算的间隔数，防止参数过小时降到最低价的时刻无法求出
+const maxDecayTicks = 100000
+
+// DecayStep 阶梯曲线的点位：钟面走过 Offset 秒起价格为 Price
+type DecayStep struct {
+	Offset int         `json:"offset"` // 距开始时间的秒数（不含暂停）
+	Price  money.Money `json:"price"`
+}
+
+// DecayStrategy 荷兰钟价格曲线，按钟面走过的时长（不含暂停）给出价格
+type DecayStrategy interface {
+	// Price 钟面走过 elapsed 后的价格，不高于初始价格、不低于最低价格
+	Price(elapsed time.Duration) money.Money
+	// NextChange 从 elapsed 起到下一次价格变化的时长
+	NextChange(elapsed time.Duration) time.Duration
+	// FloorAt 价格降到最低价格的时刻（从开始时间算起）
+	FloorAt() time.Duration
+}
+
+// 按拍卖配置的曲线创建价格策略，未设置时为线性递减
+func decayStrategy(auction *Auction) DecayStrategy {
+	initial, floor := auction.InitialPrice, auction.MinPrice
+	switch auction.DecayCurve {
+	case DecayCurveStepwise:
+		return stepwiseDecay{initial: initial, floor: floor, steps: auction.DecaySteps}
+	case DecayCurveExponential:
+		keep := 1 - auction.DecayRate/100
+		return newTickDecay(auction, func(ticks int64) money.Money {
+			return scaleMoney(initial, math.Pow(keep, float64(ticks)))
+		})
+	case DecayCurveAccelerating:
+		// 第 k 个间隔降低 PriceDecrement*(1+r)^(k-1)，前 k 个间隔累计降低 PriceDecrement*((1+r)^k-1)/r
+		growth := 1 + auction.DecayRate/100
+		decrement := auction.PriceDecrement
+		return newTickDecay(auction, func(ticks int64) money.Money {
+			price, err := initial.Sub(scaleMoney(decrement, (math.Pow(growth, float64(ticks))-1)/(growth-1)))
+			if err != nil {
+				// 累计降幅超出金额范围时早已低于最低价格
+				return floor
+			}
+			return price
+		})
+	}
+	decrement := auction.PriceDecrement
+	linear := newTickDecay(auction, func(ticks int64) money.Money {
+		total, err := decrement.Mul(ticks)
+		if err != nil {
+			// 累计降幅超出金额范围时早已低于最低价格
+			return floor
+		}
+		price, err := initial.Sub(total)
+		if err != nil {
+			return floor
+		}
+		return price
+	})
+	// 线性曲线降到最低价格需要 ceil((初始价格-最低价格)/递减价格) 个间隔
+	linear.floorTicks = func() int64 {
+		gap, step := initial.Minor()-floor.Minor(), decrement.Minor()
+		if gap <= 0 {
+			return 0
+		}
+		if step <= 0 {
+			return maxDecayTicks
+		}
+		ticks := gap / step
+		if gap%step != 0 {
+			ticks++
+		}
+		return ticks
+	}
+	return linear
+}
+
+// 金额乘以系数，向下取整到最小货币单位
+func scaleMoney(m money.Money, factor float64) money.Money {
+	return money.FromMinor(int64(math.Floor(float64(m.Minor())*factor)), m.Currency())
+}
+
+// 按递减间隔跳动的曲线，priceAt 给出走过 ticks 个间隔后的价格（未截到最低价格），
+// floorTicks 不为空时直接给出降到最低价格的间隔数
+type tickDecay struct {
+	interval   time.Duration
+	floor      money.Money
+	priceAt    func(ticks int64) money.Money
+	floorTicks func() int64
+}
+
+func newTickDecay(auction *Auction, priceAt func(ticks int64) money.Money) tickDecay {
+	return tickDecay{
+		interval: time.Duration(auction.DecrementInterval) * time.Second,
+		floor:    auction.MinPrice,
+		priceAt:  priceAt,
+	}
+}
+
+func (d tickDecay) Price(elapsed time.Duration) money.Money {
+	ticks := int64(max(elapsed, 0) / d.interval)
+	return money.Max(d.priceAt(min(ticks, maxDecayTicks)), d.floor)
+}
+
+func (d tickDecay) NextChange(elapsed time.Duration) time.Duration {
+	return d.interval - max(elapsed, 0)%d.interval
+}
+
+// 每次价格变化都会调用，不能逐个间隔计算：没有解析解的曲线价格随间隔数单调不增，
+// 二分查找第一个不高于最低价格的间隔
+func (d tickDecay) FloorAt() time.Duration {
+	var ticks int64
+	if d.floorTicks != nil {
+		ticks = min(d.floorTicks(), maxDecayTicks)
+	} else {
+		ticks = int64(sort.Search(maxDecayTicks, func(i int) bool {
+			return !d.priceAt(int64(i)).GreaterThan(d.floor)
+		}))
+	}
+	return time.Duration(ticks) * d.interval
+}
+
+// 阶梯曲线，点位按时间偏移升序，最后一个点位的价格为最低价格
+type stepwiseDecay struct {
+	initial, floor money.Money
+	steps          []DecayStep
+}
+
+func (d stepwiseDecay) Price(elapsed time.Duration) money.Money {
+	price := d.initial
+	for _, step := range d.steps {
+		if elapsed < time.Duration(step.Offset)*time.Second {
+			break
+		}
+		price = step.Price
+	}
+	return money.Max(price, d.floor)
+}
+
+func (d stepwiseDecay) NextChange(elapsed time.Duration) time.Duration {
+	for _, step := range d.steps {
+		if offset := time.Duration(step.Offset) * time.Second; offset > elapsed {
+			return offset - elapsed
+		}
+	}
+	// 已过最后一个点位，价格已到最低价格
+	return time.Second
+}
+
+func (d stepwiseDecay) FloorAt() time.Duration {
+	for _, step := range d.steps {
+		if !step.Price.GreaterThan(d.floor) {
+			return time.Duration(step.Offset) * time.Second
+		}
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package market
+
+import (
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+)
+
+func TestDecayStrategy(t *testing.T) {
+	type point struct {
+		elapsed    time.Duration
+		price      int64         // 钟面价格（分）
+		nextChange time.Duration // 到下一次价格变化的时长
+	}
+	tests := []struct {
+		name    string
+		auction Auction
+		floorAt time.Duration
+		points  []point
+	}{
+		{
+			name: "线性",
+			auction: Auction{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(500),
+				PriceDecrement: money.New(100), DecrementInterval: 60},
+			floorAt: 5 * time.Minute,
+			points: []point{
+				{-5 * time.Second, 1000, time.Minute},
+				{0, 1000, time.Minute},
+				{59 * time.Second, 1000, time.Second},
+				{time.Minute, 900, time.Minute},
+				{150 * time.Second, 800, 30 * time.Second},
+				{5 * time.Minute, 500, time.Minute},
+				{time.Hour, 500, time.Minute},
+			},
+		},
+		{
+			name: "指数",
+			auction: Auction{DecayCurve: DecayCurveExponential, InitialPrice: money.New(1000), MinPrice: money.New(500),
+				DecayRate: 10, DecrementInterval: 60},
+			// 1000 × 0.9^k 向下取整：900, 810, 729, 656, 590, 531, 478
+			floorAt: 7 * time.Minute,
+			points: []point{
+				{0, 1000, time.Minute},
+				{time.Minute, 900, time.Minute},
+				{3 * time.Minute, 729, time.Minute},
+				{4*time.Minute + 30*time.Second, 656, 30 * time.Second},
+				{6 * time.Minute, 531, time.Minute},
+				{7 * time.Minute, 500, time.Minute},
+			},
+		},
+		{
+			name: "加速",
+			auction: Auction{DecayCurve: DecayCurveAccelerating, InitialPrice: money.New(1000), MinPrice: money.New(500),
+				PriceDecrement: money.New(100), DecayRate: 50, DecrementInterval: 60},
+			// 每个间隔的降幅为 100, 150, 225, 337.5…，累计降低 100, 250, 475, 812
+			floorAt: 4 * time.Minute,
+			points: []point{
+				{0, 1000, time.Minute},
+				{time.Minute, 900, time.Minute},
+				{2 * time.Minute, 750, time.Minute},
+				{3 * time.Minute, 525, time.Minute},
+				{4 * time.Minute, 500, time.Minute},
+			},
+		},
+		{
+			name: "阶梯",
+			auction: Auction{DecayCurve: DecayCurveStepwise, InitialPrice: money.New(1000), MinPrice: money.New(400),
+				DecaySteps: []DecayStep{{30, money.New(800)}, {90, money.New(600)}, {150, money.New(400)}}},
+			floorAt: 150 * time.Second,
+			points: []point{
+				{0, 1000, 30 * time.Second},
+				{29 * time.Second, 1000, time.Second},
+				{30 * time.Second, 800, time.Minute},
+				{100 * time.Second, 600, 50 * time.Second},
+				{150 * time.Second, 400, time.Second},
+				{time.Hour, 400, time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := decayStrategy(&tt.auction)
+			if got := strategy.FloorAt(); got != tt.floorAt {
+				t.Errorf("FloorAt() = %s，期望 %s", got, tt.floorAt)
+			}
+			if got := strategy.Price(strategy.FloorAt()); !got.Equal(tt.auction.MinPrice) {
+				t.Errorf("到达最低价格时刻的价格 = %s，期望 %s", got, tt.auction.MinPrice)
+			}
+			for _, p := range tt.points {
+				if got := strategy.Price(p.elapsed); got.Minor() != p.price {
+					t.Errorf("Price(%s) = %d，期望 %d", p.elapsed, got.Minor(), p.price)
+				}
+				if got := strategy.NextChange(p.elapsed); got != p.nextChange {
+					t.Errorf("NextChange(%s) = %s，期望 %s", p.elapsed, got, p.nextChange)
+				}
+			}
+		})
+	}
+}
+
+// 参数过小时价格曲线可能很久才到最低价格，FloorAt 最多计算 maxDecayTicks 个间隔
+func TestDecayFloorAtLimit(t *testing.T) {
+	strategy := decayStrategy(&Auction{DecayCurve: DecayCurveLinear, InitialPrice: money.New(100000000), MinPrice: money.New(1),
+		PriceDecrement: money.New(1), DecrementInterval: 1})
+	if got, want := strategy.FloorAt(), maxDecayTicks*time.Second; got != want {
+		t.Errorf("FloorAt() = %s，期望 %s", got, want)
+	}
+}
+
+// FloorAt 的解析解和二分查找与逐个间隔计算的结果一致
+func TestDecayFloorAtMatchesScan(t *testing.T) {
+	tests := []Auction{
+		{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(500), PriceDecrement: money.New(100)},
+		{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(501), PriceDecrement: money.New(100)},
+		{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(999), PriceDecrement: money.New(7)},
+		{DecayCurve: DecayCurveLinear, InitialPrice: money.New(500), MinPrice: money.New(500), PriceDecrement: money.New(100)},
+		{DecayCurve: DecayCurveLinear, InitialPrice: money.New(1000), MinPrice: money.New(500), PriceDecrement: money.Zero},
+		{DecayCurve: DecayCurveExponential, InitialPrice: money.New(1000), MinPrice: money.New(500), DecayRate: 10},
+		{DecayCurve: DecayCurveExponential, InitialPrice: money.New(100000), MinPrice: money.New(1), DecayRate: 0.5},
+		{DecayCurve: DecayCurveAccelerating, InitialPrice: money.New(1000), MinPrice: money.New(500), PriceDecrement: money.New(100), DecayRate: 50},
+		{DecayCurve: DecayCurveAccelerating, InitialPrice: money.New(100000), MinPrice: money.New(1), PriceDecrement: money.New(1), DecayRate: 1},
+	}
+	for _, auction := range tests {
+		auction.DecrementInterval = 60
+		strategy := decayStrategy(&auction)
+		decay := strategy.(tickDecay)
+		want := int64(0)
+		for want < maxDecayTicks && decay.priceAt(want).GreaterThan(auction.MinPrice) {
+			want++
+		}
+		if got := strategy.FloorAt(); got != time.Duration(want)*time.Minute {
+			t.Errorf("%s %s→%s: FloorAt() = %s，期望 %s", auction.DecayCurve, auction.InitialPrice, auction.MinPrice, got, time.Duration(want)*time.Minute)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package market
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 出价被超越的通知，只发送给被超越的玩家
+type AuctionOutbidMessage struct {
+	AuctionID int         `json:"auctionId"`
+	Price     money.Money `json:"price"`    // 被超越的出价
+	NewPrice  money.Money `json:"newPrice"` // 新的最高出价
+}
+
+// 获取英式拍卖当前的最高出价，没有出价时返回 nil
+func leadingBid(store AuctionStore, auctionID int) (*AuctionBid, error) {
+	bids, err := store.ListBids(auctionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(bids) - 1; i >= 0; i-- {
+		if bids[i].Status == BidStatusLeading {
+			return &bids[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// 英式拍卖出价：不低于起拍价，已有出价时至少比最高出价高一个最低加价。
+// 新出价的资金冻结到保证金账户，被超越的出价解冻退还并通知原出价者；
+// 临近结束时出价会把结束时间延长到防狙击时长之后
+func placeEnglishBid(tx Tx, auction *Auction, req BidRequest) (*AuctionBid, []events.Event, error) {
+	if req.Quantity != 0 && req.Quantity != auction.Quantity {
+		return nil, nil, serviceError(ErrInvalidArgument, "英式拍卖只能整批竞拍 %d 个", auction.Quantity)
+	}
+
+	leading, err := leadingBid(tx.Auctions(), auction.ID)
+	if err != nil {
+		return nil, nil, internalError("获取最高出价失败", err)
+	}
+	minimum := auction.InitialPrice
+	if leading != nil {
+		if leading.UserID == req.BidderID {
+			return nil, nil, serviceError(ErrConflict, "你已是当前最高出价者")
+		}
+		if minimum, err = leading.Price.Add(auction.MinIncrement); err != nil {
+			return nil, nil, internalError("计算最低出价失败", err)
+		}
+	}
+	if req.Price.LessThan(minimum) {
+		return nil, nil, serviceError(ErrInvalidArgument, "出价不能低于 %s", minimum)
+	}
+
+	// 冻结新出价的资金
+	amount, err := req.Price.Mul(int64(auction.Quantity))
+	if err != nil {
+		return nil, nil, serviceError(ErrInvalidArgument, "出价金额超出范围")
+	}
+	hold, err := holdBidFunds(tx.Ledger(), req.BidderID, auction, amount)
+	if errors.Is(err, cash.ErrInsufficientFunds) {
+		return nil, nil, serviceError(cash.ErrInsufficientFunds, "余额不足")
+	}
+	if err != nil {
+		return nil, nil, internalError("冻结出价资金失败", err)
+	}
+	published := []events.Event{ledgerPosted(hold)}
+
+	bid := &AuctionBid{
+		AuctionID:         auction.ID,
+		UserID:            req.BidderID,
+		Price:             req.Price,
+		Quantity:          auction.Quantity,
+		RequestedQuantity: auction.Quantity,
+		Status:            BidStatusLeading,
+	}
+	if err = tx.Auctions().CreateBid(bid); err != nil {
+		return nil, nil, internalError("插入竞价记录失败", err)
+	}
+
+	auction.CurrentPrice = req.Price
+	auction.WinnerID = sql.NullInt64{Int64: int64(req.BidderID), Valid: true}
+
+	// 防狙击：结束前的延长时长内出价，结束时间顺延
+	extended := false
+	if auction.ExtensionSeconds > 0 && auction.EndTime != nil {
+		extension := time.Duration(auction.ExtensionSeconds) * time.Second
+		now := timeservice.SyncNow()
+		if auction.EndTime.Sub(now) < extension {
+			endTime := now.Add(extension)
+			auction.EndTime = &endTime
+			extended = true
+		}
+	}
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "bid_placed"); err != nil {
+		return nil, nil, internalError("写入拍卖通知失败", err)
+	}
+	published = append(published, BidPlaced{Bid: *bid, Auction: *auction, Extended: extended})
+
+	// 解冻被超越的出价并通知原出价者
+	if leading != nil {
+		release, err := releaseBid(tx, auction, leading, BidStatusOutbid)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = enqueueUserOutbox(tx, leading.UserID, OutboxAuctionOutbid, AuctionOutbidMessage{
+			AuctionID: auction.ID,
+			Price:     leading.Price,
+			NewPrice:  req.Price,
+		})
+		if err != nil {
+			return nil, nil, internalError("写入出价通知失败", err)
+		}
+		published = append(published, ledgerPosted(release), BidOutbid{Bid: *leading, NewBid: *bid})
+	}
+	return bid, published, nil
+}
+
+// 结算到期的英式拍卖：最高出价达到保留价时成交，冻结的资金付给卖家，物品放入买家背包；
+// 没有出价或未达到保留价时取消拍卖，退还出价资金和卖家物品
+func settleEnglishAuction(tx Tx, auction *Auction) (string, []events.Event, error) {
+	leading, err := leadingBid(tx.Auctions(), auction.ID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if leading == nil || leading.Price.LessThan(auction.ReservePrice) {
+		// 流拍：退还出价资金和卖家物品
+		published, err := releaseHeldBids(tx, auction, BidStatusRejected)
+		if err != nil {
+			return "", nil, err
+		}
+		if err = UnlockBackpackItems(tx.Inventory(), auction.SellerID, auction.ItemType, auction.RemainingQuantity); err != nil {
+			return "", nil, fmt.Errorf("退还物品至背包失败: %v", err)
+		}
+		if err = transitionAuction(tx, auction, AuctionStatusCancelled, ActorSystem, "拍卖结束，没有出价或未达到保留价"); err != nil {
+			return "", nil, err
+		}
+		auction.WinnerID = sql.NullInt64{}
+		return "cancelled", append(published, AuctionCancelled{Auction: *auction}), nil
+	}
+
+	// 成交：保证金付给卖家，物品放入买家背包
+	amount, err := leading.Price.Mul(int64(leading.Quantity))
+	if err != nil {
+		return "", nil, fmt.Errorf("计算成交金额失败: %v", err)
+	}
+	entry, err := settleEscrow(tx.Ledger(), leading.UserID, auction, amount)
+	if err != nil {
+		return "", nil, fmt.Errorf("结算失败: %v", err)
+	}
+	if err = UnlockBackpackItems(tx.Inventory(), leading.UserID, auction.ItemType, leading.Quantity); err != nil {
+		return "", nil, fmt.Errorf("更新买家背包失败: %v", err)
+	}
+	if err = tx.Auctions().UpdateBidStatus(leading.ID, BidStatusAccepted); err != nil {
+		return "", nil, fmt.Errorf("更新竞价记录失败: %v", err)
+	}
+	leading.Status = BidStatusAccepted
+	if err = transitionAuction(tx, auction, AuctionStatusCompleted, ActorSystem, "拍卖结束，最高出价成交"); err != nil {
+		return "", nil, err
+	}
+	return "completed", []events.Event{BidAccepted{Bid: *leading, Auction: *auction}, ledgerPosted(entry)}, nil
+}
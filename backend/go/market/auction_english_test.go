@@ -0,0 +1,170 @@
+package market
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 英式拍卖出价的冻结、退还和结算：卖家为玩家1，玩家2和3各有 100.00，
+// 起拍价 1.00、最低加价 0.10，整批竞拍2个苹果
+func TestEnglishAuctionEscrow(t *testing.T) {
+	type testBid struct {
+		bidderID int
+		price    int64 // 出价单价（分）
+		err      error
+	}
+	tests := []struct {
+		name     string
+		reserve  int64
+		bids     []testBid
+		cancel   bool          // 卖家取消而不是到期结算
+		escrow   int64         // 出价后保证金账户的余额
+		status   AuctionStatus // 结束后的拍卖状态
+		balances map[int]int64 // 结束后的玩家余额
+		apples   map[int]int   // 结束后的苹果数量
+	}{
+		{
+			name:     "最高出价成交",
+			bids:     []testBid{{2, 150, nil}, {3, 200, nil}},
+			escrow:   400,
+			status:   AuctionStatusCompleted,
+			balances: map[int]int64{1: 400, 2: 10000, 3: 9600},
+			apples:   map[int]int{1: 0, 2: 0, 3: 2},
+		},
+		{
+			name: "出价规则",
+			bids: []testBid{
+				{2, 99, ErrInvalidArgument},          // 低于起拍价
+				{2, 100, nil},                        // 等于起拍价
+				{2, 200, ErrConflict},                // 已是最高出价者
+				{3, 109, ErrInvalidArgument},         // 不足一个最低加价
+				{3, 6000, cash.ErrInsufficientFunds}, // 冻结 120.00 超过余额
+				{3, 110, nil},                        // 恰好一个最低加价
+			},
+			escrow:   220,
+			status:   AuctionStatusCompleted,
+			balances: map[int]int64{1: 220, 2: 10000, 3: 9780},
+			apples:   map[int]int{1: 0, 2: 0, 3: 2},
+		},
+		{
+			name:     "没有出价流拍",
+			status:   AuctionStatusCancelled,
+			balances: map[int]int64{1: 0, 2: 10000, 3: 10000},
+			apples:   map[int]int{1: 2, 2: 0, 3: 0},
+		},
+		{
+			name:     "未达到保留价流拍",
+			reserve:  300,
+			bids:     []testBid{{2, 150, nil}, {3, 250, nil}},
+			escrow:   500,
+			status:   AuctionStatusCancelled,
+			balances: map[int]int64{1: 0, 2: 10000, 3: 10000},
+			apples:   map[int]int{1: 2, 2: 0, 3: 0},
+		},
+		{
+			name:     "卖家取消退还出价",
+			bids:     []testBid{{2, 150, nil}},
+			cancel:   true,
+			escrow:   300,
+			status:   AuctionStatusCancelled,
+			balances: map[int]int64{1: 0, 2: 10000, 3: 10000},
+			apples:   map[int]int{1: 2, 2: 0, 3: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000, 3: 10000})
+			giveItems(t, storage, 1, "apple", 2)
+			service := NewAuctionService(storage)
+			auction, err := service.Create(context.Background(), 1, CreateAuctionRequest{
+				AuctionType: AuctionTypeEnglish, ItemType: "apple", InitialPrice: money.New(100), MinIncrement: money.New(10),
+				ReservePrice: money.New(tt.reserve), Duration: 60, Quantity: 2,
+			})
+			checkErrorKind(t, err, nil)
+			auction, err = service.Start(context.Background(), 1, auction.ID)
+			checkErrorKind(t, err, nil)
+			t.Cleanup(func() { stopAuctionTimer(auction.ID) })
+
+			for _, bid := range tt.bids {
+				_, _, err := service.Bid(context.Background(), BidRequest{AuctionID: auction.ID, BidderID: bid.bidderID, Price: money.New(bid.price)})
+				checkErrorKind(t, err, bid.err)
+			}
+			// 只有最高出价冻结在保证金账户，被超越和被拒绝的出价不占用资金
+			if got := systemBalanceOf(t, storage, cash.AccountEscrow); got != tt.escrow {
+				t.Errorf("出价后保证金 = %d，期望 %d", got, tt.escrow)
+			}
+
+			if tt.cancel {
+				_, err = service.Cancel(context.Background(), 1, auction.ID)
+				checkErrorKind(t, err, nil)
+			} else {
+				expireAuction(t, storage, auction.ID)
+			}
+
+			auction, err = service.Get(context.Background(), auction.ID)
+			checkErrorKind(t, err, nil)
+			if auction.Status != tt.status {
+				t.Errorf("拍卖状态 = %s，期望 %s", auction.Status, tt.status)
+			}
+			if got := systemBalanceOf(t, storage, cash.AccountEscrow); got != 0 {
+				t.Errorf("结束后保证金 = %d，期望 0", got)
+			}
+			for userID, want := range tt.balances {
+				if got := balanceOf(t, storage, userID); got != want {
+					t.Errorf("玩家%d余额 = %d，期望 %d", userID, got, want)
+				}
+			}
+			for userID, want := range tt.apples {
+				if got := quantityOf(t, storage, userID, "apple"); got != want {
+					t.Errorf("玩家%d的苹果 = %d，期望 %d", userID, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 临近结束时的出价把结束时间顺延到防狙击时长之后，离结束还早的出价不延长
+func TestEnglishAuctionExtension(t *testing.T) {
+	tests := []struct {
+		name      string
+		remaining time.Duration // 出价时离结束的时长
+		extended  bool
+	}{
+		{"临近结束", 5 * time.Second, true},
+		{"离结束还早", time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000})
+			giveItems(t, storage, 1, "apple", 1)
+			service := NewAuctionService(storage)
+			auction, err := service.Create(context.Background(), 1, CreateAuctionRequest{
+				AuctionType: AuctionTypeEnglish, ItemType: "apple", InitialPrice: money.New(100), MinIncrement: money.New(10),
+				Duration: 600, ExtensionSeconds: 30, Quantity: 1,
+			})
+			checkErrorKind(t, err, nil)
+			auction, err = service.Start(context.Background(), 1, auction.ID)
+			checkErrorKind(t, err, nil)
+			t.Cleanup(func() { stopAuctionTimer(auction.ID) })
+			endTime := timeservice.SyncNow().Add(tt.remaining)
+			withTx(t, storage, func(tx Tx) error {
+				auction.EndTime = &endTime
+				return tx.Auctions().UpdateAuction(auction)
+			})
+
+			_, auction, err = service.Bid(context.Background(), BidRequest{AuctionID: auction.ID, BidderID: 2, Price: money.New(100)})
+			checkErrorKind(t, err, nil)
+			if extended := auction.EndTime.Sub(endTime) > time.Second; extended != tt.extended {
+				t.Errorf("结束时间 %s → %s，期望延长 %v", endTime, auction.EndTime, tt.extended)
+			}
+			if tt.extended && auction.EndTime.Sub(timeservice.SyncNow()) < 29*time.Second {
+				t.Errorf("延长后的结束时间 %s 不足防狙击时长", auction.EndTime)
+			}
+		})
+	}
+}
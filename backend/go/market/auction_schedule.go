@@ -0,0 +1,134 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 拍卖下一个预定时刻：待启动的拍卖为预定开始时间（没有时为预定结束时间），
+// 进行中和已暂停的荷兰钟拍卖为预定结束时间。英式拍卖和密封拍卖启动后的结束时间即预定结束时间，由拍卖时钟的结束任务处理
+func nextScheduledTime(auction *Auction) *time.Time {
+	switch auction.Status {
+	case AuctionStatusPending:
+		if auction.ScheduledStart != nil {
+			return auction.ScheduledStart
+		}
+		return auction.ScheduledEnd
+	case AuctionStatusActive, AuctionStatusPaused:
+		if !timedAuction(auction) {
+			return auction.ScheduledEnd
+		}
+	}
+	return nil
+}
+
+// 按拍卖的预定时间安排自动启动或自动结束，已安排的预定时间会被替换
+func scheduleAuction(auction *Auction) {
+	at := nextScheduledTime(auction)
+	if at == nil {
+		return
+	}
+	wait := at.Sub(timeservice.SyncNow())
+	auctionScheduler.arm(clockKey{auction.ID, clockTaskSchedule}, wait)
+
+	logger.Info("auction", fmt.Sprintf("拍卖ID %d 已安排预定时间 %s，%s 后执行\n", auction.ID, at.Format(time.DateTime), FormatDuration(max(wait, 0))))
+}
+
+// 取消拍卖的预定时间
+func stopScheduleTimer(auctionID int) {
+	auctionScheduler.disarm(clockKey{auctionID, clockTaskSchedule})
+}
+
+// 到达预定时刻：启动到预定开始时间的拍卖，结束到预定结束时间的拍卖
+func runScheduledTransition(storage Storage, auctionID int) {
+	service := NewAuctionService(storage)
+	auction, err := service.Get(context.Background(), auctionID)
+	if err != nil {
+		logger.Info("auction", fmt.Sprintf("获取预定拍卖ID %d 失败: %v\n", auctionID, err))
+		return
+	}
+
+	now := timeservice.SyncNow()
+	switch {
+	case auction.Status == AuctionStatusPending && auction.ScheduledStart != nil && !now.Before(*auction.ScheduledStart):
+		// 启动时会安排预定结束时间
+		if _, err = service.StartScheduled(context.Background(), auctionID); err != nil {
+			logger.Info("auction", fmt.Sprintf("按预定时间启动拍卖ID %d 失败: %v\n", auctionID, err))
+		}
+		return
+	case auction.ScheduledEnd != nil && !now.Before(*auction.ScheduledEnd):
+		closed, err := closeScheduledAuction(storage, auctionID)
+		if err != nil {
+			logger.Info("auction", fmt.Sprintf("按预定时间结束拍卖ID %d 失败: %v\n", auctionID, err))
+			return
+		}
+		if closed {
+			logger.Info("auction", fmt.Sprintf("拍卖ID %d 已到预定结束时间，拍卖已结束\n", auctionID))
+		}
+		return
+	}
+
+	// 尚未到达预定时刻（预定时间已被修改），重新等待
+	scheduleAuction(auction)
+}
+
+// 结束到预定结束时间的拍卖：进行中的荷兰钟拍卖按流拍处理，尚未启动和已暂停的拍卖直接结束。
+// 剩余物品退还卖家，已有成交时以已完成结束，否则取消
+func closeScheduledAuction(storage Storage, auctionID int) (bool, error) {
+	tx, err := storage.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	auction, err := tx.Auctions().GetAuction(auctionID)
+	if err != nil {
+		return false, err
+	}
+	if auction.ScheduledEnd == nil || timeservice.SyncNow().Before(*auction.ScheduledEnd) {
+		return false, nil
+	}
+
+	switch {
+	case auction.Status == AuctionStatusActive && !timedAuction(auction):
+		tx.Rollback()
+		stopAuctionTimer(auctionID)
+		return cancelUnsoldAuction(storage, auctionID, auction.CurrentPrice, "到达预定结束时间")
+	case auction.Status != AuctionStatusPending && auction.Status != AuctionStatusPaused:
+		return false, nil
+	}
+
+	unsold := auction.RemainingQuantity
+	if err = UnlockBackpackItems(tx.Inventory(), auction.SellerID, auction.ItemType, unsold); err != nil {
+		return false, fmt.Errorf("退还物品至背包失败: %v", err)
+	}
+	action := AuctionStatusCancelled
+	if unsold < auction.Quantity {
+		action = AuctionStatusCompleted
+	}
+	if err = transitionAuction(tx, auction, action, ActorSystem, "到达预定结束时间"); err != nil {
+		return false, err
+	}
+	auction.PausedAt = nil
+	auction.RemainingQuantity = 0
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return false, fmt.Errorf("更新拍卖状态失败: %v", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, string(action)); err != nil {
+		return false, fmt.Errorf("写入拍卖通知失败: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	if action == AuctionStatusCancelled {
+		events.Publish(AuctionCancelled{Auction: *auction})
+	} else {
+		events.Publish(AuctionClosed{Auction: *auction, Unsold: unsold})
+	}
+	return true, nil
+}
@@ -0,0 +1,140 @@
+package market
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 到达预定时刻时的自动启动和自动结束：卖家为玩家1，拍卖2个苹果，预定时间创建时在一小时后，
+// 执行前改到过去
+func TestScheduledTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		auctionType string
+		start, end  bool                                                // 设置预定开始、结束时间
+		prepare     func(t *testing.T, service *AuctionService, id int) // 到达预定时刻前的操作
+		due         bool                                                // 预定时刻已到
+		status      AuctionStatus
+		sellerItems int // 结束后卖家的苹果
+	}{
+		{name: "到预定开始时间启动", auctionType: AuctionTypeDutch, start: true, due: true, status: AuctionStatusActive},
+		{name: "未到预定开始时间", auctionType: AuctionTypeDutch, start: true, status: AuctionStatusPending},
+		{name: "未启动的拍卖到预定结束时间", auctionType: AuctionTypeDutch, end: true, due: true, status: AuctionStatusCancelled, sellerItems: 2},
+		{
+			name: "进行中的荷兰钟拍卖流拍", auctionType: AuctionTypeDutch, end: true, due: true, status: AuctionStatusCancelled, sellerItems: 2,
+			prepare: startScheduledTestAuction,
+		},
+		{
+			name: "部分成交后到预定结束时间", auctionType: AuctionTypeDutch, end: true, due: true, status: AuctionStatusCompleted, sellerItems: 1,
+			prepare: func(t *testing.T, service *AuctionService, id int) {
+				startScheduledTestAuction(t, service, id)
+				_, _, err := service.Bid(context.Background(), BidRequest{AuctionID: id, BidderID: 2, Price: money.New(1000), Quantity: 1})
+				checkErrorKind(t, err, nil)
+			},
+		},
+		{
+			name: "暂停的拍卖到预定结束时间", auctionType: AuctionTypeDutch, end: true, due: true, status: AuctionStatusCancelled, sellerItems: 2,
+			prepare: func(t *testing.T, service *AuctionService, id int) {
+				startScheduledTestAuction(t, service, id)
+				_, err := service.Pause(context.Background(), 1, id)
+				checkErrorKind(t, err, nil)
+			},
+		},
+		{
+			name: "英式拍卖由拍卖时钟结束", auctionType: AuctionTypeEnglish, end: true, due: true, status: AuctionStatusActive,
+			prepare: startScheduledTestAuction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000})
+			giveItems(t, storage, 1, "apple", 2)
+			service := NewAuctionService(storage)
+
+			later := timeservice.SyncNow().Add(time.Hour)
+			req := CreateAuctionRequest{AuctionType: tt.auctionType, ItemType: "apple", InitialPrice: money.New(1000), Quantity: 2}
+			if tt.auctionType == AuctionTypeDutch {
+				req.MinPrice, req.PriceDecrement, req.DecrementInterval = money.New(500), money.New(100), 60
+			} else {
+				req.MinIncrement = money.New(10)
+			}
+			if tt.start {
+				req.ScheduledStart = &later
+			}
+			if tt.end {
+				req.ScheduledEnd = &later
+			}
+			auction, err := service.Create(context.Background(), 1, req)
+			checkErrorKind(t, err, nil)
+			t.Cleanup(func() {
+				stopAuctionTimer(auction.ID)
+				stopScheduleTimer(auction.ID)
+			})
+			if tt.prepare != nil {
+				tt.prepare(t, service, auction.ID)
+			}
+
+			if tt.due {
+				past := timeservice.SyncNow().Add(-time.Second)
+				withTx(t, storage, func(tx Tx) error {
+					auction, err := tx.Auctions().GetAuction(auction.ID)
+					if err != nil {
+						return err
+					}
+					if auction.ScheduledStart != nil {
+						auction.ScheduledStart = &past
+					}
+					if auction.ScheduledEnd != nil {
+						auction.ScheduledEnd = &past
+					}
+					return tx.Auctions().UpdateAuction(auction)
+				})
+			}
+			runScheduledTransition(storage, auction.ID)
+
+			auction, err = service.Get(context.Background(), auction.ID)
+			checkErrorKind(t, err, nil)
+			if auction.Status != tt.status {
+				t.Errorf("拍卖状态 = %s，期望 %s", auction.Status, tt.status)
+			}
+			if got := quantityOf(t, storage, 1, "apple"); got != tt.sellerItems {
+				t.Errorf("卖家的苹果 = %d，期望 %d", got, tt.sellerItems)
+			}
+		})
+	}
+}
+
+// 卖家手动启动设有预定结束时间的拍卖
+func startScheduledTestAuction(t *testing.T, service *AuctionService, id int) {
+	t.Helper()
+	_, err := service.Start(context.Background(), 1, id)
+	checkErrorKind(t, err, nil)
+}
+
+func TestNextScheduledTime(t *testing.T) {
+	start := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	tests := []struct {
+		name    string
+		auction Auction
+		want    *time.Time
+	}{
+		{"待启动时为预定开始时间", Auction{Status: AuctionStatusPending, ScheduledStart: &start, ScheduledEnd: &end}, &start},
+		{"待启动且只有预定结束时间", Auction{Status: AuctionStatusPending, ScheduledEnd: &end}, &end},
+		{"进行中的荷兰钟拍卖", Auction{AuctionType: AuctionTypeDutch, Status: AuctionStatusActive, ScheduledEnd: &end}, &end},
+		{"暂停的荷兰钟拍卖", Auction{AuctionType: AuctionTypeDutch, Status: AuctionStatusPaused, ScheduledEnd: &end}, &end},
+		{"进行中的英式拍卖", Auction{AuctionType: AuctionTypeEnglish, Status: AuctionStatusActive, ScheduledEnd: &end}, nil},
+		{"已结束", Auction{AuctionType: AuctionTypeDutch, Status: AuctionStatusCompleted, ScheduledEnd: &end}, nil},
+		{"没有预定时间", Auction{Status: AuctionStatusPending}, nil},
+	}
+	for _, tt := range tests {
+		got := nextScheduledTime(&tt.auction)
+		if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+			t.Errorf("%s: 预定时刻 = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
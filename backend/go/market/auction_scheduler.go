@@ -0,0 +1,319 @@
+package market
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 拍卖时钟任务类型，每个拍卖每种任务最多排队一个
+type clockTask int
+
+const (
+	clockTaskTick     clockTask = iota // 荷兰钟价格变化
+	clockTaskClose                     // 英式拍卖和密封拍卖到结束时间
+	clockTaskSchedule                  // 预定开始或结束时间
+)
+
+const (
+	schedulerIdleWait  = time.Hour              // 没有任务时的等待时长，有新任务时会被唤醒
+	schedulerPrecision = 100 * time.Millisecond // 时钟精度，截止时间向上取整，相近的任务合并到同一次处理
+)
+
+type clockKey struct {
+	auctionID int
+	task      clockTask
+}
+
+// 排队中的时钟任务
+type clockEntry struct {
+	key      clockKey
+	deadline time.Time
+	index    int // 在堆中的位置
+}
+
+// 按截止时间排序的最小堆
+type clockQueue []*clockEntry
+
+func (q clockQueue) Len() int           { return len(q) }
+func (q clockQueue) Less(i, j int) bool { return q[i].deadline.Before(q[j].deadline) }
+func (q clockQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *clockQueue) Push(x interface{}) {
+	entry := x.(*clockEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *clockQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	entry.index = -1
+	return entry
+}
+
+// AuctionScheduler 拍卖时钟：所有拍卖的价格变化、结束时间和预定时间放在同一个按截止时间排序的堆中，
+// 由一个协程等待最早的截止时间，到期后批量处理所有到期的任务。
+// 每个拍卖每种任务只保留一个，重新安排会替换原来的截止时间，不会出现重复的定时器
+type AuctionScheduler struct {
+	mutex   sync.Mutex
+	queue   clockQueue
+	entries map[clockKey]*clockEntry
+	wake    chan struct{}
+	storage Storage
+}
+
+// 全局拍卖时钟，启动前安排的任务会在启动后处理
+var auctionScheduler = &AuctionScheduler{
+	entries: make(map[clockKey]*clockEntry),
+	wake:    make(chan struct{}, 1),
+}
+
+// StartAuctionScheduler 启动拍卖时钟协程，服务启动时在恢复拍卖之前调用一次
+func StartAuctionScheduler(storage Storage) {
+	auctionScheduler.mutex.Lock()
+	if auctionScheduler.storage != nil {
+		auctionScheduler.mutex.Unlock()
+		return
+	}
+	auctionScheduler.storage = storage
+	auctionScheduler.mutex.Unlock()
+
+	go auctionScheduler.run()
+	logger.Info("auction", "拍卖时钟已启动\n")
+}
+
+// 在 wait 之后执行任务，已排队的同一任务改为新的截止时间。
+// 截止时间和到期判断都使用同步时间，与拍卖的开始时间、暂停时刻和竞价时间一致
+func (s *AuctionScheduler) arm(key clockKey, wait time.Duration) {
+	deadline := timeservice.SyncNow().Add(max(wait, 0)).Truncate(schedulerPrecision).Add(schedulerPrecision)
+
+	s.mutex.Lock()
+	if entry, exists := s.entries[key]; exists {
+		entry.deadline = deadline
+		heap.Fix(&s.queue, entry.index)
+	} else {
+		entry = &clockEntry{key: key, deadline: deadline}
+		heap.Push(&s.queue, entry)
+		s.entries[key] = entry
+	}
+	first := s.queue[0].key == key
+	s.mutex.Unlock()
+
+	// 新任务成为最早的任务时唤醒时钟协程重新计算等待时长
+	if first {
+		s.notify()
+	}
+}
+
+// 任务没有排队时才安排，用于处理完任务后续期：处理期间其他操作重新安排的任务更新，保留不动
+func (s *AuctionScheduler) armIfAbsent(key clockKey, wait time.Duration) {
+	s.mutex.Lock()
+	_, exists := s.entries[key]
+	s.mutex.Unlock()
+	if !exists {
+		s.arm(key, wait)
+	}
+}
+
+// 取消排队中的任务，返回任务是否存在
+func (s *AuctionScheduler) disarm(key clockKey) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		return false
+	}
+	heap.Remove(&s.queue, entry.index)
+	delete(s.entries, key)
+	return true
+}
+
+func (s *AuctionScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 取出所有截止时间不晚于 now 的任务，按任务类型分组，同一类型内按截止时间先后排列
+func (s *AuctionScheduler) popDue(now time.Time) (map[clockTask][]int, time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	due := make(map[clockTask][]int)
+	for len(s.queue) > 0 && !s.queue[0].deadline.After(now) {
+		entry := heap.Pop(&s.queue).(*clockEntry)
+		delete(s.entries, entry.key)
+		due[entry.key.task] = append(due[entry.key.task], entry.key.auctionID)
+	}
+	if len(s.queue) == 0 {
+		return due, schedulerIdleWait
+	}
+	return due, s.queue[0].deadline.Sub(now)
+}
+
+func (s *AuctionScheduler) run() {
+	// 等待本身使用单调定时器，醒来后按同步时间判断到期
+	timer := time.NewTimer(schedulerIdleWait)
+	defer timer.Stop()
+
+	for {
+		due, wait := s.popDue(timeservice.SyncNow())
+		if len(due) > 0 {
+			s.process(due)
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// 批量处理到期的任务：先处理预定时间（可能启动拍卖），再结束到期的拍卖，最后统一更新荷兰钟价格
+func (s *AuctionScheduler) process(due map[clockTask][]int) {
+	for _, auctionID := range due[clockTaskSchedule] {
+		runScheduledTransition(s.storage, auctionID)
+	}
+	for _, auctionID := range due[clockTaskClose] {
+		closeTimedAuction(s.storage, auctionID)
+	}
+	if auctionIDs := due[clockTaskTick]; len(auctionIDs) > 0 {
+		tickDutchAuctions(s.storage, auctionIDs)
+	}
+}
+
+// 按拍卖类型安排时钟：荷兰钟拍卖等到价格曲线的下一次变化，英式拍卖和密封拍卖等到结束时间
+func startAuctionTimer(auction *Auction) {
+	if timedAuction(auction) {
+		if auction.EndTime == nil {
+			logger.Info("auction", fmt.Sprintf("%sID %d 没有结束时间，不安排结束\n", auctionTypeName(auction), auction.ID))
+			return
+		}
+		wait := auction.EndTime.Sub(timeservice.SyncNow())
+		auctionScheduler.arm(clockKey{auction.ID, clockTaskClose}, wait)
+		logger.Info("auction", fmt.Sprintf("%sID %d 已安排结束，%s 后结束\n", auctionTypeName(auction), auction.ID, FormatDuration(max(wait, 0))))
+		return
+	}
+	wait := decayStrategy(auction).NextChange(clockElapsed(auction, timeservice.SyncNow()))
+	auctionScheduler.arm(clockKey{auction.ID, clockTaskTick}, wait)
+	logger.Info("auction", fmt.Sprintf("荷兰钟拍卖ID %d 已安排价格变化，%s 后价格变化\n", auction.ID, FormatDuration(wait)))
+}
+
+// 取消拍卖的价格变化和结束任务
+func stopAuctionTimer(auctionID int) {
+	ticked := auctionScheduler.disarm(clockKey{auctionID, clockTaskTick})
+	closing := auctionScheduler.disarm(clockKey{auctionID, clockTaskClose})
+	if ticked || closing {
+		logger.Info("auction", fmt.Sprintf("停止拍卖ID %d 的时钟\n", auctionID))
+	}
+}
+
+// 结束到期的英式拍卖或密封拍卖，结束时间被防狙击延长时按新的结束时间重新安排
+func closeTimedAuction(storage Storage, auctionID int) {
+	closed, err := closeAuction(storage, auctionID)
+	if err != nil {
+		logger.Info("auction", fmt.Sprintf("结束拍卖ID %d 失败: %v\n", auctionID, err))
+		return
+	}
+	if closed {
+		logger.Info("auction", fmt.Sprintf("拍卖ID %d 已到结束时间，拍卖已结算\n", auctionID))
+		return
+	}
+
+	current, err := NewAuctionService(storage).Get(context.Background(), auctionID)
+	if err == nil && current.Status == AuctionStatusActive && current.EndTime != nil {
+		auctionScheduler.armIfAbsent(clockKey{auctionID, clockTaskClose}, current.EndTime.Sub(timeservice.SyncNow()))
+	}
+}
+
+// 批量更新到期的荷兰钟拍卖价格：一次读取所有拍卖，价格变化在同一事务中保存并合并为一条价格通知，
+// 降到最低价的拍卖逐个结束，仍在进行的拍卖安排下一次价格变化
+func tickDutchAuctions(storage Storage, auctionIDs []int) {
+	var auctions []*Auction
+	err := view(storage, func(tx Tx) error {
+		for _, auctionID := range auctionIDs {
+			auction, err := tx.Auctions().GetAuction(auctionID)
+			if err != nil {
+				logger.Info("auction", fmt.Sprintf("查询拍卖ID %d 失败: %v\n", auctionID, err))
+				continue
+			}
+			auctions = append(auctions, auction)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Info("auction", fmt.Sprintf("读取到期拍卖失败: %v\n", err))
+		return
+	}
+
+	now := timeservice.SyncNow()
+	var updates []AuctionPriceUpdateMessage
+	var floored []*Auction
+	var running []*Auction
+	for _, auction := range auctions {
+		// 已暂停、已结束的拍卖不再安排，恢复或重新启动时会重新安排
+		if auction.StartTime == nil || auction.Status != AuctionStatusActive || timedAuction(auction) {
+			continue
+		}
+		update, reachedFloor := dutchPriceUpdate(auction, now)
+		if reachedFloor {
+			floored = append(floored, auction)
+			continue
+		}
+		if update != nil {
+			updates = append(updates, *update)
+		}
+		running = append(running, auction)
+	}
+
+	if len(updates) > 0 {
+		if err = saveAuctionPrices(storage, updates); err != nil {
+			logger.Info("auction", fmt.Sprintf("更新拍卖价格失败: %v\n", err))
+		} else {
+			published := make([]events.Event, 0, len(updates))
+			for _, update := range updates {
+				published = append(published, PriceDecremented{
+					AuctionID:     update.AuctionID,
+					OldPrice:      update.OldPrice,
+					NewPrice:      update.NewPrice,
+					TimeRemaining: update.TimeRemaining,
+				})
+			}
+			events.Publish(published...)
+		}
+	}
+
+	for _, auction := range floored {
+		cancelled, err := cancelUnsoldAuction(storage, auction.ID, auction.MinPrice, "价格降到最低价")
+		if err != nil {
+			logger.Info("auction", fmt.Sprintf("取消流拍拍卖ID %d 失败: %v\n", auction.ID, err))
+			continue
+		}
+		if cancelled {
+			logger.Info("auction", fmt.Sprintf("拍卖ID %d 已达到最低价格但无人竞价，拍卖已取消并退还物品\n", auction.ID))
+		}
+	}
+
+	for _, auction := range running {
+		wait := decayStrategy(auction).NextChange(clockElapsed(auction, now))
+		auctionScheduler.armIfAbsent(clockKey{auction.ID, clockTaskTick}, wait)
+	}
+
+	logger.Info("auction", fmt.Sprintf("拍卖时钟处理 %d 个荷兰钟拍卖：价格更新 %d 个，降到最低价 %d 个\n", len(auctionIDs), len(updates), len(floored)))
+}
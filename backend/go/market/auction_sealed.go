@@ -0,0 +1,208 @@
+package market
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/money"
+)
+
+// 密封拍卖开标结果，开标后公开全部出价
+type AuctionSealedResultMessage struct {
+	AuctionID     int          `json:"auctionId"`
+	AuctionType   string       `json:"auctionType"`
+	Sold          bool         `json:"sold"`          // 是否成交，没有出价或未达到保留价时流拍
+	WinnerID      int          `json:"winnerId"`      // 中标玩家ID，流拍时为0
+	ClearingPrice money.Money  `json:"clearingPrice"` // 成交单价，一价拍卖为最高出价，二价拍卖为第二高出价
+	Bids          []AuctionBid `json:"bids"`          // 开标后的全部出价，按出价从高到低
+}
+
+// 密封拍卖（一价或二价）
+func sealedAuction(auction *Auction) bool {
+	return auction.AuctionType == AuctionTypeSealedFirstPrice || auction.AuctionType == AuctionTypeVickrey
+}
+
+// 密封拍卖出价：出价在开标前不公开，每位玩家只能出价一次，不低于起拍价，整批竞拍。
+// 出价资金冻结到开标，拍卖的当前价格不随出价变化
+func placeSealedBid(tx Tx, auction *Auction, req BidRequest) (*AuctionBid, []events.Event, error) {
+	if req.Quantity != 0 && req.Quantity != auction.Quantity {
+		return nil, nil, serviceError(ErrInvalidArgument, "密封拍卖只能整批竞拍 %d 个", auction.Quantity)
+	}
+	if req.Price.LessThan(auction.InitialPrice) {
+		return nil, nil, serviceError(ErrInvalidArgument, "出价不能低于起拍价 %s", auction.InitialPrice)
+	}
+
+	bids, err := tx.Auctions().ListBids(auction.ID)
+	if err != nil {
+		return nil, nil, internalError("获取竞价记录失败", err)
+	}
+	for _, bid := range bids {
+		if bid.UserID == req.BidderID && bid.Status == BidStatusSealed {
+			return nil, nil, serviceError(ErrConflict, "你已提交过密封出价")
+		}
+	}
+
+	// 冻结出价资金
+	amount, err := req.Price.Mul(int64(auction.Quantity))
+	if err != nil {
+		return nil, nil, serviceError(ErrInvalidArgument, "出价金额超出范围")
+	}
+	_, err = holdBidFunds(tx.Ledger(), req.BidderID, auction, amount)
+	if errors.Is(err, cash.ErrInsufficientFunds) {
+		return nil, nil, serviceError(cash.ErrInsufficientFunds, "余额不足")
+	}
+	if err != nil {
+		return nil, nil, internalError("冻结出价资金失败", err)
+	}
+
+	bid := &AuctionBid{
+		AuctionID:         auction.ID,
+		UserID:            req.BidderID,
+		Price:             req.Price,
+		Quantity:          auction.Quantity,
+		RequestedQuantity: auction.Quantity,
+		Status:            BidStatusSealed,
+	}
+	if err = tx.Auctions().CreateBid(bid); err != nil {
+		return nil, nil, internalError("插入竞价记录失败", err)
+	}
+
+	// 出价金额在开标前不进入事件和日志，冻结分录的事件留到开标或取消时发布
+	return bid, []events.Event{SealedBidSubmitted{AuctionID: auction.ID, BidID: bid.ID, UserID: req.BidderID}}, nil
+}
+
+// 密封拍卖出价时没有发布的冻结分录事件，在开标或取消时从账本中取出，排在退还和结算的分录之前发布
+func sealedHoldEvents(tx Tx, auction *Auction) ([]events.Event, error) {
+	entries, err := tx.Ledger().JournalEntries(cash.EntryKindAuctionHold, bidHoldNote(auction))
+	if err != nil {
+		return nil, internalError("获取出价冻结分录失败", err)
+	}
+	published := make([]events.Event, 0, len(entries))
+	for i := range entries {
+		published = append(published, ledgerPosted(&entries[i]))
+	}
+	return published, nil
+}
+
+// 开标并结算到期的密封拍卖：出价从高到低排列，出价相同时先出价者优先。
+// 最高出价达到保留价时成交，一价拍卖按最高出价、二价拍卖按第二高出价（不低于起拍价和保留价）付款，
+// 多冻结的部分退还中标者；落选的出价全部退还。没有出价或未达到保留价时流拍，物品退还卖家。
+// 开标结果连同全部出价通过发件箱广播
+func settleSealedAuction(tx Tx, auction *Auction) (string, []events.Event, error) {
+	all, err := tx.Auctions().ListBids(auction.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	var bids []AuctionBid
+	for _, bid := range all {
+		if bid.Status == BidStatusSealed {
+			bids = append(bids, bid)
+		}
+	}
+	sort.SliceStable(bids, func(i, j int) bool {
+		if !bids[i].Price.Equal(bids[j].Price) {
+			return bids[i].Price.GreaterThan(bids[j].Price)
+		}
+		return bids[i].ID < bids[j].ID
+	})
+
+	result := AuctionSealedResultMessage{AuctionID: auction.ID, AuctionType: auction.AuctionType}
+	published, err := sealedHoldEvents(tx, auction)
+	if err != nil {
+		return "", nil, err
+	}
+	action := "cancelled"
+
+	if len(bids) == 0 || bids[0].Price.LessThan(auction.ReservePrice) {
+		// 流拍：退还全部出价和卖家物品
+		for i := range bids {
+			entry, err := releaseBid(tx, auction, &bids[i], BidStatusRejected)
+			if err != nil {
+				return "", nil, err
+			}
+			published = append(published, ledgerPosted(entry))
+		}
+		if err = UnlockBackpackItems(tx.Inventory(), auction.SellerID, auction.ItemType, auction.RemainingQuantity); err != nil {
+			return "", nil, fmt.Errorf("退还物品至背包失败: %v", err)
+		}
+		if err = transitionAuction(tx, auction, AuctionStatusCancelled, ActorSystem, "开标流拍，没有出价或未达到保留价"); err != nil {
+			return "", nil, err
+		}
+		auction.WinnerID = sql.NullInt64{}
+		published = append(published, AuctionCancelled{Auction: *auction})
+	} else {
+		winner := &bids[0]
+		clearingPrice := winner.Price
+		if auction.AuctionType == AuctionTypeVickrey {
+			secondPrice := auction.InitialPrice
+			if len(bids) > 1 {
+				secondPrice = bids[1].Price
+			}
+			clearingPrice = money.Max(secondPrice, auction.ReservePrice)
+		}
+
+		// 中标者按成交价付款，多冻结的部分退还
+		amount, err := clearingPrice.Mul(int64(winner.Quantity))
+		if err != nil {
+			return "", nil, fmt.Errorf("计算成交金额失败: %v", err)
+		}
+		entry, err := settleEscrow(tx.Ledger(), winner.UserID, auction, amount)
+		if err != nil {
+			return "", nil, fmt.Errorf("结算失败: %v", err)
+		}
+		published = append(published, ledgerPosted(entry))
+		refund, err := winner.Price.Sub(clearingPrice)
+		if err != nil {
+			return "", nil, fmt.Errorf("计算退还金额失败: %v", err)
+		}
+		if refund.IsPositive() {
+			amount, err = refund.Mul(int64(winner.Quantity))
+			if err != nil {
+				return "", nil, fmt.Errorf("计算退还金额失败: %v", err)
+			}
+			entry, err = releaseBidFunds(tx.Ledger(), winner.UserID, auction, amount)
+			if err != nil {
+				return "", nil, fmt.Errorf("退还多冻结的出价资金失败: %v", err)
+			}
+			published = append(published, ledgerPosted(entry))
+		}
+		if err = UnlockBackpackItems(tx.Inventory(), winner.UserID, auction.ItemType, winner.Quantity); err != nil {
+			return "", nil, fmt.Errorf("更新买家背包失败: %v", err)
+		}
+		if err = tx.Auctions().UpdateBidStatus(winner.ID, BidStatusAccepted); err != nil {
+			return "", nil, fmt.Errorf("更新竞价记录失败: %v", err)
+		}
+		winner.Status = BidStatusAccepted
+
+		// 落选的出价全部退还
+		for i := 1; i < len(bids); i++ {
+			entry, err := releaseBid(tx, auction, &bids[i], BidStatusOutbid)
+			if err != nil {
+				return "", nil, err
+			}
+			published = append(published, ledgerPosted(entry))
+		}
+
+		action = "completed"
+		if err = transitionAuction(tx, auction, AuctionStatusCompleted, ActorSystem, "开标成交"); err != nil {
+			return "", nil, err
+		}
+		auction.CurrentPrice = clearingPrice
+		auction.WinnerID = sql.NullInt64{Int64: int64(winner.UserID), Valid: true}
+		result.Sold = true
+		result.WinnerID = winner.UserID
+		result.ClearingPrice = clearingPrice
+		published = append(published, BidAccepted{Bid: *winner, Auction: *auction})
+	}
+
+	result.Bids = bids
+	if err = enqueueOutbox(tx, OutboxAuctionSealedResult, result); err != nil {
+		return "", nil, fmt.Errorf("写入开标通知失败: %v", err)
+	}
+	published = append(published, SealedBidsRevealed{Auction: *auction, Bids: bids, ClearingPrice: result.ClearingPrice})
+	return action, published, nil
+}
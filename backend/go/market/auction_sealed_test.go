@@ -0,0 +1,283 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 记录全局事件总线上发布的事件。总线不能取消订阅，测试结束后只停止记录
+func recordEvents(t *testing.T) func() []events.Event {
+	var mutex sync.Mutex
+	var recorded []events.Event
+	active := true
+	events.SubscribeAll(func(event events.Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if active {
+			recorded = append(recorded, event)
+		}
+	})
+	t.Cleanup(func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		active = false
+	})
+	return func() []events.Event {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]events.Event(nil), recorded...)
+	}
+}
+
+// 创建并启动一个数量为2、起拍价 1.00 的密封拍卖，卖家为玩家1
+func startTestSealedAuction(t *testing.T, storage *MemoryStorage, auctionType string, reserve int64) *Auction {
+	t.Helper()
+	giveItems(t, storage, 1, "apple", 2)
+	service := NewAuctionService(storage)
+	auction, err := service.Create(context.Background(), 1, CreateAuctionRequest{
+		AuctionType:  auctionType,
+		ItemType:     "apple",
+		InitialPrice: money.New(100),
+		ReservePrice: money.New(reserve),
+		Duration:     60,
+		Quantity:     2,
+	})
+	checkErrorKind(t, err, nil)
+	auction, err = service.Start(context.Background(), 1, auction.ID)
+	checkErrorKind(t, err, nil)
+	t.Cleanup(func() { stopAuctionTimer(auction.ID) })
+	return auction
+}
+
+// 把拍卖的结束时间改到过去，再按到期处理结束拍卖
+func expireAuction(t *testing.T, storage Storage, auctionID int) {
+	t.Helper()
+	withTx(t, storage, func(tx Tx) error {
+		auction, err := tx.Auctions().GetAuction(auctionID)
+		if err != nil {
+			return err
+		}
+		ended := timeservice.SyncNow().Add(-time.Second)
+		auction.EndTime = &ended
+		return tx.Auctions().UpdateAuction(auction)
+	})
+	closed, err := closeAuction(storage, auctionID)
+	if err != nil || !closed {
+		t.Fatalf("结束拍卖 = %v, %v，期望结束", closed, err)
+	}
+}
+
+// 开标前发布的事件（会被 main 中的 logEvent 写入日志）不包含出价金额，
+// 出价冻结的分录在开标时与结算分录一起发布
+func TestSealedBidEventsHidePrice(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000, 3: 10000})
+	auction := startTestSealedAuction(t, storage, AuctionTypeVickrey, 0)
+	service := NewAuctionService(storage)
+	recorded := recordEvents(t)
+
+	// 出价单价和冻结总额：玩家2 12.34 x2 = 24.68，玩家3 11.11 x2 = 22.22
+	secrets := []string{"12.34", "24.68", "11.11", "22.22"}
+	for _, bid := range []struct {
+		bidderID int
+		price    int64
+	}{{2, 1234}, {3, 1111}} {
+		_, _, err := service.Bid(context.Background(), BidRequest{AuctionID: auction.ID, BidderID: bid.bidderID, Price: money.New(bid.price)})
+		checkErrorKind(t, err, nil)
+	}
+
+	beforeReveal := recorded()
+	if len(beforeReveal) == 0 {
+		t.Fatal("出价后没有发布事件")
+	}
+	for _, event := range beforeReveal {
+		data, err := json.Marshal(event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range secrets {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("开标前的事件 %s 包含出价金额 %s: %s", event.EventName(), secret, data)
+			}
+		}
+	}
+
+	expireAuction(t, storage, auction.ID)
+	var holds []int64
+	for _, event := range recorded()[len(beforeReveal):] {
+		if posted, ok := event.(cash.LedgerPosted); ok && posted.Entry.Kind == cash.EntryKindAuctionHold {
+			holds = append(holds, posted.Entry.Postings[0].Debit.Minor())
+		}
+	}
+	if len(holds) != 2 || holds[0] != 2468 || holds[1] != 2222 {
+		t.Errorf("开标时发布的冻结分录 = %v，期望 [2468 2222]", holds)
+	}
+}
+
+// 密封拍卖的出价冻结、开标结算和退还：卖家为玩家1，玩家2、3、4各有 100.00，
+// 起拍价 1.00，整批竞拍2个苹果
+func TestSealedAuctionSettlement(t *testing.T) {
+	type testBid struct {
+		bidderID int
+		price    int64 // 出价单价（分）
+		err      error
+	}
+	tests := []struct {
+		name        string
+		auctionType string
+		reserve     int64
+		bids        []testBid
+		cancel      bool // 卖家在开标前取消
+		escrow      int64
+		status      AuctionStatus
+		winnerID    int
+		balances    map[int]int64 // 结束后的玩家余额
+		apples      map[int]int   // 结束后的苹果数量
+	}{
+		{
+			name:        "一价拍卖按最高出价成交",
+			auctionType: AuctionTypeSealedFirstPrice,
+			bids:        []testBid{{2, 150, nil}, {3, 200, nil}, {4, 120, nil}},
+			escrow:      940,
+			status:      AuctionStatusCompleted,
+			winnerID:    3,
+			balances:    map[int]int64{1: 400, 2: 10000, 3: 9600, 4: 10000},
+			apples:      map[int]int{1: 0, 3: 2},
+		},
+		{
+			name:        "二价拍卖按第二高出价成交",
+			auctionType: AuctionTypeVickrey,
+			bids:        []testBid{{2, 150, nil}, {3, 200, nil}, {4, 120, nil}},
+			escrow:      940,
+			status:      AuctionStatusCompleted,
+			winnerID:    3,
+			balances:    map[int]int64{1: 300, 2: 10000, 3: 9700, 4: 10000},
+			apples:      map[int]int{1: 0, 3: 2},
+		},
+		{
+			name:        "二价拍卖只有一个出价时按起拍价成交",
+			auctionType: AuctionTypeVickrey,
+			bids:        []testBid{{2, 150, nil}},
+			escrow:      300,
+			status:      AuctionStatusCompleted,
+			winnerID:    2,
+			balances:    map[int]int64{1: 200, 2: 9800},
+			apples:      map[int]int{1: 0, 2: 2},
+		},
+		{
+			name:        "二价拍卖成交价不低于保留价",
+			auctionType: AuctionTypeVickrey,
+			reserve:     180,
+			bids:        []testBid{{2, 150, nil}, {3, 200, nil}},
+			escrow:      700,
+			status:      AuctionStatusCompleted,
+			winnerID:    3,
+			balances:    map[int]int64{1: 360, 2: 10000, 3: 9640},
+			apples:      map[int]int{1: 0, 3: 2},
+		},
+		{
+			name:        "出价相同时先出价者中标",
+			auctionType: AuctionTypeSealedFirstPrice,
+			bids:        []testBid{{2, 150, nil}, {3, 150, nil}},
+			escrow:      600,
+			status:      AuctionStatusCompleted,
+			winnerID:    2,
+			balances:    map[int]int64{1: 300, 2: 9700, 3: 10000},
+			apples:      map[int]int{1: 0, 2: 2},
+		},
+		{
+			name:        "出价规则",
+			auctionType: AuctionTypeSealedFirstPrice,
+			bids: []testBid{
+				{2, 99, ErrInvalidArgument},          // 低于起拍价
+				{2, 150, nil},                        // 出价
+				{2, 200, ErrConflict},                // 每位玩家只能出价一次
+				{3, 6000, cash.ErrInsufficientFunds}, // 冻结 120.00 超过余额
+			},
+			escrow:   300,
+			status:   AuctionStatusCompleted,
+			winnerID: 2,
+			balances: map[int]int64{1: 300, 2: 9700, 3: 10000},
+			apples:   map[int]int{1: 0, 2: 2},
+		},
+		{
+			name:        "未达到保留价流拍",
+			auctionType: AuctionTypeVickrey,
+			reserve:     250,
+			bids:        []testBid{{2, 150, nil}, {3, 200, nil}},
+			escrow:      700,
+			status:      AuctionStatusCancelled,
+			balances:    map[int]int64{1: 0, 2: 10000, 3: 10000},
+			apples:      map[int]int{1: 2, 2: 0, 3: 0},
+		},
+		{
+			name:        "没有出价流拍",
+			auctionType: AuctionTypeSealedFirstPrice,
+			status:      AuctionStatusCancelled,
+			balances:    map[int]int64{1: 0},
+			apples:      map[int]int{1: 2},
+		},
+		{
+			name:        "卖家取消退还出价",
+			auctionType: AuctionTypeVickrey,
+			bids:        []testBid{{2, 150, nil}, {3, 200, nil}},
+			cancel:      true,
+			escrow:      700,
+			status:      AuctionStatusCancelled,
+			balances:    map[int]int64{1: 0, 2: 10000, 3: 10000},
+			apples:      map[int]int{1: 2, 2: 0, 3: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 0, 2: 10000, 3: 10000, 4: 10000})
+			auction := startTestSealedAuction(t, storage, tt.auctionType, tt.reserve)
+			service := NewAuctionService(storage)
+
+			for _, bid := range tt.bids {
+				_, _, err := service.Bid(context.Background(), BidRequest{AuctionID: auction.ID, BidderID: bid.bidderID, Price: money.New(bid.price)})
+				checkErrorKind(t, err, bid.err)
+			}
+			if got := systemBalanceOf(t, storage, cash.AccountEscrow); got != tt.escrow {
+				t.Errorf("开标前保证金 = %d，期望 %d", got, tt.escrow)
+			}
+
+			if tt.cancel {
+				_, err := service.Cancel(context.Background(), 1, auction.ID)
+				checkErrorKind(t, err, nil)
+			} else {
+				expireAuction(t, storage, auction.ID)
+			}
+
+			var closed *Auction
+			view(storage, func(tx Tx) (err error) {
+				closed, err = tx.Auctions().GetAuction(auction.ID)
+				return err
+			})
+			if closed.Status != tt.status || int(closed.WinnerID.Int64) != tt.winnerID {
+				t.Errorf("拍卖 = %s 中标玩家 %d，期望 %s 中标玩家 %d", closed.Status, closed.WinnerID.Int64, tt.status, tt.winnerID)
+			}
+			if got := systemBalanceOf(t, storage, cash.AccountEscrow); got != 0 {
+				t.Errorf("结束后保证金 = %d，期望 0", got)
+			}
+			for userID, want := range tt.balances {
+				if got := balanceOf(t, storage, userID); got != want {
+					t.Errorf("玩家%d余额 = %d，期望 %d", userID, got, want)
+				}
+			}
+			for userID, want := range tt.apples {
+				if got := quantityOf(t, storage, userID, "apple"); got != want {
+					t.Errorf("玩家%d的苹果 = %d，期望 %d", userID, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,828 @@
+package market
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// AuctionService 拍卖业务（荷兰钟拍卖、英式拍卖和密封拍卖）：创建、启动、竞价、取消、暂停和重新激活
+type AuctionService struct {
+	storage Storage
+}
+
+// NewAuctionService 创建拍卖业务服务
+func NewAuctionService(storage Storage) *AuctionService {
+	return &AuctionService{storage: storage}
+}
+
+// CreateAuctionRequest 创建拍卖的参数
+type CreateAuctionRequest struct {
+	AuctionType       string      `json:"auctionType"`       // 拍卖类型：dutch（默认）, english, sealed_first, vickrey
+	ItemType          string      `json:"itemType"`          // 物品类型
+	InitialPrice      money.Money `json:"initialPrice"`      // 初始价格（英式拍卖和密封拍卖为起拍价）
+	MinPrice          money.Money `json:"minPrice"`          // 最低价格（仅荷兰钟拍卖）
+	ReservePrice      money.Money `json:"reservePrice"`      // 保留价（不公开），省略或为0表示不设
+	PriceDecrement    money.Money `json:"priceDecrement"`    // 价格递减量（仅荷兰钟拍卖）
+	DecrementInterval int         `json:"decrementInterval"` // 价格递减间隔（秒，仅荷兰钟拍卖）
+	DecayCurve        string      `json:"decayCurve"`        // 价格曲线（仅荷兰钟拍卖）：linear（默认）, exponential, stepwise, accelerating
+	DecayRate         float64     `json:"decayRate"`         // 曲线百分比：指数曲线每个间隔的降幅，加速曲线每个间隔降幅的增长
+	DecaySteps        []DecayStep `json:"decaySteps"`        // 阶梯曲线的点位，按时间偏移升序，最后一个点位的价格为最低价格
+	MinIncrement      money.Money `json:"minIncrement"`      // 最低加价（仅英式拍卖）
+	Duration          int         `json:"duration"`          // 持续时长（秒，英式拍卖和密封拍卖），密封拍卖为出价窗口
+	ExtensionSeconds  int         `json:"extensionSeconds"`  // 防狙击延长时长（秒，仅英式拍卖），0 表示不延长
+	Quantity          int         `json:"quantity"`          // 数量
+	ScheduledStart    *time.Time  `json:"scheduled_start"`   // 预定开始时间，省略时由卖家手动启动
+	ScheduledEnd      *time.Time  `json:"scheduled_end"`     // 预定结束时间，省略时按拍卖规则结束；英式拍卖和密封拍卖设置后代替持续时长
+}
+
+// BidRequest 竞价参数
+type BidRequest struct {
+	AuctionID int         // 拍卖ID
+	BidderID  int         // 竞价玩家ID
+	Price     money.Money // 荷兰钟拍卖为愿意支付的最高单价，不低于当前价格时按当前价格成交；英式拍卖和密封拍卖为出价单价
+	Quantity  int         // 买入数量，0 表示买下全部剩余；英式拍卖和密封拍卖只能整批竞拍
+}
+
+// 在事务中读取拍卖，拍卖ID无效或不存在时返回业务错误
+func loadAuction(tx Tx, auctionID int) (*Auction, error) {
+	if auctionID <= 0 {
+		return nil, serviceError(ErrInvalidArgument, "拍卖ID无效")
+	}
+	auction, err := tx.Auctions().GetAuction(auctionID)
+	if errors.Is(err, ErrAuctionNotFound) {
+		return nil, serviceError(ErrAuctionNotFound, "拍卖不存在")
+	}
+	if err != nil {
+		return nil, internalError("数据库查询失败", err)
+	}
+	return auction, nil
+}
+
+// 只有卖家本人可以操作自己的拍卖，action 为操作名称
+func checkSeller(auction *Auction, userID int, action string) error {
+	if auction.SellerID != userID {
+		return serviceError(ErrForbidden, "只有卖家本人可以%s拍卖", action)
+	}
+	return nil
+}
+
+// 校验荷兰钟拍卖的参数
+func validateDutchAuction(req CreateAuctionRequest) error {
+	if !req.InitialPrice.IsPositive() || req.MinPrice.IsNegative() {
+		return serviceError(ErrInvalidArgument, "初始价格必须为正数，最低价格不能为负数")
+	}
+	if req.InitialPrice.LessThan(req.MinPrice) {
+		return serviceError(ErrInvalidArgument, "初始价格必须大于或等于最低价格")
+	}
+	if !req.ReservePrice.IsZero() && (req.ReservePrice.LessThan(req.MinPrice) || req.ReservePrice.GreaterThan(req.InitialPrice)) {
+		return serviceError(ErrInvalidArgument, "保留价必须在最低价格和初始价格之间")
+	}
+	if req.DecayCurve == DecayCurveStepwise {
+		return validateDecaySteps(req)
+	}
+	if req.DecrementInterval <= 0 {
+		return serviceError(ErrInvalidArgument, "价格递减间隔必须为正数")
+	}
+	switch req.DecayCurve {
+	case DecayCurveLinear:
+		if !req.PriceDecrement.IsPositive() {
+			return serviceError(ErrInvalidArgument, "价格递减量必须为正数")
+		}
+	case DecayCurveExponential:
+		if req.DecayRate <= 0 || req.DecayRate >= 100 {
+			return serviceError(ErrInvalidArgument, "指数曲线每个间隔的降幅必须在 0 到 100%% 之间")
+		}
+	case DecayCurveAccelerating:
+		if !req.PriceDecrement.IsPositive() {
+			return serviceError(ErrInvalidArgument, "价格递减量必须为正数")
+		}
+		if req.DecayRate <= 0 {
+			return serviceError(ErrInvalidArgument, "加速曲线降幅的增长必须为正数")
+		}
+	default:
+		return serviceError(ErrInvalidArgument, "无效的价格曲线")
+	}
+	return nil
+}
+
+// 校验阶梯曲线的点位：时间偏移为正且递增，价格不升且在最低价格和初始价格之间，最后一个点位降到最低价格
+func validateDecaySteps(req CreateAuctionRequest) error {
+	if len(req.DecaySteps) == 0 {
+		return serviceError(ErrInvalidArgument, "阶梯曲线至少需要一个点位")
+	}
+	offset, price := 0, req.InitialPrice
+	for _, step := range req.DecaySteps {
+		if step.Offset <= offset {
+			return serviceError(ErrInvalidArgument, "阶梯曲线的时间偏移必须为正数且逐个递增")
+		}
+		if step.Price.GreaterThan(price) || step.Price.LessThan(req.MinPrice) {
+			return serviceError(ErrInvalidArgument, "阶梯曲线的价格不能上升，且必须在最低价格和初始价格之间")
+		}
+		offset, price = step.Offset, step.Price
+	}
+	if !price.Equal(req.MinPrice) {
+		return serviceError(ErrInvalidArgument, "阶梯曲线最后一个点位的价格必须等于最低价格")
+	}
+	return nil
+}
+
+// 校验英式拍卖的参数
+func validateEnglishAuction(req CreateAuctionRequest) error {
+	if !req.InitialPrice.IsPositive() || !req.MinIncrement.IsPositive() {
+		return serviceError(ErrInvalidArgument, "起拍价和最低加价必须为正数")
+	}
+	if !req.ReservePrice.IsZero() && req.ReservePrice.LessThan(req.InitialPrice) {
+		return serviceError(ErrInvalidArgument, "保留价不能低于起拍价")
+	}
+	if req.Duration <= 0 && req.ScheduledEnd == nil {
+		return serviceError(ErrInvalidArgument, "拍卖持续时长必须为正数")
+	}
+	if req.ExtensionSeconds < 0 {
+		return serviceError(ErrInvalidArgument, "防狙击延长时长不能为负数")
+	}
+	return nil
+}
+
+// 校验密封拍卖的参数
+func validateSealedAuction(req CreateAuctionRequest) error {
+	if !req.InitialPrice.IsPositive() {
+		return serviceError(ErrInvalidArgument, "起拍价必须为正数")
+	}
+	if !req.ReservePrice.IsZero() && req.ReservePrice.LessThan(req.InitialPrice) {
+		return serviceError(ErrInvalidArgument, "保留价不能低于起拍价")
+	}
+	if req.Duration <= 0 && req.ScheduledEnd == nil {
+		return serviceError(ErrInvalidArgument, "出价窗口时长必须为正数")
+	}
+	return nil
+}
+
+// 校验预定时间：开始时间晚于当前时间，结束时间晚于开始时间（未预定开始时晚于当前时间）
+func validateSchedule(req CreateAuctionRequest) error {
+	earliest := timeservice.SyncNow()
+	if req.ScheduledStart != nil {
+		if !req.ScheduledStart.After(earliest) {
+			return serviceError(ErrInvalidArgument, "预定开始时间必须晚于当前时间")
+		}
+		earliest = *req.ScheduledStart
+	}
+	if req.ScheduledEnd != nil && !req.ScheduledEnd.After(earliest) {
+		return serviceError(ErrInvalidArgument, "预定结束时间必须晚于开始时间和当前时间")
+	}
+	return nil
+}
+
+// Create 创建待启动的拍卖，拍卖物品从卖家背包中锁定。
+// 设置了预定开始时间的拍卖到时自动启动，设置了预定结束时间的拍卖到时自动结束
+func (s *AuctionService) Create(ctx context.Context, sellerID int, req CreateAuctionRequest) (*Auction, error) {
+	if req.Quantity <= 0 {
+		return nil, serviceError(ErrInvalidArgument, "数量必须为正数")
+	}
+	if err := validateSchedule(req); err != nil {
+		return nil, err
+	}
+	var err error
+	switch req.AuctionType {
+	case "", AuctionTypeDutch:
+		req.AuctionType = AuctionTypeDutch
+		if req.DecayCurve == "" {
+			req.DecayCurve = DecayCurveLinear
+		}
+		// 只保留所选曲线用到的参数
+		switch req.DecayCurve {
+		case DecayCurveLinear:
+			req.DecayRate, req.DecaySteps = 0, nil
+		case DecayCurveExponential:
+			req.PriceDecrement, req.DecaySteps = money.Money{}, nil
+		case DecayCurveAccelerating:
+			req.DecaySteps = nil
+		case DecayCurveStepwise:
+			req.PriceDecrement, req.DecrementInterval, req.DecayRate = money.Money{}, 0, 0
+		}
+		err = validateDutchAuction(req)
+	case AuctionTypeEnglish:
+		// 英式拍卖没有钟面递减，最低价格即起拍价
+		req.MinPrice = req.InitialPrice
+		req.PriceDecrement, req.DecrementInterval = money.Money{}, 0
+		err = validateEnglishAuction(req)
+	case AuctionTypeSealedFirstPrice, AuctionTypeVickrey:
+		// 密封拍卖没有钟面递减和公开加价，最低价格即起拍价
+		req.MinPrice = req.InitialPrice
+		req.PriceDecrement, req.DecrementInterval = money.Money{}, 0
+		req.MinIncrement, req.ExtensionSeconds = money.Money{}, 0
+		err = validateSealedAuction(req)
+	default:
+		err = serviceError(ErrInvalidArgument, "无效的拍卖类型")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	published, err := LockBackpackItems(tx, sellerID, req.ItemType, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	auction := &Auction{
+		AuctionType:       req.AuctionType,
+		ItemType:          req.ItemType,
+		InitialPrice:      req.InitialPrice,
+		CurrentPrice:      req.InitialPrice,
+		MinPrice:          req.MinPrice,
+		ReservePrice:      req.ReservePrice,
+		PriceDecrement:    req.PriceDecrement,
+		DecrementInterval: req.DecrementInterval,
+		DecayCurve:        req.DecayCurve,
+		DecayRate:         req.DecayRate,
+		DecaySteps:        req.DecaySteps,
+		MinIncrement:      req.MinIncrement,
+		Duration:          req.Duration,
+		ExtensionSeconds:  req.ExtensionSeconds,
+		Quantity:          req.Quantity,
+		RemainingQuantity: req.Quantity,
+		Status:            AuctionStatusPending,
+		SellerID:          sellerID,
+		ScheduledStart:    req.ScheduledStart,
+		ScheduledEnd:      req.ScheduledEnd,
+	}
+	if err = tx.Auctions().CreateAuction(auction); err != nil {
+		return nil, internalError("插入拍卖记录失败", err)
+	}
+	if err = recordAuctionEvent(tx, auction.ID, "", AuctionStatusPending, userActor(sellerID), "卖家创建拍卖"); err != nil {
+		return nil, err
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "created"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(published...)
+	events.Publish(AuctionCreated{Auction: *auction})
+
+	logger.Info("auction", fmt.Sprintf("创建%s成功，ID: %d，物品类型: %s，数量: %d\n", auctionTypeName(auction), auction.ID, auction.ItemType, auction.Quantity))
+
+	// 安排预定的开始或结束时间
+	scheduleAuction(auction)
+	return auction, nil
+}
+
+// Get 获取拍卖
+func (s *AuctionService) Get(ctx context.Context, auctionID int) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return loadAuction(tx, auctionID)
+}
+
+// Bids 获取拍卖的竞价记录，按出价先后排列。未开标的密封出价只返回给出价者本人
+func (s *AuctionService) Bids(ctx context.Context, auctionID, viewerID int) ([]AuctionBid, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bids, err := tx.Auctions().ListBids(auctionID)
+	if err != nil {
+		return nil, internalError("获取竞价记录失败", err)
+	}
+	visible := make([]AuctionBid, 0, len(bids))
+	for _, bid := range bids {
+		if bid.Status == BidStatusSealed && bid.UserID != viewerID {
+			continue
+		}
+		visible = append(visible, bid)
+	}
+	return visible, nil
+}
+
+// History 获取拍卖的状态变化记录，按发生先后排列
+func (s *AuctionService) History(ctx context.Context, auctionID int) ([]AuctionEvent, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = loadAuction(tx, auctionID); err != nil {
+		return nil, err
+	}
+	auctionEvents, err := tx.Auctions().ListEvents(auctionID)
+	if err != nil {
+		return nil, internalError("获取拍卖状态记录失败", err)
+	}
+	return auctionEvents, nil
+}
+
+// List 获取所有拍卖，最新创建的在前
+func (s *AuctionService) List(ctx context.Context) ([]Auction, error) {
+	return s.list(ctx, AuctionFilter{})
+}
+
+// ListBySeller 获取卖家发布的拍卖
+func (s *AuctionService) ListBySeller(ctx context.Context, sellerID int) ([]Auction, error) {
+	return s.list(ctx, AuctionFilter{SellerID: sellerID})
+}
+
+// Active 获取待启动、进行中和已暂停的拍卖
+func (s *AuctionService) Active(ctx context.Context) ([]Auction, error) {
+	return s.list(ctx, AuctionFilter{Statuses: []AuctionStatus{AuctionStatusPending, AuctionStatusActive, AuctionStatusPaused}})
+}
+
+func (s *AuctionService) list(ctx context.Context, filter AuctionFilter) ([]Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auctions, err := tx.Auctions().ListAuctions(filter)
+	if err != nil {
+		return nil, internalError("数据库查询失败", err)
+	}
+	return auctions, nil
+}
+
+// Start 启动待启动的拍卖。荷兰钟拍卖价格从初始价格开始按间隔递减，
+// 英式拍卖从起拍价开始接受出价直到结束时间，密封拍卖在出价窗口内接受出价、到时开标
+func (s *AuctionService) Start(ctx context.Context, sellerID, auctionID int) (*Auction, error) {
+	return s.start(ctx, auctionID, userActor(sellerID), "卖家启动拍卖", func(auction *Auction) error {
+		return checkSeller(auction, sellerID, "启动")
+	})
+}
+
+// StartScheduled 在预定开始时间自动启动拍卖，未到预定开始时间时返回冲突错误
+func (s *AuctionService) StartScheduled(ctx context.Context, auctionID int) (*Auction, error) {
+	return s.start(ctx, auctionID, ActorSystem, "到达预定开始时间", func(auction *Auction) error {
+		if auction.ScheduledStart == nil || timeservice.SyncNow().Before(*auction.ScheduledStart) {
+			return serviceError(ErrConflict, "拍卖未到预定开始时间")
+		}
+		return nil
+	})
+}
+
+// 启动拍卖，check 在事务中检查是否允许启动，actor 和 reason 记入状态变化记录
+func (s *AuctionService) start(ctx context.Context, auctionID int, actor, reason string, check func(*Auction) error) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = check(auction); err != nil {
+		return nil, err
+	}
+	// 已暂停的拍卖只能恢复，不能重新启动
+	if auction.Status != AuctionStatusPending {
+		return nil, serviceError(ErrConflict, "拍卖状态不是待启动状态")
+	}
+
+	// 荷兰钟拍卖的结束时间为价格按曲线从初始价格降到最低价格的时刻，英式拍卖和密封拍卖为持续时长之后；
+	// 设置了预定结束时间时，英式拍卖和密封拍卖在预定结束时间结束，荷兰钟拍卖最晚在预定结束时间结束
+	startTime := timeservice.SyncNow()
+	var endTime time.Time
+	if timedAuction(auction) {
+		endTime = startTime.Add(time.Duration(auction.Duration) * time.Second)
+		if auction.ScheduledEnd != nil {
+			endTime = *auction.ScheduledEnd
+		}
+	} else {
+		endTime = startTime.Add(decayStrategy(auction).FloorAt())
+		if auction.ScheduledEnd != nil && auction.ScheduledEnd.Before(endTime) {
+			endTime = *auction.ScheduledEnd
+		}
+	}
+
+	if err = transitionAuction(tx, auction, AuctionStatusActive, actor, reason); err != nil {
+		return nil, err
+	}
+	auction.StartTime = &startTime
+	auction.EndTime = &endTime
+	auction.PausedAt, auction.PausedDuration = nil, 0
+	auction.CurrentPrice = auction.InitialPrice
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "started"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(AuctionStarted{Auction: *auction})
+
+	logger.Info("auction", fmt.Sprintf("启动%s成功，ID: %d，物品类型: %s，数量: %d\n", auctionTypeName(auction), auction.ID, auction.ItemType, auction.Quantity))
+
+	// 加入拍卖时钟，并安排预定结束时间
+	startAuctionTimer(auction)
+	scheduleAuction(auction)
+	return auction, nil
+}
+
+// Bid 竞价。荷兰钟拍卖按当前钟面价格买入部分或全部剩余物品，请求数量超过剩余时只分配剩余部分，
+// 售完时拍卖结束，否则剩余物品留在钟上继续降价；同时到达的荷兰钟竞价经过仲裁按到达时间依次处理，
+// 被拒绝的竞价也写入竞价记录。英式拍卖出价成为最高出价，资金冻结到拍卖结束；
+// 密封拍卖提交不公开的出价，资金冻结到开标
+func (s *AuctionService) Bid(ctx context.Context, req BidRequest) (*AuctionBid, *Auction, error) {
+	// 到达时间取同步后的服务器时间，荷兰钟竞价据此排序
+	received := timeservice.SyncNow()
+
+	// 拍卖ID无效或拍卖不存在时不写竞价记录；读取失败（如请求已取消）时拍卖可能存在，
+	// 记录前再确认拍卖存在且为荷兰钟拍卖
+	auction, err := s.Get(ctx, req.AuctionID)
+	if err != nil {
+		if !errors.Is(err, ErrAuctionNotFound) && !errors.Is(err, ErrInvalidArgument) {
+			s.rejectDutchBid(req, received, err)
+		}
+		return nil, nil, err
+	}
+	if !req.Price.IsPositive() {
+		err = serviceError(ErrInvalidArgument, "竞价金额必须为正数")
+	} else if req.Quantity < 0 {
+		err = serviceError(ErrInvalidArgument, "竞价数量无效")
+	}
+	if !timedAuction(auction) {
+		if err != nil {
+			s.rejectDutchBid(req, received, err)
+			return nil, nil, err
+		}
+		return bidArbiter.submit(ctx, s, req, received)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if auction, err = loadAuction(tx, req.AuctionID); err != nil {
+		return nil, nil, err
+	}
+	if err = checkBidOpen(auction, req, received); err != nil {
+		return nil, nil, err
+	}
+
+	var bid *AuctionBid
+	var published []events.Event
+	if auction.AuctionType == AuctionTypeEnglish {
+		bid, published, err = placeEnglishBid(tx, auction, req)
+	} else {
+		bid, published, err = placeSealedBid(tx, auction, req)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, nil, err
+	}
+
+	events.Publish(published...)
+
+	// 密封出价的金额在开标前不写入日志
+	if sealedAuction(auction) {
+		logger.Info("auction", fmt.Sprintf("%s收到密封出价，拍卖ID: %d，玩家ID: %d，竞价ID: %d\n", auctionTypeName(auction), auction.ID, req.BidderID, bid.ID))
+		return bid, auction, nil
+	}
+	logger.Info("auction", fmt.Sprintf("%s竞价成功，拍卖ID: %d，玩家ID: %d，价格: %s，竞价ID: %d\n",
+		auctionTypeName(auction), auction.ID, req.BidderID, bid.Price, bid.ID))
+	return bid, auction, nil
+}
+
+// 检查拍卖当前是否接受该玩家的竞价
+func checkBidOpen(auction *Auction, req BidRequest, now time.Time) error {
+	if auction.SellerID == req.BidderID {
+		return serviceError(ErrInvalidArgument, "不能竞拍自己发布的拍卖")
+	}
+	switch auction.Status {
+	case AuctionStatusActive:
+	case AuctionStatusPaused:
+		return serviceError(ErrConflict, "拍卖已暂停")
+	case AuctionStatusCompleted, AuctionStatusCancelled:
+		return serviceError(ErrConflict, "拍卖已结束")
+	default:
+		return serviceError(ErrConflict, "拍卖未启动")
+	}
+	if auction.EndTime != nil && now.After(*auction.EndTime) {
+		return serviceError(ErrConflict, "拍卖已结束")
+	}
+	return nil
+}
+
+// 荷兰钟拍卖成交：按当前钟面价格分配物品，买家直接向卖家付款，竞价记录的时间为到达时间
+func fillDutchBid(tx Tx, auction *Auction, req BidRequest, received time.Time) (*AuctionBid, []events.Event, error) {
+	// 竞价金额是买家愿意支付的最高单价，钟面价格尚未降到该价格时不能成交
+	if req.Price.LessThan(auction.CurrentPrice) {
+		return nil, nil, serviceError(ErrInvalidArgument, "竞价金额低于当前价格 %s", auction.CurrentPrice)
+	}
+	if auction.RemainingQuantity <= 0 {
+		return nil, nil, serviceError(ErrConflict, "拍卖物品已售完")
+	}
+	// 钟面价格低于保留价后拍卖不会再成交，按已结束拒绝，不透露设有保留价
+	if auction.CurrentPrice.LessThan(auction.ReservePrice) {
+		return nil, nil, serviceError(ErrConflict, "拍卖已结束")
+	}
+
+	requested := req.Quantity
+	if requested == 0 {
+		requested = auction.RemainingQuantity
+	}
+	quantity := min(requested, auction.RemainingQuantity)
+	price := auction.CurrentPrice
+
+	bid := &AuctionBid{
+		AuctionID:         auction.ID,
+		UserID:            req.BidderID,
+		Price:             price,
+		Quantity:          quantity,
+		RequestedQuantity: requested,
+		Status:            BidStatusAccepted,
+		CreatedAt:         sql.NullTime{Time: received, Valid: true},
+	}
+	if err := tx.Auctions().CreateBid(bid); err != nil {
+		return nil, nil, internalError("插入竞价记录失败", err)
+	}
+
+	// 扣减剩余数量，售完时拍卖结束
+	auction.RemainingQuantity -= quantity
+	if auction.RemainingQuantity == 0 {
+		if err := transitionAuction(tx, auction, AuctionStatusCompleted, userActor(req.BidderID), "全部售出"); err != nil {
+			return nil, nil, err
+		}
+	}
+	auction.WinnerID = sql.NullInt64{Int64: int64(req.BidderID), Valid: true}
+	if err := tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, nil, internalError("更新拍卖状态失败", err)
+	}
+
+	// 物品放入买家背包
+	if err := UnlockBackpackItems(tx.Inventory(), req.BidderID, auction.ItemType, quantity); err != nil {
+		return nil, nil, internalError("更新买家背包失败", err)
+	}
+
+	// 买家向卖家支付成交金额
+	amount, err := price.Mul(int64(quantity))
+	if err != nil {
+		return nil, nil, serviceError(ErrInvalidArgument, "成交金额超出范围")
+	}
+	entry, err := settleAuctionPayment(tx.Ledger(), req.BidderID, auction.SellerID, auction.ItemType, amount)
+	if errors.Is(err, cash.ErrInsufficientFunds) {
+		return nil, nil, serviceError(cash.ErrInsufficientFunds, "余额不足")
+	}
+	if err != nil {
+		return nil, nil, internalError("结算失败", err)
+	}
+
+	if err = enqueueAuctionUpdate(tx, auction, "bid_placed"); err != nil {
+		return nil, nil, internalError("写入拍卖通知失败", err)
+	}
+	return bid, []events.Event{BidAccepted{Bid: *bid, Auction: *auction}, ledgerPosted(entry)}, nil
+}
+
+// 日志中的拍卖类型名称
+func auctionTypeName(auction *Auction) string {
+	switch auction.AuctionType {
+	case AuctionTypeEnglish:
+		return "英式拍卖"
+	case AuctionTypeSealedFirstPrice:
+		return "密封一价拍卖"
+	case AuctionTypeVickrey:
+		return "维克里拍卖"
+	}
+	return "荷兰钟拍卖"
+}
+
+// Cancel 取消未完成的拍卖，尚未成交的物品退还卖家背包
+func (s *AuctionService) Cancel(ctx context.Context, sellerID, auctionID int) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSeller(auction, sellerID, "取消"); err != nil {
+		return nil, err
+	}
+	if auction.Status == AuctionStatusCompleted {
+		return nil, serviceError(ErrConflict, "无法取消已完成的拍卖")
+	}
+
+	// 只退还尚未成交的物品
+	if err = UnlockBackpackItems(tx.Inventory(), auction.SellerID, auction.ItemType, auction.RemainingQuantity); err != nil {
+		return nil, internalError("解锁背包物品失败", err)
+	}
+
+	// 英式拍卖和密封拍卖退还冻结的出价资金
+	var published []events.Event
+	if timedAuction(auction) {
+		if published, err = releaseHeldBids(tx, auction, BidStatusRejected); err != nil {
+			return nil, err
+		}
+		auction.WinnerID = sql.NullInt64{}
+	}
+	if err = transitionAuction(tx, auction, AuctionStatusCancelled, userActor(sellerID), "卖家取消拍卖"); err != nil {
+		return nil, err
+	}
+	auction.RemainingQuantity = 0
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "cancelled"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(append(published, AuctionCancelled{Auction: *auction})...)
+
+	logger.Info("auction", fmt.Sprintf("取消%s成功，ID: %d，物品类型: %s，数量: %d\n", auctionTypeName(auction), auction.ID, auction.ItemType, auction.Quantity))
+
+	// 停止该拍卖的时钟和预定时间
+	stopAuctionTimer(auction.ID)
+	stopScheduleTimer(auction.ID)
+	return auction, nil
+}
+
+// Pause 暂停进行中的荷兰钟拍卖（下架），钟面停在当前位置，物品仍保持锁定，
+// 恢复后价格从暂停时的价格继续递减
+func (s *AuctionService) Pause(ctx context.Context, sellerID, auctionID int) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSeller(auction, sellerID, "暂停"); err != nil {
+		return nil, err
+	}
+	// 英式拍卖和密封拍卖已有冻结的出价和公开的结束时间，只能取消
+	if timedAuction(auction) {
+		return nil, serviceError(ErrConflict, "%s不能暂停", auctionTypeName(auction))
+	}
+	if auction.Status != AuctionStatusActive {
+		return nil, serviceError(ErrConflict, "拍卖ID不是活跃状态")
+	}
+
+	// 记录暂停时刻，预定结束时间在暂停期间仍然有效
+	if err = transitionAuction(tx, auction, AuctionStatusPaused, userActor(sellerID), "卖家暂停拍卖"); err != nil {
+		return nil, err
+	}
+	pausedAt := timeservice.SyncNow()
+	auction.PausedAt = &pausedAt
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "paused"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(AuctionPaused{Auction: *auction})
+
+	logger.Info("auction", fmt.Sprintf("暂停荷兰钟拍卖成功，ID: %d，物品类型: %s，数量: %d\n", auction.ID, auction.ItemType, auction.Quantity))
+
+	// 停止该拍卖的价格变化
+	stopAuctionTimer(auction.ID)
+	return auction, nil
+}
+
+// Resume 恢复已暂停的荷兰钟拍卖，本次暂停时长计入累计暂停时长，
+// 价格从暂停时的价格继续递减，结束时间顺延（不晚于预定结束时间）
+func (s *AuctionService) Resume(ctx context.Context, sellerID, auctionID int) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSeller(auction, sellerID, "恢复"); err != nil {
+		return nil, err
+	}
+	if auction.Status != AuctionStatusPaused || auction.PausedAt == nil {
+		return nil, serviceError(ErrConflict, "拍卖不是已暂停状态")
+	}
+
+	paused := max(timeservice.SyncNow().Sub(*auction.PausedAt), 0)
+	if err = transitionAuction(tx, auction, AuctionStatusActive, userActor(sellerID), "卖家恢复拍卖"); err != nil {
+		return nil, err
+	}
+	auction.PausedAt = nil
+	auction.PausedDuration += paused.Milliseconds()
+	if auction.EndTime != nil {
+		endTime := auction.EndTime.Add(paused)
+		if auction.ScheduledEnd != nil && auction.ScheduledEnd.Before(endTime) {
+			endTime = *auction.ScheduledEnd
+		}
+		auction.EndTime = &endTime
+	}
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "resumed"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(AuctionResumed{Auction: *auction, Paused: paused})
+
+	logger.Info("auction", fmt.Sprintf("恢复荷兰钟拍卖成功，ID: %d，暂停 %s，当前价格: %s\n", auction.ID, FormatDuration(paused), auction.CurrentPrice))
+
+	// 重新安排该拍卖的价格变化
+	startAuctionTimer(auction)
+	return auction, nil
+}
+
+// Reactivate 将已完成或已取消的拍卖重置为待启动，重新从卖家背包锁定物品
+func (s *AuctionService) Reactivate(ctx context.Context, sellerID, auctionID int) (*Auction, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	auction, err := loadAuction(tx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSeller(auction, sellerID, "重新激活"); err != nil {
+		return nil, err
+	}
+	if auction.Status != AuctionStatusCompleted && auction.Status != AuctionStatusCancelled {
+		return nil, serviceError(ErrConflict, "只能重新激活已完成或已取消的拍卖")
+	}
+
+	published, err := LockBackpackItems(tx, sellerID, auction.ItemType, auction.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	// 重置拍卖状态为pending，并重置当前价格为初始价格、剩余数量为全部数量
+	if err = transitionAuction(tx, auction, AuctionStatusPending, userActor(sellerID), "卖家重新激活拍卖"); err != nil {
+		return nil, err
+	}
+	auction.CurrentPrice = auction.InitialPrice
+	auction.RemainingQuantity = auction.Quantity
+	auction.StartTime, auction.EndTime = nil, nil
+	auction.ScheduledStart, auction.ScheduledEnd = nil, nil
+	auction.PausedAt, auction.PausedDuration = nil, 0
+	auction.WinnerID = sql.NullInt64{}
+	if err = tx.Auctions().UpdateAuction(auction); err != nil {
+		return nil, internalError("更新拍卖状态失败", err)
+	}
+	if err = enqueueAuctionUpdate(tx, auction, "reactivated"); err != nil {
+		return nil, internalError("写入拍卖通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(published...)
+	events.Publish(AuctionReactivated{Auction: *auction})
+
+	logger.Info("auction", fmt.Sprintf("重新激活拍卖成功，ID: %d，物品类型: %s，数量: %d\n", auction.ID, auction.ItemType, auction.Quantity))
+	return auction, nil
+}
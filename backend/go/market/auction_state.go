@@ -0,0 +1,105 @@
+package market
+
+import (
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// AuctionStatus 拍卖状态
+type AuctionStatus string
+
+const (
+	AuctionStatusPending   AuctionStatus = "pending"   // 待启动
+	AuctionStatusActive    AuctionStatus = "active"    // 进行中
+	AuctionStatusPaused    AuctionStatus = "paused"    // 已暂停（仅荷兰钟拍卖）
+	AuctionStatusCompleted AuctionStatus = "completed" // 已完成（全部或部分成交）
+	AuctionStatusCancelled AuctionStatus = "cancelled" // 已取消（卖家取消或流拍）
+)
+
+// 合法的状态变化，空状态表示拍卖刚创建
+var auctionTransitions = map[AuctionStatus][]AuctionStatus{
+	"":                     {AuctionStatusPending},
+	AuctionStatusPending:   {AuctionStatusActive, AuctionStatusCancelled},
+	AuctionStatusActive:    {AuctionStatusPaused, AuctionStatusCompleted, AuctionStatusCancelled},
+	AuctionStatusPaused:    {AuctionStatusActive, AuctionStatusCompleted, AuctionStatusCancelled},
+	AuctionStatusCompleted: {AuctionStatusPending},
+	AuctionStatusCancelled: {AuctionStatusPending},
+}
+
+// CanTransitionTo 是否允许从当前状态变为 to
+func (s AuctionStatus) CanTransitionTo(to AuctionStatus) bool {
+	for _, next := range auctionTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 状态的中文名称
+func (s AuctionStatus) displayName() string {
+	switch s {
+	case AuctionStatusPending:
+		return "待启动"
+	case AuctionStatusActive:
+		return "进行中"
+	case AuctionStatusPaused:
+		return "已暂停"
+	case AuctionStatusCompleted:
+		return "已完成"
+	case AuctionStatusCancelled:
+		return "已取消"
+	}
+	return "新建"
+}
+
+// 系统自动触发的状态变化（拍卖时钟、预定时间、结算）的操作者
+const ActorSystem = "system"
+
+// 玩家操作者
+func userActor(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// AuctionEvent 拍卖状态变化记录，按时间顺序可以还原拍卖的完整经历
+type AuctionEvent struct {
+	ID         int           `json:"id"`
+	AuctionID  int           `json:"auctionId"`
+	Actor      string        `json:"actor"`      // 操作者：user:<玩家ID> 或 system
+	FromStatus AuctionStatus `json:"fromStatus"` // 变化前的状态，创建时为空
+	ToStatus   AuctionStatus `json:"toStatus"`   // 变化后的状态
+	Reason     string        `json:"reason"`     // 变化原因
+	CreatedAt  time.Time     `json:"createdAt"`
+}
+
+// 把拍卖变为 to 状态并在同一事务中记录状态变化，非法的状态变化返回冲突错误。
+// 调用方负责随后保存拍卖
+func transitionAuction(tx Tx, auction *Auction, to AuctionStatus, actor, reason string) error {
+	from := auction.Status
+	if !from.CanTransitionTo(to) {
+		return serviceError(ErrConflict, "拍卖状态不能从%s变为%s", from.displayName(), to.displayName())
+	}
+	if err := recordAuctionEvent(tx, auction.ID, from, to, actor, reason); err != nil {
+		return err
+	}
+	auction.Status = to
+	return nil
+}
+
+// 记录拍卖状态变化，时间取同步后的服务器时间
+func recordAuctionEvent(tx Tx, auctionID int, from, to AuctionStatus, actor, reason string) error {
+	err := tx.Auctions().CreateEvent(&AuctionEvent{
+		AuctionID:  auctionID,
+		Actor:      actor,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		CreatedAt:  timeservice.SyncNow(),
+	})
+	if err != nil {
+		return internalError("记录拍卖状态变化失败", err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"own-1Pixel/backend/go/money"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	statuses := []AuctionStatus{"", AuctionStatusPending, AuctionStatusActive, AuctionStatusPaused, AuctionStatusCompleted, AuctionStatusCancelled}
+	allowed := map[[2]AuctionStatus]bool{
+		{"", AuctionStatusPending}:                     true,
+		{AuctionStatusPending, AuctionStatusActive}:    true,
+		{AuctionStatusPending, AuctionStatusCancelled}: true,
+		{AuctionStatusActive, AuctionStatusPaused}:     true,
+		{AuctionStatusActive, AuctionStatusCompleted}:  true,
+		{AuctionStatusActive, AuctionStatusCancelled}:  true,
+		{AuctionStatusPaused, AuctionStatusActive}:     true,
+		{AuctionStatusPaused, AuctionStatusCompleted}:  true,
+		{AuctionStatusPaused, AuctionStatusCancelled}:  true,
+		{AuctionStatusCompleted, AuctionStatusPending}: true,
+		{AuctionStatusCancelled, AuctionStatusPending}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]AuctionStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%q -> %q = %v，期望 %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestAuctionLifecycle(t *testing.T) {
+	const seller, other = 1, 2
+	storage := newTestStorage(t, map[int]int64{seller: 0, other: 0})
+	giveItems(t, storage, seller, "apple", 2)
+	service := NewAuctionService(storage)
+	ctx := context.Background()
+
+	auction, err := service.Create(ctx, seller, CreateAuctionRequest{
+		ItemType:          "apple",
+		InitialPrice:      money.New(1000),
+		MinPrice:          money.New(500),
+		PriceDecrement:    money.New(100),
+		DecrementInterval: 60,
+		Quantity:          2,
+	})
+	checkErrorKind(t, err, nil)
+	if quantityOf(t, storage, seller, "apple") != 0 {
+		t.Fatal("创建拍卖后物品没有锁定")
+	}
+
+	type operation func(userID, auctionID int) (*Auction, error)
+	var (
+		start      operation = func(u, id int) (*Auction, error) { return service.Start(ctx, u, id) }
+		pause      operation = func(u, id int) (*Auction, error) { return service.Pause(ctx, u, id) }
+		resume     operation = func(u, id int) (*Auction, error) { return service.Resume(ctx, u, id) }
+		cancel     operation = func(u, id int) (*Auction, error) { return service.Cancel(ctx, u, id) }
+		reactivate operation = func(u, id int) (*Auction, error) { return service.Reactivate(ctx, u, id) }
+	)
+	steps := []struct {
+		name   string
+		op     operation
+		userID int
+		err    error
+		status AuctionStatus // 操作后的状态
+	}{
+		{"待启动时暂停", pause, seller, ErrConflict, AuctionStatusPending},
+		{"待启动时恢复", resume, seller, ErrConflict, AuctionStatusPending},
+		{"其他玩家启动", start, other, ErrForbidden, AuctionStatusPending},
+		{"启动", start, seller, nil, AuctionStatusActive},
+		{"重复启动", start, seller, ErrConflict, AuctionStatusActive},
+		{"进行中重新激活", reactivate, seller, ErrConflict, AuctionStatusActive},
+		{"暂停", pause, seller, nil, AuctionStatusPaused},
+		{"重复暂停", pause, seller, ErrConflict, AuctionStatusPaused},
+		{"恢复", resume, seller, nil, AuctionStatusActive},
+		{"其他玩家取消", cancel, other, ErrForbidden, AuctionStatusActive},
+		{"取消", cancel, seller, nil, AuctionStatusCancelled},
+		{"取消后恢复", resume, seller, ErrConflict, AuctionStatusCancelled},
+		{"重复取消", cancel, seller, ErrConflict, AuctionStatusCancelled},
+		{"重新激活", reactivate, seller, nil, AuctionStatusPending},
+	}
+	for _, step := range steps {
+		if _, err := step.op(step.userID, auction.ID); !errors.Is(err, step.err) {
+			t.Fatalf("%s: 错误 = %v，期望 %v", step.name, err, step.err)
+		}
+		current, err := service.Get(ctx, auction.ID)
+		checkErrorKind(t, err, nil)
+		if current.Status != step.status {
+			t.Fatalf("%s: 状态 = %s，期望 %s", step.name, current.Status, step.status)
+		}
+	}
+	stopAuctionTimer(auction.ID)
+
+	// 只有成功的状态变化留下记录，按发生顺序
+	history, err := service.History(ctx, auction.ID)
+	checkErrorKind(t, err, nil)
+	want := [][2]AuctionStatus{
+		{"", AuctionStatusPending},
+		{AuctionStatusPending, AuctionStatusActive},
+		{AuctionStatusActive, AuctionStatusPaused},
+		{AuctionStatusPaused, AuctionStatusActive},
+		{AuctionStatusActive, AuctionStatusCancelled},
+		{AuctionStatusCancelled, AuctionStatusPending},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("状态变化记录数 = %d，期望 %d", len(history), len(want))
+	}
+	for i, event := range history {
+		if event.FromStatus != want[i][0] || event.ToStatus != want[i][1] {
+			t.Errorf("第%d条记录 = %q -> %q，期望 %q -> %q", i+1, event.FromStatus, event.ToStatus, want[i][0], want[i][1])
+		}
+	}
+
+	// 取消时退还的物品在重新激活时再次锁定
+	if got := quantityOf(t, storage, seller, "apple"); got != 0 {
+		t.Errorf("重新激活后背包中的苹果 = %d，期望 0", got)
+	}
+}
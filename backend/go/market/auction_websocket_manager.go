@@ -1,32 +1,64 @@
 package market
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"own-1Pixel/backend/go/config"
 	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
 	"own-1Pixel/backend/go/timeservice"
+	"own-1Pixel/backend/go/user"
 
 	"github.com/gorilla/websocket"
 )
 
 // WebSocket连接管理器
 type AuctionWSManager struct {
-	connections map[*websocket.Conn]bool
-	dbConn      *sql.DB
+	connections map[*websocket.Conn]*auctionWSClient
+	auctions    *AuctionService
+	orders      *OrderBookService
 	mutex       sync.Mutex
 }
 
+// 一个WebSocket连接。gorilla/websocket 同一时刻只允许一个写入者，
+// 发件箱投递、心跳和消息回复都通过 writeMutex 串行写入
+type auctionWSClient struct {
+	conn       *websocket.Conn
+	userID     int // 已认证的玩家ID
+	writeMutex sync.Mutex
+}
+
+// 写入JSON消息，每次写入前重新设置写入超时
+func (client *auctionWSClient) writeJSON(v interface{}) error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	client.conn.SetWriteDeadline(timeservice.SyncNow().Add(config.GetConfig().AuctionWebSocket.WriteTimeout))
+	return client.conn.WriteJSON(v)
+}
+
+// 发送心跳ping
+func (client *auctionWSClient) writePing() error {
+	client.writeMutex.Lock()
+	defer client.writeMutex.Unlock()
+	client.conn.SetWriteDeadline(timeservice.SyncNow().Add(config.GetConfig().AuctionWebSocket.WriteTimeout))
+	return client.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
 // WebSocket消息结构
 type AuctionWSMessage struct {
-	Type      string      `json:"type"`      // 消息类型: auction_update, auction_price_update, bid_result等
-	Data      interface{} `json:"data"`      // 消息数据
-	Timestamp time.Time   `json:"timestamp"` // 时间戳
-	SendTime  time.Time   `json:"sendTime"`  // 发送时间
+	Type      string      `json:"type"`          // 消息类型: auction_update, auction_price_batch, auction_outbid, seq, bid_result等
+	Seq       int64       `json:"seq,omitempty"` // 发件箱通知序号，只有发件箱投递的通知带有序号
+	Data      interface{} `json:"data"`          // 消息数据
+	Timestamp time.Time   `json:"timestamp"`     // 时间戳
+	SendTime  time.Time   `json:"sendTime"`      // 发送时间
 }
 
 // 荷兰钟拍卖更新消息
@@ -37,35 +69,58 @@ type AuctionWSUpdateMessage struct {
 
 // 价格更新消息
 type AuctionPriceUpdateMessage struct {
-	AuctionID     int     `json:"auctionId"`
-	OldPrice      float64 `json:"oldPrice"`
-	NewPrice      float64 `json:"newPrice"`
-	TimeRemaining int     `json:"timeRemaining"` // 剩余时间（秒）
+	AuctionID     int         `json:"auctionId"`
+	OldPrice      money.Money `json:"oldPrice"`
+	NewPrice      money.Money `json:"newPrice"`
+	TimeRemaining int         `json:"timeRemaining"` // 剩余时间（秒）
+}
+
+// 批量价格更新消息，拍卖时钟同一次处理的价格变化合并为一条通知
+type AuctionPriceBatchMessage struct {
+	Updates []AuctionPriceUpdateMessage `json:"updates"`
 }
 
 // 竞价结果消息
 type AuctionWSBidResultMessage struct {
-	AuctionID int     `json:"auctionId"`
-	UserID    int     `json:"userId"`
-	Success   bool    `json:"success"`
-	Message   string  `json:"message"`
-	Price     float64 `json:"price"`
-	Quantity  int     `json:"quantity"`
+	AuctionID int         `json:"auctionId"`
+	UserID    int         `json:"userId"`
+	Success   bool        `json:"success"`
+	Message   string      `json:"message"`
+	Price     money.Money `json:"price"`
+	Quantity  int         `json:"quantity"`
+}
+
+// 订单簿快照消息，订阅订单簿时发送，之后的变化通过发件箱推送
+type OrderBookSnapshotMessage struct {
+	Depth  *OrderBookDepth `json:"depth"`
+	Trades []Trade         `json:"trades"` // 最近成交，最新的在前
 }
 
 // 创建新的WebSocket管理器
-func InitAuctionWSManager(dbConn *sql.DB) *AuctionWSManager {
+func InitAuctionWSManager(auctions *AuctionService, orders *OrderBookService) *AuctionWSManager {
 	return &AuctionWSManager{
-		connections: make(map[*websocket.Conn]bool),
-		dbConn:      dbConn,
+		connections: make(map[*websocket.Conn]*auctionWSClient),
+		auctions:    auctions,
+		orders:      orders,
 	}
 }
 
 // WebSocket升级器
 var auctionWSUpgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源，生产环境应该更严格
-	},
+	CheckOrigin: checkAuctionWSOrigin,
+}
+
+// 只允许同源页面建立连接，防止其他站点借用玩家的会话Cookie
+func checkAuctionWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true // 非浏览器客户端不携带Origin
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(originURL.Host, r.Host)
 }
 
 // 处理WebSocket连接
@@ -74,6 +129,13 @@ func (auctionWSManager *AuctionWSManager) HandleAuctionWebSocket(w http.Response
 	_config := config.GetConfig()
 	auctionWebSocketConfig := _config.AuctionWebSocket
 
+	// 认证中间件已校验会话
+	userID, ok := user.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "未登录或会话已过期", http.StatusUnauthorized)
+		return
+	}
+
 	// 升级HTTP连接到WebSocket
 	conn, err := auctionWSUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -82,28 +144,46 @@ func (auctionWSManager *AuctionWSManager) HandleAuctionWebSocket(w http.Response
 	}
 
 	// 设置连接参数
-	conn.SetReadLimit(int64(auctionWebSocketConfig.ReadLimit))                            // 限制读取消息大小
-	conn.SetReadDeadline(timeservice.SyncNow().Add(auctionWebSocketConfig.ReadTimeout))   // 设置读取超时，比心跳间隔长
-	conn.SetWriteDeadline(timeservice.SyncNow().Add(auctionWebSocketConfig.WriteTimeout)) // 设置写入超时
+	conn.SetReadLimit(int64(auctionWebSocketConfig.ReadLimit))                          // 限制读取消息大小
+	conn.SetReadDeadline(timeservice.SyncNow().Add(auctionWebSocketConfig.ReadTimeout)) // 设置读取超时，比心跳间隔长
 	conn.SetPongHandler(func(string) error {
 		logger.Info("websocket", "收到pong响应\n")
 		conn.SetReadDeadline(timeservice.SyncNow().Add(auctionWebSocketConfig.ReadTimeout))
 		return nil
 	})
 
-	// 添加连接到管理器
+	// 重连的客户端通过 since 参数带上最近收到的通知序号，先补发断线期间的通知再加入广播。
+	// 补发和加入连接在同一把锁内完成，之后投递的通知不会早于补发的通知到达
+	client := &auctionWSClient{conn: conn, userID: userID}
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
 	auctionWSManager.mutex.Lock()
-	auctionWSManager.connections[conn] = true
+	complete, replayed := true, 0
+	if since > 0 {
+		complete, err = replayOutbox(auctionWSManager.auctions.storage, since, func(message OutboxMessage) error {
+			replayed++
+			return client.writeJSON(outboxWSMessage(message, userID))
+		})
+		if err != nil {
+			logger.Info("websocket", fmt.Sprintf("补发通知失败: 从序号 %d 开始, %v\n", since, err))
+		}
+	}
+	auctionWSManager.connections[conn] = client
 	connectionCount := len(auctionWSManager.connections)
 	auctionWSManager.mutex.Unlock()
 
-	logger.Info("websocket", fmt.Sprintf("新的WebSocket连接已建立，当前连接数: %d\n", connectionCount))
+	logger.Info("websocket", fmt.Sprintf("玩家 %d 的WebSocket连接已建立，当前连接数: %d\n", userID, connectionCount))
+	if since > 0 {
+		logger.Info("websocket", fmt.Sprintf("玩家 %d 重连，从序号 %d 补发 %d 条通知，完整: %v\n", userID, since, replayed, complete))
+		auctionWSManager.sendResumeResult(client, since, complete)
+	}
 
 	// 发送当前活跃拍卖列表
-	auctionWSManager.sendActiveAuctions(conn)
+	auctionWSManager.sendActiveAuctions(client)
 
-	// 启动心跳检测
-	go auctionWSManager.auctionHeartbeatLoop(conn)
+	// 启动心跳检测，读取循环结束时停止
+	done := make(chan struct{})
+	defer close(done)
+	go auctionWSManager.auctionHeartbeatLoop(client, done)
 
 	// 处理消息
 	for {
@@ -122,7 +202,7 @@ func (auctionWSManager *AuctionWSManager) HandleAuctionWebSocket(w http.Response
 		}
 
 		// 处理客户端消息
-		auctionWSManager.handleAuctionClientMessage(conn, msg)
+		auctionWSManager.handleAuctionClientMessage(client, msg)
 	}
 
 	// 连接关闭时清理
@@ -130,12 +210,13 @@ func (auctionWSManager *AuctionWSManager) HandleAuctionWebSocket(w http.Response
 	delete(auctionWSManager.connections, conn)
 	connectionCount = len(auctionWSManager.connections)
 	auctionWSManager.mutex.Unlock()
+	conn.Close()
 
 	logger.Info("websocket", fmt.Sprintf("WebSocket连接已关闭，当前连接数: %d\n", connectionCount))
 }
 
 // 心跳检测循环
-func (auctionWSManager *AuctionWSManager) auctionHeartbeatLoop(conn *websocket.Conn) {
+func (auctionWSManager *AuctionWSManager) auctionHeartbeatLoop(client *auctionWSClient, done <-chan struct{}) {
 	// 获取全局配置实例
 	_config := config.GetConfig()
 	auctionWebSocket := _config.AuctionWebSocket
@@ -145,9 +226,15 @@ func (auctionWSManager *AuctionWSManager) auctionHeartbeatLoop(conn *websocket.C
 	ticker := time.NewTicker(heartbeatInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
 		// 发送ping
-		err := conn.WriteMessage(websocket.PingMessage, nil)
+		err := client.writePing()
 		if err != nil {
 			logger.Info("websocket", fmt.Sprintf("发送ping失败: %v\n", err))
 			return
@@ -159,19 +246,26 @@ func (auctionWSManager *AuctionWSManager) auctionHeartbeatLoop(conn *websocket.C
 }
 
 // 处理客户端消息
-func (auctionWSManager *AuctionWSManager) handleAuctionClientMessage(conn *websocket.Conn, msg AuctionWSMessage) {
+func (auctionWSManager *AuctionWSManager) handleAuctionClientMessage(client *auctionWSClient, msg AuctionWSMessage) {
 	switch msg.Type {
 	case "get_auction":
 		// 获取特定拍卖详情
 		if auctionID, ok := msg.Data.(float64); ok {
-			auctionWSManager.sendAuctionDetails(conn, int(auctionID))
+			auctionWSManager.sendAuctionDetails(client, int(auctionID))
 		}
 	case "place_bid":
 		// 处理竞价请求
-		auctionWSManager.handleAuctionBidRequest(conn, msg.Data)
+		auctionWSManager.handleAuctionBidRequest(client, msg.Data)
 	case "get_auctions":
 		// 获取拍卖列表
-		auctionWSManager.sendActiveAuctions(conn)
+		auctionWSManager.sendActiveAuctions(client)
+	case "get_order_book":
+		// 获取物品的订单簿快照
+		if data, ok := msg.Data.(map[string]interface{}); ok {
+			if code, ok := data["item_code"].(string); ok {
+				auctionWSManager.sendOrderBookSnapshot(client, code)
+			}
+		}
 	case "ping":
 		// 处理客户端发送的ping消息，回复pong
 		now := timeservice.SyncNow()
@@ -182,7 +276,7 @@ func (auctionWSManager *AuctionWSManager) handleAuctionClientMessage(conn *webso
 			SendTime:  now,
 		}
 
-		err := conn.WriteJSON(pongMsg)
+		err := client.writeJSON(pongMsg)
 		if err != nil {
 			logger.Info("websocket", fmt.Sprintf("发送pong响应失败: %v\n", err))
 		} else {
@@ -198,7 +292,7 @@ func (auctionWSManager *AuctionWSManager) handleAuctionClientMessage(conn *webso
 			SendTime:  now,
 		}
 
-		err := conn.WriteJSON(checkMsg)
+		err := client.writeJSON(checkMsg)
 		if err != nil {
 			logger.Info("websocket", fmt.Sprintf("连接健康检查响应失败: %v\n", err))
 		} else {
@@ -208,8 +302,8 @@ func (auctionWSManager *AuctionWSManager) handleAuctionClientMessage(conn *webso
 }
 
 // 发送活跃拍卖列表
-func (auctionWSManager *AuctionWSManager) sendActiveAuctions(conn *websocket.Conn) {
-	auctions, err := GetActiveAuctions(auctionWSManager.dbConn)
+func (auctionWSManager *AuctionWSManager) sendActiveAuctions(client *auctionWSClient) {
+	auctions, err := auctionWSManager.auctions.Active(context.Background())
 	if err != nil {
 		logger.Info("websocket", fmt.Sprintf("获取活跃拍卖失败: %v\n", err))
 		return
@@ -224,7 +318,7 @@ func (auctionWSManager *AuctionWSManager) sendActiveAuctions(conn *websocket.Con
 	}
 
 	startTime := timeservice.SyncNow()
-	err = conn.WriteJSON(msg)
+	err = client.writeJSON(msg)
 	if err != nil {
 		logger.Info("websocket", fmt.Sprintf("发送拍卖列表失败: %v\n", err))
 		return
@@ -236,8 +330,8 @@ func (auctionWSManager *AuctionWSManager) sendActiveAuctions(conn *websocket.Con
 }
 
 // 发送特定拍卖详情
-func (auctionWSManager *AuctionWSManager) sendAuctionDetails(conn *websocket.Conn, auctionID int) {
-	auction, err := GetAuctionID(auctionWSManager.dbConn, auctionID)
+func (auctionWSManager *AuctionWSManager) sendAuctionDetails(client *auctionWSClient, auctionID int) {
+	auction, err := auctionWSManager.auctions.Get(context.Background(), auctionID)
 	if err != nil {
 		logger.Info("websocket", fmt.Sprintf("获取拍卖详情失败: %v\n", err))
 		return
@@ -252,7 +346,7 @@ func (auctionWSManager *AuctionWSManager) sendAuctionDetails(conn *websocket.Con
 	}
 
 	startTime := timeservice.SyncNow()
-	err = conn.WriteJSON(msg)
+	err = client.writeJSON(msg)
 	if err != nil {
 		logger.Info("websocket", fmt.Sprintf("发送拍卖详情失败: %v\n", err))
 		return
@@ -263,49 +357,79 @@ func (auctionWSManager *AuctionWSManager) sendAuctionDetails(conn *websocket.Con
 	logger.Info("websocket", fmt.Sprintf("发送拍卖详情耗时: %s\n", FormatDuration(sendDuration)))
 }
 
-// 处理竞价请求
-func (auctionWSManager *AuctionWSManager) handleAuctionBidRequest(conn *websocket.Conn, data interface{}) {
+// 发送物品的订单簿深度和最近成交
+func (auctionWSManager *AuctionWSManager) sendOrderBookSnapshot(client *auctionWSClient, code string) {
+	depth, trades, err := auctionWSManager.orders.Book(context.Background(), code)
+	if err != nil {
+		logger.Info("websocket", fmt.Sprintf("获取订单簿失败: %v\n", err))
+		return
+	}
+
+	now := timeservice.SyncNow()
+	msg := AuctionWSMessage{
+		Type:      "order_book_snapshot",
+		Data:      OrderBookSnapshotMessage{Depth: depth, Trades: trades},
+		Timestamp: now,
+		SendTime:  now,
+	}
+
+	if err = client.writeJSON(msg); err != nil {
+		logger.Info("websocket", fmt.Sprintf("发送订单簿失败: %v\n", err))
+	}
+}
+
+// 处理竞价请求，竞价玩家取自连接的会话而不是客户端数据
+func (auctionWSManager *AuctionWSManager) handleAuctionBidRequest(client *auctionWSClient, data interface{}) {
 	// 解析竞价数据
 	bidData, ok := data.(map[string]interface{})
 	if !ok {
-		auctionWSManager.sendAuctionWSBidResult(conn, 0, false, "无效的竞价数据", 0, 0)
+		auctionWSManager.sendAuctionWSBidResult(client, false, "无效的竞价数据", money.Zero, 0)
 		return
 	}
 
 	auctionID, ok1 := bidData["auctionId"].(float64)
-	userID, ok2 := bidData["userId"].(float64)
-	price, ok3 := bidData["price"].(float64)
-	quantity, ok4 := bidData["quantity"].(float64)
+	rawPrice, ok2 := bidData["price"].(float64)
+	quantity, ok3 := bidData["quantity"].(float64)
 
-	if !ok1 || !ok2 || !ok3 || !ok4 {
-		auctionWSManager.sendAuctionWSBidResult(conn, 0, false, "竞价数据格式错误", 0, 0)
+	if !ok1 || !ok2 || !ok3 {
+		auctionWSManager.sendAuctionWSBidResult(client, false, "竞价数据格式错误", money.Zero, 0)
 		return
 	}
 
-	// 处理竞价
-	success, message, err := ProcessAuctionBid(auctionWSManager.dbConn, int(auctionID), int(userID), price, int(quantity))
+	// 竞价金额按十进制解析，最多两位小数
+	price, err := money.Parse(strconv.FormatFloat(rawPrice, 'f', -1, 64))
 	if err != nil {
-		logger.Info("websocket", fmt.Sprintf("处理竞价失败: %v\n", err))
-		auctionWSManager.sendAuctionWSBidResult(conn, int(userID), false, "竞价处理失败", 0, 0)
+		auctionWSManager.sendAuctionWSBidResult(client, false, err.Error(), money.Zero, 0)
 		return
 	}
 
-	// 发送竞价结果
-	auctionWSManager.sendAuctionWSBidResult(conn, int(userID), success, message, price, int(quantity))
-
-	// 如果竞价成功，广播拍卖更新
-	if success {
-		auction, err := GetAuctionID(auctionWSManager.dbConn, int(auctionID))
-		if err == nil {
-			auctionWSManager.BroadcastAuctionWSUpdate(auction, "bid_placed")
+	// 与HTTP竞价共用同一业务逻辑，数量为0时买下全部剩余
+	bid, _, err := auctionWSManager.auctions.Bid(context.Background(), BidRequest{
+		AuctionID: int(auctionID),
+		BidderID:  client.userID,
+		Price:     price,
+		Quantity:  int(quantity),
+	})
+	if err != nil {
+		logger.Info("websocket", fmt.Sprintf("处理竞价失败: %v\n", err))
+		// 业务错误直接告知玩家，内部错误只返回概要
+		message := "竞价处理失败"
+		var serviceErr *ServiceError
+		if errors.As(err, &serviceErr) && serviceErr.Kind != nil {
+			message = serviceErr.Message
 		}
+		auctionWSManager.sendAuctionWSBidResult(client, false, message, money.Zero, 0)
+		return
 	}
+
+	// 发送竞价结果，拍卖更新通过发件箱广播
+	auctionWSManager.sendAuctionWSBidResult(client, true, "竞价成功", bid.Price, bid.Quantity)
 }
 
 // 发送竞价结果
-func (auctionWSManager *AuctionWSManager) sendAuctionWSBidResult(conn *websocket.Conn, userID int, success bool, message string, price float64, quantity int) {
+func (auctionWSManager *AuctionWSManager) sendAuctionWSBidResult(client *auctionWSClient, success bool, message string, price money.Money, quantity int) {
 	result := AuctionWSBidResultMessage{
-		UserID:   userID,
+		UserID:   client.userID,
 		Success:  success,
 		Message:  message,
 		Price:    price,
@@ -321,7 +445,7 @@ func (auctionWSManager *AuctionWSManager) sendAuctionWSBidResult(conn *websocket
 	}
 
 	startTime := timeservice.SyncNow()
-	err := conn.WriteJSON(msg)
+	err := client.writeJSON(msg)
 	if err != nil {
 		logger.Info("websocket", fmt.Sprintf("发送竞价结果失败: %v\n", err))
 		return
@@ -332,143 +456,73 @@ func (auctionWSManager *AuctionWSManager) sendAuctionWSBidResult(conn *websocket
 	logger.Info("websocket", fmt.Sprintf("发送竞价结果耗时: %s\n", FormatDuration(sendDuration)))
 }
 
-// 广播拍卖更新
-func (auctionWSManager *AuctionWSManager) BroadcastAuctionWSUpdate(auction *Auction, action string) {
-	update := AuctionWSUpdateMessage{
-		Auction: auction,
-		Action:  action,
-	}
-
-	now := timeservice.SyncNow()
-	msg := AuctionWSMessage{
-		Type:      "auction_update",
-		Data:      update,
-		Timestamp: now,
-		SendTime:  now,
-	}
-
+// DeliverOutboxMessage 将发件箱通知广播给所有连接，消息带有通知序号。
+// 只发给指定玩家的通知，其他连接只收到不含内容的序号消息，保持客户端序号连续。
+// 写入失败的连接会被移除，客户端重连时带上最近收到的序号，由发件箱补发缺失的通知
+func (auctionWSManager *AuctionWSManager) DeliverOutboxMessage(message OutboxMessage) error {
 	auctionWSManager.mutex.Lock()
 	defer auctionWSManager.mutex.Unlock()
 
 	// 创建临时连接列表，避免在迭代过程中修改原map
-	connections := make([]*websocket.Conn, 0, len(auctionWSManager.connections))
-	for conn := range auctionWSManager.connections {
-		connections = append(connections, conn)
+	clients := make([]*auctionWSClient, 0, len(auctionWSManager.connections))
+	for _, client := range auctionWSManager.connections {
+		clients = append(clients, client)
 	}
 
 	var successCount int
-	var failedConnections []*websocket.Conn
+	var failedClients []*auctionWSClient
 
 	// 记录广播开始时间
-	broadcastStartTime := timeservice.SyncNow()
-
-	for _, conn := range connections {
-		// 检查连接是否还在管理器中
-		if _, exists := auctionWSManager.connections[conn]; !exists {
-			continue
-		}
-
-		// 设置写入超时
-		_config := config.GetConfig()
-		conn.SetWriteDeadline(timeservice.SyncNow().Add(time.Duration(_config.AuctionWebSocket.WriteTimeout)))
+	broadcastStartTime := time.Now()
 
+	for _, client := range clients {
 		// 记录单个连接发送时间
-		sendStartTime := timeservice.SyncNow()
-		err := conn.WriteJSON(msg)
+		sendStartTime := time.Now()
+		err := client.writeJSON(outboxWSMessage(message, client.userID))
 		sendDuration := time.Since(sendStartTime)
 
 		if err != nil {
-			logger.Info("websocket", fmt.Sprintf("广播拍卖更新失败: %v, 发送耗时: %s\n", err, FormatDuration(sendDuration)))
-			failedConnections = append(failedConnections, conn)
+			logger.Info("websocket", fmt.Sprintf("广播通知失败: 序号 %d, 类型 %s, %v, 发送耗时: %s\n", message.Seq, message.Type, err, FormatDuration(sendDuration)))
+			failedClients = append(failedClients, client)
 		} else {
 			successCount++
-			logger.Info("websocket", fmt.Sprintf("广播拍卖更新成功, 当前价格: %.2f, 发送耗时: %s\n", auction.CurrentPrice, FormatDuration(sendDuration)))
 		}
 	}
 
-	// 记录总广播时间
-	totalBroadcastDuration := time.Since(broadcastStartTime)
-	logger.Info("websocket", fmt.Sprintf("广播拍卖更新总耗时: %s, 成功: %d, 失败: %d\n", FormatDuration(totalBroadcastDuration), successCount, len(failedConnections)))
-
 	// 移除失败的连接
-	for _, conn := range failedConnections {
-		conn.Close()
-		delete(auctionWSManager.connections, conn)
+	for _, client := range failedClients {
+		client.conn.Close()
+		delete(auctionWSManager.connections, client.conn)
 	}
 
-	logger.Info("websocket", fmt.Sprintf("广播拍卖更新完成: 成功 %d, 失败 %d\n", successCount, len(failedConnections)))
+	// 记录总广播时间
+	totalBroadcastDuration := time.Since(broadcastStartTime)
+	logger.Info("websocket", fmt.Sprintf("广播通知完成: 序号 %d, 类型 %s, 总耗时: %s, 成功: %d, 失败: %d\n",
+		message.Seq, message.Type, FormatDuration(totalBroadcastDuration), successCount, len(failedClients)))
+	return nil
 }
 
-// 广播价格更新
-func (auctionWSManager *AuctionWSManager) BroadcastAuctionWSPriceUpdate(auctionID int, oldPrice, newPrice float64, timeRemaining int) {
-	// 获取全局配置实例
-	_config := config.GetConfig()
-	auctionWebSocketConfig := _config.AuctionWebSocket
-
-	update := AuctionPriceUpdateMessage{
-		AuctionID:     auctionID,
-		OldPrice:      oldPrice,
-		NewPrice:      newPrice,
-		TimeRemaining: timeRemaining,
+// 发件箱通知对应发给玩家 userID 的WebSocket消息，发给其他玩家的通知只带序号
+func outboxWSMessage(message OutboxMessage, userID int) AuctionWSMessage {
+	now := timeservice.SyncNow()
+	if message.UserID != 0 && message.UserID != userID {
+		return AuctionWSMessage{Type: "seq", Seq: message.Seq, Timestamp: now, SendTime: now}
 	}
+	return AuctionWSMessage{Type: message.Type, Seq: message.Seq, Data: message.Payload, Timestamp: now, SendTime: now}
+}
 
+// 发送补发结果，complete 为 false 时客户端需要重新拉取全部状态
+func (auctionWSManager *AuctionWSManager) sendResumeResult(client *auctionWSClient, since int64, complete bool) {
 	now := timeservice.SyncNow()
 	msg := AuctionWSMessage{
-		Type:      "auction_price_update",
-		Data:      update,
+		Type:      "resume",
+		Data:      map[string]interface{}{"since": since, "complete": complete},
 		Timestamp: now,
 		SendTime:  now,
 	}
-
-	auctionWSManager.mutex.Lock()
-	defer auctionWSManager.mutex.Unlock()
-
-	// 创建临时连接列表，避免在迭代过程中修改原map
-	connections := make([]*websocket.Conn, 0, len(auctionWSManager.connections))
-	for conn := range auctionWSManager.connections {
-		connections = append(connections, conn)
-	}
-
-	var successCount int
-	var failedConnections []*websocket.Conn
-
-	// 记录广播开始时间
-	broadcastStartTime := timeservice.SyncNow()
-
-	for _, conn := range connections {
-		// 检查连接是否还在管理器中
-		if _, exists := auctionWSManager.connections[conn]; !exists {
-			continue
-		}
-
-		// 设置写入超时
-		conn.SetWriteDeadline(timeservice.SyncNow().Add(time.Duration(auctionWebSocketConfig.WriteTimeout)))
-
-		// 记录单个连接发送时间
-		sendStartTime := timeservice.SyncNow()
-		err := conn.WriteJSON(msg)
-		sendDuration := time.Since(sendStartTime)
-
-		if err != nil {
-			logger.Info("websocket", fmt.Sprintf("广播价格更新失败: %v, 发送耗时: %s\n", err, FormatDuration(sendDuration)))
-			failedConnections = append(failedConnections, conn)
-		} else {
-			successCount++
-			logger.Info("websocket", fmt.Sprintf("广播价格更新成功, 旧价格: %.2f, 新价格: %.2f, 发送耗时: %s\n", oldPrice, newPrice, FormatDuration(sendDuration)))
-		}
-	}
-
-	// 记录总广播时间
-	totalBroadcastDuration := time.Since(broadcastStartTime)
-	logger.Info("websocket", fmt.Sprintf("广播价格更新总耗时: %s, 成功: %d, 失败: %d\n", FormatDuration(totalBroadcastDuration), successCount, len(failedConnections)))
-
-	// 移除失败的连接
-	for _, conn := range failedConnections {
-		conn.Close()
-		delete(auctionWSManager.connections, conn)
+	if err := client.writeJSON(msg); err != nil {
+		logger.Info("websocket", fmt.Sprintf("发送补发结果失败: %v\n", err))
 	}
-
-	logger.Info("websocket", fmt.Sprintf("广播价格更新完成: 成功 %d, 失败 %d\n", successCount, len(failedConnections)))
 }
 
 // 获取连接数
@@ -0,0 +1,181 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 制作任务状态
+const (
+	CraftingJobPending   = "pending"   // 制作中
+	CraftingJobCompleted = "completed" // 已完成，产出已放入背包
+)
+
+// CraftingJob 需要制作时长的配方生成的制作任务。原料和费用在开始制作时扣除，
+// 到完成时间（时间服务时间）后产出放入背包，任务保存在数据库中，重启后照常完成
+type CraftingJob struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	ItemCode    string     `json:"item_code"` // 产出的物品代码
+	Quantity    int        `json:"quantity"`  // 产出数量
+	Status      string     `json:"status"`
+	StartedAt   time.Time  `json:"started_at"`   // 开始制作的时间，排在玩家已有的任务之后
+	CompletesAt time.Time  `json:"completes_at"` // 完成时间
+	CompletedAt *time.Time `json:"completed_at"` // 实际放入背包的时间
+}
+
+// CraftResult 制作物品的结果
+type CraftResult struct {
+	Backpack *Backpack    // 制作后的背包
+	Job      *CraftingJob // 需要制作时长时的制作任务，立即完成的配方为空
+}
+
+// 完成玩家已到完成时间的制作任务，产出放入背包，返回本次完成的任务。
+// 读取或扣减背包前调用，保证背包中包含已制作完成的物品
+func collectCraftingJobs(tx Tx, userID int, now time.Time) ([]CraftingJob, error) {
+	jobs, err := tx.Inventory().ListCraftingJobs(userID)
+	if err != nil {
+		return nil, fmt.Errorf("获取制作任务失败: %w", err)
+	}
+
+	var completed []CraftingJob
+	for _, job := range jobs {
+		if job.CompletesAt.After(now) {
+			continue
+		}
+		if err = tx.Inventory().AddItems(userID, job.ItemCode, job.Quantity); err != nil {
+			return nil, fmt.Errorf("更新背包失败: %w", err)
+		}
+		if err = tx.Inventory().CompleteCraftingJob(job.ID, now); err != nil {
+			return nil, fmt.Errorf("更新制作任务失败: %w", err)
+		}
+		job.Status = CraftingJobCompleted
+		job.CompletedAt = &now
+		completed = append(completed, job)
+		logger.Info("market", fmt.Sprintf("玩家 %d 的制作任务 %d 已完成: %s x%d\n", userID, job.ID, job.ItemCode, job.Quantity))
+	}
+	return completed, nil
+}
+
+// 制作任务完成事件
+func craftingCompleted(jobs []CraftingJob) []events.Event {
+	published := make([]events.Event, 0, len(jobs))
+	for _, job := range jobs {
+		published = append(published, CraftingCompleted{Job: job})
+	}
+	return published
+}
+
+// 玩家向园区工坊支付制作 output 个物品的费用
+func payCraftingCost(ledger cash.LedgerStore, userID int, item *Item, output int, cost money.Money) (*cash.JournalEntry, error) {
+	userAccountID, err := cash.UserCashAccountID(ledger, userID)
+	if err != nil {
+		return nil, err
+	}
+	workshopAccountID, err := cash.AccountIDByCode(ledger, cash.AccountWorkshop)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindCrafting,
+		FromAccountID: userAccountID,
+		ToAccountID:   workshopAccountID,
+		Amount:        cost,
+		Memo: cash.Memo{
+			OurBankAccountName: "玩家",
+			CounterpartyAlias:  "园区工坊",
+			OurBankName:        "玩家银行",
+			CounterpartyBank:   "园区工坊银行",
+			Note:               fmt.Sprintf("制作%s x%d", item.Name(defaultLanguage), output),
+		},
+	})
+}
+
+// CraftingJobs 获取玩家制作中的任务，已到完成时间的任务先放入背包
+func (s *MarketService) CraftingJobs(ctx context.Context, userID int) ([]CraftingJob, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	completed, err := collectCraftingJobs(tx, userID, timeservice.SyncNow())
+	if err != nil {
+		return nil, internalError("完成制作任务失败", err)
+	}
+	jobs, err := tx.Inventory().ListCraftingJobs(userID)
+	if err != nil {
+		return nil, internalError("获取制作任务失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(craftingCompleted(completed)...)
+	return jobs, nil
+}
+
+// 获取制作中的任务
+func GetCraftingJobs(service *MarketService, w http.ResponseWriter, r *http.Request, userID int) {
+	jobs, err := service.CraftingJobs(r.Context(), userID)
+	if err != nil {
+		writeError(w, "market", "获取制作任务", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"jobs":    jobs,
+	})
+}
+
+// 玩家的工坊空闲的时刻：每个玩家的制作任务逐个进行，新任务在已排队的任务全部完成后才开始，
+// 制作时长因此限制了单位时间内能制作的数量
+func workshopFreeAt(tx Tx, userID int, now time.Time) (time.Time, error) {
+	jobs, err := tx.Inventory().ListCraftingJobs(userID)
+	if err != nil {
+		return now, err
+	}
+	freeAt := now
+	for _, job := range jobs {
+		if job.CompletesAt.After(freeAt) {
+			freeAt = job.CompletesAt
+		}
+	}
+	return freeAt, nil
+}
+
+// 制作任务开始时间之后的完成时间，同一批制作多份时逐份制作，时长按份数累计
+func craftingCompletesAt(recipe *Recipe, batches int, startedAt time.Time) time.Time {
+	return startedAt.Add(time.Duration(recipe.Duration*batches) * time.Second)
+}
+
+// 检查配方：产出数量为正，原料数量为正，费用和时长不为负
+func validateRecipe(recipe *Recipe) error {
+	if recipe.Output <= 0 {
+		return errors.New("产出数量必须为正数")
+	}
+	for _, input := range recipe.Inputs {
+		if input.Item == "" || input.Quantity <= 0 {
+			return fmt.Errorf("原料 %q 的数量必须为正数", input.Item)
+		}
+	}
+	if recipe.Cost.IsNegative() {
+		return errors.New("制作费用不能为负数")
+	}
+	if recipe.Duration < 0 {
+		return errors.New("制作时长不能为负数")
+	}
+	return nil
+}
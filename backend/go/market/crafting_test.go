@@ -0,0 +1,207 @@
+package market
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 写入一个已到完成时间的制作任务
+func addFinishedCraftingJob(t *testing.T, storage Storage, userID int, code string, quantity int) {
+	t.Helper()
+	now := timeservice.SyncNow()
+	withTx(t, storage, func(tx Tx) error {
+		return tx.Inventory().CreateCraftingJob(&CraftingJob{
+			UserID:      userID,
+			ItemCode:    code,
+			Quantity:    quantity,
+			Status:      CraftingJobPending,
+			StartedAt:   now.Add(-time.Minute),
+			CompletesAt: now.Add(-time.Second),
+		})
+	})
+}
+
+// 锁定背包物品前完成的制作任务发布完成事件，物品可以直接用于拍卖和挂单
+func TestLockBackpackItemsPublishesCraftingCompleted(t *testing.T) {
+	tests := []struct {
+		name string
+		lock func(storage Storage) error
+	}{
+		{"创建拍卖", func(storage Storage) error {
+			auction, err := NewAuctionService(storage).Create(context.Background(), 1, CreateAuctionRequest{
+				AuctionType: AuctionTypeEnglish, ItemType: "apple", InitialPrice: money.New(100), MinIncrement: money.New(10), Duration: 60, Quantity: 2,
+			})
+			if err == nil {
+				stopAuctionTimer(auction.ID)
+			}
+			return err
+		}},
+		{"挂卖单", func(storage Storage) error {
+			_, _, err := NewOrderBookService(storage).Place(context.Background(), 1, testOrder{1, OrderSideSell, OrderTypeLimit, 500, 2}.request())
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 0})
+			addFinishedCraftingJob(t, storage, 1, "apple", 2)
+			recorded := recordEvents(t)
+
+			checkErrorKind(t, tt.lock(storage), nil)
+			var completed []CraftingJob
+			for _, event := range recorded() {
+				if event, ok := event.(CraftingCompleted); ok && event.Job.UserID == 1 {
+					completed = append(completed, event.Job)
+				}
+			}
+			if len(completed) != 1 || completed[0].ItemCode != "apple" || completed[0].Status != CraftingJobCompleted {
+				t.Errorf("制作完成事件 = %+v，期望一个已完成的苹果制作任务", completed)
+			}
+			if got := quantityOf(t, storage, 1, "apple"); got != 0 {
+				t.Errorf("背包中的苹果 = %d，期望全部锁定", got)
+			}
+		})
+	}
+}
+
+// 制作物品：扣除原料和制作费用后排队制作，原料或余额不足时不做任何修改
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name     string
+		funds    int64 // 玩家初始余额（分）
+		wood     int   // 玩家初始木材
+		code     string
+		quantity int
+		err      error
+		balance  int64         // 制作后的余额
+		workshop int64         // 园区工坊收到的费用
+		woodLeft int           // 制作后的木材
+		output   int           // 制作任务的产出数量，0 表示没有任务
+		duration time.Duration // 制作任务的时长
+	}{
+		{"苹果按份数收费", 10000, 0, "apple", 2, nil, 9900, 100, 0, 2, 10 * time.Second},
+		{"数量为0时制作一份", 10000, 0, "apple", 0, nil, 9950, 50, 0, 1, 5 * time.Second},
+		{"木板消耗木材", 10000, 7, "plank", 2, nil, 9600, 400, 1, 2, 20 * time.Second},
+		{"原料不足", 10000, 5, "plank", 2, ErrInvalidArgument, 10000, 0, 5, 0, 0},
+		{"余额不足", 50, 0, "apple", 2, cash.ErrInsufficientFunds, 50, 0, 0, 0, 0},
+		{"原料足够余额不足", 150, 3, "plank", 1, cash.ErrInsufficientFunds, 150, 0, 3, 0, 0},
+		{"数量为负", 10000, 0, "apple", -1, ErrInvalidArgument, 10000, 0, 0, 0, 0},
+		{"物品不存在", 10000, 0, "gold", 1, ErrInvalidItemType, 10000, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: tt.funds})
+			giveItems(t, storage, 1, "wood", tt.wood)
+
+			result, err := NewMarketService(storage).Make(context.Background(), 1, tt.code, tt.quantity)
+			checkErrorKind(t, err, tt.err)
+			if got := balanceOf(t, storage, 1); got != tt.balance {
+				t.Errorf("余额 = %d，期望 %d", got, tt.balance)
+			}
+			if got := systemBalanceOf(t, storage, cash.AccountWorkshop); got != tt.workshop {
+				t.Errorf("园区工坊 = %d，期望 %d", got, tt.workshop)
+			}
+			if got := quantityOf(t, storage, 1, "wood"); got != tt.woodLeft {
+				t.Errorf("木材 = %d，期望 %d", got, tt.woodLeft)
+			}
+			jobs := craftingJobsOf(t, storage, 1)
+			if tt.output == 0 {
+				if len(jobs) != 0 {
+					t.Errorf("制作任务 = %+v，期望没有任务", jobs)
+				}
+				return
+			}
+			if len(jobs) != 1 || result.Job == nil || jobs[0].ID != result.Job.ID {
+				t.Fatalf("制作任务 = %+v，期望一个任务", jobs)
+			}
+			job := jobs[0]
+			if job.ItemCode != tt.code || job.Quantity != tt.output || job.CompletesAt.Sub(job.StartedAt) != tt.duration {
+				t.Errorf("制作任务 = %s x%d 时长 %s，期望 %s x%d 时长 %s",
+					job.ItemCode, job.Quantity, job.CompletesAt.Sub(job.StartedAt), tt.code, tt.output, tt.duration)
+			}
+			// 产出在完成时才放入背包
+			if got := quantityOf(t, storage, 1, tt.code); got != 0 {
+				t.Errorf("制作完成前背包中有 %d 个%s", got, tt.code)
+			}
+		})
+	}
+}
+
+// 同一玩家的制作任务逐个进行，新任务排在已有任务之后；到完成时间的任务在读取制作任务时放入背包
+func TestCraftingQueue(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 10000})
+	service := NewMarketService(storage)
+
+	first, err := service.Make(context.Background(), 1, "apple", 1)
+	checkErrorKind(t, err, nil)
+	second, err := service.Make(context.Background(), 1, "wood", 1)
+	checkErrorKind(t, err, nil)
+	if !second.Job.StartedAt.Equal(first.Job.CompletesAt) {
+		t.Errorf("第二个任务开始于 %s，期望第一个任务完成的 %s", second.Job.StartedAt, first.Job.CompletesAt)
+	}
+	if got := second.Job.CompletesAt.Sub(first.Job.StartedAt); got != 15*time.Second {
+		t.Errorf("两个任务共需 %s，期望 15s", got)
+	}
+
+	// 把第一个任务的完成时间移到过去
+	addFinishedCraftingJob(t, storage, 1, "apple", 3)
+	recorded := recordEvents(t)
+	jobs, err := service.CraftingJobs(context.Background(), 1)
+	checkErrorKind(t, err, nil)
+	if len(jobs) != 2 {
+		t.Errorf("制作中的任务 = %d 个，期望 2 个", len(jobs))
+	}
+	if got := quantityOf(t, storage, 1, "apple"); got != 3 {
+		t.Errorf("苹果 = %d，期望已完成任务的 3 个", got)
+	}
+	var completed int
+	for _, event := range recorded() {
+		if event, ok := event.(CraftingCompleted); ok && event.Job.UserID == 1 {
+			completed++
+		}
+	}
+	if completed != 1 {
+		t.Errorf("制作完成事件 = %d 个，期望 1 个", completed)
+	}
+}
+
+// 配方检查
+func TestValidateRecipe(t *testing.T) {
+	tests := []struct {
+		name   string
+		recipe Recipe
+		ok     bool
+	}{
+		{"有效", Recipe{Inputs: []RecipeInput{{"wood", 3}}, Cost: money.New(200), Output: 1, Duration: 10}, true},
+		{"无原料无费用", Recipe{Output: 1}, true},
+		{"产出为0", Recipe{Output: 0}, false},
+		{"原料数量为0", Recipe{Inputs: []RecipeInput{{"wood", 0}}, Output: 1}, false},
+		{"原料没有物品代码", Recipe{Inputs: []RecipeInput{{"", 1}}, Output: 1}, false},
+		{"费用为负", Recipe{Cost: money.New(-1), Output: 1}, false},
+		{"时长为负", Recipe{Output: 1, Duration: -1}, false},
+	}
+	for _, tt := range tests {
+		if err := validateRecipe(&tt.recipe); (err == nil) != tt.ok {
+			t.Errorf("%s: 错误 = %v，期望通过 %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+// 玩家制作中的任务
+func craftingJobsOf(t *testing.T, storage Storage, userID int) []CraftingJob {
+	t.Helper()
+	var jobs []CraftingJob
+	err := view(storage, func(tx Tx) (err error) {
+		jobs, err = tx.Inventory().ListCraftingJobs(userID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
@@ -0,0 +1,158 @@
+package market
+
+import (
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/money"
+)
+
+// 市场和拍卖的领域事件，均在事务提交后发布
+
+// AuctionCreated 拍卖已创建
+type AuctionCreated struct {
+	Auction Auction
+}
+
+// AuctionStarted 拍卖已启动
+type AuctionStarted struct {
+	Auction Auction
+}
+
+// AuctionPaused 拍卖已暂停
+type AuctionPaused struct {
+	Auction Auction
+}
+
+// AuctionResumed 已暂停的拍卖已恢复
+type AuctionResumed struct {
+	Auction Auction
+	Paused  time.Duration // 本次暂停时长
+}
+
+// AuctionCancelled 拍卖已取消（卖家取消或降到最低价流拍）
+type AuctionCancelled struct {
+	Auction Auction
+}
+
+// AuctionClosed 部分成交的拍卖降到最低价后结束，剩余物品已退还卖家
+type AuctionClosed struct {
+	Auction Auction
+	Unsold  int // 退还卖家的数量
+}
+
+// AuctionReactivated 拍卖已重新激活
+type AuctionReactivated struct {
+	Auction Auction
+}
+
+// BidAccepted 竞价成交，拍卖的剩余数量已扣减，售完时拍卖结束
+type BidAccepted struct {
+	Bid     AuctionBid
+	Auction Auction
+}
+
+// BidPlaced 英式拍卖出价成为最高出价，资金已冻结
+type BidPlaced struct {
+	Bid      AuctionBid
+	Auction  Auction
+	Extended bool // 出价触发防狙击，结束时间已顺延
+}
+
+// BidOutbid 英式拍卖出价被超越，资金已退还
+type BidOutbid struct {
+	Bid    AuctionBid // 被超越的出价
+	NewBid AuctionBid // 新的最高出价
+}
+
+// SealedBidSubmitted 密封拍卖收到出价，开标前不包含出价金额
+type SealedBidSubmitted struct {
+	AuctionID int
+	BidID     int
+	UserID    int
+}
+
+// SealedBidsRevealed 密封拍卖已开标，流拍时成交价为0
+type SealedBidsRevealed struct {
+	Auction       Auction
+	Bids          []AuctionBid // 开标后的全部出价，按出价从高到低
+	ClearingPrice money.Money
+}
+
+// PriceDecremented 拍卖价格已递减
+type PriceDecremented struct {
+	AuctionID     int
+	OldPrice      money.Money
+	NewPrice      money.Money
+	TimeRemaining int // 降到最低价的剩余时间（秒）
+}
+
+// ItemSold 玩家向市场卖出物品
+type ItemSold struct {
+	UserID   int
+	ItemCode string
+	Quantity int
+	Total    money.Money // 货款合计
+	Price    money.Money // 平均成交价格
+}
+
+// ItemBought 玩家从市场买入物品
+type ItemBought struct {
+	UserID   int
+	ItemCode string
+	Quantity int
+	Total    money.Money // 货款合计
+	Price    money.Money // 平均成交价格
+}
+
+// CraftingStarted 玩家开始制作需要制作时长的物品，原料和费用已扣除
+type CraftingStarted struct {
+	Job CraftingJob
+}
+
+// CraftingCompleted 制作任务已完成，产出已放入背包
+type CraftingCompleted struct {
+	Job CraftingJob
+}
+
+// OrderPlaced 玩家在订单簿下单，已与订单簿撮合
+type OrderPlaced struct {
+	Order Order
+}
+
+// OrderCancelled 玩家取消订单，未成交部分已退还
+type OrderCancelled struct {
+	Order Order
+}
+
+// TradeExecuted 订单簿成交，货款已付给卖家，物品已放入买家背包
+type TradeExecuted struct {
+	Trade Trade
+}
+
+func (AuctionCreated) EventName() string     { return "auction.created" }
+func (AuctionStarted) EventName() string     { return "auction.started" }
+func (AuctionPaused) EventName() string      { return "auction.paused" }
+func (AuctionResumed) EventName() string     { return "auction.resumed" }
+func (AuctionCancelled) EventName() string   { return "auction.cancelled" }
+func (AuctionClosed) EventName() string      { return "auction.closed" }
+func (AuctionReactivated) EventName() string { return "auction.reactivated" }
+func (BidAccepted) EventName() string        { return "auction.bid_accepted" }
+func (BidPlaced) EventName() string          { return "auction.bid_placed" }
+func (BidOutbid) EventName() string          { return "auction.bid_outbid" }
+func (SealedBidSubmitted) EventName() string { return "auction.sealed_bid_submitted" }
+func (SealedBidsRevealed) EventName() string { return "auction.sealed_bids_revealed" }
+func (PriceDecremented) EventName() string   { return "auction.price_decremented" }
+func (ItemSold) EventName() string           { return "market.item_sold" }
+func (ItemBought) EventName() string         { return "market.item_bought" }
+func (CraftingStarted) EventName() string    { return "market.crafting_started" }
+func (CraftingCompleted) EventName() string  { return "market.crafting_completed" }
+func (OrderPlaced) EventName() string        { return "market.order_placed" }
+func (OrderCancelled) EventName() string     { return "market.order_cancelled" }
+func (TradeExecuted) EventName() string      { return "market.trade_executed" }
+
+// 分录登记事件
+func ledgerPosted(entry *cash.JournalEntry) events.Event {
+	return cash.LedgerPosted{Entry: *entry}
+}
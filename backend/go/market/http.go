@@ -0,0 +1,76 @@
+package market
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/logger"
+)
+
+// 业务错误对应的HTTP状态码
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrAuctionNotFound), errors.Is(err, ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidArgument), errors.Is(err, ErrConflict),
+		errors.Is(err, ErrInvalidItemType), errors.Is(err, cash.ErrInsufficientFunds):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 写入JSON响应
+func writeJSON(w http.ResponseWriter, status int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// 记录日志并写入错误响应，内部错误附带底层错误信息
+func writeError(w http.ResponseWriter, component, action string, err error) {
+	logger.Info(component, fmt.Sprintf("%s失败: %v\n", action, err))
+
+	status := statusCode(err)
+	body := map[string]interface{}{
+		"success": false,
+		"message": "服务器内部错误",
+	}
+	var serviceErr *ServiceError
+	if errors.As(err, &serviceErr) {
+		body["message"] = serviceErr.Message
+		if serviceErr.Err != nil {
+			body["error"] = serviceErr.Err.Error()
+		}
+	} else if errors.Is(err, cash.ErrInsufficientFunds) {
+		body["message"] = "余额不足"
+	}
+	writeJSON(w, status, body)
+}
+
+// 只允许POST请求，否则写入 405 响应
+func requirePost(w http.ResponseWriter, r *http.Request, component, action string) bool {
+	if r.Method == "POST" {
+		return true
+	}
+	logger.Info(component, fmt.Sprintf("%s请求失败，不支持的请求方法: %s\n", action, r.Method))
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{
+		"success": false,
+		"message": "不支持的请求方法",
+	})
+	return false
+}
+
+// 解析请求体JSON，失败时写入 400 响应
+func decodeBody(w http.ResponseWriter, r *http.Request, component, action string, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, component, action, &ServiceError{Kind: ErrInvalidArgument, Message: "请求数据解析失败", Err: err})
+		return false
+	}
+	return true
+}
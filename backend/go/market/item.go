@@ -0,0 +1,124 @@
+package market
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/money"
+)
+
+// 物品名称的默认语言
+const defaultLanguage = "zh"
+
+// Item 物品目录中的物品。物品由数据定义，增加新物品只需在 items 表中写入一行
+type Item struct {
+	ID        int               `json:"id"`
+	Code      string            `json:"code"`      // 物品代码，接口和库存中用它标识物品
+	Names     map[string]string `json:"names"`     // 各语言的名称，key 为语言代码（zh、en）
+	BasePrice money.Money       `json:"basePrice"` // 基础价格，市场首次交易该物品时的初始价格
+	Recipe    *Recipe           `json:"recipe"`    // 制作配方，为空时不能制作
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Recipe 制作配方：消耗原料并支付费用，产出若干个物品。
+// 制作时长为0时立即放入背包，否则生成制作任务，到完成时间后放入背包
+type Recipe struct {
+	Inputs   []RecipeInput `json:"inputs,omitempty"`   // 原料，为空表示无需原料
+	Cost     money.Money   `json:"cost"`               // 制作费用，支付给园区工坊
+	Output   int           `json:"output"`             // 产出数量
+	Duration int           `json:"duration,omitempty"` // 制作时长（秒）
+}
+
+// RecipeInput 配方原料
+type RecipeInput struct {
+	Item     string `json:"item"`     // 物品代码
+	Quantity int    `json:"quantity"` // 消耗数量
+}
+
+// Name 物品在指定语言下的名称，没有该语言的名称时依次使用默认语言名称和物品代码
+func (i *Item) Name(language string) string {
+	if name := i.Names[language]; name != "" {
+		return name
+	}
+	if name := i.Names[defaultLanguage]; name != "" {
+		return name
+	}
+	return i.Code
+}
+
+// 内置物品，数据库迁移和内存存储据此初始化物品目录。
+// 苹果和木材没有原料，制作费用约为初始价格的一半、需要制作时长，避免无成本地批量制作后卖给市场
+func defaultItems() []Item {
+	marketConfig := config.GetConfig().Market
+	return []Item{
+		{
+			Code:      "apple",
+			Names:     map[string]string{"zh": "苹果", "en": "Apple"},
+			BasePrice: money.FromFloat(marketConfig.InitialApplePrice),
+			Recipe:    &Recipe{Cost: money.New(50), Output: 1, Duration: 5},
+		},
+		{
+			Code:      "wood",
+			Names:     map[string]string{"zh": "木材", "en": "Wood"},
+			BasePrice: money.FromFloat(marketConfig.InitialWoodPrice),
+			Recipe:    &Recipe{Cost: money.New(250), Output: 1, Duration: 10},
+		},
+		{
+			Code:      "plank",
+			Names:     map[string]string{"zh": "木板", "en": "Plank"},
+			BasePrice: money.FromFloat(marketConfig.InitialWoodPrice * 4),
+			Recipe: &Recipe{
+				Inputs:   []RecipeInput{{Item: "wood", Quantity: 3}},
+				Cost:     money.FromFloat(2),
+				Output:   1,
+				Duration: 10,
+			},
+		},
+	}
+}
+
+// 写入尚不存在的内置物品
+func seedCatalog(store MarketStore) error {
+	for _, item := range defaultItems() {
+		_, err := store.GetCatalogItem(item.Code)
+		if errors.Is(err, ErrItemNotFound) {
+			err = store.CreateCatalogItem(&item)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 在事务中读取物品目录中的物品，物品代码无效或不存在时返回业务错误
+func loadCatalogItem(tx Tx, code string) (*Item, error) {
+	if code == "" {
+		return nil, serviceError(ErrInvalidItemType, "物品代码不能为空")
+	}
+	item, err := tx.Market().GetCatalogItem(code)
+	if errors.Is(err, ErrItemNotFound) {
+		return nil, serviceError(ErrInvalidItemType, "无效的物品类型: %s", code)
+	}
+	if err != nil {
+		return nil, internalError("获取物品目录失败", err)
+	}
+	return item, nil
+}
+
+// 获取物品目录
+func GetCatalog(service *MarketService, w http.ResponseWriter, r *http.Request) {
+	items, err := service.Catalog(r.Context())
+	if err != nil {
+		writeError(w, "market", "获取物品目录", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"items":   items,
+	})
+}
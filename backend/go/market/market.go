@@ -1,1128 +1,288 @@
 package market
 
 import (
-	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
-	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/cash"
 	"own-1Pixel/backend/go/logger"
-	"own-1Pixel/backend/go/timeservice"
+	"own-1Pixel/backend/go/money"
 )
 
-// 物品类型枚举
-type ItemType string
-
-const (
-	ItemTypeApple ItemType = "apple"
-	ItemTypeWood  ItemType = "wood"
-)
-
-// 翻译物品类型名称
-func (it ItemType) translateName(language string) string {
-	switch language {
-	case "中文":
-		switch it {
-		case ItemTypeApple:
-			return "苹果"
-		case ItemTypeWood:
-			return "木材"
-		default:
-			return string(it)
-		}
-	default:
-		return string(it)
-	}
-}
-
-// 市场参数结构
+// 市场参数结构，物品代码为空的一组参数是默认参数，物品可以有自己的一组参数
 type MarketParams struct {
 	ID               int       `json:"id"`
+	ItemCode         string    `json:"itemCode"`         // 适用的物品代码，空为默认参数
+	PriceModel       string    `json:"priceModel"`       // 定价模型: linear, amm, lmsr, ema
 	BalanceRange     float64   `json:"balanceRange"`     // 平衡区间系数
 	PriceFluctuation float64   `json:"priceFluctuation"` // 价格波动系数
 	MaxPriceChange   float64   `json:"maxPriceChange"`   // 最大价格变动系数
+	Liquidity        float64   `json:"liquidity"`        // 流动性参数：做市模型的虚拟库存、LMSR的b值
+	Smoothing        float64   `json:"smoothing"`        // 指数移动平均模型的平滑系数，0到1之间
+	MinPriceRatio    float64   `json:"minPriceRatio"`    // 价格下限相对基础价格的比例
+	MaxPriceRatio    float64   `json:"maxPriceRatio"`    // 价格上限相对基础价格的比例
 	CreatedAt        time.Time `json:"created_at"`
 	UpdatedAt        time.Time `json:"updated_at"`
 }
 
-// 背包结构
+// 背包结构，由玩家库存中数量不为0的物品组成
 type Backpack struct {
-	ID        int       `json:"id"`
-	Apple     int       `json:"apple"`
-	Wood      int       `json:"wood"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	UserID int            `json:"user_id"` // 玩家ID
+	Items  map[string]int `json:"items"`   // 物品代码 -> 数量
 }
 
-// 市场物品结构
+// 市场物品结构，记录物品在市场上的当前价格和库存
 type MarketItem struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Price     float64   `json:"price"`
-	Stock     int       `json:"stock"`
-	BasePrice float64   `json:"basePrice"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int         `json:"id"`
+	Name      string      `json:"name"` // 物品代码
+	Price     money.Money `json:"price"`
+	Stock     int         `json:"stock"`
+	BasePrice money.Money `json:"basePrice"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
 }
 
-// 市场物品集合
-type MarketItems struct {
-	Apple MarketItem `json:"apple"`
-	Wood  MarketItem `json:"wood"`
-}
-
-// 初始化市场数据库
-func InitMarketDatabase(dbConn *sql.DB) error {
-	// 获取全局配置实例
-	_config := config.GetConfig()
-	marketConfig := _config.Market
-
-	logger.Info("market", "初始化市场数据库\n")
-
-	var currentTime time.Time
-
-	// 创建市场参数表
-	_, err := dbConn.Exec(`
-		CREATE TABLE IF NOT EXISTS market_params (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			balance_range REAL NOT NULL DEFAULT 1.0,
-			price_fluctuation REAL NOT NULL DEFAULT 1.0,
-			max_price_change REAL NOT NULL DEFAULT 1.0,
-			created_at DATETIME,
-			updated_at DATETIME
-		)
-	`)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("创建市场参数表失败: %v\n", err))
-		return err
-	}
-
-	// 创建背包表
-	_, err = dbConn.Exec(`
-		CREATE TABLE IF NOT EXISTS backpack (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			apple INTEGER NOT NULL DEFAULT 0,
-			wood INTEGER NOT NULL DEFAULT 0,
-			created_at DATETIME,
-			updated_at DATETIME
-		)
-	`)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("创建背包表失败: %v\n", err))
-		return err
-	}
-
-	// 创建市场物品表
-	_, err = dbConn.Exec(`
-		CREATE TABLE IF NOT EXISTS market_items (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL UNIQUE,
-			price REAL NOT NULL,
-			stock INTEGER NOT NULL DEFAULT 0,
-			base_price REAL NOT NULL,
-			created_at DATETIME,
-			updated_at DATETIME
-		)
-	`)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("创建市场物品表失败: %v\n", err))
-		return err
-	}
-
-	// 检查是否有市场参数记录，如果没有则初始化
-	var count int
-	err = dbConn.QueryRow("SELECT COUNT(*) FROM market_params").Scan(&count)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("查询市场参数记录数量失败: %v\n", err))
-		return err
-	}
-
-	if count == 0 {
-		currentTime = timeservice.SyncNow()
-		_, err = dbConn.Exec("INSERT INTO market_params (balance_range, price_fluctuation, max_price_change, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-			marketConfig.DefaultBalance, marketConfig.DefaultFluctuation, marketConfig.DefaultMaxChange, currentTime, currentTime)
-		if err != nil {
-			logger.Info("market", fmt.Sprintf("初始化市场参数记录失败: %v\n", err))
-			return err
-		}
-	}
-
-	// 检查是否有背包记录，如果没有则初始化
-	err = dbConn.QueryRow("SELECT COUNT(*) FROM backpack").Scan(&count)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("查询背包记录数量失败: %v\n", err))
-		return err
-	}
-
-	if count == 0 {
-		currentTime = timeservice.SyncNow()
-		_, err = dbConn.Exec("INSERT INTO backpack (apple, wood, created_at, updated_at) VALUES (0, 0, ?, ?)", currentTime, currentTime)
-		if err != nil {
-			logger.Info("market", fmt.Sprintf("初始化背包记录失败: %v\n", err))
-			return err
-		}
-	}
-
-	// 检查是否有市场物品记录，如果没有则初始化
-	err = dbConn.QueryRow("SELECT COUNT(*) FROM market_items WHERE name IN ('apple', 'wood')").Scan(&count)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("查询市场物品记录数量失败: %v\n", err))
-		return err
-	}
-
-	if count < 2 {
-		// 检查是否有苹果记录
-		var appleCount int
-		dbConn.QueryRow("SELECT COUNT(*) FROM market_items WHERE name = 'apple'").Scan(&appleCount)
-		if appleCount == 0 {
-			currentTime = timeservice.SyncNow()
-			_, err = dbConn.Exec("INSERT INTO market_items (name, price, stock, base_price, created_at, updated_at) VALUES ('apple', ?, 0, ?, ?, ?)",
-				marketConfig.InitialApplePrice, marketConfig.InitialApplePrice, currentTime, currentTime)
-			if err != nil {
-				logger.Info("market", fmt.Sprintf("初始化苹果物品记录失败: %v\n", err))
-				return err
-			}
-		}
-
-		// 检查是否有木材记录
-		var woodCount int
-		dbConn.QueryRow("SELECT COUNT(*) FROM market_items WHERE name = 'wood'").Scan(&woodCount)
-		if woodCount == 0 {
-			currentTime = timeservice.SyncNow()
-			_, err = dbConn.Exec("INSERT INTO market_items (name, price, stock, base_price, created_at, updated_at) VALUES ('wood', ?, 0, ?, ?, ?)",
-				marketConfig.InitialWoodPrice, marketConfig.InitialWoodPrice, currentTime, currentTime)
-			if err != nil {
-				logger.Info("market", fmt.Sprintf("初始化木材物品记录失败: %v\n", err))
-				return err
-			}
-		}
-	}
-
-	logger.Info("market", "市场数据库初始化完成\n")
-	return nil
-}
+// 市场物品集合，物品代码 -> 市场物品
+type MarketItems map[string]MarketItem
 
 // 获取市场参数
-func GetMarketParams(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var params MarketParams
-	err := db.QueryRow("SELECT id, balance_range, price_fluctuation, max_price_change, created_at, updated_at FROM market_params ORDER BY id DESC LIMIT 1").Scan(
-		&params.ID, &params.BalanceRange, &params.PriceFluctuation, &params.MaxPriceChange, &params.CreatedAt, &params.UpdatedAt)
+func GetMarketParams(service *MarketService, w http.ResponseWriter, r *http.Request) {
+	params, itemParams, err := service.Params(r.Context())
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取市场参数失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取市场参数失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "获取市场参数", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"params":  params,
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":     true,
+		"params":      params,
+		"itemParams":  itemParams,
+		"priceModels": priceModelNames,
 	})
 }
 
-// 更新市场参数
-func UpdateMarketParams(db *sql.DB, params MarketParams) error {
-	currentTime := timeservice.SyncNow()
-	_, err := db.Exec("UPDATE market_params SET balance_range = ?, price_fluctuation = ?, max_price_change = ?, updated_at = ? WHERE id = ?",
-		params.BalanceRange, params.PriceFluctuation, params.MaxPriceChange, currentTime, params.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新市场参数失败: %v\n", err))
-		return err
-	}
-	return nil
-}
-
 // 保存市场参数
-func SaveMarketParams(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != "POST" {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
+func SaveMarketParams(service *MarketService, w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r, "market", "保存市场参数") {
 		return
 	}
 
 	logger.Info("market", "更新市场参数\n")
 
 	var params MarketParams
-	err := json.NewDecoder(r.Body).Decode(&params)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "解析请求数据失败",
-			"error":   err.Error(),
-		})
+	if !decodeBody(w, r, "market", "保存市场参数", &params) {
 		return
 	}
 
-	// 获取当前参数ID
-	var currentID int
-	err = db.QueryRow("SELECT id FROM market_params ORDER BY id DESC LIMIT 1").Scan(&currentID)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取当前参数ID失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	params.ID = currentID
-
-	// 更新市场参数
-	err = UpdateMarketParams(db, params)
+	saved, err := service.UpdateParams(r.Context(), params)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新市场参数失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "更新市场参数", err)
 		return
 	}
 
-	logger.Info("market", fmt.Sprintf("成功更新市场参数: 平衡区间=%.2f, 价格波动=%.2f, 最大价格变动=%.2f\n", params.BalanceRange, params.PriceFluctuation, params.MaxPriceChange))
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"message": "市场参数更新成功",
-		"params":  params,
+		"params":  saved,
 	})
 }
 
 // 获取背包状态
-func GetBackpack(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var backpack Backpack
-	err := db.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
+func GetBackpack(service *MarketService, w http.ResponseWriter, r *http.Request, userID int) {
+	backpack, err := service.Backpack(r.Context(), userID)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取背包状态失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取背包状态失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "获取背包状态", err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
 		"backpack": backpack,
 	})
 }
 
-// 更新背包
-func UpdateBackpack(db *sql.DB, backpack Backpack) error {
-	_, err := db.Exec("UPDATE backpack SET apple = ?, wood = ?, updated_at = ? WHERE id = ?",
-		backpack.Apple, &backpack.Wood, timeservice.SyncNow(), backpack.ID)
+// 读取物品目录中全部物品的市场物品，尚未在市场上交易过的物品按基础价格、零库存展示
+func loadMarketItems(store MarketStore) (MarketItems, error) {
+	catalog, err := store.ListCatalogItems()
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新背包失败: %v\n", err))
-		return err
+		return nil, fmt.Errorf("获取物品目录失败: %w", err)
+	}
+	items := make(MarketItems, len(catalog))
+	for _, entry := range catalog {
+		item, err := store.GetItem(entry.Code)
+		if errors.Is(err, ErrMarketItemNotFound) {
+			item = &MarketItem{Name: entry.Code, Price: entry.BasePrice, BasePrice: entry.BasePrice}
+		} else if err != nil {
+			return nil, fmt.Errorf("获取%s的市场信息失败: %w", entry.Name(defaultLanguage), err)
+		}
+		items[entry.Code] = *item
 	}
-	return nil
+	return items, nil
 }
 
-// 获取市场物品
-func GetMarketItems(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// 获取苹果
-	var apple MarketItem
-	err := db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'apple'").Scan(
-		&apple.ID, &apple.Name, &apple.Price, &apple.Stock, &apple.BasePrice, &apple.CreatedAt, &apple.UpdatedAt)
+// 在事务中读取物品的市场物品，首次交易的物品按基础价格创建
+func loadMarketItem(store MarketStore, entry *Item) (*MarketItem, error) {
+	item, err := store.GetItem(entry.Code)
+	if errors.Is(err, ErrMarketItemNotFound) {
+		item = &MarketItem{Name: entry.Code, Price: entry.BasePrice, BasePrice: entry.BasePrice}
+		err = store.CreateItem(item)
+	}
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取苹果物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取苹果物品信息失败",
-			"error":   err.Error(),
-		})
-		return
+		return nil, err
 	}
+	return item, nil
+}
 
-	// 获取木材
-	var wood MarketItem
-	err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'wood'").Scan(
-		&wood.ID, &wood.Name, &wood.Price, &wood.Stock, &wood.BasePrice, &wood.CreatedAt, &wood.UpdatedAt)
+// 获取市场物品
+func GetMarketItems(service *MarketService, w http.ResponseWriter, r *http.Request) {
+	items, err := service.Items(r.Context())
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取木材物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取木材物品信息失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "获取市场物品", err)
 		return
 	}
 
-	items := MarketItems{
-		Apple: apple,
-		Wood:  wood,
-	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success": true,
 		"items":   items,
 	})
 }
 
-// 更新市场物品价格和库存
-func UpdateMarketItem(db *sql.DB, item MarketItem) error {
-	_, err := db.Exec("UPDATE market_items SET price = ?, stock = ?, updated_at = ? WHERE id = ?",
-		item.Price, item.Stock, timeservice.SyncNow(), item.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新市场物品失败: %v\n", err))
-		return err
-	}
-	return nil
+// 计算新价格：按市场参数选择的定价模型计算库存变为 stock 后的价格，
+// 并限制在市场参数设置的价格区间内
+func CalculateNewPrice(currentPrice money.Money, stock int, params MarketParams, basePrice money.Money) money.Money {
+	return clampPrice(priceModel(params, basePrice).Price(currentPrice, stock), basePrice, params)
 }
 
-// 计算新价格
-func CalculateNewPrice(currentPrice float64, stock int, params MarketParams, basePrice float64) float64 {
-	// 计算平衡区间
-	balanceRange := params.BalanceRange * 5 // 假设5个物品为平衡点
-
-	// 计算价格变动
-	var priceChange float64
-	if stock > int(balanceRange) {
-		// 供过于求，价格下降
-		excess := float64(stock - int(balanceRange))
-		priceChange = -excess * params.PriceFluctuation * 0.1
-	} else if stock < int(balanceRange) {
-		// 供不应求，价格上涨
-		shortage := float64(int(balanceRange) - stock)
-		priceChange = shortage * params.PriceFluctuation * 0.1
-	} else {
-		// 供求平衡，价格不变
-		return currentPrice
-	}
-
-	// 限制价格变动幅度
-	if priceChange > params.MaxPriceChange {
-		priceChange = params.MaxPriceChange
-	} else if priceChange < -params.MaxPriceChange {
-		priceChange = -params.MaxPriceChange
-	}
-
-	// 计算新价格
-	newPrice := currentPrice + priceChange
-
-	// 确保价格不低于基础价格的50%，不高于基础价格的200%
-	minPrice := basePrice * 0.5
-	maxPrice := basePrice * 2.0
-
-	if newPrice < minPrice {
-		newPrice = minPrice
-	} else if newPrice > maxPrice {
-		newPrice = maxPrice
-	}
-
-	return newPrice
+// 物品操作请求
+type itemRequest struct {
+	ItemCode string `json:"item_code"` // 物品代码
+	Quantity int    `json:"quantity"`  // 买卖或制作的数量，未指定时为1个
 }
 
 // 制作物品
-func MakeItem(db *sql.DB, w http.ResponseWriter, r *http.Request, itemType ItemType) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var currentTime time.Time
-
-	if r.Method != "POST" {
-		logger.Info("market", fmt.Sprintf("制作物品请求失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	logger.Info("market", fmt.Sprintf("制作物品: %s\n", itemType))
-
-	// 获取当前背包
-	var backpack Backpack
-	err := db.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取背包状态失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取背包状态失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 根据物品类型更新背包
-	switch itemType {
-	case ItemTypeApple:
-		backpack.Apple++
-	case ItemTypeWood:
-		backpack.Wood++
-	default:
-		logger.Info("market", fmt.Sprintf("制作物品失败，无效的物品类型: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "无效的物品类型",
-		})
-		return
-	}
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("开始事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "开始事务失败",
-			"error":   err.Error(),
-		})
+func MakeItem(service *MarketService, w http.ResponseWriter, r *http.Request, userID int) {
+	if !requirePost(w, r, "market", "制作物品") {
 		return
 	}
 
-	// 更新背包
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE backpack SET apple = ?, wood = ?, updated_at = ? WHERE id = ?",
-		backpack.Apple, backpack.Wood, currentTime, backpack.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新背包失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新背包失败",
-			"error":   err.Error(),
-		})
+	var data itemRequest
+	if !decodeBody(w, r, "market", "制作物品", &data) {
 		return
 	}
 
-	// 添加交易记录，收入和支出都为0，备注为制作苹果或制作木材
-	note := ""
-	switch itemType {
-	case ItemTypeApple:
-		note = "制作苹果"
-	case ItemTypeWood:
-		note = "制作木材"
-	}
+	logger.Info("market", fmt.Sprintf("玩家 %d 制作物品: %s x%d\n", userID, data.ItemCode, data.Quantity))
 
-	// 隐私数据
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(
-		"INSERT INTO transactions (transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, note, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		currentTime, "玩家", "系统", "玩家银行", "系统银行", 0, 0, note, currentTime)
+	result, err := service.Make(r.Context(), userID, data.ItemCode, data.Quantity)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("添加交易记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "添加交易记录失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "制作物品", err)
 		return
 	}
 
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("提交事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "提交事务失败",
-			"error":   err.Error(),
-		})
-		return
+	message := "物品制作成功"
+	if result.Job != nil {
+		message = "开始制作，完成后放入背包"
 	}
-
-	logger.Info("market", fmt.Sprintf("成功制作物品: %s\n", itemType))
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"success":  true,
-		"message":  "物品制作成功",
-		"backpack": backpack,
+		"message":  message,
+		"backpack": result.Backpack,
+		"job":      result.Job,
 	})
 }
 
 // 卖出物品
-func SellItem(db *sql.DB, w http.ResponseWriter, r *http.Request, itemType ItemType) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var currentTime time.Time
-
-	if r.Method != "POST" {
-		logger.Info("market", fmt.Sprintf("卖出物品请求失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	logger.Info("market", fmt.Sprintf("卖出物品: %s\n", itemType))
-
-	// 获取当前背包
-	var backpack Backpack
-	err := db.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取背包状态失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取背包状态失败",
-			"error":   err.Error(),
-		})
+func SellItem(service *MarketService, w http.ResponseWriter, r *http.Request, userID int) {
+	if !requirePost(w, r, "market", "卖出物品") {
 		return
 	}
 
-	// 检查背包中是否有足够的物品
-	if itemType == ItemTypeApple && backpack.Apple <= 0 {
-		logger.Info("market", "卖出物品失败，背包中没有苹果\n")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "卖出物品失败，背包中没有苹果",
-		})
-		return
-	} else if itemType == ItemTypeWood && backpack.Wood <= 0 {
-		logger.Info("market", "卖出物品失败，背包中没有木材\n")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "卖出物品失败，背包中没有木材",
-		})
+	var data itemRequest
+	if !decodeBody(w, r, "market", "卖出物品", &data) {
 		return
 	}
 
-	// 获取当前市场物品
-	var item MarketItem
-	switch itemType {
-	case ItemTypeApple:
-		err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'apple'").Scan(
-			&item.ID, &item.Name, &item.Price, &item.Stock, &item.BasePrice, &item.CreatedAt, &item.UpdatedAt)
-	case ItemTypeWood:
-		err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'wood'").Scan(
-			&item.ID, &item.Name, &item.Price, &item.Stock, &item.BasePrice, &item.CreatedAt, &item.UpdatedAt)
-	default:
-		logger.Info("market", fmt.Sprintf("卖出物品失败，无效的物品类型: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "卖出物品失败，无效的物品类型",
-		})
-		return
-	}
+	logger.Info("market", fmt.Sprintf("玩家 %d 卖出物品: %s x%d\n", userID, data.ItemCode, data.Quantity))
 
+	result, err := service.Sell(r.Context(), userID, data.ItemCode, data.Quantity)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取市场物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取市场物品信息失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "卖出物品", err)
 		return
 	}
 
-	// 获取当前余额
-	var balance struct {
-		ID        int       `json:"id"`
-		Amount    float64   `json:"amount"`
-		UpdatedAt time.Time `json:"updated_at"`
-	}
-	err = db.QueryRow("SELECT id, amount, updated_at FROM balance ORDER BY id DESC LIMIT 1").Scan(&balance.ID, &balance.Amount, &balance.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取账户余额失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取账户余额失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 获取市场参数
-	var params MarketParams
-	err = db.QueryRow("SELECT id, balance_range, price_fluctuation, max_price_change, created_at, updated_at FROM market_params ORDER BY id DESC LIMIT 1").Scan(
-		&params.ID, &params.BalanceRange, &params.PriceFluctuation, &params.MaxPriceChange, &params.CreatedAt, &params.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取市场参数失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取市场参数失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 更新背包
-	switch itemType {
-	case ItemTypeApple:
-		backpack.Apple--
-	case ItemTypeWood:
-		backpack.Wood--
-	default:
-		logger.Info("market", fmt.Sprintf("卖出物品失败，无效的物品类型: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "卖出物品失败，无效的物品类型",
-		})
-		return
-	}
-
-	// 更新市场物品库存
-	item.Stock++
-
-	// 计算新价格
-	item.Price = CalculateNewPrice(item.Price, item.Stock, params, item.BasePrice)
-
-	// 更新余额
-	newBalance := balance.Amount + item.Price
-
-	// 开始事务
-	tx, err := db.Begin()
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("开始事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "开始事务失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 更新背包
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE backpack SET apple = ?, wood = ?, updated_at = ? WHERE id = ?",
-		backpack.Apple, backpack.Wood, currentTime, backpack.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新背包失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新背包失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 更新市场物品
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE market_items SET price = ?, stock = ?, updated_at = ? WHERE id = ?",
-		item.Price, item.Stock, currentTime, item.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新市场物品失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新市场物品失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 更新余额
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE balance SET amount = ?, updated_at = ? WHERE id = ?",
-		newBalance, currentTime, balance.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新余额失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新余额失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 添加交易记录
-	// 隐私数据
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(
-		"INSERT INTO transactions (transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, note, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		currentTime, "萌铺子市场", "玩家", "萌铺子市场银行", "玩家银行", 0, item.Price, fmt.Sprintf("卖出%s", itemType), currentTime)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("添加交易记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "添加交易记录失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("提交事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "提交事务失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	logger.Info("market", fmt.Sprintf("成功卖出物品: %s，价格: %.2f\n", itemType, item.Price))
-
-	// 获取更新后的市场物品
-	var apple MarketItem
-	err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'apple'").Scan(
-		&apple.ID, &apple.Name, &apple.Price, &apple.Stock, &apple.BasePrice, &apple.CreatedAt, &apple.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取苹果物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取苹果物品信息失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	var wood MarketItem
-	err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'wood'").Scan(
-		&wood.ID, &wood.Name, &wood.Price, &wood.Stock, &wood.BasePrice, &wood.CreatedAt, &wood.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取木材物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取木材物品信息失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	items := MarketItems{
-		Apple: apple,
-		Wood:  wood,
-	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":     true,
-		"message":     "物品卖出成功",
-		"backpack":    backpack,
-		"marketItems": items,
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"message":      fmt.Sprintf("物品卖出成功 %d 个", result.Quantity),
+		"quantity":     result.Quantity,
+		"total":        result.Total,
+		"averagePrice": result.AveragePrice,
+		"price":        result.Price,
+		"backpack":     result.Backpack,
+		"marketItems":  result.Items,
 	})
 }
 
 // 买入物品
-func BuyItem(db *sql.DB, w http.ResponseWriter, r *http.Request, itemType ItemType) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var currentTime time.Time
-
-	if r.Method != "POST" {
-		logger.Info("market", fmt.Sprintf("买入物品请求失败，不支持的请求方法: %s\n", r.Method))
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "不支持的请求方法",
-		})
-		return
-	}
-
-	logger.Info("market", fmt.Sprintf("买入物品: %s\n", itemType))
-
-	// 获取当前市场物品
-	var item MarketItem
-	switch itemType {
-	case ItemTypeApple:
-		err := db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'apple'").Scan(
-			&item.ID, &item.Name, &item.Price, &item.Stock, &item.BasePrice, &item.CreatedAt, &item.UpdatedAt)
-		if err != nil {
-			logger.Info("market", fmt.Sprintf("获取苹果物品信息失败: %v\n", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "获取苹果物品信息失败",
-				"error":   err.Error(),
-			})
-			return
-		}
-	case ItemTypeWood:
-		err := db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'wood'").Scan(
-			&item.ID, &item.Name, &item.Price, &item.Stock, &item.BasePrice, &item.CreatedAt, &item.UpdatedAt)
-		if err != nil {
-			logger.Info("market", fmt.Sprintf("获取木材物品信息失败: %v\n", err))
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"message": "获取木材物品信息失败",
-				"error":   err.Error(),
-			})
-			return
-		}
-	default:
-		logger.Info("market", fmt.Sprintf("买入物品失败，无效的物品类型: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "无效的物品类型",
-		})
-		return
-	}
-
-	// 检查市场物品库存
-	if item.Stock <= 0 {
-		logger.Info("market", fmt.Sprintf("买入物品失败，市场库存不足: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": fmt.Sprintf("库存中没有%s", ItemType(itemType).translateName("中文")),
-		})
-		return
-	}
-
-	// 获取当前余额
-	var balance struct {
-		ID        int       `json:"id"`
-		Amount    float64   `json:"amount"`
-		UpdatedAt time.Time `json:"updated_at"`
-	}
-	err := db.QueryRow("SELECT id, amount, updated_at FROM balance ORDER BY id DESC LIMIT 1").Scan(&balance.ID, &balance.Amount, &balance.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取账户余额失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取账户余额失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 检查余额是否足够
-	if balance.Amount < item.Price {
-		logger.Info("market", fmt.Sprintf("买入物品失败，余额不足，需要: %.2f，当前余额: %.2f\n", item.Price, balance.Amount))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "余额不足",
-		})
-		return
-	}
-
-	// 获取当前背包
-	var backpack Backpack
-	err = db.QueryRow("SELECT id, apple, wood, created_at, updated_at FROM backpack ORDER BY id DESC LIMIT 1").Scan(
-		&backpack.ID, &backpack.Apple, &backpack.Wood, &backpack.CreatedAt, &backpack.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取背包状态失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取背包状态失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 获取市场参数
-	var params MarketParams
-	err = db.QueryRow("SELECT id, balance_range, price_fluctuation, max_price_change, created_at, updated_at FROM market_params ORDER BY id DESC LIMIT 1").Scan(
-		&params.ID, &params.BalanceRange, &params.PriceFluctuation, &params.MaxPriceChange, &params.CreatedAt, &params.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取市场参数失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取市场参数失败",
-			"error":   err.Error(),
-		})
+func BuyItem(service *MarketService, w http.ResponseWriter, r *http.Request, userID int) {
+	if !requirePost(w, r, "market", "买入物品") {
 		return
 	}
 
-	// 更新背包
-	switch itemType {
-	case ItemTypeApple:
-		backpack.Apple++
-	case ItemTypeWood:
-		backpack.Wood++
-	default:
-		logger.Info("market", fmt.Sprintf("买入物品失败，无效的物品类型: %s\n", itemType))
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "无效的物品类型",
-		})
+	var data itemRequest
+	if !decodeBody(w, r, "market", "买入物品", &data) {
 		return
 	}
 
-	// 更新市场物品库存
-	item.Stock--
+	logger.Info("market", fmt.Sprintf("玩家 %d 买入物品: %s x%d\n", userID, data.ItemCode, data.Quantity))
 
-	// 计算新价格
-	item.Price = CalculateNewPrice(item.Price, item.Stock, params, item.BasePrice)
-
-	// 更新余额
-	newBalance := balance.Amount - item.Price
-
-	// 开始事务
-	tx, err := db.Begin()
+	result, err := service.Buy(r.Context(), userID, data.ItemCode, data.Quantity)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("开始事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "开始事务失败",
-			"error":   err.Error(),
-		})
+		writeError(w, "market", "买入物品", err)
 		return
 	}
 
-	// 更新背包
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE backpack SET apple = ?, wood = ?, updated_at = ? WHERE id = ?",
-		backpack.Apple, backpack.Wood, currentTime, backpack.ID)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新背包失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新背包失败",
-			"error":   err.Error(),
-		})
-		return
-	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"message":      fmt.Sprintf("物品买入成功 %d 个", result.Quantity),
+		"quantity":     result.Quantity,
+		"total":        result.Total,
+		"averagePrice": result.AveragePrice,
+		"price":        result.Price,
+		"backpack":     result.Backpack,
+		"marketItems":  result.Items,
+	})
+}
 
-	// 更新市场物品
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE market_items SET price = ?, stock = ?, updated_at = ? WHERE id = ?",
-		item.Price, item.Stock, currentTime, item.ID)
+// 结算市场买卖，玩家与萌铺子市场账户之间转账并写入交易记录，返回登记的分录
+func settleMarketTrade(ledger cash.LedgerStore, userID int, item *Item, quantity int, amount money.Money, buy bool) (*cash.JournalEntry, error) {
+	userAccountID, err := cash.UserCashAccountID(ledger, userID)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新市场物品失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新市场物品失败",
-			"error":   err.Error(),
-		})
-		return
+		return nil, err
 	}
-
-	// 更新余额
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec("UPDATE balance SET amount = ?, updated_at = ? WHERE id = ?",
-		newBalance, currentTime, balance.ID)
+	marketAccountID, err := cash.AccountIDByCode(ledger, cash.AccountMarket)
 	if err != nil {
-		logger.Info("market", fmt.Sprintf("更新余额失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "更新余额失败",
-			"error":   err.Error(),
-		})
-		return
+		return nil, err
 	}
 
-	// 添加交易记录
 	// 隐私数据
-	currentTime = timeservice.SyncNow()
-	_, err = tx.Exec(
-		"INSERT INTO transactions (transaction_time, our_bank_account_name, counterparty_alias, our_bank_name, counterparty_bank, expense_amount, income_amount, note, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		currentTime, "玩家", "萌铺子市场", "玩家银行", "萌铺子市场银行", item.Price, 0, fmt.Sprintf("买入%s", itemType), currentTime)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("添加交易记录失败: %v\n", err))
-		tx.Rollback()
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "添加交易记录失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	// 提交事务
-	err = tx.Commit()
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("提交事务失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "提交事务失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	logger.Info("market", fmt.Sprintf("成功买入物品: %s，价格: %.2f\n", itemType, item.Price))
-
-	// 获取更新后的市场物品
-	var apple MarketItem
-	err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'apple'").Scan(
-		&apple.ID, &apple.Name, &apple.Price, &apple.Stock, &apple.BasePrice, &apple.CreatedAt, &apple.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取苹果物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取苹果物品信息失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	var wood MarketItem
-	err = db.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = 'wood'").Scan(
-		&wood.ID, &wood.Name, &wood.Price, &wood.Stock, &wood.BasePrice, &wood.CreatedAt, &wood.UpdatedAt)
-	if err != nil {
-		logger.Info("market", fmt.Sprintf("获取木材物品信息失败: %v\n", err))
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"message": "获取木材物品信息失败",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	items := MarketItems{
-		Apple: apple,
-		Wood:  wood,
+	memo := cash.Memo{
+		OurBankAccountName: "玩家",
+		CounterpartyAlias:  "萌铺子市场",
+		OurBankName:        "玩家银行",
+		CounterpartyBank:   "萌铺子市场银行",
+	}
+	req := cash.TransferRequest{Amount: amount}
+	if buy {
+		memo.Note = fmt.Sprintf("买入%s x%d", item.Name(defaultLanguage), quantity)
+		req.Kind = cash.EntryKindMarketBuy
+		req.FromAccountID, req.ToAccountID = userAccountID, marketAccountID
+		req.Memo = memo
+	} else {
+		memo.Note = fmt.Sprintf("卖出%s x%d", item.Name(defaultLanguage), quantity)
+		req.Kind = cash.EntryKindMarketSell
+		req.FromAccountID, req.ToAccountID = marketAccountID, userAccountID
+		req.Memo = memo.Swapped()
 	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":     true,
-		"message":     "物品买入成功",
-		"backpack":    backpack,
-		"marketItems": items,
-	})
+	return cash.Transfer(ledger, req)
 }
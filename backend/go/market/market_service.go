@@ -0,0 +1,506 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// MarketService 萌铺子市场业务：市场参数、物品目录、背包、制作和买卖物品
+type MarketService struct {
+	storage Storage
+}
+
+// NewMarketService 创建市场业务服务
+func NewMarketService(storage Storage) *MarketService {
+	return &MarketService{storage: storage}
+}
+
+// 一次买卖或制作的最大数量
+const maxBatchQuantity = 10000
+
+// TradeResult 买卖物品的结果
+type TradeResult struct {
+	Quantity     int         // 成交数量
+	Total        money.Money // 成交总额
+	AveragePrice money.Money // 平均成交价格
+	Price        money.Money // 交易后的市场价格
+	Backpack     *Backpack   // 交易后的背包
+	Items        MarketItems // 交易后的市场物品
+}
+
+// 检查买卖或制作的数量，未指定时为1个
+func batchQuantity(quantity int) (int, error) {
+	if quantity == 0 {
+		return 1, nil
+	}
+	if quantity < 0 || quantity > maxBatchQuantity {
+		return 0, serviceError(ErrInvalidArgument, "数量必须在 1 到 %d 之间", maxBatchQuantity)
+	}
+	return quantity, nil
+}
+
+// 沿定价模型的价格曲线逐个成交：每成交一个物品市场库存变化 delta（卖出为1，买入为-1），
+// 按变化后的价格成交，返回成交总额，市场物品的库存和价格更新为成交后的状态
+func fillAlongCurve(item *MarketItem, params *MarketParams, delta int, quantity int) (money.Money, error) {
+	total := money.Zero
+	for i := 0; i < quantity; i++ {
+		item.Stock += delta
+		item.Price = CalculateNewPrice(item.Price, item.Stock, *params, item.BasePrice)
+		var err error
+		if total, err = total.Add(item.Price); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// 平均成交价格，四舍五入到分
+func averagePrice(total money.Money, quantity int) money.Money {
+	n := int64(quantity)
+	return money.New((total.Minor() + n/2) / n)
+}
+
+// Params 获取当前默认市场参数和单独设置了参数的物品的参数
+func (s *MarketService) Params(ctx context.Context) (*MarketParams, []MarketParams, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	params, err := tx.Market().GetParams()
+	if err != nil {
+		return nil, nil, internalError("获取市场参数失败", err)
+	}
+	itemParams, err := tx.Market().ListItemParams()
+	if err != nil {
+		return nil, nil, internalError("获取物品市场参数失败", err)
+	}
+	return params, itemParams, nil
+}
+
+// UpdateParams 保存市场参数。物品代码为空时覆盖当前默认参数，
+// 否则保存该物品自己的一组参数，物品第一次单独设置时新建
+func (s *MarketService) UpdateParams(ctx context.Context, params MarketParams) (*MarketParams, error) {
+	if err := validatePriceModel(&params); err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if params.ItemCode != "" {
+		if _, err = loadCatalogItem(tx, params.ItemCode); err != nil {
+			return nil, err
+		}
+	}
+	current, err := tx.Market().GetItemParams(params.ItemCode)
+	switch {
+	case errors.Is(err, ErrMarketParamsNotFound) && params.ItemCode != "":
+		err = tx.Market().CreateParams(&params)
+	case err != nil:
+		return nil, internalError("获取当前市场参数失败", err)
+	default:
+		params.ID = current.ID
+		params.CreatedAt = current.CreatedAt
+		err = tx.Market().UpdateParams(&params)
+	}
+	if err != nil {
+		return nil, internalError("更新市场参数失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	scope := "默认"
+	if params.ItemCode != "" {
+		scope = params.ItemCode
+	}
+	logger.Info("market", fmt.Sprintf("成功更新%s市场参数: 定价模型=%s, 平衡区间=%.2f, 价格波动=%.2f, 最大价格变动=%.2f, 流动性=%.2f, 平滑系数=%.2f, 价格区间=%.2f-%.2f\n",
+		scope, params.PriceModel, params.BalanceRange, params.PriceFluctuation, params.MaxPriceChange, params.Liquidity, params.Smoothing,
+		params.MinPriceRatio, params.MaxPriceRatio))
+	return &params, nil
+}
+
+// 获取物品适用的市场参数，物品没有单独设置时使用默认参数
+func loadItemParams(store MarketStore, code string) (*MarketParams, error) {
+	params, err := store.GetItemParams(code)
+	if errors.Is(err, ErrMarketParamsNotFound) {
+		return store.GetParams()
+	}
+	return params, err
+}
+
+// Backpack 获取玩家背包
+func (s *MarketService) Backpack(ctx context.Context, userID int) (*Backpack, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 已到完成时间的制作任务先放入背包
+	completed, err := collectCraftingJobs(tx, userID, timeservice.SyncNow())
+	if err != nil {
+		return nil, internalError("完成制作任务失败", err)
+	}
+	backpack, err := tx.Inventory().GetBackpack(userID)
+	if err != nil {
+		return nil, internalError("获取背包状态失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(craftingCompleted(completed)...)
+	return backpack, nil
+}
+
+// Catalog 获取物品目录
+func (s *MarketService) Catalog(ctx context.Context) ([]Item, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	items, err := tx.Market().ListCatalogItems()
+	if err != nil {
+		return nil, internalError("获取物品目录失败", err)
+	}
+	return items, nil
+}
+
+// Items 获取物品目录中全部物品的市场价格和库存
+func (s *MarketService) Items(ctx context.Context) (MarketItems, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	items, err := loadMarketItems(tx.Market())
+	if err != nil {
+		return nil, internalError("获取市场物品失败", err)
+	}
+	return items, nil
+}
+
+// Make 按配方制作 quantity 份物品：扣除背包中的原料并支付制作费用。
+// 没有制作时长的配方产出立即放入背包，否则生成一个制作任务，排在玩家已有的任务之后，到完成时间后放入背包
+func (s *MarketService) Make(ctx context.Context, userID int, code string, quantity int) (*CraftResult, error) {
+	quantity, err := batchQuantity(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	item, err := loadCatalogItem(tx, code)
+	if err != nil {
+		return nil, err
+	}
+	name := item.Name(defaultLanguage)
+	if item.Recipe == nil {
+		return nil, serviceError(ErrInvalidArgument, "%s不能制作", name)
+	}
+	if err = validateRecipe(item.Recipe); err != nil {
+		return nil, serviceError(ErrInvalidArgument, "%s的配方无效: %v", name, err)
+	}
+
+	now := timeservice.SyncNow()
+	completed, err := collectCraftingJobs(tx, userID, now)
+	if err != nil {
+		return nil, internalError("完成制作任务失败", err)
+	}
+
+	// 扣除原料
+	for _, input := range item.Recipe.Inputs {
+		if err = consumeItems(tx, userID, input.Item, input.Quantity*quantity); err != nil {
+			return nil, err
+		}
+	}
+
+	// 支付制作费用，没有费用时只写入收支都为0的交易记录
+	var published []events.Event
+	output := item.Recipe.Output * quantity
+	if item.Recipe.Cost.IsPositive() {
+		cost, err := item.Recipe.Cost.Mul(int64(quantity))
+		if err != nil {
+			return nil, serviceError(ErrInvalidArgument, "制作费用超出范围")
+		}
+		journal, err := payCraftingCost(tx.Ledger(), userID, item, output, cost)
+		if errors.Is(err, cash.ErrInsufficientFunds) {
+			return nil, serviceError(cash.ErrInsufficientFunds, "余额不足，制作 %d 个%s需要 %s", output, name, cost)
+		}
+		if err != nil {
+			return nil, internalError("记账失败", err)
+		}
+		published = append(published, ledgerPosted(journal))
+	} else {
+		// 隐私数据
+		err = cash.AddStatementNote(tx.Ledger(), userID, cash.Memo{
+			OurBankAccountName: "玩家",
+			CounterpartyAlias:  "系统",
+			OurBankName:        "玩家银行",
+			CounterpartyBank:   "系统银行",
+			Note:               fmt.Sprintf("制作%s x%d", name, output),
+		})
+		if err != nil {
+			return nil, internalError("添加交易记录失败", err)
+		}
+	}
+
+	result := &CraftResult{}
+	if item.Recipe.Duration > 0 {
+		startedAt, err := workshopFreeAt(tx, userID, now)
+		if err != nil {
+			return nil, internalError("获取制作任务失败", err)
+		}
+		result.Job = &CraftingJob{
+			UserID:      userID,
+			ItemCode:    item.Code,
+			Quantity:    output,
+			Status:      CraftingJobPending,
+			StartedAt:   startedAt,
+			CompletesAt: craftingCompletesAt(item.Recipe, quantity, startedAt),
+		}
+		if err = tx.Inventory().CreateCraftingJob(result.Job); err != nil {
+			return nil, internalError("创建制作任务失败", err)
+		}
+		published = append(published, CraftingStarted{Job: *result.Job})
+	} else if err = tx.Inventory().AddItems(userID, item.Code, output); err != nil {
+		return nil, internalError("更新背包失败", err)
+	}
+
+	result.Backpack, err = tx.Inventory().GetBackpack(userID)
+	if err != nil {
+		return nil, internalError("获取背包状态失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(append(craftingCompleted(completed), published...)...)
+	if result.Job != nil {
+		logger.Info("market", fmt.Sprintf("玩家 %d 开始制作物品: %s x%d，任务ID: %d，完成时间: %s\n",
+			userID, item.Code, output, result.Job.ID, result.Job.CompletesAt.Format("2006-01-02 15:04:05")))
+	} else {
+		logger.Info("market", fmt.Sprintf("玩家 %d 成功制作物品: %s x%d\n", userID, item.Code, output))
+	}
+	return result, nil
+}
+
+// 从玩家背包中扣除物品，物品无效或数量不足时返回业务错误
+func consumeItems(tx Tx, userID int, code string, quantity int) error {
+	item, err := loadCatalogItem(tx, code)
+	if err != nil {
+		return err
+	}
+	owned, err := tx.Inventory().GetQuantity(userID, code)
+	if err != nil {
+		return internalError("获取背包状态失败", err)
+	}
+	if owned < quantity {
+		return serviceError(ErrInvalidArgument, "背包中的%s数量不足，需要 %d 个，当前 %d 个", item.Name(defaultLanguage), quantity, owned)
+	}
+	if err = tx.Inventory().AddItems(userID, code, -quantity); err != nil {
+		return internalError("更新背包失败", err)
+	}
+	return nil
+}
+
+// Sell 向市场卖出 quantity 个物品，每卖出一个市场库存增加后按新价格成交，
+// 货款合计一次付给玩家
+func (s *MarketService) Sell(ctx context.Context, userID int, code string, quantity int) (*TradeResult, error) {
+	quantity, err := batchQuantity(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entry, err := loadCatalogItem(tx, code)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := collectCraftingJobs(tx, userID, timeservice.SyncNow())
+	if err != nil {
+		return nil, internalError("完成制作任务失败", err)
+	}
+	owned, err := tx.Inventory().GetQuantity(userID, code)
+	if err != nil {
+		return nil, internalError("获取背包状态失败", err)
+	}
+	if owned <= 0 {
+		return nil, serviceError(ErrInvalidArgument, "卖出物品失败，背包中没有%s", entry.Name(defaultLanguage))
+	}
+	if owned < quantity {
+		return nil, serviceError(ErrInvalidArgument, "卖出物品失败，背包中只有 %d 个%s", owned, entry.Name(defaultLanguage))
+	}
+
+	item, err := loadMarketItem(tx.Market(), entry)
+	if err != nil {
+		return nil, internalError("获取市场物品信息失败", err)
+	}
+	params, err := loadItemParams(tx.Market(), code)
+	if err != nil {
+		return nil, internalError("获取市场参数失败", err)
+	}
+
+	// 更新市场物品库存并沿价格曲线计算货款
+	total, err := fillAlongCurve(item, params, 1, quantity)
+	if err != nil {
+		return nil, serviceError(ErrInvalidArgument, "卖出金额超出范围")
+	}
+
+	if err = tx.Inventory().AddItems(userID, code, -quantity); err != nil {
+		return nil, internalError("更新背包失败", err)
+	}
+	if err = tx.Market().UpdateItem(item); err != nil {
+		return nil, internalError("更新市场物品失败", err)
+	}
+
+	// 记账：市场向玩家付款
+	journal, err := settleMarketTrade(tx.Ledger(), userID, entry, quantity, total, false)
+	if err != nil {
+		return nil, internalError("记账失败", err)
+	}
+
+	result, err := loadTradeResult(tx, userID, quantity, total, item.Price)
+	if err != nil {
+		return nil, err
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	sold := ItemSold{UserID: userID, ItemCode: code, Quantity: quantity, Total: total, Price: result.AveragePrice}
+	events.Publish(append(craftingCompleted(completed), sold, ledgerPosted(journal))...)
+
+	logger.Info("market", fmt.Sprintf("玩家 %d 成功卖出物品: %s x%d，货款: %s，平均价格: %s，市场价格: %s\n",
+		userID, code, quantity, total, result.AveragePrice, item.Price))
+	return result, nil
+}
+
+// Buy 从市场买入 quantity 个物品，每买入一个市场库存减少后按新价格成交，
+// 玩家一次支付全部货款
+func (s *MarketService) Buy(ctx context.Context, userID int, code string, quantity int) (*TradeResult, error) {
+	quantity, err := batchQuantity(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	entry, err := loadCatalogItem(tx, code)
+	if err != nil {
+		return nil, err
+	}
+	item, err := loadMarketItem(tx.Market(), entry)
+	if err != nil {
+		return nil, internalError("获取市场物品信息失败", err)
+	}
+	if item.Stock <= 0 {
+		return nil, serviceError(ErrConflict, "库存中没有%s", entry.Name(defaultLanguage))
+	}
+	if item.Stock < quantity {
+		return nil, serviceError(ErrConflict, "库存中只有 %d 个%s", item.Stock, entry.Name(defaultLanguage))
+	}
+	completed, err := collectCraftingJobs(tx, userID, timeservice.SyncNow())
+	if err != nil {
+		return nil, internalError("完成制作任务失败", err)
+	}
+
+	params, err := loadItemParams(tx.Market(), code)
+	if err != nil {
+		return nil, internalError("获取市场参数失败", err)
+	}
+
+	// 更新市场物品库存并沿价格曲线计算货款
+	total, err := fillAlongCurve(item, params, -1, quantity)
+	if err != nil {
+		return nil, serviceError(ErrInvalidArgument, "买入金额超出范围")
+	}
+
+	account, err := cash.GetUserCashAccount(tx.Ledger(), userID)
+	if err != nil {
+		return nil, internalError("获取账户余额失败", err)
+	}
+	if account.Balance.LessThan(total) {
+		return nil, serviceError(cash.ErrInsufficientFunds, "余额不足，买入 %d 个%s需要 %s", quantity, entry.Name(defaultLanguage), total)
+	}
+
+	if err = tx.Inventory().AddItems(userID, code, quantity); err != nil {
+		return nil, internalError("更新背包失败", err)
+	}
+	if err = tx.Market().UpdateItem(item); err != nil {
+		return nil, internalError("更新市场物品失败", err)
+	}
+
+	// 记账：玩家向市场付款
+	journal, err := settleMarketTrade(tx.Ledger(), userID, entry, quantity, total, true)
+	if errors.Is(err, cash.ErrInsufficientFunds) {
+		return nil, serviceError(cash.ErrInsufficientFunds, "余额不足")
+	}
+	if err != nil {
+		return nil, internalError("记账失败", err)
+	}
+
+	result, err := loadTradeResult(tx, userID, quantity, total, item.Price)
+	if err != nil {
+		return nil, err
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	bought := ItemBought{UserID: userID, ItemCode: code, Quantity: quantity, Total: total, Price: result.AveragePrice}
+	events.Publish(append(craftingCompleted(completed), bought, ledgerPosted(journal))...)
+
+	logger.Info("market", fmt.Sprintf("玩家 %d 成功买入物品: %s x%d，货款: %s，平均价格: %s，市场价格: %s\n",
+		userID, code, quantity, total, result.AveragePrice, item.Price))
+	return result, nil
+}
+
+// 读取交易后的背包和市场物品
+func loadTradeResult(tx Tx, userID int, quantity int, total money.Money, price money.Money) (*TradeResult, error) {
+	backpack, err := tx.Inventory().GetBackpack(userID)
+	if err != nil {
+		return nil, internalError("获取背包状态失败", err)
+	}
+	items, err := loadMarketItems(tx.Market())
+	if err != nil {
+		return nil, internalError("获取市场物品失败", err)
+	}
+	return &TradeResult{
+		Quantity:     quantity,
+		Total:        total,
+		AveragePrice: averagePrice(total, quantity),
+		Price:        price,
+		Backpack:     backpack,
+		Items:        items,
+	}, nil
+}
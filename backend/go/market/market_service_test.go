@@ -0,0 +1,135 @@
+package market
+
+import (
+	"context"
+	"testing"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+)
+
+// 为物品单独设置测试用市场参数，并把市场价格和库存设为1.00和5个（基础价格1.00）
+func setTestMarket(t *testing.T, storage Storage, code string, model string) {
+	t.Helper()
+	withTx(t, storage, func(tx Tx) error {
+		params := testMarketParams(model)
+		params.ItemCode = code
+		if err := tx.Market().CreateParams(&params); err != nil {
+			return err
+		}
+		item, err := tx.Market().GetItem(code)
+		if err != nil {
+			return err
+		}
+		item.Price, item.Stock = money.New(100), 5
+		return tx.Market().UpdateItem(item)
+	})
+}
+
+// 市场物品当前的价格和库存
+func marketItemOf(t *testing.T, storage Storage, code string) *MarketItem {
+	t.Helper()
+	var item *MarketItem
+	err := view(storage, func(tx Tx) (err error) {
+		item, err = tx.Market().GetItem(code)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// 批量买卖沿价格曲线成交，货款一次结算；任何一步失败时余额、背包和市场都不变
+func TestBatchTrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		funds    int64 // 玩家初始余额（分）
+		apples   int   // 玩家初始苹果
+		buy      bool
+		quantity int
+		err      error
+		total    int64 // 成交总额（分）
+		average  int64 // 平均成交价格（分）
+		price    int64 // 成交后的市场价格（分）
+		stock    int   // 成交后的市场库存
+		left     int   // 成交后玩家的苹果
+	}{
+		{"线性卖出", PriceModelLinear, 0, 3, false, 3, nil, 210, 70, 50, 8, 0},
+		{"线性买入", PriceModelLinear, 1000, 0, true, 3, nil, 400, 133, 160, 2, 3},
+		{"AMM买入", PriceModelAMM, 1000, 0, true, 2, nil, 248, 124, 133, 3, 2},
+		{"LMSR卖出", PriceModelLMSR, 0, 4, false, 2, nil, 185, 93, 90, 7, 2},
+		{"数量为0时买入一个", PriceModelLinear, 1000, 0, true, 0, nil, 110, 110, 110, 4, 1},
+		{"余额不足", PriceModelLinear, 399, 0, true, 3, cash.ErrInsufficientFunds, 0, 0, 100, 5, 0},
+		{"买入超过库存", PriceModelLinear, 10000, 0, true, 6, ErrConflict, 0, 0, 100, 5, 0},
+		{"卖出超过背包数量", PriceModelLinear, 0, 2, false, 3, ErrInvalidArgument, 0, 0, 100, 5, 2},
+		{"背包中没有物品", PriceModelLinear, 0, 0, false, 1, ErrInvalidArgument, 0, 0, 100, 5, 0},
+		{"数量超出上限", PriceModelLinear, 0, 0, true, maxBatchQuantity + 1, ErrInvalidArgument, 0, 0, 100, 5, 0},
+		{"数量为负", PriceModelLinear, 0, 3, false, -1, ErrInvalidArgument, 0, 0, 100, 5, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: tt.funds})
+			setTestMarket(t, storage, "apple", tt.model)
+			giveItems(t, storage, 1, "apple", tt.apples)
+
+			service := NewMarketService(storage)
+			trade := service.Sell
+			if tt.buy {
+				trade = service.Buy
+			}
+			result, err := trade(context.Background(), 1, "apple", tt.quantity)
+			checkErrorKind(t, err, tt.err)
+
+			// 买入时玩家向市场付款，卖出时市场向玩家付款
+			paid := tt.total
+			if !tt.buy {
+				paid = -tt.total
+			}
+			if got := balanceOf(t, storage, 1); got != tt.funds-paid {
+				t.Errorf("余额 = %d，期望 %d", got, tt.funds-paid)
+			}
+			if got := systemBalanceOf(t, storage, cash.AccountMarket); got != paid {
+				t.Errorf("市场账户 = %d，期望 %d", got, paid)
+			}
+			if got := quantityOf(t, storage, 1, "apple"); got != tt.left {
+				t.Errorf("苹果 = %d，期望 %d", got, tt.left)
+			}
+			item := marketItemOf(t, storage, "apple")
+			if item.Price.Minor() != tt.price || item.Stock != tt.stock {
+				t.Errorf("市场 价格 %d 库存 %d，期望 价格 %d 库存 %d", item.Price.Minor(), item.Stock, tt.price, tt.stock)
+			}
+			if tt.err != nil {
+				return
+			}
+			if result.Total.Minor() != tt.total || result.AveragePrice.Minor() != tt.average || result.Price.Minor() != tt.price {
+				t.Errorf("成交结果 总额 %d 平均价格 %d 市场价格 %d，期望 总额 %d 平均价格 %d 市场价格 %d",
+					result.Total.Minor(), result.AveragePrice.Minor(), result.Price.Minor(), tt.total, tt.average, tt.price)
+			}
+			if result.Backpack.Items["apple"] != tt.left {
+				t.Errorf("成交结果中的苹果 = %d，期望 %d", result.Backpack.Items["apple"], tt.left)
+			}
+		})
+	}
+}
+
+func TestBatchQuantity(t *testing.T) {
+	tests := []struct {
+		quantity int
+		want     int
+		ok       bool
+	}{
+		{0, 1, true},
+		{1, 1, true},
+		{maxBatchQuantity, maxBatchQuantity, true},
+		{maxBatchQuantity + 1, 0, false},
+		{-1, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := batchQuantity(tt.quantity)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("数量 %d: %d, %v，期望 %d 通过 %v", tt.quantity, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package market
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+)
+
+// 订单方向
+const (
+	OrderSideBuy  = "buy"  // 买单
+	OrderSideSell = "sell" // 卖单
+)
+
+// 订单类型
+const (
+	OrderTypeLimit  = "limit"  // 限价单：按不差于限价的价格成交，未成交部分挂在订单簿上
+	OrderTypeMarket = "market" // 市价单：按订单簿上的价格立即成交，未成交部分取消
+)
+
+// 订单状态
+const (
+	OrderStatusOpen      = "open"      // 挂单中，可能已部分成交
+	OrderStatusFilled    = "filled"    // 全部成交
+	OrderStatusCancelled = "cancelled" // 已取消，未成交部分已退还
+)
+
+// 订单簿推送的深度档位数
+const orderBookDepthLevels = 20
+
+// 订单簿返回的最近成交记录数
+const recentTradeLimit = 50
+
+// Order 订单簿中的订单。买单挂单时按限价冻结资金，卖单挂单时从背包锁定物品，
+// 成交或取消后结算或退还
+type Order struct {
+	ID        int         `json:"id"`
+	UserID    int         `json:"userId"`
+	ItemCode  string      `json:"itemCode"`
+	Side      string      `json:"side"`      // buy, sell
+	Type      string      `json:"type"`      // limit, market
+	Price     money.Money `json:"price"`     // 限价，市价单为0
+	Quantity  int         `json:"quantity"`  // 下单数量
+	Remaining int         `json:"remaining"` // 未成交数量
+	Status    string      `json:"status"`    // open, filled, cancelled
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Trade 成交记录，按挂单方（先挂在订单簿上的订单）的价格成交
+type Trade struct {
+	ID          int         `json:"id"`
+	ItemCode    string      `json:"itemCode"`
+	BuyOrderID  int         `json:"buyOrderId"`
+	SellOrderID int         `json:"sellOrderId"`
+	BuyerID     int         `json:"buyerId"`
+	SellerID    int         `json:"sellerId"`
+	Price       money.Money `json:"price"`
+	Quantity    int         `json:"quantity"`
+	TakerSide   string      `json:"takerSide"` // 主动成交方的方向
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// OrderBookLevel 订单簿的一个价格档位
+type OrderBookLevel struct {
+	Price    money.Money `json:"price"`
+	Quantity int         `json:"quantity"` // 该价格未成交数量合计
+	Orders   int         `json:"orders"`   // 该价格的订单数
+}
+
+// OrderBookDepth 订单簿深度快照，买盘价格从高到低，卖盘价格从低到高
+type OrderBookDepth struct {
+	ItemCode string           `json:"itemCode"`
+	Bids     []OrderBookLevel `json:"bids"`
+	Asks     []OrderBookLevel `json:"asks"`
+}
+
+// OrderRequest 下单请求
+type OrderRequest struct {
+	ItemCode string      `json:"item_code"`
+	Side     string      `json:"side"`
+	Type     string      `json:"type"`
+	Price    money.Money `json:"price"` // 限价单的限价
+	Quantity int         `json:"quantity"`
+}
+
+// OrderStore 订单簿存储：订单和成交记录
+type OrderStore interface {
+	// CreateOrder 写入订单，回填ID和创建时间
+	CreateOrder(order *Order) error
+	// GetOrder 获取订单，不存在时返回 ErrOrderNotFound
+	GetOrder(orderID int) (*Order, error)
+	// UpdateOrder 按ID保存订单的未成交数量和状态
+	UpdateOrder(order *Order) error
+	// ListOpenOrders 获取物品某一方向挂单中的订单，按价格优先、时间优先排列：
+	// 买单价格从高到低，卖单价格从低到高，同价格先挂单的在前
+	ListOpenOrders(code string, side string) ([]Order, error)
+	// ListUserOrders 获取玩家挂单中的订单，最新的在前
+	ListUserOrders(userID int) ([]Order, error)
+	// CreateTrade 写入成交记录，回填ID
+	CreateTrade(trade *Trade) error
+	// ListTrades 获取物品最近的成交记录，最新的在前，最多 limit 条
+	ListTrades(code string, limit int) ([]Trade, error)
+}
+
+// 按挂单计算订单簿深度，每一方最多 orderBookDepthLevels 档
+func orderBookDepth(code string, bids, asks []Order) OrderBookDepth {
+	return OrderBookDepth{
+		ItemCode: code,
+		Bids:     depthLevels(bids),
+		Asks:     depthLevels(asks),
+	}
+}
+
+// 已按价格优先排列的挂单合并为价格档位
+func depthLevels(orders []Order) []OrderBookLevel {
+	levels := []OrderBookLevel{}
+	for _, order := range orders {
+		if n := len(levels); n > 0 && levels[n-1].Price.Equal(order.Price) {
+			levels[n-1].Quantity += order.Remaining
+			levels[n-1].Orders++
+			continue
+		}
+		if len(levels) == orderBookDepthLevels {
+			break
+		}
+		levels = append(levels, OrderBookLevel{Price: order.Price, Quantity: order.Remaining, Orders: 1})
+	}
+	return levels
+}
+
+// 订单方向名称
+func orderSideName(side string) string {
+	if side == OrderSideBuy {
+		return "买单"
+	}
+	return "卖单"
+}
+
+// 冻结买单资金：从玩家现金账户转入挂单冻结资金账户
+func holdOrderFunds(ledger cash.LedgerStore, order *Order, amount money.Money) (*cash.JournalEntry, error) {
+	userAccountID, err := cash.UserCashAccountID(ledger, order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	escrowID, err := cash.AccountIDByCode(ledger, cash.AccountOrderEscrow)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindOrderHold,
+		FromAccountID: userAccountID,
+		ToAccountID:   escrowID,
+		Amount:        amount,
+		Memo: cash.Memo{
+			OurBankAccountName: "玩家",
+			CounterpartyAlias:  "挂单冻结资金",
+			OurBankName:        "玩家银行",
+			CounterpartyBank:   "萌铺子交易所",
+			Note:               fmt.Sprintf("买单 #%d 冻结", order.ID),
+		},
+	})
+}
+
+// 解冻买单资金：从挂单冻结资金账户退还玩家，用于取消订单和成交价低于限价时退还差额
+func releaseOrderFunds(ledger cash.LedgerStore, order *Order, amount money.Money) (*cash.JournalEntry, error) {
+	userAccountID, err := cash.UserCashAccountID(ledger, order.UserID)
+	if err != nil {
+		return nil, err
+	}
+	escrowID, err := cash.AccountIDByCode(ledger, cash.AccountOrderEscrow)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindOrderRelease,
+		FromAccountID: escrowID,
+		ToAccountID:   userAccountID,
+		Amount:        amount,
+		Memo: cash.Memo{
+			OurBankAccountName: "挂单冻结资金",
+			CounterpartyAlias:  "玩家",
+			OurBankName:        "萌铺子交易所",
+			CounterpartyBank:   "玩家银行",
+			Note:               fmt.Sprintf("买单 #%d 退还", order.ID),
+		},
+	})
+}
+
+// 成交结算：限价买单从挂单冻结资金付款，市价买单从买家现金账户直接付款给卖家
+func settleTrade(ledger cash.LedgerStore, buy *Order, trade *Trade, item *Item) (*cash.JournalEntry, error) {
+	sellerAccountID, err := cash.UserCashAccountID(ledger, trade.SellerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 隐私数据
+	memo := cash.Memo{
+		OurBankAccountName: "挂单冻结资金",
+		CounterpartyAlias:  "卖家",
+		OurBankName:        "萌铺子交易所",
+		CounterpartyBank:   "玩家银行",
+		Note:               fmt.Sprintf("成交 %s x%d @ %s，玩家%d买入", item.Name(defaultLanguage), trade.Quantity, trade.Price, trade.BuyerID),
+	}
+	var fromAccountID int
+	if buy.Type == OrderTypeMarket {
+		fromAccountID, err = cash.UserCashAccountID(ledger, trade.BuyerID)
+		memo.OurBankAccountName, memo.OurBankName = "玩家", "玩家银行"
+	} else {
+		fromAccountID, err = cash.AccountIDByCode(ledger, cash.AccountOrderEscrow)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := trade.Price.Mul(int64(trade.Quantity))
+	if err != nil {
+		return nil, err
+	}
+
+	return cash.Transfer(ledger, cash.TransferRequest{
+		Kind:          cash.EntryKindOrderSettlement,
+		FromAccountID: fromAccountID,
+		ToAccountID:   sellerAccountID,
+		Amount:        amount,
+		Memo:          memo,
+	})
+}
+
+// 下单
+func PlaceOrder(service *OrderBookService, w http.ResponseWriter, r *http.Request, userID int) {
+	if !requirePost(w, r, "orderbook", "下单") {
+		return
+	}
+
+	var req OrderRequest
+	if !decodeBody(w, r, "orderbook", "下单", &req) {
+		return
+	}
+	logger.Info("orderbook", fmt.Sprintf("玩家 %d 下单: %s %s %s x%d @ %s\n", userID, req.ItemCode, req.Side, req.Type, req.Quantity, req.Price))
+
+	order, trades, err := service.Place(r.Context(), userID, req)
+	if err != nil {
+		writeError(w, "orderbook", "下单", err)
+		return
+	}
+
+	message := "下单成功"
+	switch {
+	case order.Status == OrderStatusFilled:
+		message = "订单全部成交"
+	case order.Status == OrderStatusCancelled:
+		message = fmt.Sprintf("市价单成交 %d 个，未成交的 %d 个已取消", order.Quantity-order.Remaining, order.Remaining)
+	case len(trades) > 0:
+		message = fmt.Sprintf("订单部分成交 %d 个，剩余 %d 个挂单中", order.Quantity-order.Remaining, order.Remaining)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": message,
+		"order":   order,
+		"trades":  trades,
+	})
+}
+
+// 取消订单
+func CancelOrder(service *OrderBookService, w http.ResponseWriter, r *http.Request, userID int) {
+	if !requirePost(w, r, "orderbook", "取消订单") {
+		return
+	}
+
+	var data struct {
+		OrderID int `json:"order_id"`
+	}
+	if !decodeBody(w, r, "orderbook", "取消订单", &data) {
+		return
+	}
+
+	order, err := service.Cancel(r.Context(), userID, data.OrderID)
+	if err != nil {
+		writeError(w, "orderbook", "取消订单", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"message": "订单已取消",
+		"order":   order,
+	})
+}
+
+// 获取玩家挂单中的订单
+func GetUserOrders(service *OrderBookService, w http.ResponseWriter, r *http.Request, userID int) {
+	orders, err := service.UserOrders(r.Context(), userID)
+	if err != nil {
+		writeError(w, "orderbook", "获取订单", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"orders":  orders,
+	})
+}
+
+// 获取物品的订单簿深度和最近成交
+func GetOrderBook(service *OrderBookService, w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r, "orderbook", "获取订单簿") {
+		return
+	}
+
+	var data itemRequest
+	if !decodeBody(w, r, "orderbook", "获取订单簿", &data) {
+		return
+	}
+
+	depth, trades, err := service.Book(r.Context(), data.ItemCode)
+	if err != nil {
+		writeError(w, "orderbook", "获取订单簿", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"depth":   depth,
+		"trades":  trades,
+	})
+}
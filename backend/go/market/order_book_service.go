@@ -0,0 +1,391 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/events"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+)
+
+// OrderBookService 订单簿业务：每种物品一个连续双向拍卖订单簿，
+// 限价单和市价单按价格优先、时间优先撮合，支持部分成交和撤单。
+// 撮合在下单的事务中完成，存储同一时间只有一个写事务，订单簿不会被并发修改
+type OrderBookService struct {
+	storage Storage
+}
+
+// NewOrderBookService 创建订单簿业务服务
+func NewOrderBookService(storage Storage) *OrderBookService {
+	return &OrderBookService{storage: storage}
+}
+
+// 检查下单请求，未指定类型时为限价单，市价单忽略价格
+func validateOrder(req *OrderRequest) error {
+	if req.Side != OrderSideBuy && req.Side != OrderSideSell {
+		return serviceError(ErrInvalidArgument, "无效的订单方向")
+	}
+	switch req.Type {
+	case "", OrderTypeLimit:
+		req.Type = OrderTypeLimit
+		if !req.Price.IsPositive() {
+			return serviceError(ErrInvalidArgument, "限价必须为正数")
+		}
+	case OrderTypeMarket:
+		req.Price = money.Money{}
+	default:
+		return serviceError(ErrInvalidArgument, "无效的订单类型")
+	}
+	if req.Quantity <= 0 {
+		return serviceError(ErrInvalidArgument, "数量必须为正数")
+	}
+	return nil
+}
+
+// Place 下单并立即与订单簿撮合。买单按限价冻结资金，卖单从背包锁定物品；
+// 限价单未成交的部分挂在订单簿上，市价单未成交的部分取消，完全无法成交的市价单返回错误。
+// 订单会与自己的挂单成交时停止撮合并取消剩余部分，订单簿上不会出现买价不低于卖价的交叉
+func (s *OrderBookService) Place(ctx context.Context, userID int, req OrderRequest) (*Order, []Trade, error) {
+	if err := validateOrder(&req); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	item, err := loadCatalogItem(tx, req.ItemCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	order := &Order{
+		UserID:    userID,
+		ItemCode:  item.Code,
+		Side:      req.Side,
+		Type:      req.Type,
+		Price:     req.Price,
+		Quantity:  req.Quantity,
+		Remaining: req.Quantity,
+		Status:    OrderStatusOpen,
+	}
+	if err = tx.Orders().CreateOrder(order); err != nil {
+		return nil, nil, internalError("创建订单失败", err)
+	}
+
+	// 锁定卖出的物品或冻结买单资金，市价买单成交时直接付款
+	var published []events.Event
+	if order.Side == OrderSideSell {
+		if published, err = LockBackpackItems(tx, userID, item.Code, order.Quantity); err != nil {
+			return nil, nil, err
+		}
+	} else if order.Type == OrderTypeLimit {
+		amount, err := order.Price.Mul(int64(order.Quantity))
+		if err != nil {
+			return nil, nil, serviceError(ErrInvalidArgument, "订单金额超出范围")
+		}
+		journal, err := holdOrderFunds(tx.Ledger(), order, amount)
+		if errors.Is(err, cash.ErrInsufficientFunds) {
+			return nil, nil, serviceError(cash.ErrInsufficientFunds, "余额不足，买单需要冻结 %s", amount)
+		}
+		if err != nil {
+			return nil, nil, internalError("冻结买单资金失败", err)
+		}
+		published = append(published, ledgerPosted(journal))
+	}
+
+	trades, settled, selfCross, err := matchOrder(tx, order, item)
+	if err != nil {
+		return nil, nil, err
+	}
+	published = append(published, settled...)
+
+	// 市价单不挂单，与自己挂单交叉的订单也不挂单，未成交的部分取消，退还冻结的资金或物品
+	if order.Remaining > 0 && (order.Type == OrderTypeMarket || selfCross) {
+		if len(trades) == 0 {
+			if selfCross {
+				return nil, nil, serviceError(ErrConflict, "订单会与你自己的挂单成交，请先撤销该挂单")
+			}
+			return nil, nil, serviceError(ErrConflict, "订单簿上没有可成交的%s", item.Name(defaultLanguage))
+		}
+		released, err := releaseOrderRemainder(tx, order)
+		if err != nil {
+			return nil, nil, err
+		}
+		published = append(published, released...)
+		order.Status = OrderStatusCancelled
+	}
+	if err = tx.Orders().UpdateOrder(order); err != nil {
+		return nil, nil, internalError("更新订单失败", err)
+	}
+	if err = enqueueOrderBookUpdate(tx, item.Code, trades); err != nil {
+		return nil, nil, internalError("写入订单簿通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, nil, err
+	}
+
+	events.Publish(OrderPlaced{Order: *order})
+	events.Publish(published...)
+	logger.Info("orderbook", fmt.Sprintf("订单 %d 已处理: 玩家 %d %s%s %s x%d，成交 %d 笔，剩余 %d，状态 %s\n",
+		order.ID, userID, order.Type, orderSideName(order.Side), order.ItemCode, order.Quantity, len(trades), order.Remaining, order.Status))
+	return order, trades, nil
+}
+
+// 按价格优先、时间优先与对手方挂单撮合，成交价为挂单价格。市价买单按余额能支付的数量成交。
+// 不与自己的挂单成交：轮到价格满足的自己的挂单时停止撮合，selfCross 为真，
+// 剩余部分由调用方取消，不能越过自己的挂单继续成交或挂单
+func matchOrder(tx Tx, taker *Order, item *Item) (trades []Trade, published []events.Event, selfCross bool, err error) {
+	opposite := OrderSideSell
+	if taker.Side == OrderSideSell {
+		opposite = OrderSideBuy
+	}
+	makers, err := tx.Orders().ListOpenOrders(item.Code, opposite)
+	if err != nil {
+		return nil, nil, false, internalError("获取订单簿失败", err)
+	}
+
+	for i := range makers {
+		if taker.Remaining == 0 {
+			break
+		}
+		maker := &makers[i]
+		// 挂单已按价格排列，第一个价格不满足限价的挂单之后都不满足
+		if taker.Type == OrderTypeLimit && !priceCrosses(taker, maker.Price) {
+			break
+		}
+		if maker.UserID == taker.UserID {
+			selfCross = true
+			break
+		}
+
+		quantity := min(taker.Remaining, maker.Remaining)
+		if taker.Side == OrderSideBuy && taker.Type == OrderTypeMarket {
+			account, err := cash.GetUserCashAccount(tx.Ledger(), taker.UserID)
+			if err != nil {
+				return nil, nil, false, internalError("获取账户余额失败", err)
+			}
+			quantity = min(quantity, int(account.Balance.Minor()/maker.Price.Minor()))
+			if quantity <= 0 {
+				break
+			}
+		}
+
+		buy, sell := taker, maker
+		if taker.Side == OrderSideSell {
+			buy, sell = maker, taker
+		}
+		trade := &Trade{
+			ItemCode:    item.Code,
+			BuyOrderID:  buy.ID,
+			SellOrderID: sell.ID,
+			BuyerID:     buy.UserID,
+			SellerID:    sell.UserID,
+			Price:       maker.Price,
+			Quantity:    quantity,
+			TakerSide:   taker.Side,
+		}
+		settled, err := fillTrade(tx, buy, trade, item)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		published = append(published, settled...)
+
+		taker.Remaining -= quantity
+		maker.Remaining -= quantity
+		if maker.Remaining == 0 {
+			maker.Status = OrderStatusFilled
+		}
+		if err = tx.Orders().UpdateOrder(maker); err != nil {
+			return nil, nil, false, internalError("更新订单失败", err)
+		}
+		// 通知挂单方订单已成交
+		if err = enqueueUserOutbox(tx, maker.UserID, OutboxOrderUpdate, maker); err != nil {
+			return nil, nil, false, internalError("写入订单通知失败", err)
+		}
+		trades = append(trades, *trade)
+	}
+	if taker.Remaining == 0 {
+		taker.Status = OrderStatusFilled
+	}
+	return trades, published, selfCross, nil
+}
+
+// 限价单的限价是否满足挂单价格：买单价格不低于卖出挂单，卖单价格不高于买入挂单
+func priceCrosses(taker *Order, price money.Money) bool {
+	if taker.Side == OrderSideBuy {
+		return !taker.Price.LessThan(price)
+	}
+	return !taker.Price.GreaterThan(price)
+}
+
+// 写入成交记录并结算：买家付款给卖家，卖家锁定的物品放入买家背包。
+// 限价买单按限价冻结资金，成交价低于限价时退还差额
+func fillTrade(tx Tx, buy *Order, trade *Trade, item *Item) ([]events.Event, error) {
+	if err := tx.Orders().CreateTrade(trade); err != nil {
+		return nil, internalError("写入成交记录失败", err)
+	}
+
+	journal, err := settleTrade(tx.Ledger(), buy, trade, item)
+	if errors.Is(err, cash.ErrInsufficientFunds) {
+		return nil, serviceError(cash.ErrInsufficientFunds, "余额不足")
+	}
+	if err != nil {
+		return nil, internalError("成交结算失败", err)
+	}
+	published := []events.Event{TradeExecuted{Trade: *trade}, ledgerPosted(journal)}
+
+	if buy.Type == OrderTypeLimit && buy.Price.GreaterThan(trade.Price) {
+		difference, err := buy.Price.Sub(trade.Price)
+		if err != nil {
+			return nil, internalError("计算买单差额失败", err)
+		}
+		refund, err := difference.Mul(int64(trade.Quantity))
+		if err != nil {
+			return nil, internalError("计算买单差额失败", err)
+		}
+		journal, err = releaseOrderFunds(tx.Ledger(), buy, refund)
+		if err != nil {
+			return nil, internalError("退还买单差额失败", err)
+		}
+		published = append(published, ledgerPosted(journal))
+	}
+
+	if err = tx.Inventory().AddItems(trade.BuyerID, item.Code, trade.Quantity); err != nil {
+		return nil, internalError("更新背包失败", err)
+	}
+	return published, nil
+}
+
+// 在事务中写入订单簿深度和成交通知
+func enqueueOrderBookUpdate(tx Tx, code string, trades []Trade) error {
+	for _, trade := range trades {
+		if err := enqueueOutbox(tx, OutboxMarketTrade, trade); err != nil {
+			return err
+		}
+	}
+	depth, err := loadOrderBookDepth(tx, code)
+	if err != nil {
+		return err
+	}
+	return enqueueOutbox(tx, OutboxOrderBookDepth, depth)
+}
+
+// 读取物品当前的订单簿深度
+func loadOrderBookDepth(tx Tx, code string) (*OrderBookDepth, error) {
+	bids, err := tx.Orders().ListOpenOrders(code, OrderSideBuy)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := tx.Orders().ListOpenOrders(code, OrderSideSell)
+	if err != nil {
+		return nil, err
+	}
+	depth := orderBookDepth(code, bids, asks)
+	return &depth, nil
+}
+
+// Cancel 取消挂单中的订单，买单退还未成交部分的冻结资金，卖单退还未成交的物品
+func (s *OrderBookService) Cancel(ctx context.Context, userID, orderID int) (*Order, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := tx.Orders().GetOrder(orderID)
+	if errors.Is(err, ErrOrderNotFound) {
+		return nil, serviceError(ErrOrderNotFound, "订单不存在")
+	}
+	if err != nil {
+		return nil, internalError("获取订单失败", err)
+	}
+	if order.UserID != userID {
+		return nil, serviceError(ErrForbidden, "只能取消自己的订单")
+	}
+	if order.Status != OrderStatusOpen {
+		return nil, serviceError(ErrConflict, "订单已成交或已取消")
+	}
+
+	published, err := releaseOrderRemainder(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	order.Status = OrderStatusCancelled
+	if err = tx.Orders().UpdateOrder(order); err != nil {
+		return nil, internalError("更新订单失败", err)
+	}
+	if err = enqueueOrderBookUpdate(tx, order.ItemCode, nil); err != nil {
+		return nil, internalError("写入订单簿通知失败", err)
+	}
+	if err = commitTx(tx); err != nil {
+		return nil, err
+	}
+
+	events.Publish(append([]events.Event{OrderCancelled{Order: *order}}, published...)...)
+	logger.Info("orderbook", fmt.Sprintf("订单 %d 已取消，退还 %d 个未成交数量\n", order.ID, order.Remaining))
+	return order, nil
+}
+
+// 退还订单未成交部分：限价买单解冻对应的资金，卖单退还锁定的物品，市价买单没有冻结资金
+func releaseOrderRemainder(tx Tx, order *Order) ([]events.Event, error) {
+	if order.Side == OrderSideSell {
+		if err := UnlockBackpackItems(tx.Inventory(), order.UserID, order.ItemCode, order.Remaining); err != nil {
+			return nil, internalError("退还物品失败", err)
+		}
+		return nil, nil
+	}
+	if order.Type != OrderTypeLimit {
+		return nil, nil
+	}
+	amount, err := order.Price.Mul(int64(order.Remaining))
+	if err != nil {
+		return nil, internalError("计算买单资金失败", err)
+	}
+	journal, err := releaseOrderFunds(tx.Ledger(), order, amount)
+	if err != nil {
+		return nil, internalError("退还买单资金失败", err)
+	}
+	return []events.Event{ledgerPosted(journal)}, nil
+}
+
+// UserOrders 获取玩家挂单中的订单
+func (s *OrderBookService) UserOrders(ctx context.Context, userID int) ([]Order, error) {
+	var orders []Order
+	err := view(s.storage, func(tx Tx) error {
+		var err error
+		orders, err = tx.Orders().ListUserOrders(userID)
+		return err
+	})
+	if err != nil {
+		return nil, internalError("获取订单失败", err)
+	}
+	return orders, nil
+}
+
+// Book 获取物品的订单簿深度和最近成交
+func (s *OrderBookService) Book(ctx context.Context, code string) (*OrderBookDepth, []Trade, error) {
+	tx, err := beginTx(ctx, s.storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err = loadCatalogItem(tx, code); err != nil {
+		return nil, nil, err
+	}
+	depth, err := loadOrderBookDepth(tx, code)
+	if err != nil {
+		return nil, nil, internalError("获取订单簿失败", err)
+	}
+	trades, err := tx.Orders().ListTrades(code, recentTradeLimit)
+	if err != nil {
+		return nil, nil, internalError("获取成交记录失败", err)
+	}
+	return depth, trades, nil
+}
@@ -0,0 +1,233 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+)
+
+// 测试下单参数，价格以分为单位
+type testOrder struct {
+	userID   int
+	side     string
+	typ      string
+	price    int64
+	quantity int
+}
+
+func (o testOrder) request() OrderRequest {
+	return OrderRequest{ItemCode: "apple", Side: o.side, Type: o.typ, Price: money.New(o.price), Quantity: o.quantity}
+}
+
+// 订单簿的一个档位：价格（分）和数量
+type testLevel struct {
+	price    int64
+	quantity int
+}
+
+func TestOrderBookMatching(t *testing.T) {
+	type wantTrade struct {
+		price             int64
+		quantity          int
+		buyerID, sellerID int
+	}
+	tests := []struct {
+		name      string
+		book      []testOrder // 预先依次挂出的订单
+		taker     testOrder
+		err       error
+		trades    []wantTrade
+		status    string
+		remaining int
+		bids      []testLevel
+		asks      []testLevel
+		balances  map[int]int64 // 下单后的玩家余额（分）
+	}{
+		{
+			name:     "价格优先",
+			book:     []testOrder{{1, OrderSideSell, OrderTypeLimit, 500, 2}, {2, OrderSideSell, OrderTypeLimit, 400, 2}},
+			taker:    testOrder{3, OrderSideBuy, OrderTypeLimit, 600, 3},
+			trades:   []wantTrade{{400, 2, 3, 2}, {500, 1, 3, 1}},
+			status:   OrderStatusFilled,
+			asks:     []testLevel{{500, 1}},
+			balances: map[int]int64{1: 10500, 2: 10800, 3: 8700}, // 限价高于成交价的差额退还给买家
+		},
+		{
+			name:   "同价时间优先",
+			book:   []testOrder{{1, OrderSideSell, OrderTypeLimit, 500, 1}, {2, OrderSideSell, OrderTypeLimit, 500, 1}},
+			taker:  testOrder{3, OrderSideBuy, OrderTypeLimit, 500, 1},
+			trades: []wantTrade{{500, 1, 3, 1}},
+			status: OrderStatusFilled,
+			asks:   []testLevel{{500, 1}},
+		},
+		{
+			name:      "部分成交后挂单",
+			book:      []testOrder{{1, OrderSideSell, OrderTypeLimit, 500, 2}},
+			taker:     testOrder{3, OrderSideBuy, OrderTypeLimit, 500, 5},
+			trades:    []wantTrade{{500, 2, 3, 1}},
+			status:    OrderStatusOpen,
+			remaining: 3,
+			bids:      []testLevel{{500, 3}},
+			balances:  map[int]int64{3: 7500}, // 成交 1000，剩余 3 个冻结 1500
+		},
+		{
+			name:      "限价不满足",
+			book:      []testOrder{{1, OrderSideSell, OrderTypeLimit, 600, 1}},
+			taker:     testOrder{3, OrderSideBuy, OrderTypeLimit, 500, 1},
+			status:    OrderStatusOpen,
+			remaining: 1,
+			bids:      []testLevel{{500, 1}},
+			asks:      []testLevel{{600, 1}},
+		},
+		{
+			name:     "卖单按买盘价格从高到低成交",
+			book:     []testOrder{{3, OrderSideBuy, OrderTypeLimit, 600, 2}, {4, OrderSideBuy, OrderTypeLimit, 700, 1}},
+			taker:    testOrder{1, OrderSideSell, OrderTypeLimit, 500, 3},
+			trades:   []wantTrade{{700, 1, 4, 1}, {600, 2, 3, 1}},
+			status:   OrderStatusFilled,
+			balances: map[int]int64{1: 11900, 3: 8800, 4: 9300},
+		},
+		{
+			name:      "市价单成交后取消剩余",
+			book:      []testOrder{{1, OrderSideSell, OrderTypeLimit, 500, 1}, {2, OrderSideSell, OrderTypeLimit, 700, 1}},
+			taker:     testOrder{3, OrderSideBuy, OrderTypeMarket, 0, 3},
+			trades:    []wantTrade{{500, 1, 3, 1}, {700, 1, 3, 2}},
+			status:    OrderStatusCancelled,
+			remaining: 1,
+			balances:  map[int]int64{3: 8800},
+		},
+		{
+			name:  "市价单没有对手方",
+			taker: testOrder{3, OrderSideBuy, OrderTypeMarket, 0, 1},
+			err:   ErrConflict,
+		},
+		{
+			name:      "与自己的挂单交叉时取消剩余",
+			book:      []testOrder{{1, OrderSideSell, OrderTypeLimit, 400, 1}, {3, OrderSideSell, OrderTypeLimit, 500, 1}},
+			taker:     testOrder{3, OrderSideBuy, OrderTypeLimit, 600, 2},
+			trades:    []wantTrade{{400, 1, 3, 1}},
+			status:    OrderStatusCancelled,
+			remaining: 1,
+			asks:      []testLevel{{500, 1}},
+			balances:  map[int]int64{3: 9600}, // 剩余部分的冻结资金全部退还
+		},
+		{
+			name:  "只能与自己的挂单成交",
+			book:  []testOrder{{3, OrderSideSell, OrderTypeLimit, 500, 1}},
+			taker: testOrder{3, OrderSideBuy, OrderTypeLimit, 600, 1},
+			err:   ErrConflict,
+			asks:  []testLevel{{500, 1}},
+		},
+		{
+			name:  "余额不足以冻结",
+			taker: testOrder{3, OrderSideBuy, OrderTypeLimit, 10001, 1},
+			err:   cash.ErrInsufficientFunds,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := newTestStorage(t, map[int]int64{1: 10000, 2: 10000, 3: 10000, 4: 10000})
+			for userID := 1; userID <= 4; userID++ {
+				giveItems(t, storage, userID, "apple", 10)
+			}
+			service := NewOrderBookService(storage)
+			ctx := context.Background()
+			for _, o := range tt.book {
+				_, _, err := service.Place(ctx, o.userID, o.request())
+				checkErrorKind(t, err, nil)
+			}
+
+			order, trades, err := service.Place(ctx, tt.taker.userID, tt.taker.request())
+			checkErrorKind(t, err, tt.err)
+			if err == nil {
+				if order.Status != tt.status || order.Remaining != tt.remaining {
+					t.Errorf("订单 = %s 剩余 %d，期望 %s 剩余 %d", order.Status, order.Remaining, tt.status, tt.remaining)
+				}
+				if len(trades) != len(tt.trades) {
+					t.Fatalf("成交 %d 笔，期望 %d 笔", len(trades), len(tt.trades))
+				}
+				for i, trade := range trades {
+					want := tt.trades[i]
+					if trade.Price.Minor() != want.price || trade.Quantity != want.quantity || trade.BuyerID != want.buyerID || trade.SellerID != want.sellerID {
+						t.Errorf("第%d笔成交 = %s x%d 买家%d 卖家%d，期望 %d x%d 买家%d 卖家%d", i+1,
+							trade.Price, trade.Quantity, trade.BuyerID, trade.SellerID, want.price, want.quantity, want.buyerID, want.sellerID)
+					}
+				}
+			}
+
+			depth, _, err := service.Book(ctx, "apple")
+			checkErrorKind(t, err, nil)
+			checkLevels(t, "买盘", depth.Bids, tt.bids)
+			checkLevels(t, "卖盘", depth.Asks, tt.asks)
+			if len(depth.Bids) > 0 && len(depth.Asks) > 0 && !depth.Bids[0].Price.LessThan(depth.Asks[0].Price) {
+				t.Errorf("订单簿交叉：买一 %s，卖一 %s", depth.Bids[0].Price, depth.Asks[0].Price)
+			}
+			for userID, want := range tt.balances {
+				if got := balanceOf(t, storage, userID); got != want {
+					t.Errorf("玩家%d余额 = %d，期望 %d", userID, got, want)
+				}
+			}
+		})
+	}
+}
+
+func checkLevels(t *testing.T, name string, got []OrderBookLevel, want []testLevel) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s档位数 = %d，期望 %d", name, len(got), len(want))
+		return
+	}
+	for i, level := range got {
+		if level.Price.Minor() != want[i].price || level.Quantity != want[i].quantity {
+			t.Errorf("%s第%d档 = %s x%d，期望 %d x%d", name, i+1, level.Price, level.Quantity, want[i].price, want[i].quantity)
+		}
+	}
+}
+
+// 撤销部分成交的订单，退还未成交部分冻结的资金或锁定的物品
+func TestOrderCancel(t *testing.T) {
+	storage := newTestStorage(t, map[int]int64{1: 10000, 3: 10000})
+	giveItems(t, storage, 1, "apple", 5)
+	service := NewOrderBookService(storage)
+	ctx := context.Background()
+
+	sell, _, err := service.Place(ctx, 1, testOrder{1, OrderSideSell, OrderTypeLimit, 500, 2}.request())
+	checkErrorKind(t, err, nil)
+	buy, _, err := service.Place(ctx, 3, testOrder{3, OrderSideBuy, OrderTypeLimit, 500, 5}.request())
+	checkErrorKind(t, err, nil)
+
+	tests := []struct {
+		name    string
+		userID  int
+		orderID int
+		err     error
+	}{
+		{"撤销他人订单", 1, buy.ID, ErrForbidden},
+		{"撤销已成交订单", 1, sell.ID, ErrConflict},
+		{"订单不存在", 3, 999, ErrOrderNotFound},
+		{"撤销部分成交的买单", 3, buy.ID, nil},
+		{"重复撤销", 3, buy.ID, ErrConflict},
+	}
+	for _, tt := range tests {
+		_, err := service.Cancel(ctx, tt.userID, tt.orderID)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("%s: 错误 = %v，期望 %v", tt.name, err, tt.err)
+		}
+	}
+
+	// 买家只为成交的2个苹果付款
+	if got := balanceOf(t, storage, 3); got != 9000 {
+		t.Errorf("买家余额 = %d，期望 9000", got)
+	}
+	if got := quantityOf(t, storage, 3, "apple"); got != 2 {
+		t.Errorf("买家的苹果 = %d，期望 2", got)
+	}
+	depth, _, err := service.Book(ctx, "apple")
+	checkErrorKind(t, err, nil)
+	if len(depth.Bids) != 0 || len(depth.Asks) != 0 {
+		t.Errorf("撤单后订单簿不为空: %+v", depth)
+	}
+}
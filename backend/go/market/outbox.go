@@ -0,0 +1,217 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 发件箱通知类型，与WebSocket消息类型一致
+const (
+	OutboxAuctionUpdate       = "auction_update"
+	OutboxAuctionPriceUpdate  = "auction_price_update" // 旧版逐个拍卖的价格通知，升级前未投递的通知仍按此类型投递
+	OutboxAuctionPriceBatch   = "auction_price_batch"  // 拍卖时钟同一次处理的所有价格变化
+	OutboxAuctionOutbid       = "auction_outbid"
+	OutboxAuctionSealedResult = "auction_sealed_result"
+	OutboxOrderBookDepth      = "order_book_depth" // 订单簿深度变化
+	OutboxMarketTrade         = "market_trade"     // 订单簿成交
+	OutboxOrderUpdate         = "order_update"     // 挂单被成交，只发送给挂单的玩家
+)
+
+const (
+	outboxBatchSize    = 100            // 每次投递的最大通知数
+	outboxPollInterval = time.Second    // 没有唤醒时的轮询间隔
+	outboxReplayWindow = 24 * time.Hour // 补发窗口：已投递的通知保留这么久，断线的客户端在此期间重连可以补发
+	outboxReplayLimit  = 1000           // 一次补发的最大通知数，缺失更多时客户端重新拉取全部状态
+)
+
+// OutboxMessage 发件箱通知，与状态修改在同一事务中写入，提交后由投递器按序号发送
+type OutboxMessage struct {
+	Seq       int64           `json:"seq"`       // 序号，单调递增，客户端据此发现丢失的通知
+	UserID    int             `json:"userId"`    // 接收通知的玩家，0 表示广播给所有连接
+	Type      string          `json:"type"`      // 通知类型
+	Payload   json.RawMessage `json:"payload"`   // 通知内容
+	CreatedAt time.Time       `json:"createdAt"` // 写入时间
+}
+
+// OutboxStore 发件箱存储
+type OutboxStore interface {
+	// Append 写入待投递的通知，回填序号和写入时间
+	Append(message *OutboxMessage) error
+	// ListPending 按序号升序获取未投递的通知，最多 limit 条
+	ListPending(limit int) ([]OutboxMessage, error)
+	// ListFrom 按序号升序获取序号不小于 seq 的通知（包括未投递的），最多 limit 条
+	ListFrom(seq int64, limit int) ([]OutboxMessage, error)
+	// MarkDelivered 标记序号不大于 seq 的通知已投递
+	MarkDelivered(seq int64) error
+	// PruneDelivered 删除在 before 之前已投递的通知
+	PruneDelivered(before time.Time) error
+}
+
+// 在事务中写入一条通知
+func enqueueOutbox(tx Tx, messageType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox().Append(&OutboxMessage{Type: messageType, Payload: payload})
+}
+
+// 在事务中写入只发送给指定玩家的通知
+func enqueueUserOutbox(tx Tx, userID int, messageType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Outbox().Append(&OutboxMessage{Type: messageType, UserID: userID, Payload: payload})
+}
+
+// 在事务中写入拍卖更新通知，action 为 created、started、bid_placed 等
+func enqueueAuctionUpdate(tx Tx, auction *Auction, action string) error {
+	return enqueueOutbox(tx, OutboxAuctionUpdate, AuctionWSUpdateMessage{Auction: auction, Action: action})
+}
+
+// OutboxDispatcher 发件箱投递器：按序号把已提交的通知交给投递函数，投递成功后才标记，
+// 投递失败或进程退出时未标记的通知会重新投递（至少一次）。
+// 投递函数只负责当前在线的连接，断线期间错过的通知由客户端重连时按序号补发（见 replayOutbox）
+type OutboxDispatcher struct {
+	storage    Storage
+	deliver    func(OutboxMessage) error
+	wake       chan struct{}
+	lastPruned time.Time // 上次清理已投递通知的时间
+}
+
+// NewOutboxDispatcher 创建发件箱投递器
+func NewOutboxDispatcher(storage Storage, deliver func(OutboxMessage) error) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		storage: storage,
+		deliver: deliver,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Start 启动投递协程
+func (d *OutboxDispatcher) Start() {
+	go d.run()
+	logger.Info("outbox", "发件箱投递器已启动\n")
+}
+
+// Notify 唤醒投递协程，有新通知提交后调用；不会阻塞
+func (d *OutboxDispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *OutboxDispatcher) run() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.dispatchPending(); err != nil {
+			logger.Info("outbox", fmt.Sprintf("投递通知失败，稍后重试: %v\n", err))
+		}
+		if err := d.prune(); err != nil {
+			logger.Info("outbox", fmt.Sprintf("清理已投递通知失败: %v\n", err))
+		}
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// 投递所有未投递的通知，遇到投递失败时停止，已投递的部分先标记
+func (d *OutboxDispatcher) dispatchPending() error {
+	for {
+		var messages []OutboxMessage
+		err := view(d.storage, func(tx Tx) (err error) {
+			messages, err = tx.Outbox().ListPending(outboxBatchSize)
+			return err
+		})
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		var delivered int64
+		var deliverErr error
+		for _, message := range messages {
+			if deliverErr = d.deliver(message); deliverErr != nil {
+				break
+			}
+			delivered = message.Seq
+		}
+		if delivered > 0 {
+			if err = d.markDelivered(delivered); err != nil {
+				return err
+			}
+		}
+		if deliverErr != nil {
+			return deliverErr
+		}
+		if len(messages) < outboxBatchSize {
+			return nil
+		}
+	}
+}
+
+func (d *OutboxDispatcher) markDelivered(seq int64) error {
+	tx, err := d.storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = tx.Outbox().MarkDelivered(seq); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 每小时清理一次投递时间早于补发窗口的通知，窗口内的通知保留用于补发
+func (d *OutboxDispatcher) prune() error {
+	now := timeservice.SyncNow()
+	if now.Sub(d.lastPruned) < time.Hour {
+		return nil
+	}
+	tx, err := d.storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = tx.Outbox().PruneDelivered(now.Add(-outboxReplayWindow)); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	d.lastPruned = now
+	return nil
+}
+
+// 补发序号大于 lastSeq 的通知（包括还没投递的，客户端按序号去重），依次交给 send。
+// lastSeq 这条通知已被清理或者缺失的通知超过 outboxReplayLimit 时不补发，返回 false，
+// 客户端需要重新拉取全部状态
+func replayOutbox(storage Storage, lastSeq int64, send func(OutboxMessage) error) (bool, error) {
+	var messages []OutboxMessage
+	err := view(storage, func(tx Tx) (err error) {
+		// 多取一条用于判断是否超过补发上限
+		messages, err = tx.Outbox().ListFrom(lastSeq, outboxReplayLimit+2)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(messages) == 0 || messages[0].Seq != lastSeq || len(messages) > outboxReplayLimit+1 {
+		return false, nil
+	}
+	for _, message := range messages[1:] {
+		if err = send(message); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,214 @@
+package market
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/timeservice"
+)
+
+var errTestDeliver = errors.New("连接已断开")
+
+// 在一个事务中依次写入 count 条通知，内容为写入顺序
+func enqueueTestMessages(t *testing.T, storage Storage, count int) {
+	t.Helper()
+	withTx(t, storage, func(tx Tx) error {
+		for i := 0; i < count; i++ {
+			if err := enqueueOutbox(tx, OutboxMarketTrade, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestOutboxDispatchOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		count  int
+		failAt []int // 每次投递时在第几条通知失败，-1 表示不失败
+		want   [][]int
+	}{
+		{"按写入顺序投递", 3, []int{-1}, [][]int{{0, 1, 2}}},
+		{"超过一批", outboxBatchSize + 5, []int{-1}, nil},
+		{"失败后从失败的通知重新投递", 4, []int{2, -1}, [][]int{{0, 1}, {2, 3}}},
+		{"第一条就失败", 2, []int{0, 0, -1}, [][]int{{}, {}, {0, 1}}},
+		{"没有通知", 0, []int{-1}, [][]int{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewMemoryStorage()
+			enqueueTestMessages(t, storage, tt.count)
+
+			var delivered []int
+			var lastSeq int64
+			attempt, position := 0, 0
+			dispatcher := NewOutboxDispatcher(storage, func(message OutboxMessage) error {
+				if position == tt.failAt[attempt] {
+					return errTestDeliver
+				}
+				position++
+				if message.Seq <= lastSeq {
+					t.Errorf("序号 %d 没有大于上一条的 %d", message.Seq, lastSeq)
+				}
+				lastSeq = message.Seq
+				var index int
+				if err := json.Unmarshal(message.Payload, &index); err != nil {
+					t.Fatal(err)
+				}
+				delivered = append(delivered, index)
+				return nil
+			})
+
+			var all []int
+			for attempt = range tt.failAt {
+				delivered, position = nil, 0
+				err := dispatcher.dispatchPending()
+				if wantErr := tt.failAt[attempt] >= 0; (err != nil) != wantErr || (err != nil && !errors.Is(err, errTestDeliver)) {
+					t.Fatalf("第%d次投递 错误 = %v，期望失败 %v", attempt+1, err, wantErr)
+				}
+				if tt.want != nil && !equalInts(delivered, tt.want[attempt]) {
+					t.Errorf("第%d次投递 = %v，期望 %v", attempt+1, delivered, tt.want[attempt])
+				}
+				all = append(all, delivered...)
+			}
+
+			// 每条通知恰好投递一次，并且不再留在发件箱中
+			if len(all) != tt.count {
+				t.Fatalf("共投递 %d 条，期望 %d 条", len(all), tt.count)
+			}
+			for i, index := range all {
+				if index != i {
+					t.Fatalf("第%d条投递的是第%d条通知", i+1, index+1)
+				}
+			}
+			if pending := pendingOutbox(t, storage); len(pending) != 0 {
+				t.Errorf("投递完后还有 %d 条未投递的通知", len(pending))
+			}
+		})
+	}
+}
+
+// 回滚的事务中写入的通知不会投递，序号在之后的写入中继续递增
+func TestOutboxRollback(t *testing.T) {
+	storage := NewMemoryStorage()
+	enqueueTestMessages(t, storage, 1)
+
+	tx, err := storage.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = enqueueOutbox(tx, OutboxMarketTrade, 99); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	enqueueTestMessages(t, storage, 1)
+	pending := pendingOutbox(t, storage)
+	if len(pending) != 2 {
+		t.Fatalf("未投递的通知 = %d 条，期望 2 条", len(pending))
+	}
+	if pending[0].Seq >= pending[1].Seq {
+		t.Errorf("序号 %d, %d 没有递增", pending[0].Seq, pending[1].Seq)
+	}
+}
+
+// 重连补发：补发窗口内的通知按序号补发，之前的通知已清理或缺失太多时要求客户端重新拉取
+func TestOutboxReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		deliver  int  // 已投递的通知数
+		prune    bool // 清理所有已投递的通知
+		lastSeq  int64
+		complete bool
+		want     []int64
+	}{
+		{"补发已投递的通知", 5, 5, false, 2, true, []int64{3, 4, 5}},
+		{"也补发还没投递的通知", 5, 2, false, 1, true, []int64{2, 3, 4, 5}},
+		{"没有缺失", 3, 3, false, 3, true, nil},
+		{"窗口内的通知不会被清理", 3, 3, false, 1, true, []int64{2, 3}},
+		{"上次收到的通知已清理", 5, 3, true, 2, false, nil},
+		{"序号超过最新通知", 3, 3, false, 10, false, nil},
+		{"缺失太多", outboxReplayLimit + 2, 0, false, 1, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewMemoryStorage()
+			enqueueTestMessages(t, storage, tt.count)
+			withTx(t, storage, func(tx Tx) error {
+				if err := tx.Outbox().MarkDelivered(int64(tt.deliver)); err != nil {
+					return err
+				}
+				// 按补发窗口清理，刚投递的通知都在窗口内；prune 时把窗口移到之后
+				before := timeservice.SyncNow().Add(-outboxReplayWindow)
+				if tt.prune {
+					before = timeservice.SyncNow().Add(time.Second)
+				}
+				return tx.Outbox().PruneDelivered(before)
+			})
+
+			var replayed []int64
+			complete, err := replayOutbox(storage, tt.lastSeq, func(message OutboxMessage) error {
+				replayed = append(replayed, message.Seq)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if complete != tt.complete || !equalSeqs(replayed, tt.want) {
+				t.Errorf("补发 = %v %v，期望 %v %v", replayed, complete, tt.want, tt.complete)
+			}
+		})
+	}
+}
+
+// 补发的通知中只发给其他玩家的只带序号
+func TestOutboxWSMessage(t *testing.T) {
+	message := OutboxMessage{Seq: 7, UserID: 2, Type: OutboxOrderUpdate, Payload: json.RawMessage(`{"id":1}`)}
+	if got := outboxWSMessage(message, 2); got.Type != OutboxOrderUpdate || got.Seq != 7 || got.Data == nil {
+		t.Errorf("发给接收者的消息 = %+v", got)
+	}
+	if got := outboxWSMessage(message, 3); got.Type != "seq" || got.Seq != 7 || got.Data != nil {
+		t.Errorf("发给其他玩家的消息 = %+v，期望只带序号", got)
+	}
+}
+
+func pendingOutbox(t *testing.T, storage Storage) []OutboxMessage {
+	t.Helper()
+	var pending []OutboxMessage
+	err := view(storage, func(tx Tx) (err error) {
+		pending, err = tx.Outbox().ListPending(outboxBatchSize)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalSeqs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package market
+
+import (
+	"math"
+
+	"own-1Pixel/backend/go/money"
+)
+
+// 市场物品的定价模型
+const (
+	PriceModelLinear = "linear" // 线性：库存偏离平衡点时每次交易按偏离量调整价格（默认）
+	PriceModelAMM    = "amm"    // 恒定乘积做市：价格与（库存+虚拟流动性）的平方成反比
+	PriceModelLMSR   = "lmsr"   // 对数市场评分规则：价格随净买入量沿S形曲线变化，有上下限
+	PriceModelEMA    = "ema"    // 指数移动平均：价格按平滑系数逐步趋近库存对应的目标价格
+)
+
+// 全部定价模型，按市场参数页面的显示顺序
+var priceModelNames = []string{PriceModelLinear, PriceModelAMM, PriceModelLMSR, PriceModelEMA}
+
+// PriceModel 市场物品的定价模型，按库存变化后的状态给出新价格
+type PriceModel interface {
+	// Price 库存变为 stock 后的新价格，current 为变化前的价格
+	Price(current money.Money, stock int) money.Money
+}
+
+// 按市场参数选择的模型创建定价模型，未设置时为线性模型
+func priceModel(params MarketParams, basePrice money.Money) PriceModel {
+	balance := params.BalanceRange * 5 // 假设5个物品为平衡点
+	switch params.PriceModel {
+	case PriceModelAMM:
+		return ammPriceModel{base: basePrice, balance: balance, liquidity: params.Liquidity}
+	case PriceModelLMSR:
+		return lmsrPriceModel{base: basePrice, balance: balance, liquidity: params.Liquidity}
+	case PriceModelEMA:
+		return emaPriceModel{base: basePrice, balance: balance, fluctuation: params.PriceFluctuation, smoothing: params.Smoothing}
+	}
+	return linearPriceModel{balance: int(balance), fluctuation: params.PriceFluctuation, maxChange: params.MaxPriceChange}
+}
+
+// 检查定价模型和模型需要的参数
+func validatePriceModel(params *MarketParams) error {
+	if params.PriceModel == "" {
+		params.PriceModel = PriceModelLinear
+	}
+	if params.BalanceRange <= 0 {
+		return serviceError(ErrInvalidArgument, "平衡区间系数必须为正数")
+	}
+	if params.PriceFluctuation < 0 || params.MaxPriceChange < 0 {
+		return serviceError(ErrInvalidArgument, "价格波动系数和最大价格变动系数不能为负数")
+	}
+	if params.MinPriceRatio <= 0 || params.MinPriceRatio > 1 || params.MaxPriceRatio < 1 {
+		return serviceError(ErrInvalidArgument, "价格下限比例必须在0到1之间，价格上限比例不能小于1")
+	}
+	switch params.PriceModel {
+	case PriceModelLinear:
+	case PriceModelAMM, PriceModelLMSR:
+		if params.Liquidity <= 0 {
+			return serviceError(ErrInvalidArgument, "流动性参数必须为正数")
+		}
+	case PriceModelEMA:
+		if params.Smoothing <= 0 || params.Smoothing > 1 {
+			return serviceError(ErrInvalidArgument, "平滑系数必须在0到1之间")
+		}
+	default:
+		return serviceError(ErrInvalidArgument, "无效的定价模型: %s", params.PriceModel)
+	}
+	return nil
+}
+
+// 价格限制在市场参数设置的基础价格比例区间内
+func clampPrice(price money.Money, basePrice money.Money, params MarketParams) money.Money {
+	minPrice := money.FromFloat(basePrice.Float64() * params.MinPriceRatio)
+	maxPrice := money.FromFloat(basePrice.Float64() * params.MaxPriceRatio)
+	if price.LessThan(minPrice) {
+		return minPrice
+	}
+	if price.GreaterThan(maxPrice) {
+		return maxPrice
+	}
+	return price
+}
+
+// 线性模型：库存高于平衡点时每次交易降价，低于平衡点时涨价，
+// 变动量与偏离量成正比，单次变动不超过最大价格变动系数
+type linearPriceModel struct {
+	balance     int
+	fluctuation float64
+	maxChange   float64
+}
+
+func (m linearPriceModel) Price(current money.Money, stock int) money.Money {
+	// 供求平衡，价格不变
+	if stock == m.balance {
+		return current
+	}
+
+	// 供过于求时偏离量为负，价格下降；供不应求时为正，价格上涨
+	priceChange := float64(m.balance-stock) * m.fluctuation * 0.1
+	priceChange = math.Max(-m.maxChange, math.Min(m.maxChange, priceChange))
+
+	// 变动量四舍五入到分
+	return addPriceChange(current, priceChange)
+}
+
+// 价格加上以元为单位的变动量，超出金额范围时保持原价（随后限制在价格区间内）
+func addPriceChange(current money.Money, change float64) money.Money {
+	price, err := current.Add(money.FromFloat(change))
+	if err != nil {
+		return current
+	}
+	return price
+}
+
+// 恒定乘积做市模型：市场持有（库存+虚拟流动性）个物品，物品数量与资金数量的乘积不变，
+// 边际价格为 k/x²；k 取在平衡点时价格等于基础价格。虚拟流动性越大价格曲线越平缓
+type ammPriceModel struct {
+	base      money.Money
+	balance   float64
+	liquidity float64
+}
+
+func (m ammPriceModel) Price(_ money.Money, stock int) money.Money {
+	ratio := (m.balance + m.liquidity) / (float64(stock) + m.liquidity)
+	return money.FromFloat(m.base.Float64() * ratio * ratio)
+}
+
+// 对数市场评分规则：以平衡点为起点，市场净卖出 q 个物品（库存低于平衡点的数量）后，
+// 价格为 2×基础价格×e^(q/b)/(e^(q/b)+1)，b 为流动性参数，平衡点时等于基础价格，最高不超过基础价格的2倍
+type lmsrPriceModel struct {
+	base      money.Money
+	balance   float64
+	liquidity float64
+}
+
+func (m lmsrPriceModel) Price(_ money.Money, stock int) money.Money {
+	q := m.balance - float64(stock)
+	return money.FromFloat(2 * m.base.Float64() / (1 + math.Exp(-q/m.liquidity)))
+}
+
+// 指数移动平均模型：目标价格为基础价格加上与库存偏离量成正比的变动，
+// 每次交易价格向目标价格移动差额的平滑系数倍，价格变化平稳且不会因连续交易无限漂移
+type emaPriceModel struct {
+	base        money.Money
+	balance     float64
+	fluctuation float64
+	smoothing   float64
+}
+
+func (m emaPriceModel) Price(current money.Money, stock int) money.Money {
+	target := m.base.Float64() + (m.balance-float64(stock))*m.fluctuation*0.1
+	return addPriceChange(current, (target-current.Float64())*m.smoothing)
+}
@@ -0,0 +1,157 @@
+package market
+
+import (
+	"errors"
+	"testing"
+
+	"own-1Pixel/backend/go/money"
+)
+
+// 测试用市场参数：平衡点为5个物品，价格区间为基础价格的50%到200%
+func testMarketParams(model string) MarketParams {
+	return MarketParams{
+		PriceModel:       model,
+		BalanceRange:     1,
+		PriceFluctuation: 1,
+		MaxPriceChange:   1,
+		Liquidity:        10,
+		Smoothing:        0.5,
+		MinPriceRatio:    0.5,
+		MaxPriceRatio:    2,
+	}
+}
+
+func TestPriceModels(t *testing.T) {
+	base := money.New(100)
+	tests := []struct {
+		model   string
+		current int64 // 变化前的价格（分）
+		stock   int
+		raw     int64 // 模型给出的价格
+		clamped int64 // 限制在价格区间后的价格
+	}{
+		{PriceModelLinear, 100, 5, 100, 100},
+		{PriceModelLinear, 100, 6, 90, 90},
+		{PriceModelLinear, 100, 0, 150, 150},
+		{PriceModelLinear, 100, 20, 0, 50}, // 单次变动不超过最大价格变动
+		{PriceModelLinear, 190, 0, 240, 200},
+		{PriceModelAMM, 100, 5, 100, 100},
+		{PriceModelAMM, 100, 0, 225, 200}, // (15/10)²
+		{PriceModelAMM, 100, 10, 56, 56},  // (15/20)²
+		{PriceModelAMM, 100, 20, 25, 50},
+		{PriceModelLMSR, 100, 5, 100, 100},
+		{PriceModelLMSR, 100, 0, 124, 124}, // 2/(1+e^-0.5)
+		{PriceModelLMSR, 100, 15, 54, 54},  // 2/(1+e^1)
+		{PriceModelLMSR, 100, -1000, 200, 200},
+		{PriceModelEMA, 100, 0, 125, 125}, // 目标 1.50，移动一半
+		{PriceModelEMA, 200, 5, 150, 150}, // 目标 1.00，移动一半
+		{PriceModelEMA, 100, 5, 100, 100},
+	}
+	for _, tt := range tests {
+		params := testMarketParams(tt.model)
+		current := money.New(tt.current)
+		if got := priceModel(params, base).Price(current, tt.stock); got.Minor() != tt.raw {
+			t.Errorf("%s 价格 %d 库存 %d: 模型价格 = %d，期望 %d", tt.model, tt.current, tt.stock, got.Minor(), tt.raw)
+		}
+		if got := CalculateNewPrice(current, tt.stock, params, base); got.Minor() != tt.clamped {
+			t.Errorf("%s 价格 %d 库存 %d: 新价格 = %d，期望 %d", tt.model, tt.current, tt.stock, got.Minor(), tt.clamped)
+		}
+	}
+}
+
+func TestClampPrice(t *testing.T) {
+	base := money.New(100)
+	tests := []struct {
+		minRatio, maxRatio float64
+		price, want        int64
+	}{
+		{0.5, 2, 40, 50},
+		{0.5, 2, 120, 120},
+		{0.5, 2, 250, 200},
+		{0.8, 1.2, 70, 80},
+		{0.8, 1.2, 124, 120},
+		{1, 1, 130, 100},
+	}
+	for _, tt := range tests {
+		params := MarketParams{MinPriceRatio: tt.minRatio, MaxPriceRatio: tt.maxRatio}
+		if got := clampPrice(money.New(tt.price), base, params); got.Minor() != tt.want {
+			t.Errorf("区间 %.1f-%.1f 价格 %d = %d，期望 %d", tt.minRatio, tt.maxRatio, tt.price, got.Minor(), tt.want)
+		}
+	}
+}
+
+func TestValidatePriceModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*MarketParams)
+		ok     bool
+	}{
+		{"默认参数", func(p *MarketParams) {}, true},
+		{"未设置模型时为线性", func(p *MarketParams) { p.PriceModel = "" }, true},
+		{"未知模型", func(p *MarketParams) { p.PriceModel = "random" }, false},
+		{"平衡区间为0", func(p *MarketParams) { p.BalanceRange = 0 }, false},
+		{"负的价格波动", func(p *MarketParams) { p.PriceFluctuation = -1 }, false},
+		{"AMM流动性为0", func(p *MarketParams) { p.PriceModel, p.Liquidity = PriceModelAMM, 0 }, false},
+		{"LMSR流动性为正", func(p *MarketParams) { p.PriceModel = PriceModelLMSR }, true},
+		{"EMA平滑系数为0", func(p *MarketParams) { p.PriceModel, p.Smoothing = PriceModelEMA, 0 }, false},
+		{"EMA平滑系数大于1", func(p *MarketParams) { p.PriceModel, p.Smoothing = PriceModelEMA, 1.5 }, false},
+		{"价格下限为0", func(p *MarketParams) { p.MinPriceRatio = 0 }, false},
+		{"价格下限大于1", func(p *MarketParams) { p.MinPriceRatio = 1.1 }, false},
+		{"价格上限小于1", func(p *MarketParams) { p.MaxPriceRatio = 0.9 }, false},
+		{"固定价格", func(p *MarketParams) { p.MinPriceRatio, p.MaxPriceRatio = 1, 1 }, true},
+	}
+	for _, tt := range tests {
+		params := testMarketParams(PriceModelLinear)
+		tt.modify(&params)
+		err := validatePriceModel(&params)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: 错误 = %v，期望通过 %v", tt.name, err, tt.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%s: 错误类别 = %v，期望 %v", tt.name, err, ErrInvalidArgument)
+		}
+		if err == nil && params.PriceModel == "" {
+			t.Errorf("%s: 没有补上默认定价模型", tt.name)
+		}
+	}
+}
+
+// 批量买卖沿价格曲线逐个成交，数量越大平均价格越差
+func TestFillAlongCurve(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		delta    int
+		quantity int
+		total    int64 // 成交总额（分）
+		average  int64 // 平均成交价格（分）
+		price    int64 // 成交后的市场价格（分）
+		stock    int   // 成交后的市场库存
+	}{
+		{"线性卖出", PriceModelLinear, 1, 3, 210, 70, 50, 8},    // 0.90, 0.70, 0.50（0.40 限制到下限）
+		{"线性买入", PriceModelLinear, -1, 3, 400, 133, 160, 2}, // 1.10, 1.30, 1.60
+		{"AMM买入", PriceModelAMM, -1, 2, 248, 124, 133, 3},   // 1.15, 1.33
+		{"LMSR卖出", PriceModelLMSR, 1, 2, 185, 93, 90, 7},    // 0.95, 0.90
+		{"EMA买入", PriceModelEMA, -1, 2, 217, 109, 112, 3},   // 1.05, 1.12
+		{"单个", PriceModelLinear, 1, 1, 90, 90, 90, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &MarketItem{Name: "apple", Price: money.New(100), Stock: 5, BasePrice: money.New(100)}
+			params := testMarketParams(tt.model)
+			total, err := fillAlongCurve(item, &params, tt.delta, tt.quantity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total.Minor() != tt.total {
+				t.Errorf("成交总额 = %d，期望 %d", total.Minor(), tt.total)
+			}
+			if got := averagePrice(total, tt.quantity); got.Minor() != tt.average {
+				t.Errorf("平均价格 = %d，期望 %d", got.Minor(), tt.average)
+			}
+			if item.Price.Minor() != tt.price || item.Stock != tt.stock {
+				t.Errorf("成交后 价格 %d 库存 %d，期望 价格 %d 库存 %d", item.Price.Minor(), item.Stock, tt.price, tt.stock)
+			}
+		})
+	}
+}
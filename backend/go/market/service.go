@@ -0,0 +1,67 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 业务错误类别，HTTP适配层据此选择状态码
+var (
+	ErrInvalidArgument = errors.New("请求参数无效")
+	ErrForbidden       = errors.New("没有操作权限")
+	ErrConflict        = errors.New("当前状态不允许该操作")
+)
+
+// ServiceError 业务层返回的错误。Message 可以直接展示给玩家，
+// Kind 为错误类别（ErrInvalidArgument、ErrAuctionNotFound、cash.ErrInsufficientFunds 等），
+// 内部错误的 Kind 为空，Err 保存底层错误
+type ServiceError struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (e *ServiceError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *ServiceError) Unwrap() error {
+	if e.Kind != nil {
+		return e.Kind
+	}
+	return e.Err
+}
+
+// 构造业务错误
+func serviceError(kind error, format string, args ...interface{}) error {
+	return &ServiceError{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// 构造内部错误，message 说明失败的步骤
+func internalError(message string, err error) error {
+	return &ServiceError{Message: message, Err: err}
+}
+
+// 检查请求是否已取消后开始事务
+func beginTx(ctx context.Context, storage Storage) (Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tx, err := storage.Begin()
+	if err != nil {
+		return nil, internalError("事务开始失败", err)
+	}
+	return tx, nil
+}
+
+// 提交事务
+func commitTx(tx Tx) error {
+	if err := tx.Commit(); err != nil {
+		return internalError("事务提交失败", err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package market
+
+import (
+	"errors"
+	"testing"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+)
+
+// 创建内存存储，为玩家开立现金账户并从外部资金存入初始余额（分）
+func newTestStorage(t *testing.T, funds map[int]int64) *MemoryStorage {
+	t.Helper()
+	storage := NewMemoryStorage()
+	fundTestUsers(t, storage, funds)
+	return storage
+}
+
+// 为玩家开立现金账户并从外部资金存入初始余额（分）
+func fundTestUsers(t *testing.T, storage Storage, funds map[int]int64) {
+	t.Helper()
+	for userID, amount := range funds {
+		withTx(t, storage, func(tx Tx) error {
+			return cash.EnsureUserAccount(tx.Ledger(), userID)
+		})
+		if amount == 0 {
+			continue
+		}
+		withTx(t, storage, func(tx Tx) error {
+			externalID, err := cash.AccountIDByCode(tx.Ledger(), cash.AccountExternal)
+			if err != nil {
+				return err
+			}
+			accountID, err := cash.UserCashAccountID(tx.Ledger(), userID)
+			if err != nil {
+				return err
+			}
+			_, err = cash.Transfer(tx.Ledger(), cash.TransferRequest{
+				Kind:          cash.EntryKindManual,
+				FromAccountID: externalID,
+				ToAccountID:   accountID,
+				Amount:        money.New(amount),
+			})
+			return err
+		})
+	}
+}
+
+// 在事务中执行 fn 并提交
+func withTx(t *testing.T, storage Storage, fn func(tx Tx) error) {
+	t.Helper()
+	tx, err := storage.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err = fn(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 向玩家背包放入物品
+func giveItems(t *testing.T, storage Storage, userID int, code string, quantity int) {
+	t.Helper()
+	withTx(t, storage, func(tx Tx) error {
+		return tx.Inventory().AddItems(userID, code, quantity)
+	})
+}
+
+// 玩家现金余额（分）
+func balanceOf(t *testing.T, storage Storage, userID int) int64 {
+	t.Helper()
+	var balance int64
+	view(storage, func(tx Tx) error {
+		account, err := cash.GetUserCashAccount(tx.Ledger(), userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balance = account.Balance.Minor()
+		return nil
+	})
+	return balance
+}
+
+// 系统账户余额（分）
+func systemBalanceOf(t *testing.T, storage Storage, code string) int64 {
+	t.Helper()
+	var balance int64
+	view(storage, func(tx Tx) error {
+		account, err := tx.Ledger().AccountByCode(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		balance = account.Balance.Minor()
+		return nil
+	})
+	return balance
+}
+
+// 玩家背包中物品的数量
+func quantityOf(t *testing.T, storage Storage, userID int, code string) int {
+	t.Helper()
+	var quantity int
+	view(storage, func(tx Tx) error {
+		var err error
+		if quantity, err = tx.Inventory().GetQuantity(userID, code); err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+	return quantity
+}
+
+// 检查错误类别，want 为空时要求没有错误
+func checkErrorKind(t *testing.T, err, want error) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Fatalf("意外的错误: %v", err)
+		}
+		return
+	}
+	if !errors.Is(err, want) {
+		t.Fatalf("错误 = %v，期望 %v", err, want)
+	}
+}
@@ -0,0 +1,173 @@
+package market
+
+import (
+	"errors"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/money"
+)
+
+// 存储相关错误
+var (
+	ErrMarketParamsNotFound = errors.New("市场参数不存在")
+	ErrMarketItemNotFound   = errors.New("市场物品不存在")
+	ErrItemNotFound         = errors.New("物品目录中没有该物品")
+	ErrAuctionNotFound      = errors.New("拍卖不存在")
+	ErrAuctionBidNotFound   = errors.New("竞价记录不存在")
+	ErrOrderNotFound        = errors.New("订单不存在")
+	ErrInvalidItemType      = errors.New("无效的物品类型")
+)
+
+// MarketStore 市场存储：市场参数、物品目录和市场物品
+type MarketStore interface {
+	// GetParams 获取当前默认市场参数，不存在时返回 ErrMarketParamsNotFound
+	GetParams() (*MarketParams, error)
+	// GetItemParams 获取物品自己的市场参数，物品没有单独设置时返回 ErrMarketParamsNotFound
+	GetItemParams(code string) (*MarketParams, error)
+	// ListItemParams 获取单独设置了市场参数的物品的参数，按物品代码升序
+	ListItemParams() ([]MarketParams, error)
+	// CreateParams 写入市场参数，回填ID
+	CreateParams(params *MarketParams) error
+	// UpdateParams 按ID更新市场参数
+	UpdateParams(params *MarketParams) error
+	// ListCatalogItems 获取物品目录中的全部物品，按ID升序
+	ListCatalogItems() ([]Item, error)
+	// GetCatalogItem 按物品代码获取物品目录中的物品，不存在时返回 ErrItemNotFound
+	GetCatalogItem(code string) (*Item, error)
+	// CreateCatalogItem 写入物品目录，回填ID
+	CreateCatalogItem(item *Item) error
+	// GetItem 按物品代码获取市场物品，不存在时返回 ErrMarketItemNotFound
+	GetItem(code string) (*MarketItem, error)
+	// CreateItem 写入市场物品，回填ID
+	CreateItem(item *MarketItem) error
+	// UpdateItem 按ID更新市场物品的价格和库存
+	UpdateItem(item *MarketItem) error
+}
+
+// InventoryStore 库存存储：每个玩家每种物品一条数量记录，以及尚未完成的制作任务
+type InventoryStore interface {
+	// GetBackpack 获取玩家背包中数量不为0的全部物品
+	GetBackpack(userID int) (*Backpack, error)
+	// GetQuantity 获取玩家背包中某种物品的数量，没有记录时为0
+	GetQuantity(userID int, code string) (int, error)
+	// AddItems 增减玩家背包中的物品数量（数量为负时减少）
+	AddItems(userID int, code string, quantity int) error
+	// CreateCraftingJob 写入制作任务，回填ID
+	CreateCraftingJob(job *CraftingJob) error
+	// ListCraftingJobs 获取玩家制作中的任务，按完成时间升序
+	ListCraftingJobs(userID int) ([]CraftingJob, error)
+	// CompleteCraftingJob 将制作任务标记为已完成
+	CompleteCraftingJob(jobID int, completedAt time.Time) error
+}
+
+// 拍卖查询条件，零值表示不限
+type AuctionFilter struct {
+	SellerID int             // 卖家ID
+	Statuses []AuctionStatus // 状态
+}
+
+// AuctionStore 拍卖存储：荷兰钟拍卖和竞价记录
+type AuctionStore interface {
+	// CreateAuction 写入拍卖，回填ID和创建时间
+	CreateAuction(auction *Auction) error
+	// GetAuction 获取拍卖，不存在时返回 ErrAuctionNotFound
+	GetAuction(auctionID int) (*Auction, error)
+	// ListAuctions 按条件查询拍卖，最新创建的在前
+	ListAuctions(filter AuctionFilter) ([]Auction, error)
+	// UpdateAuction 按ID保存拍卖的当前价格、剩余数量、起止时间、状态和中标者。
+	// 状态只能经 transitionAuction 修改
+	UpdateAuction(auction *Auction) error
+	// UpdateAuctionPrice 只更新拍卖的当前价格，不覆盖其他并发修改
+	UpdateAuctionPrice(auctionID int, price money.Money) error
+	// CreateBid 写入竞价记录，回填ID
+	CreateBid(bid *AuctionBid) error
+	// UpdateBidStatus 更新竞价记录状态
+	UpdateBidStatus(bidID int, status string) error
+	// GetBid 获取竞价记录，不存在时返回 ErrAuctionBidNotFound
+	GetBid(bidID int) (*AuctionBid, error)
+	// ListBids 获取拍卖的全部竞价记录，按ID升序
+	ListBids(auctionID int) ([]AuctionBid, error)
+	// CreateEvent 写入拍卖状态变化记录，回填ID
+	CreateEvent(event *AuctionEvent) error
+	// ListEvents 获取拍卖的全部状态变化记录，按ID升序
+	ListEvents(auctionID int) ([]AuctionEvent, error)
+}
+
+// Tx 存储事务，同一事务中对账本、市场、背包、拍卖、订单簿和发件箱的修改一起提交或回滚
+type Tx interface {
+	Ledger() cash.LedgerStore
+	Market() MarketStore
+	Inventory() InventoryStore
+	Auctions() AuctionStore
+	Orders() OrderStore
+	Outbox() OutboxStore
+	Commit() error
+	Rollback() error
+}
+
+// Storage 存储后端，所有读写都在事务中进行
+type Storage interface {
+	Begin() (Tx, error)
+}
+
+// 在只读事务中执行查询
+func view(storage Storage, fn func(tx Tx) error) error {
+	tx, err := storage.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// LedgerStorage 将存储后端作为账本存储后端使用，现金模块与市场共用同一个账本
+func LedgerStorage(storage Storage) cash.Storage {
+	return ledgerStorage{storage: storage}
+}
+
+type ledgerStorage struct {
+	storage Storage
+}
+
+func (s ledgerStorage) Begin() (cash.Tx, error) {
+	tx, err := s.storage.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// 按配置初始化市场参数和内置物品的市场物品（已存在则跳过）
+func seedMarket(store MarketStore) error {
+	marketConfig := config.GetConfig().Market
+
+	_, err := store.GetParams()
+	if err == ErrMarketParamsNotFound {
+		err = store.CreateParams(&MarketParams{
+			PriceModel:       marketConfig.DefaultPriceModel,
+			BalanceRange:     marketConfig.DefaultBalance,
+			PriceFluctuation: marketConfig.DefaultFluctuation,
+			MaxPriceChange:   marketConfig.DefaultMaxChange,
+			Liquidity:        marketConfig.DefaultLiquidity,
+			Smoothing:        marketConfig.DefaultSmoothing,
+			MinPriceRatio:    marketConfig.DefaultMinPriceRatio,
+			MaxPriceRatio:    marketConfig.DefaultMaxPriceRatio,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, item := range defaultItems() {
+		_, err = store.GetItem(item.Code)
+		if err == ErrMarketItemNotFound {
+			err = store.CreateItem(&MarketItem{Name: item.Code, Price: item.BasePrice, BasePrice: item.BasePrice})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,638 @@
+package market
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 内存中的全部数据，事务开始时整体复制
+type memoryState struct {
+	ledger    *cash.MemoryLedger
+	params    []MarketParams
+	catalog   []Item // 物品目录，按ID排列
+	items     map[string]*MarketItem
+	nextItem  int
+	inventory map[int]map[string]int // 玩家ID -> 物品代码 -> 数量
+	jobs      []CraftingJob          // 制作任务，按ID排列
+	auctions  map[int]*Auction
+	bids      []AuctionBid
+	events    []AuctionEvent      // 拍卖状态变化记录
+	orders    []Order             // 订单簿订单，按ID排列
+	trades    []Trade             // 订单簿成交记录，按ID排列
+	outbox    []memoryOutboxEntry // 发件箱通知，按序号排列，已投递的保留到清理
+	nextSeq   int64
+}
+
+func (s *memoryState) clone() *memoryState {
+	clone := &memoryState{
+		ledger:    s.ledger.Clone(),
+		params:    append([]MarketParams(nil), s.params...),
+		catalog:   make([]Item, 0, len(s.catalog)),
+		items:     make(map[string]*MarketItem, len(s.items)),
+		nextItem:  s.nextItem,
+		inventory: make(map[int]map[string]int, len(s.inventory)),
+		jobs:      make([]CraftingJob, 0, len(s.jobs)),
+		auctions:  make(map[int]*Auction, len(s.auctions)),
+		bids:      append([]AuctionBid(nil), s.bids...),
+		events:    append([]AuctionEvent(nil), s.events...),
+		orders:    append([]Order(nil), s.orders...),
+		trades:    append([]Trade(nil), s.trades...),
+		outbox:    append([]memoryOutboxEntry(nil), s.outbox...),
+		nextSeq:   s.nextSeq,
+	}
+	for _, item := range s.catalog {
+		clone.catalog = append(clone.catalog, copyCatalogItem(item))
+	}
+	for code, item := range s.items {
+		copied := *item
+		clone.items[code] = &copied
+	}
+	for _, job := range s.jobs {
+		clone.jobs = append(clone.jobs, copyCraftingJob(job))
+	}
+	for userID, items := range s.inventory {
+		copied := make(map[string]int, len(items))
+		for code, quantity := range items {
+			copied[code] = quantity
+		}
+		clone.inventory[userID] = copied
+	}
+	for auctionID, auction := range s.auctions {
+		clone.auctions[auctionID] = copyAuction(auction)
+	}
+	return clone
+}
+
+// 复制物品目录中的物品，名称和配方不与原记录共享
+func copyCatalogItem(item Item) Item {
+	copied := item
+	copied.Names = make(map[string]string, len(item.Names))
+	for language, name := range item.Names {
+		copied.Names[language] = name
+	}
+	if item.Recipe != nil {
+		recipe := *item.Recipe
+		recipe.Inputs = append([]RecipeInput(nil), item.Recipe.Inputs...)
+		copied.Recipe = &recipe
+	}
+	return copied
+}
+
+// 复制制作任务，完成时间指针不与原记录共享
+func copyCraftingJob(job CraftingJob) CraftingJob {
+	if job.CompletedAt != nil {
+		completedAt := *job.CompletedAt
+		job.CompletedAt = &completedAt
+	}
+	return job
+}
+
+// 复制拍卖，起止时间指针和阶梯点位不与原记录共享
+func copyAuction(auction *Auction) *Auction {
+	copied := *auction
+	copied.DecaySteps = append([]DecayStep(nil), auction.DecaySteps...)
+	if auction.StartTime != nil {
+		startTime := *auction.StartTime
+		copied.StartTime = &startTime
+	}
+	if auction.EndTime != nil {
+		endTime := *auction.EndTime
+		copied.EndTime = &endTime
+	}
+	if auction.ScheduledStart != nil {
+		scheduledStart := *auction.ScheduledStart
+		copied.ScheduledStart = &scheduledStart
+	}
+	if auction.ScheduledEnd != nil {
+		scheduledEnd := *auction.ScheduledEnd
+		copied.ScheduledEnd = &scheduledEnd
+	}
+	if auction.PausedAt != nil {
+		pausedAt := *auction.PausedAt
+		copied.PausedAt = &pausedAt
+	}
+	return &copied
+}
+
+// 内存市场存储
+type memoryMarketStore struct {
+	state *memoryState
+}
+
+func (s memoryMarketStore) GetParams() (*MarketParams, error) {
+	return s.GetItemParams("")
+}
+
+func (s memoryMarketStore) GetItemParams(code string) (*MarketParams, error) {
+	for i := len(s.state.params) - 1; i >= 0; i-- {
+		if s.state.params[i].ItemCode == code {
+			params := s.state.params[i]
+			return &params, nil
+		}
+	}
+	return nil, ErrMarketParamsNotFound
+}
+
+func (s memoryMarketStore) ListItemParams() ([]MarketParams, error) {
+	var list []MarketParams
+	for _, params := range s.state.params {
+		if params.ItemCode != "" {
+			list = append(list, params)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].ItemCode < list[j].ItemCode
+	})
+	return list, nil
+}
+
+func (s memoryMarketStore) CreateParams(params *MarketParams) error {
+	currentTime := timeservice.SyncNow()
+	params.ID = len(s.state.params) + 1
+	params.CreatedAt, params.UpdatedAt = currentTime, currentTime
+	s.state.params = append(s.state.params, *params)
+	return nil
+}
+
+func (s memoryMarketStore) UpdateParams(params *MarketParams) error {
+	for i := range s.state.params {
+		if s.state.params[i].ID == params.ID {
+			params.ItemCode = s.state.params[i].ItemCode
+			params.CreatedAt = s.state.params[i].CreatedAt
+			params.UpdatedAt = timeservice.SyncNow()
+			s.state.params[i] = *params
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s memoryMarketStore) GetItem(code string) (*MarketItem, error) {
+	item, exists := s.state.items[code]
+	if !exists {
+		return nil, ErrMarketItemNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (s memoryMarketStore) CreateItem(item *MarketItem) error {
+	currentTime := timeservice.SyncNow()
+	s.state.nextItem++
+	item.ID = s.state.nextItem
+	item.CreatedAt, item.UpdatedAt = currentTime, currentTime
+	copied := *item
+	s.state.items[item.Name] = &copied
+	return nil
+}
+
+func (s memoryMarketStore) UpdateItem(item *MarketItem) error {
+	for _, stored := range s.state.items {
+		if stored.ID == item.ID {
+			stored.Price = item.Price
+			stored.Stock = item.Stock
+			stored.UpdatedAt = timeservice.SyncNow()
+			item.UpdatedAt = stored.UpdatedAt
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s memoryMarketStore) ListCatalogItems() ([]Item, error) {
+	items := make([]Item, 0, len(s.state.catalog))
+	for _, item := range s.state.catalog {
+		items = append(items, copyCatalogItem(item))
+	}
+	return items, nil
+}
+
+func (s memoryMarketStore) GetCatalogItem(code string) (*Item, error) {
+	for _, item := range s.state.catalog {
+		if item.Code == code {
+			copied := copyCatalogItem(item)
+			return &copied, nil
+		}
+	}
+	return nil, ErrItemNotFound
+}
+
+func (s memoryMarketStore) CreateCatalogItem(item *Item) error {
+	currentTime := timeservice.SyncNow()
+	item.ID = len(s.state.catalog) + 1
+	item.CreatedAt, item.UpdatedAt = currentTime, currentTime
+	s.state.catalog = append(s.state.catalog, copyCatalogItem(*item))
+	return nil
+}
+
+// 内存背包存储
+type memoryInventoryStore struct {
+	state *memoryState
+}
+
+func (s memoryInventoryStore) GetBackpack(userID int) (*Backpack, error) {
+	backpack := &Backpack{UserID: userID, Items: make(map[string]int)}
+	for code, quantity := range s.state.inventory[userID] {
+		if quantity != 0 {
+			backpack.Items[code] = quantity
+		}
+	}
+	return backpack, nil
+}
+
+func (s memoryInventoryStore) GetQuantity(userID int, code string) (int, error) {
+	return s.state.inventory[userID][code], nil
+}
+
+func (s memoryInventoryStore) AddItems(userID int, code string, quantity int) error {
+	items, exists := s.state.inventory[userID]
+	if !exists {
+		items = make(map[string]int)
+		s.state.inventory[userID] = items
+	}
+	items[code] += quantity
+	return nil
+}
+
+func (s memoryInventoryStore) CreateCraftingJob(job *CraftingJob) error {
+	job.ID = len(s.state.jobs) + 1
+	s.state.jobs = append(s.state.jobs, copyCraftingJob(*job))
+	return nil
+}
+
+func (s memoryInventoryStore) ListCraftingJobs(userID int) ([]CraftingJob, error) {
+	var jobs []CraftingJob
+	for _, job := range s.state.jobs {
+		if job.UserID == userID && job.Status == CraftingJobPending {
+			jobs = append(jobs, copyCraftingJob(job))
+		}
+	}
+	// 与数据库实现一致：按完成时间升序，时间相同时按ID升序
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CompletesAt.Before(jobs[j].CompletesAt)
+	})
+	return jobs, nil
+}
+
+func (s memoryInventoryStore) CompleteCraftingJob(jobID int, completedAt time.Time) error {
+	for i := range s.state.jobs {
+		if s.state.jobs[i].ID == jobID {
+			s.state.jobs[i].Status = CraftingJobCompleted
+			s.state.jobs[i].CompletedAt = &completedAt
+			return nil
+		}
+	}
+	return nil
+}
+
+// 内存拍卖存储
+type memoryAuctionStore struct {
+	state *memoryState
+}
+
+func (s memoryAuctionStore) CreateAuction(auction *Auction) error {
+	currentTime := timeservice.SyncNow()
+	auction.ID = len(s.state.auctions) + 1
+	auction.CreatedAt = sql.NullTime{Time: currentTime, Valid: true}
+	auction.UpdatedAt = auction.CreatedAt
+	s.state.auctions[auction.ID] = copyAuction(auction)
+	return nil
+}
+
+func (s memoryAuctionStore) GetAuction(auctionID int) (*Auction, error) {
+	auction, exists := s.state.auctions[auctionID]
+	if !exists {
+		return nil, ErrAuctionNotFound
+	}
+	return copyAuction(auction), nil
+}
+
+func (s memoryAuctionStore) ListAuctions(filter AuctionFilter) ([]Auction, error) {
+	var auctions []Auction
+	for _, auction := range s.state.auctions {
+		if filter.SellerID > 0 && auction.SellerID != filter.SellerID {
+			continue
+		}
+		if len(filter.Statuses) > 0 && !containsStatus(filter.Statuses, auction.Status) {
+			continue
+		}
+		auctions = append(auctions, *copyAuction(auction))
+	}
+	// 与数据库实现一致：按创建时间倒序，时间相同时按ID倒序
+	sort.Slice(auctions, func(i, j int) bool {
+		if !auctions[i].CreatedAt.Time.Equal(auctions[j].CreatedAt.Time) {
+			return auctions[i].CreatedAt.Time.After(auctions[j].CreatedAt.Time)
+		}
+		return auctions[i].ID > auctions[j].ID
+	})
+	return auctions, nil
+}
+
+func containsStatus(statuses []AuctionStatus, status AuctionStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (s memoryAuctionStore) UpdateAuction(auction *Auction) error {
+	stored, exists := s.state.auctions[auction.ID]
+	if !exists {
+		return nil
+	}
+	auction.UpdatedAt = sql.NullTime{Time: timeservice.SyncNow(), Valid: true}
+	updated := copyAuction(auction)
+	// 与数据库实现一致，只保存可变字段
+	stored.CurrentPrice = updated.CurrentPrice
+	stored.RemainingQuantity = updated.RemainingQuantity
+	stored.StartTime = updated.StartTime
+	stored.EndTime = updated.EndTime
+	stored.ScheduledStart = updated.ScheduledStart
+	stored.ScheduledEnd = updated.ScheduledEnd
+	stored.PausedAt = updated.PausedAt
+	stored.PausedDuration = updated.PausedDuration
+	stored.Status = updated.Status
+	stored.WinnerID = updated.WinnerID
+	stored.UpdatedAt = updated.UpdatedAt
+	return nil
+}
+
+func (s memoryAuctionStore) UpdateAuctionPrice(auctionID int, price money.Money) error {
+	if stored, exists := s.state.auctions[auctionID]; exists {
+		stored.CurrentPrice = price
+		stored.UpdatedAt = sql.NullTime{Time: timeservice.SyncNow(), Valid: true}
+	}
+	return nil
+}
+
+func (s memoryAuctionStore) CreateBid(bid *AuctionBid) error {
+	bid.ID = len(s.state.bids) + 1
+	if !bid.CreatedAt.Valid {
+		bid.CreatedAt = sql.NullTime{Time: timeservice.SyncNow(), Valid: true}
+	}
+	s.state.bids = append(s.state.bids, *bid)
+	return nil
+}
+
+func (s memoryAuctionStore) UpdateBidStatus(bidID int, status string) error {
+	if bidID > 0 && bidID <= len(s.state.bids) {
+		s.state.bids[bidID-1].Status = status
+	}
+	return nil
+}
+
+func (s memoryAuctionStore) GetBid(bidID int) (*AuctionBid, error) {
+	if bidID <= 0 || bidID > len(s.state.bids) {
+		return nil, ErrAuctionBidNotFound
+	}
+	bid := s.state.bids[bidID-1]
+	return &bid, nil
+}
+
+func (s memoryAuctionStore) ListBids(auctionID int) ([]AuctionBid, error) {
+	var bids []AuctionBid
+	for _, bid := range s.state.bids {
+		if bid.AuctionID == auctionID {
+			bids = append(bids, bid)
+		}
+	}
+	return bids, nil
+}
+
+func (s memoryAuctionStore) CreateEvent(event *AuctionEvent) error {
+	event.ID = len(s.state.events) + 1
+	s.state.events = append(s.state.events, *event)
+	return nil
+}
+
+func (s memoryAuctionStore) ListEvents(auctionID int) ([]AuctionEvent, error) {
+	var auctionEvents []AuctionEvent
+	for _, event := range s.state.events {
+		if event.AuctionID == auctionID {
+			auctionEvents = append(auctionEvents, event)
+		}
+	}
+	return auctionEvents, nil
+}
+
+// 内存订单簿存储
+type memoryOrderStore struct {
+	state *memoryState
+}
+
+func (s memoryOrderStore) CreateOrder(order *Order) error {
+	currentTime := timeservice.SyncNow()
+	order.ID = len(s.state.orders) + 1
+	order.CreatedAt, order.UpdatedAt = currentTime, currentTime
+	s.state.orders = append(s.state.orders, *order)
+	return nil
+}
+
+func (s memoryOrderStore) GetOrder(orderID int) (*Order, error) {
+	if orderID <= 0 || orderID > len(s.state.orders) {
+		return nil, ErrOrderNotFound
+	}
+	order := s.state.orders[orderID-1]
+	return &order, nil
+}
+
+func (s memoryOrderStore) UpdateOrder(order *Order) error {
+	if order.ID <= 0 || order.ID > len(s.state.orders) {
+		return ErrOrderNotFound
+	}
+	order.UpdatedAt = timeservice.SyncNow()
+	stored := &s.state.orders[order.ID-1]
+	stored.Remaining, stored.Status, stored.UpdatedAt = order.Remaining, order.Status, order.UpdatedAt
+	return nil
+}
+
+func (s memoryOrderStore) ListOpenOrders(code string, side string) ([]Order, error) {
+	var orders []Order
+	for _, order := range s.state.orders {
+		if order.ItemCode == code && order.Side == side && order.Status == OrderStatusOpen {
+			orders = append(orders, order)
+		}
+	}
+	// 与数据库实现一致：价格优先，同价格按ID（下单先后）升序
+	sort.SliceStable(orders, func(i, j int) bool {
+		if side == OrderSideBuy {
+			return orders[i].Price.GreaterThan(orders[j].Price)
+		}
+		return orders[i].Price.LessThan(orders[j].Price)
+	})
+	return orders, nil
+}
+
+func (s memoryOrderStore) ListUserOrders(userID int) ([]Order, error) {
+	var orders []Order
+	for i := len(s.state.orders) - 1; i >= 0; i-- {
+		if order := s.state.orders[i]; order.UserID == userID && order.Status == OrderStatusOpen {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (s memoryOrderStore) CreateTrade(trade *Trade) error {
+	trade.ID = len(s.state.trades) + 1
+	trade.CreatedAt = timeservice.SyncNow()
+	s.state.trades = append(s.state.trades, *trade)
+	return nil
+}
+
+func (s memoryOrderStore) ListTrades(code string, limit int) ([]Trade, error) {
+	var trades []Trade
+	for i := len(s.state.trades) - 1; i >= 0 && len(trades) < limit; i-- {
+		if s.state.trades[i].ItemCode == code {
+			trades = append(trades, s.state.trades[i])
+		}
+	}
+	return trades, nil
+}
+
+// 内存发件箱存储
+type memoryOutboxStore struct {
+	state *memoryState
+}
+
+// 内存发件箱中的一条通知，deliveredAt 为零值表示未投递
+type memoryOutboxEntry struct {
+	message     OutboxMessage
+	deliveredAt time.Time
+}
+
+func (s memoryOutboxStore) Append(message *OutboxMessage) error {
+	s.state.nextSeq++
+	message.Seq = s.state.nextSeq
+	message.CreatedAt = timeservice.SyncNow()
+	s.state.outbox = append(s.state.outbox, memoryOutboxEntry{message: *message})
+	return nil
+}
+
+func (s memoryOutboxStore) ListPending(limit int) ([]OutboxMessage, error) {
+	var pending []OutboxMessage
+	for _, entry := range s.state.outbox {
+		if len(pending) == limit {
+			break
+		}
+		if entry.deliveredAt.IsZero() {
+			pending = append(pending, entry.message)
+		}
+	}
+	return pending, nil
+}
+
+func (s memoryOutboxStore) ListFrom(seq int64, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	for _, entry := range s.state.outbox {
+		if len(messages) == limit {
+			break
+		}
+		if entry.message.Seq >= seq {
+			messages = append(messages, entry.message)
+		}
+	}
+	return messages, nil
+}
+
+func (s memoryOutboxStore) MarkDelivered(seq int64) error {
+	now := timeservice.SyncNow()
+	for i := range s.state.outbox {
+		if entry := &s.state.outbox[i]; entry.message.Seq <= seq && entry.deliveredAt.IsZero() {
+			entry.deliveredAt = now
+		}
+	}
+	return nil
+}
+
+func (s memoryOutboxStore) PruneDelivered(before time.Time) error {
+	var kept []memoryOutboxEntry
+	for _, entry := range s.state.outbox {
+		if entry.deliveredAt.IsZero() || !entry.deliveredAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	s.state.outbox = kept
+	return nil
+}
+
+// MemoryStorage 内存存储后端，不需要数据库文件，用于测试和单机演示。
+// 事务开始时复制全部数据，提交时替换；同一时间只有一个事务，其余事务在 Begin 处等待
+type MemoryStorage struct {
+	mutex sync.Mutex
+	state *memoryState
+}
+
+// NewMemoryStorage 创建内存存储后端，并按配置初始化物品目录、系统账户、市场参数和市场物品
+func NewMemoryStorage() *MemoryStorage {
+	state := &memoryState{
+		ledger:    cash.NewMemoryLedger(),
+		items:     make(map[string]*MarketItem),
+		inventory: make(map[int]map[string]int),
+		auctions:  make(map[int]*Auction),
+	}
+	// 内存存储不会出错
+	seedCatalog(memoryMarketStore{state: state})
+	seedMarket(memoryMarketStore{state: state})
+	return &MemoryStorage{state: state}
+}
+
+// InitUser 为玩家开立现金账户（已存在则跳过），背包在玩家第一次获得物品时建立
+func (s *MemoryStorage) InitUser(userID int) error {
+	tx, err := s.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = cash.EnsureUserAccount(tx.Ledger(), userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MemoryStorage) Begin() (Tx, error) {
+	s.mutex.Lock()
+	return &memoryTx{storage: s, state: s.state.clone()}, nil
+}
+
+// 内存事务
+type memoryTx struct {
+	storage *MemoryStorage
+	state   *memoryState
+	done    bool
+}
+
+func (t *memoryTx) Ledger() cash.LedgerStore  { return t.state.ledger }
+func (t *memoryTx) Market() MarketStore       { return memoryMarketStore{state: t.state} }
+func (t *memoryTx) Inventory() InventoryStore { return memoryInventoryStore{state: t.state} }
+func (t *memoryTx) Auctions() AuctionStore    { return memoryAuctionStore{state: t.state} }
+func (t *memoryTx) Orders() OrderStore        { return memoryOrderStore{state: t.state} }
+
+func (t *memoryTx) Outbox() OutboxStore { return memoryOutboxStore{state: t.state} }
+
+func (t *memoryTx) Commit() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.storage.state = t.state
+	t.storage.mutex.Unlock()
+	return nil
+}
+
+func (t *memoryTx) Rollback() error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	t.storage.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,804 @@
+package market
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/money"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 行扫描接口，*sql.Row 和 *sql.Rows 均实现
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// 基于 turso/sqlite 的市场存储
+type sqlMarketStore struct {
+	q cash.Querier
+}
+
+func newSQLMarketStore(q cash.Querier) *sqlMarketStore {
+	return &sqlMarketStore{q: q}
+}
+
+// 市场参数查询列
+const paramsColumns = "id, item_code, price_model, balance_range, price_fluctuation, max_price_change, liquidity, smoothing, min_price_ratio, max_price_ratio, created_at, updated_at"
+
+// 扫描市场参数
+func scanParams(scanner rowScanner) (*MarketParams, error) {
+	var params MarketParams
+	err := scanner.Scan(&params.ID, &params.ItemCode, &params.PriceModel, &params.BalanceRange, &params.PriceFluctuation,
+		&params.MaxPriceChange, &params.Liquidity, &params.Smoothing, &params.MinPriceRatio, &params.MaxPriceRatio,
+		&params.CreatedAt, &params.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMarketParamsNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+func (s *sqlMarketStore) GetParams() (*MarketParams, error) {
+	return scanParams(s.q.QueryRow("SELECT " + paramsColumns + " FROM market_params WHERE item_code = '' ORDER BY id DESC LIMIT 1"))
+}
+
+func (s *sqlMarketStore) GetItemParams(code string) (*MarketParams, error) {
+	return scanParams(s.q.QueryRow("SELECT "+paramsColumns+" FROM market_params WHERE item_code = ? ORDER BY id DESC LIMIT 1", code))
+}
+
+func (s *sqlMarketStore) ListItemParams() ([]MarketParams, error) {
+	rows, err := s.q.Query("SELECT " + paramsColumns + " FROM market_params WHERE item_code <> '' ORDER BY item_code, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []MarketParams
+	for rows.Next() {
+		params, err := scanParams(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *params)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlMarketStore) CreateParams(params *MarketParams) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec(`
+		INSERT INTO market_params (item_code, price_model, balance_range, price_fluctuation, max_price_change, liquidity, smoothing,
+			min_price_ratio, max_price_ratio, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		params.ItemCode, params.PriceModel, params.BalanceRange, params.PriceFluctuation, params.MaxPriceChange,
+		params.Liquidity, params.Smoothing, params.MinPriceRatio, params.MaxPriceRatio, currentTime, currentTime)
+	if err != nil {
+		return err
+	}
+	paramsID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	params.ID = int(paramsID)
+	params.CreatedAt, params.UpdatedAt = currentTime, currentTime
+	return nil
+}
+
+func (s *sqlMarketStore) UpdateParams(params *MarketParams) error {
+	currentTime := timeservice.SyncNow()
+	_, err := s.q.Exec(`
+		UPDATE market_params SET price_model = ?, balance_range = ?, price_fluctuation = ?, max_price_change = ?, liquidity = ?, smoothing = ?,
+			min_price_ratio = ?, max_price_ratio = ?, updated_at = ?
+		WHERE id = ?`,
+		params.PriceModel, params.BalanceRange, params.PriceFluctuation, params.MaxPriceChange, params.Liquidity, params.Smoothing,
+		params.MinPriceRatio, params.MaxPriceRatio, currentTime, params.ID)
+	if err != nil {
+		return err
+	}
+	params.UpdatedAt = currentTime
+	return nil
+}
+
+func (s *sqlMarketStore) GetItem(code string) (*MarketItem, error) {
+	var item MarketItem
+	err := s.q.QueryRow("SELECT id, name, price, stock, base_price, created_at, updated_at FROM market_items WHERE name = ?", code).Scan(
+		&item.ID, &item.Name, &item.Price, &item.Stock, &item.BasePrice, &item.CreatedAt, &item.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMarketItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *sqlMarketStore) CreateItem(item *MarketItem) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec("INSERT INTO market_items (name, price, stock, base_price, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		item.Name, item.Price, item.Stock, item.BasePrice, currentTime, currentTime)
+	if err != nil {
+		return err
+	}
+	itemID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.ID = int(itemID)
+	item.CreatedAt, item.UpdatedAt = currentTime, currentTime
+	return nil
+}
+
+func (s *sqlMarketStore) UpdateItem(item *MarketItem) error {
+	currentTime := timeservice.SyncNow()
+	_, err := s.q.Exec("UPDATE market_items SET price = ?, stock = ?, updated_at = ? WHERE id = ?",
+		item.Price, item.Stock, currentTime, item.ID)
+	if err != nil {
+		return err
+	}
+	item.UpdatedAt = currentTime
+	return nil
+}
+
+const catalogColumns = "id, code, names, base_price, recipe, created_at, updated_at"
+
+// 扫描物品目录中的一行，名称和配方以 JSON 保存
+func scanCatalogItem(row rowScanner) (*Item, error) {
+	var item Item
+	var names, recipe string
+	err := row.Scan(&item.ID, &item.Code, &names, &item.BasePrice, &recipe, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal([]byte(names), &item.Names); err != nil {
+		return nil, fmt.Errorf("解析物品 %s 的名称失败: %v", item.Code, err)
+	}
+	if recipe != "" {
+		if err = json.Unmarshal([]byte(recipe), &item.Recipe); err != nil {
+			return nil, fmt.Errorf("解析物品 %s 的配方失败: %v", item.Code, err)
+		}
+	}
+	return &item, nil
+}
+
+func (s *sqlMarketStore) ListCatalogItems() ([]Item, error) {
+	rows, err := s.q.Query("SELECT " + catalogColumns + " FROM items ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []Item
+	for rows.Next() {
+		item, err := scanCatalogItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *item)
+	}
+	return items, rows.Err()
+}
+
+func (s *sqlMarketStore) GetCatalogItem(code string) (*Item, error) {
+	item, err := scanCatalogItem(s.q.QueryRow("SELECT "+catalogColumns+" FROM items WHERE code = ?", code))
+	if err == sql.ErrNoRows {
+		return nil, ErrItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *sqlMarketStore) CreateCatalogItem(item *Item) error {
+	names, err := json.Marshal(item.Names)
+	if err != nil {
+		return err
+	}
+	var recipe []byte
+	if item.Recipe != nil {
+		if recipe, err = json.Marshal(item.Recipe); err != nil {
+			return err
+		}
+	}
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec("INSERT INTO items (code, names, base_price, recipe, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		item.Code, string(names), item.BasePrice, string(recipe), currentTime, currentTime)
+	if err != nil {
+		return err
+	}
+	itemID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.ID = int(itemID)
+	item.CreatedAt, item.UpdatedAt = currentTime, currentTime
+	return nil
+}
+
+// 基于 turso/sqlite 的背包存储，每个玩家每种物品一行
+type sqlInventoryStore struct {
+	q cash.Querier
+}
+
+func newSQLInventoryStore(q cash.Querier) *sqlInventoryStore {
+	return &sqlInventoryStore{q: q}
+}
+
+func (s *sqlInventoryStore) GetBackpack(userID int) (*Backpack, error) {
+	rows, err := s.q.Query("SELECT item_code, quantity FROM inventory WHERE user_id = ? AND quantity <> 0", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backpack := &Backpack{UserID: userID, Items: make(map[string]int)}
+	for rows.Next() {
+		var code string
+		var quantity int
+		if err = rows.Scan(&code, &quantity); err != nil {
+			return nil, err
+		}
+		backpack.Items[code] = quantity
+	}
+	return backpack, rows.Err()
+}
+
+func (s *sqlInventoryStore) GetQuantity(userID int, code string) (int, error) {
+	var quantity int
+	err := s.q.QueryRow("SELECT quantity FROM inventory WHERE user_id = ? AND item_code = ?", userID, code).Scan(&quantity)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return quantity, err
+}
+
+func (s *sqlInventoryStore) AddItems(userID int, code string, quantity int) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec("UPDATE inventory SET quantity = quantity + ?, updated_at = ? WHERE user_id = ? AND item_code = ?",
+		quantity, currentTime, userID, code)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected > 0 {
+		return err
+	}
+	_, err = s.q.Exec("INSERT INTO inventory (user_id, item_code, quantity, updated_at) VALUES (?, ?, ?, ?)",
+		userID, code, quantity, currentTime)
+	return err
+}
+
+func (s *sqlInventoryStore) CreateCraftingJob(job *CraftingJob) error {
+	result, err := s.q.Exec("INSERT INTO crafting_jobs (user_id, item_code, quantity, status, started_at, completes_at) VALUES (?, ?, ?, ?, ?, ?)",
+		job.UserID, job.ItemCode, job.Quantity, job.Status, job.StartedAt, job.CompletesAt)
+	if err != nil {
+		return err
+	}
+	jobID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = int(jobID)
+	return nil
+}
+
+func (s *sqlInventoryStore) ListCraftingJobs(userID int) ([]CraftingJob, error) {
+	rows, err := s.q.Query("SELECT id, user_id, item_code, quantity, status, started_at, completes_at FROM crafting_jobs WHERE user_id = ? AND status = ? ORDER BY completes_at, id",
+		userID, CraftingJobPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []CraftingJob
+	for rows.Next() {
+		var job CraftingJob
+		if err = rows.Scan(&job.ID, &job.UserID, &job.ItemCode, &job.Quantity, &job.Status, &job.StartedAt, &job.CompletesAt); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *sqlInventoryStore) CompleteCraftingJob(jobID int, completedAt time.Time) error {
+	_, err := s.q.Exec("UPDATE crafting_jobs SET status = ?, completed_at = ? WHERE id = ?", CraftingJobCompleted, completedAt, jobID)
+	return err
+}
+
+// 基于 turso/sqlite 的拍卖存储
+type sqlAuctionStore struct {
+	q cash.Querier
+}
+
+func newSQLAuctionStore(q cash.Querier) *sqlAuctionStore {
+	return &sqlAuctionStore{q: q}
+}
+
+// 拍卖查询列
+const auctionColumns = `id, auction_type, item_type, initial_price, current_price, min_price, reserve_price, price_decrement,
+	decrement_interval, decay_curve, decay_rate, decay_steps, min_increment, duration, extension_seconds, quantity, remaining_quantity, start_time, end_time,
+	scheduled_start, scheduled_end, paused_at, paused_duration, status, winner_id, seller_id, created_at, updated_at`
+
+// 钟面时刻（开始时间、暂停时刻）保存为 RFC3339Nano 文本。驱动默认按秒写入时间，
+// 暂停恢复后钟面会偏离冻结时的价格；已有的按秒保存的值仍能正常读取
+func clockTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// 扫描拍卖
+func scanAuction(scanner rowScanner) (*Auction, error) {
+	var auction Auction
+	var startTime, endTime, scheduledStart, scheduledEnd, pausedAt sql.NullTime
+	var status, decaySteps string
+	err := scanner.Scan(
+		&auction.ID, &auction.AuctionType, &auction.ItemType, &auction.InitialPrice, &auction.CurrentPrice,
+		&auction.MinPrice, &auction.ReservePrice, &auction.PriceDecrement, &auction.DecrementInterval,
+		&auction.DecayCurve, &auction.DecayRate, &decaySteps,
+		&auction.MinIncrement, &auction.Duration, &auction.ExtensionSeconds, &auction.Quantity, &auction.RemainingQuantity,
+		&startTime, &endTime, &scheduledStart, &scheduledEnd, &pausedAt, &auction.PausedDuration, &status,
+		&auction.WinnerID, &auction.SellerID, &auction.CreatedAt, &auction.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuctionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	auction.Status = AuctionStatus(status)
+	if decaySteps != "" {
+		if err = json.Unmarshal([]byte(decaySteps), &auction.DecaySteps); err != nil {
+			return nil, fmt.Errorf("解析阶梯曲线失败: %v", err)
+		}
+	}
+
+	// 处理可能为NULL的时间字段
+	if startTime.Valid {
+		auction.StartTime = &startTime.Time
+	}
+	if endTime.Valid {
+		auction.EndTime = &endTime.Time
+	}
+	if scheduledStart.Valid {
+		auction.ScheduledStart = &scheduledStart.Time
+	}
+	if scheduledEnd.Valid {
+		auction.ScheduledEnd = &scheduledEnd.Time
+	}
+	if pausedAt.Valid {
+		auction.PausedAt = &pausedAt.Time
+	}
+	return &auction, nil
+}
+
+func (s *sqlAuctionStore) CreateAuction(auction *Auction) error {
+	var decaySteps []byte
+	if len(auction.DecaySteps) > 0 {
+		var err error
+		if decaySteps, err = json.Marshal(auction.DecaySteps); err != nil {
+			return err
+		}
+	}
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec(`
+		INSERT INTO auctions
+		(auction_type, item_type, initial_price, current_price, min_price, reserve_price, price_decrement, decrement_interval,
+		decay_curve, decay_rate, decay_steps, min_increment, duration, extension_seconds, quantity, remaining_quantity, start_time, end_time, scheduled_start, scheduled_end,
+		status, seller_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		auction.AuctionType, auction.ItemType, auction.InitialPrice, auction.CurrentPrice, auction.MinPrice, auction.ReservePrice,
+		auction.PriceDecrement, auction.DecrementInterval, auction.DecayCurve, auction.DecayRate, string(decaySteps), auction.MinIncrement, auction.Duration, auction.ExtensionSeconds, auction.Quantity, auction.RemainingQuantity,
+		clockTime(auction.StartTime), auction.EndTime, auction.ScheduledStart, auction.ScheduledEnd, string(auction.Status), auction.SellerID, currentTime, currentTime)
+	if err != nil {
+		return err
+	}
+	auctionID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	auction.ID = int(auctionID)
+	auction.CreatedAt = sql.NullTime{Time: currentTime, Valid: true}
+	auction.UpdatedAt = auction.CreatedAt
+	return nil
+}
+
+func (s *sqlAuctionStore) GetAuction(auctionID int) (*Auction, error) {
+	return scanAuction(s.q.QueryRow("SELECT "+auctionColumns+" FROM auctions WHERE id = ?", auctionID))
+}
+
+func (s *sqlAuctionStore) ListAuctions(filter AuctionFilter) ([]Auction, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.SellerID > 0 {
+		conditions = append(conditions, "seller_id = ?")
+		args = append(args, filter.SellerID)
+	}
+	if len(filter.Statuses) > 0 {
+		conditions = append(conditions, "status IN (?"+strings.Repeat(", ?", len(filter.Statuses)-1)+")")
+		for _, status := range filter.Statuses {
+			args = append(args, string(status))
+		}
+	}
+	query := "SELECT " + auctionColumns + " FROM auctions"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auctions []Auction
+	for rows.Next() {
+		auction, err := scanAuction(rows)
+		if err != nil {
+			return nil, err
+		}
+		auctions = append(auctions, *auction)
+	}
+	return auctions, rows.Err()
+}
+
+func (s *sqlAuctionStore) UpdateAuction(auction *Auction) error {
+	currentTime := timeservice.SyncNow()
+	_, err := s.q.Exec(`
+		UPDATE auctions
+		SET current_price = ?, remaining_quantity = ?, start_time = ?, end_time = ?, scheduled_start = ?, scheduled_end = ?,
+			paused_at = ?, paused_duration = ?, status = ?, winner_id = ?, updated_at = ?
+		WHERE id = ?`,
+		auction.CurrentPrice, auction.RemainingQuantity, clockTime(auction.StartTime), auction.EndTime, auction.ScheduledStart, auction.ScheduledEnd,
+		clockTime(auction.PausedAt), auction.PausedDuration, string(auction.Status), auction.WinnerID, currentTime, auction.ID)
+	if err != nil {
+		return err
+	}
+	auction.UpdatedAt = sql.NullTime{Time: currentTime, Valid: true}
+	return nil
+}
+
+func (s *sqlAuctionStore) UpdateAuctionPrice(auctionID int, price money.Money) error {
+	_, err := s.q.Exec("UPDATE auctions SET current_price = ?, updated_at = ? WHERE id = ?",
+		price, timeservice.SyncNow(), auctionID)
+	return err
+}
+
+func (s *sqlAuctionStore) CreateBid(bid *AuctionBid) error {
+	// 调用方给出到达时间时按到达时间记录
+	currentTime := timeservice.SyncNow()
+	if bid.CreatedAt.Valid {
+		currentTime = bid.CreatedAt.Time
+	}
+	result, err := s.q.Exec(`
+		INSERT INTO auction_bids (auction_id, user_id, price, quantity, requested_quantity, status, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		bid.AuctionID, bid.UserID, bid.Price, bid.Quantity, bid.RequestedQuantity, bid.Status, bid.Reason, currentTime)
+	if err != nil {
+		return err
+	}
+	bidID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	bid.ID = int(bidID)
+	bid.CreatedAt = sql.NullTime{Time: currentTime, Valid: true}
+	return nil
+}
+
+func (s *sqlAuctionStore) UpdateBidStatus(bidID int, status string) error {
+	_, err := s.q.Exec("UPDATE auction_bids SET status = ? WHERE id = ?", status, bidID)
+	return err
+}
+
+// 竞价记录查询列
+const bidColumns = "id, auction_id, user_id, price, quantity, requested_quantity, status, reason, created_at"
+
+// 扫描竞价记录
+func scanBid(scanner rowScanner) (*AuctionBid, error) {
+	var bid AuctionBid
+	err := scanner.Scan(&bid.ID, &bid.AuctionID, &bid.UserID, &bid.Price, &bid.Quantity, &bid.RequestedQuantity, &bid.Status, &bid.Reason, &bid.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuctionBidNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bid, nil
+}
+
+func (s *sqlAuctionStore) GetBid(bidID int) (*AuctionBid, error) {
+	return scanBid(s.q.QueryRow("SELECT "+bidColumns+" FROM auction_bids WHERE id = ?", bidID))
+}
+
+func (s *sqlAuctionStore) ListBids(auctionID int) ([]AuctionBid, error) {
+	rows, err := s.q.Query("SELECT "+bidColumns+" FROM auction_bids WHERE auction_id = ? ORDER BY id", auctionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bids []AuctionBid
+	for rows.Next() {
+		bid, err := scanBid(rows)
+		if err != nil {
+			return nil, err
+		}
+		bids = append(bids, *bid)
+	}
+	return bids, rows.Err()
+}
+
+func (s *sqlAuctionStore) CreateEvent(event *AuctionEvent) error {
+	result, err := s.q.Exec(`
+		INSERT INTO auction_events (auction_id, actor, from_status, to_status, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		event.AuctionID, event.Actor, string(event.FromStatus), string(event.ToStatus), event.Reason, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+	eventID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = int(eventID)
+	return nil
+}
+
+func (s *sqlAuctionStore) ListEvents(auctionID int) ([]AuctionEvent, error) {
+	rows, err := s.q.Query(`
+		SELECT id, auction_id, actor, from_status, to_status, reason, created_at
+		FROM auction_events WHERE auction_id = ? ORDER BY id`, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auctionEvents []AuctionEvent
+	for rows.Next() {
+		var event AuctionEvent
+		var from, to string
+		if err := rows.Scan(&event.ID, &event.AuctionID, &event.Actor, &from, &to, &event.Reason, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.FromStatus, event.ToStatus = AuctionStatus(from), AuctionStatus(to)
+		auctionEvents = append(auctionEvents, event)
+	}
+	return auctionEvents, rows.Err()
+}
+
+// 基于 turso/sqlite 的订单簿存储
+type sqlOrderStore struct {
+	q cash.Querier
+}
+
+func newSQLOrderStore(q cash.Querier) *sqlOrderStore {
+	return &sqlOrderStore{q: q}
+}
+
+// 订单查询列
+const orderColumns = "id, user_id, item_code, side, type, price, quantity, remaining, status, created_at, updated_at"
+
+// 扫描订单
+func scanOrder(scanner rowScanner) (*Order, error) {
+	var order Order
+	err := scanner.Scan(&order.ID, &order.UserID, &order.ItemCode, &order.Side, &order.Type, &order.Price,
+		&order.Quantity, &order.Remaining, &order.Status, &order.CreatedAt, &order.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// 查询订单列表
+func (s *sqlOrderStore) queryOrders(query string, args ...interface{}) ([]Order, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+	return orders, rows.Err()
+}
+
+func (s *sqlOrderStore) CreateOrder(order *Order) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec(`
+		INSERT INTO orders (user_id, item_code, side, type, price, quantity, remaining, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.UserID, order.ItemCode, order.Side, order.Type, order.Price, order.Quantity, order.Remaining, order.Status,
+		currentTime, currentTime)
+	if err != nil {
+		return err
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	order.ID = int(orderID)
+	order.CreatedAt, order.UpdatedAt = currentTime, currentTime
+	return nil
+}
+
+func (s *sqlOrderStore) GetOrder(orderID int) (*Order, error) {
+	return scanOrder(s.q.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = ?", orderID))
+}
+
+func (s *sqlOrderStore) UpdateOrder(order *Order) error {
+	currentTime := timeservice.SyncNow()
+	_, err := s.q.Exec("UPDATE orders SET remaining = ?, status = ?, updated_at = ? WHERE id = ?",
+		order.Remaining, order.Status, currentTime, order.ID)
+	if err != nil {
+		return err
+	}
+	order.UpdatedAt = currentTime
+	return nil
+}
+
+func (s *sqlOrderStore) ListOpenOrders(code string, side string) ([]Order, error) {
+	priceOrder := "price ASC"
+	if side == OrderSideBuy {
+		priceOrder = "price DESC"
+	}
+	return s.queryOrders("SELECT "+orderColumns+" FROM orders WHERE item_code = ? AND side = ? AND status = ? ORDER BY "+priceOrder+", created_at, id",
+		code, side, OrderStatusOpen)
+}
+
+func (s *sqlOrderStore) ListUserOrders(userID int) ([]Order, error) {
+	return s.queryOrders("SELECT "+orderColumns+" FROM orders WHERE user_id = ? AND status = ? ORDER BY id DESC", userID, OrderStatusOpen)
+}
+
+func (s *sqlOrderStore) CreateTrade(trade *Trade) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec(`
+		INSERT INTO trades (item_code, buy_order_id, sell_order_id, buyer_id, seller_id, price, quantity, taker_side, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		trade.ItemCode, trade.BuyOrderID, trade.SellOrderID, trade.BuyerID, trade.SellerID, trade.Price, trade.Quantity,
+		trade.TakerSide, currentTime)
+	if err != nil {
+		return err
+	}
+	tradeID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	trade.ID = int(tradeID)
+	trade.CreatedAt = currentTime
+	return nil
+}
+
+func (s *sqlOrderStore) ListTrades(code string, limit int) ([]Trade, error) {
+	rows, err := s.q.Query(`
+		SELECT id, item_code, buy_order_id, sell_order_id, buyer_id, seller_id, price, quantity, taker_side, created_at
+		FROM trades WHERE item_code = ? ORDER BY id DESC LIMIT ?`, code, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trades []Trade
+	for rows.Next() {
+		var trade Trade
+		if err = rows.Scan(&trade.ID, &trade.ItemCode, &trade.BuyOrderID, &trade.SellOrderID, &trade.BuyerID, &trade.SellerID,
+			&trade.Price, &trade.Quantity, &trade.TakerSide, &trade.CreatedAt); err != nil {
+			return nil, err
+		}
+		trades = append(trades, trade)
+	}
+	return trades, rows.Err()
+}
+
+// 基于 turso/sqlite 的发件箱存储
+type sqlOutboxStore struct {
+	q cash.Querier
+}
+
+func newSQLOutboxStore(q cash.Querier) *sqlOutboxStore {
+	return &sqlOutboxStore{q: q}
+}
+
+func (s *sqlOutboxStore) Append(message *OutboxMessage) error {
+	currentTime := timeservice.SyncNow()
+	result, err := s.q.Exec("INSERT INTO outbox (type, user_id, payload, created_at) VALUES (?, ?, ?, ?)",
+		message.Type, message.UserID, string(message.Payload), currentTime)
+	if err != nil {
+		return err
+	}
+	seq, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	message.Seq = seq
+	message.CreatedAt = currentTime
+	return nil
+}
+
+func (s *sqlOutboxStore) ListPending(limit int) ([]OutboxMessage, error) {
+	return s.list("SELECT seq, type, user_id, payload, created_at FROM outbox WHERE delivered_at IS NULL ORDER BY seq LIMIT ?", limit)
+}
+
+func (s *sqlOutboxStore) ListFrom(seq int64, limit int) ([]OutboxMessage, error) {
+	return s.list("SELECT seq, type, user_id, payload, created_at FROM outbox WHERE seq >= ? ORDER BY seq LIMIT ?", seq, limit)
+}
+
+func (s *sqlOutboxStore) list(query string, args ...interface{}) ([]OutboxMessage, error) {
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var message OutboxMessage
+		var payload string
+		if err = rows.Scan(&message.Seq, &message.Type, &message.UserID, &payload, &message.CreatedAt); err != nil {
+			return nil, err
+		}
+		message.Payload = json.RawMessage(payload)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (s *sqlOutboxStore) MarkDelivered(seq int64) error {
+	_, err := s.q.Exec("UPDATE outbox SET delivered_at = ? WHERE seq <= ? AND delivered_at IS NULL", timeservice.SyncNow(), seq)
+	return err
+}
+
+func (s *sqlOutboxStore) PruneDelivered(before time.Time) error {
+	_, err := s.q.Exec("DELETE FROM outbox WHERE delivered_at IS NOT NULL AND delivered_at < ?", before)
+	return err
+}
+
+// 基于 turso/sqlite 的存储后端
+type sqlStorage struct {
+	db *sql.DB
+}
+
+// NewSQLStorage 创建基于数据库连接的存储后端
+func NewSQLStorage(db *sql.DB) Storage {
+	return &sqlStorage{db: db}
+}
+
+func (s *sqlStorage) Begin() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx}, nil
+}
+
+// 数据库事务
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlTx) Ledger() cash.LedgerStore  { return cash.NewSQLLedgerStore(t.tx) }
+func (t *sqlTx) Market() MarketStore       { return newSQLMarketStore(t.tx) }
+func (t *sqlTx) Inventory() InventoryStore { return newSQLInventoryStore(t.tx) }
+func (t *sqlTx) Auctions() AuctionStore    { return newSQLAuctionStore(t.tx) }
+func (t *sqlTx) Orders() OrderStore        { return newSQLOrderStore(t.tx) }
+func (t *sqlTx) Outbox() OutboxStore       { return newSQLOutboxStore(t.tx) }
+func (t *sqlTx) Commit() error             { return t.tx.Commit() }
+func (t *sqlTx) Rollback() error           { return t.tx.Rollback() }
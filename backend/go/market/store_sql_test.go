@@ -0,0 +1,183 @@
+package market
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"own-1Pixel/backend/go/cash"
+	"own-1Pixel/backend/go/migrate"
+	"own-1Pixel/backend/go/user"
+
+	_ "github.com/tursodatabase/turso-go"
+)
+
+var registerTestMigrations sync.Once
+
+// 在临时目录创建数据库并执行全部迁移
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	registerTestMigrations.Do(func() {
+		migrate.Register(user.Migrations()...)
+		migrate.Register(cash.Migrations()...)
+		migrate.Register(Migrations()...)
+	})
+	db, err := sql.Open("turso", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if _, err = migrate.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 新数据库执行全部迁移后达到最新版本，再次执行不做任何修改
+func TestMigrationsFreshDatabase(t *testing.T) {
+	db := newTestDB(t)
+	statuses, err := migrate.GetStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("迁移 %d %s.%s 没有执行", status.Version, status.Package, status.Name)
+		}
+	}
+	count, err := migrate.Up(db)
+	if err != nil || count != 0 {
+		t.Errorf("再次执行迁移: %d 个, %v，期望没有迁移", count, err)
+	}
+
+	storage := NewSQLStorage(db)
+	for _, code := range []string{cash.AccountExternal, cash.AccountMarket, cash.AccountEscrow, cash.AccountWorkshop, cash.AccountOrderEscrow} {
+		if got := systemBalanceOf(t, storage, code); got != 0 {
+			t.Errorf("系统账户 %s 余额 = %d，期望 0", code, got)
+		}
+	}
+}
+
+// 迁移写入的默认市场参数、物品目录和市场物品与内存存储按默认配置写入的一致
+func TestMigrationsSeedMatchesMemoryStore(t *testing.T) {
+	type seed struct {
+		params  MarketParams
+		catalog []Item
+		items   []MarketItem
+	}
+	load := func(storage Storage) seed {
+		var result seed
+		err := view(storage, func(tx Tx) error {
+			params, err := tx.Market().GetParams()
+			if err != nil {
+				return err
+			}
+			result.params = *params
+			result.params.ID, result.params.CreatedAt, result.params.UpdatedAt = 0, time.Time{}, time.Time{}
+			catalog, err := tx.Market().ListCatalogItems()
+			if err != nil {
+				return err
+			}
+			for _, entry := range catalog {
+				// 迁移只写入了最初的物品，其余物品的市场记录在首次交易时建立
+				item, err := loadMarketItem(tx.Market(), &entry)
+				if err != nil {
+					return err
+				}
+				entry.ID, entry.CreatedAt, entry.UpdatedAt = 0, time.Time{}, time.Time{}
+				result.catalog = append(result.catalog, entry)
+				result.items = append(result.items, MarketItem{Name: item.Name, Price: item.Price, Stock: item.Stock, BasePrice: item.BasePrice})
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	want, got := load(NewMemoryStorage()), load(NewSQLStorage(newTestDB(t)))
+	if !reflect.DeepEqual(got.params, want.params) {
+		t.Errorf("默认市场参数 = %+v，期望 %+v", got.params, want.params)
+	}
+	if !reflect.DeepEqual(got.catalog, want.catalog) {
+		t.Errorf("物品目录 = %+v，期望 %+v", got.catalog, want.catalog)
+	}
+	if !reflect.DeepEqual(got.items, want.items) {
+		t.Errorf("市场物品 = %+v，期望 %+v", got.items, want.items)
+	}
+}
+
+// 同一组买卖、制作和挂单在数据库存储和内存存储上得到相同的结果
+func TestSQLStoreMatchesMemoryStore(t *testing.T) {
+	type snapshot struct {
+		errs     []string         // 每一步的错误，成功为空
+		balances map[string]int64 // 玩家和系统账户余额（分）
+		items    map[string]int   // "玩家ID:物品代码" -> 数量
+		jobs     map[int][]string // 玩家ID -> 制作任务的物品代码和数量
+		market   [2]int64         // 苹果的市场价格（分）和库存
+	}
+	run := func(storage Storage) snapshot {
+		fundTestUsers(t, storage, map[int]int64{1: 10000, 2: 10000})
+		setTestMarket(t, storage, "apple", PriceModelLinear)
+		giveItems(t, storage, 2, "wood", 3)
+
+		ctx := context.Background()
+		market := NewMarketService(storage)
+		orders := NewOrderBookService(storage)
+		var result snapshot
+		steps := []func() error{
+			func() error { _, err := market.Buy(ctx, 1, "apple", 3); return err },
+			func() error { _, err := market.Sell(ctx, 1, "apple", 1); return err },
+			func() error { _, err := market.Buy(ctx, 1, "apple", 100); return err },
+			func() error { _, err := market.Sell(ctx, 2, "apple", 1); return err },
+			func() error { _, err := market.Make(ctx, 2, "plank", 1); return err },
+			func() error { _, err := market.Make(ctx, 2, "plank", 1); return err },
+			func() error { _, err := market.Make(ctx, 1, "apple", 2); return err },
+			func() error {
+				_, _, err := orders.Place(ctx, 1, testOrder{1, OrderSideSell, OrderTypeLimit, 500, 2}.request())
+				return err
+			},
+			func() error {
+				_, _, err := orders.Place(ctx, 2, testOrder{2, OrderSideBuy, OrderTypeLimit, 600, 3}.request())
+				return err
+			},
+		}
+		for _, step := range steps {
+			message := ""
+			if err := step(); err != nil {
+				message = err.Error()
+			}
+			result.errs = append(result.errs, message)
+		}
+
+		result.balances = map[string]int64{"1": balanceOf(t, storage, 1), "2": balanceOf(t, storage, 2)}
+		for _, code := range []string{cash.AccountMarket, cash.AccountWorkshop, cash.AccountOrderEscrow} {
+			result.balances[code] = systemBalanceOf(t, storage, code)
+		}
+		result.items = make(map[string]int)
+		result.jobs = make(map[int][]string)
+		for _, userID := range []int{1, 2} {
+			for _, code := range []string{"apple", "wood", "plank"} {
+				result.items[fmt.Sprintf("%d:%s", userID, code)] = quantityOf(t, storage, userID, code)
+			}
+			for _, job := range craftingJobsOf(t, storage, userID) {
+				result.jobs[userID] = append(result.jobs[userID], fmt.Sprintf("%s x%d", job.ItemCode, job.Quantity))
+			}
+		}
+		item := marketItemOf(t, storage, "apple")
+		result.market = [2]int64{item.Price.Minor(), int64(item.Stock)}
+		return result
+	}
+
+	want, got := run(NewMemoryStorage()), run(NewSQLStorage(newTestDB(t)))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("数据库存储:\n%+v\n内存存储:\n%+v", got, want)
+	}
+}
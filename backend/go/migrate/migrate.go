@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// Migration 一次数据库升级，Up 在事务中执行，必须能兼容任意旧版表结构（幂等）
+type Migration struct {
+	Version int64                  // 版本号，全局唯一，按从小到大的顺序执行
+	Package string                 // 所属模块
+	Name    string                 // 说明
+	Up      func(tx *sql.Tx) error // 升级操作
+}
+
+// 迁移执行状态
+type Status struct {
+	Version   int64      `json:"version"`
+	Package   string     `json:"package"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`    // 是否已执行
+	AppliedAt *time.Time `json:"applied_at"` // 执行时间
+}
+
+var migrations = make(map[int64]Migration)
+var migrationsMutex sync.Mutex
+
+// Register 注册迁移，版本号重复时 panic
+func Register(list ...Migration) {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	for _, m := range list {
+		if m.Version <= 0 || m.Up == nil {
+			panic(fmt.Sprintf("迁移 %d %s 无效", m.Version, m.Name))
+		}
+		if existing, ok := migrations[m.Version]; ok {
+			panic(fmt.Sprintf("迁移版本号 %d 重复: %s.%s 与 %s.%s", m.Version, existing.Package, existing.Name, m.Package, m.Name))
+		}
+		migrations[m.Version] = m
+	}
+}
+
+// 按版本号排序的全部迁移
+func sortedMigrations() []Migration {
+	migrationsMutex.Lock()
+	defer migrationsMutex.Unlock()
+	list := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+// 创建迁移记录表
+func ensureMigrationsTable(dbConn *sql.DB) error {
+	_, err := dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			package TEXT NOT NULL,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		logger.Info("migrate", fmt.Sprintf("创建迁移记录表失败: %v\n", err))
+	}
+	return err
+}
+
+// 查询已执行的迁移
+func appliedMigrations(dbConn *sql.DB) (map[int64]time.Time, error) {
+	rows, err := dbConn.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// GetStatus 获取所有已注册迁移的执行状态
+func GetStatus(dbConn *sql.DB) ([]Status, error) {
+	if err := ensureMigrationsTable(dbConn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, m := range sortedMigrations() {
+		status := Status{Version: m.Version, Package: m.Package, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up 按版本顺序执行所有未执行的迁移，每个迁移单独一个事务，失败时回滚并停止
+func Up(dbConn *sql.DB) (int, error) {
+	if err := ensureMigrationsTable(dbConn); err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(dbConn)
+	if err != nil {
+		logger.Info("migrate", fmt.Sprintf("查询迁移记录失败: %v\n", err))
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range sortedMigrations() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err = apply(dbConn, m); err != nil {
+			logger.Info("migrate", fmt.Sprintf("执行迁移 %d %s.%s 失败: %v\n", m.Version, m.Package, m.Name, err))
+			return count, fmt.Errorf("执行迁移 %d %s.%s 失败: %w", m.Version, m.Package, m.Name, err)
+		}
+		logger.Info("migrate", fmt.Sprintf("已执行迁移 %d %s.%s\n", m.Version, m.Package, m.Name))
+		count++
+	}
+	return count, nil
+}
+
+// 在事务中执行单个迁移并记录
+func apply(dbConn *sql.DB, m Migration) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = m.Up(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO schema_migrations (version, package, name, applied_at) VALUES (?, ?, ?, ?)",
+		m.Version, m.Package, m.Name, timeservice.SyncNow())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/money"
+)
+
+// 表的列信息
+type columnInfo struct {
+	name     string
+	dataType string
+	notNull  bool
+}
+
+// 查询表的列信息
+func tableColumns(tx *sql.Tx, table string) ([]columnInfo, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []columnInfo
+	for rows.Next() {
+		var cid int
+		var name string
+		var dataType string
+		var notNull int
+		var dfltValue interface{}
+		var pk int
+		if err = rows.Scan(&cid, &name, &dataType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, columnInfo{name: name, dataType: dataType, notNull: notNull == 1})
+	}
+	return columns, rows.Err()
+}
+
+// 查询单个列，不存在时返回nil
+func findColumn(tx *sql.Tx, table string, column string) (*columnInfo, error) {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		if c.name == column {
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+// Exec 依次执行多条语句
+func Exec(tx *sql.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("%w: %s", err, strings.Join(strings.Fields(statement), " "))
+		}
+	}
+	return nil
+}
+
+// TableExists 检查表是否存在
+func TableExists(tx *sql.Tx, table string) (bool, error) {
+	var name string
+	err := tx.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name = ?", table).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ColumnExists 检查表中是否存在指定列
+func ColumnExists(tx *sql.Tx, table string, column string) (bool, error) {
+	c, err := findColumn(tx, table, column)
+	return c != nil, err
+}
+
+// AddColumn 为表添加列（已存在则跳过）
+func AddColumn(tx *sql.Tx, table string, column string, definition string) error {
+	exists, err := ColumnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	logger.Info("migrate", fmt.Sprintf("为%s表添加%s列\n", table, column))
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// ConvertMoneyColumns 将以元为单位的 REAL 金额列换算为以分为单位的 INTEGER 列（已是 INTEGER 则跳过）
+func ConvertMoneyColumns(tx *sql.Tx, table string, columns ...string) error {
+	for _, column := range columns {
+		c, err := findColumn(tx, table, column)
+		if err != nil {
+			return err
+		}
+		if c == nil || !strings.EqualFold(c.dataType, "REAL") {
+			continue
+		}
+
+		definition := "INTEGER"
+		if c.notNull {
+			definition = "INTEGER NOT NULL DEFAULT 0"
+		}
+		tempColumn := column + "_minor"
+
+		// SQLite 的 REAL 列会把整数再转回浮点数，所以需要新建 INTEGER 列后替换
+		err = Exec(tx,
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, tempColumn, definition),
+			fmt.Sprintf("UPDATE %s SET %s = CAST(ROUND(%s * %d) AS INTEGER) WHERE %s IS NOT NULL", table, tempColumn, column, money.MinorUnitsPerMajor, column),
+			fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column),
+			fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, tempColumn, column),
+		)
+		if err != nil {
+			return err
+		}
+		logger.Info("migrate", fmt.Sprintf("金额列 %s.%s 已由元(REAL)换算为分(INTEGER)\n", table, column))
+	}
+	return nil
+}
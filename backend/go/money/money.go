@@ -0,0 +1,409 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 货币代码
+type Currency string
+
+// 人民币
+const CNY Currency = "CNY"
+
+// 默认货币，游戏内的金额均按默认货币计价
+const DefaultCurrency = CNY
+
+// 每个货币单位包含的最小单位数（元 -> 分）
+const MinorUnitsPerMajor = 100
+
+// 小数位数
+const scale = 2
+
+// 金额错误
+var (
+	ErrInvalidAmount = errors.New("金额格式无效")
+	ErrTooPrecise    = errors.New("金额最多保留两位小数")
+	ErrOverflow      = errors.New("金额超出范围")
+	ErrCurrency      = errors.New("货币不一致")
+)
+
+// Money 定点金额，以最小货币单位（分）的整数和货币代码保存，避免浮点累加误差。
+// 零值为默认货币的零金额
+type Money struct {
+	minor    int64
+	currency Currency
+}
+
+// Zero 默认货币的零金额
+var Zero = New(0)
+
+// New 以最小货币单位创建默认货币金额
+func New(minor int64) Money {
+	return Money{minor: minor, currency: DefaultCurrency}
+}
+
+// FromMinor 以最小货币单位创建指定货币金额
+func FromMinor(minor int64, currency Currency) Money {
+	return Money{minor: minor, currency: currency}
+}
+
+// FromFloat 将以元为单位的浮点数换算为默认货币金额，四舍五入到分
+func FromFloat(major float64) Money {
+	return New(int64(math.Round(major * MinorUnitsPerMajor)))
+}
+
+// Parse 解析十进制金额字符串为默认货币金额，如 "12.34"、"-0.5"、"100"
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Money{}, ErrInvalidAmount
+	}
+	// 科学计数法先按十进制移动小数点展开，不经过浮点数
+	if strings.ContainsAny(s, "eE") {
+		expanded, err := expandExponent(s)
+		if err != nil {
+			return Money{}, err
+		}
+		s = expanded
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	integerPart, fractionPart, _ := strings.Cut(s, ".")
+	if integerPart == "" && fractionPart == "" {
+		return Money{}, ErrInvalidAmount
+	}
+	if len(fractionPart) > scale {
+		// 超出精度的位数必须全为0
+		if strings.Trim(fractionPart[scale:], "0") != "" {
+			return Money{}, ErrTooPrecise
+		}
+		fractionPart = fractionPart[:scale]
+	}
+	fractionPart += strings.Repeat("0", scale-len(fractionPart))
+	if integerPart == "" {
+		integerPart = "0"
+	}
+	for _, part := range []string{integerPart, fractionPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return Money{}, ErrInvalidAmount
+			}
+		}
+	}
+
+	major, err := strconv.ParseInt(integerPart, 10, 64)
+	if err != nil || major > math.MaxInt64/MinorUnitsPerMajor-1 {
+		return Money{}, ErrInvalidAmount
+	}
+	fraction, _ := strconv.ParseInt(fractionPart, 10, 64)
+	minor := major*MinorUnitsPerMajor + fraction
+	if negative {
+		minor = -minor
+	}
+	return New(minor), nil
+}
+
+// 展开科学计数法，如 "1.5e3" -> "1500"、"-25E-2" -> "-0.25"
+func expandExponent(s string) (string, error) {
+	mantissa, exponentPart, _ := strings.Cut(strings.ToLower(s), "e")
+	exponent, err := strconv.Atoi(exponentPart)
+	if err != nil {
+		return "", ErrInvalidAmount
+	}
+
+	sign := ""
+	if mantissa != "" && (mantissa[0] == '-' || mantissa[0] == '+') {
+		sign, mantissa = mantissa[:1], mantissa[1:]
+	}
+	integerPart, fractionPart, _ := strings.Cut(mantissa, ".")
+	digits := integerPart + fractionPart
+	if digits == "" {
+		return "", ErrInvalidAmount
+	}
+	// 限制展开后的长度，超出范围的结果由后续的整数解析和精度检查拒绝
+	if exponent > 64 || exponent < -64 {
+		return "", ErrInvalidAmount
+	}
+
+	point := len(integerPart) + exponent
+	switch {
+	case point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits, nil
+	case point >= len(digits):
+		return sign + digits + strings.Repeat("0", point-len(digits)), nil
+	}
+	return sign + digits[:point] + "." + digits[point:], nil
+}
+
+// Minor 返回以最小货币单位表示的金额
+func (m Money) Minor() int64 {
+	return m.minor
+}
+
+// Currency 返回货币代码，零值视为默认货币
+func (m Money) Currency() Currency {
+	if m.currency == "" {
+		return DefaultCurrency
+	}
+	return m.currency
+}
+
+// Float64 返回以元为单位的浮点数，仅用于价格模型等近似计算
+func (m Money) Float64() float64 {
+	return float64(m.minor) / MinorUnitsPerMajor
+}
+
+// Add 加法，货币不同时返回 ErrCurrency，结果超出 int64 范围时返回 ErrOverflow
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency() != other.Currency() {
+		return Money{}, fmt.Errorf("%w: %s 与 %s", ErrCurrency, m.Currency(), other.Currency())
+	}
+	sum := m.minor + other.minor
+	if (other.minor > 0 && sum < m.minor) || (other.minor < 0 && sum > m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: sum, currency: m.Currency()}, nil
+}
+
+// Sub 减法，货币不同时返回 ErrCurrency，结果超出 int64 范围时返回 ErrOverflow
+func (m Money) Sub(other Money) (Money, error) {
+	if m.Currency() != other.Currency() {
+		return Money{}, fmt.Errorf("%w: %s 与 %s", ErrCurrency, m.Currency(), other.Currency())
+	}
+	difference := m.minor - other.minor
+	if (other.minor > 0 && difference > m.minor) || (other.minor < 0 && difference < m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: difference, currency: m.Currency()}, nil
+}
+
+// Mul 乘以数量，结果超出 int64 范围时返回 ErrOverflow
+func (m Money) Mul(quantity int64) (Money, error) {
+	if m.minor == 0 || quantity == 0 {
+		return Money{currency: m.Currency()}, nil
+	}
+	product := m.minor * quantity
+	if product/quantity != m.minor || (m.minor == -1 && quantity == math.MinInt64) ||
+		(quantity == -1 && m.minor == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: product, currency: m.Currency()}, nil
+}
+
+// Neg 取相反数
+func (m Money) Neg() Money {
+	return Money{minor: -m.minor, currency: m.Currency()}
+}
+
+// Abs 取绝对值
+func (m Money) Abs() Money {
+	if m.minor < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Cmp 比较大小，小于返回-1，等于返回0，大于返回1。
+// 不同货币的金额不能比较，属于程序错误，直接 panic
+func (m Money) Cmp(other Money) int {
+	if m.Currency() != other.Currency() {
+		panic(fmt.Sprintf("%v: %s 与 %s", ErrCurrency, m.Currency(), other.Currency()))
+	}
+	switch {
+	case m.minor < other.minor:
+		return -1
+	case m.minor > other.minor:
+		return 1
+	}
+	return 0
+}
+
+// Equal 是否相等
+func (m Money) Equal(other Money) bool {
+	return m.Cmp(other) == 0
+}
+
+// LessThan 是否小于
+func (m Money) LessThan(other Money) bool {
+	return m.Cmp(other) < 0
+}
+
+// GreaterThan 是否大于
+func (m Money) GreaterThan(other Money) bool {
+	return m.Cmp(other) > 0
+}
+
+// IsZero 是否为零
+func (m Money) IsZero() bool {
+	return m.minor == 0
+}
+
+// IsPositive 是否大于零
+func (m Money) IsPositive() bool {
+	return m.minor > 0
+}
+
+// IsNegative 是否小于零
+func (m Money) IsNegative() bool {
+	return m.minor < 0
+}
+
+// Min 返回较小的金额
+func Min(a, b Money) Money {
+	if a.LessThan(b) {
+		return a
+	}
+	return b
+}
+
+// Max 返回较大的金额
+func Max(a, b Money) Money {
+	if a.GreaterThan(b) {
+		return a
+	}
+	return b
+}
+
+// String 以元为单位格式化，保留两位小数，如 "12.34"；非默认货币加上货币代码，如 "12.34 USD"
+func (m Money) String() string {
+	if m.Currency() != DefaultCurrency {
+		return m.amount() + " " + string(m.Currency())
+	}
+	return m.amount()
+}
+
+// 以元为单位的金额文本，不含货币代码
+func (m Money) amount() string {
+	minor := m.minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/MinorUnitsPerMajor, minor%MinorUnitsPerMajor)
+}
+
+// MarshalJSON 序列化为金额（以元为单位的JSON数字）和货币代码，如 {"amount":12.34,"currency":"CNY"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"amount":%s,"currency":%q}`, m.amount(), m.Currency())), nil
+}
+
+// UnmarshalJSON 支持 {"amount":12.34,"currency":"CNY"} 对象，以及按默认货币解析的JSON数字和字符串
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, "{") {
+		var object struct {
+			Amount   json.RawMessage `json:"amount"`
+			Currency Currency        `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		if object.Amount == nil {
+			return fmt.Errorf("解析金额 %s 失败: %w", string(data), ErrInvalidAmount)
+		}
+		if err := m.UnmarshalJSON(object.Amount); err != nil {
+			return err
+		}
+		if object.Currency != "" {
+			m.currency = object.Currency
+		}
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		text = s
+	}
+	parsed, err := Parse(text)
+	if err != nil {
+		return fmt.Errorf("解析金额 %s 失败: %w", string(data), err)
+	}
+	*m = parsed
+	return nil
+}
+
+// Value 写入数据库。默认货币保存为最小货币单位的整数，金额列的汇总和比较可以直接在SQL中进行；
+// 其他货币保存为货币代码加最小货币单位的文本，如 "USD 1234"
+func (m Money) Value() (driver.Value, error) {
+	if m.Currency() != DefaultCurrency {
+		return fmt.Sprintf("%s %d", m.Currency(), m.minor), nil
+	}
+	return m.minor, nil
+}
+
+// Scan 从数据库的金额列读取金额，整数为默认货币的最小货币单位
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Zero
+	case int64:
+		*m = New(v)
+	case float64:
+		// 表达式结果可能以浮点数返回，仍按最小货币单位处理
+		*m = New(int64(math.Round(v)))
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	default:
+		return fmt.Errorf("无法将 %T 转换为金额", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	currency, text := DefaultCurrency, strings.TrimSpace(s)
+	if code, minor, found := strings.Cut(text, " "); found {
+		currency, text = Currency(code), minor
+	}
+	minor, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("无法将 %q 转换为金额: %w", s, err)
+	}
+	*m = FromMinor(minor, currency)
+	return nil
+}
+
+// NullMoney 可为空的金额，用于可空的金额列
+type NullMoney struct {
+	Money Money
+	Valid bool
+}
+
+// Scan 从数据库读取可空金额
+func (n *NullMoney) Scan(src interface{}) error {
+	if src == nil {
+		n.Money, n.Valid = Zero, false
+		return nil
+	}
+	n.Valid = true
+	return n.Money.Scan(src)
+}
+
+// Value 写入数据库，无效时写入NULL
+func (n NullMoney) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Money.Value()
+}
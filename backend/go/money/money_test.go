@@ -0,0 +1,257 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		minor int64
+		err   error
+	}{
+		{"12.34", 1234, nil},
+		{"100", 10000, nil},
+		{"-0.5", -50, nil},
+		{"+3.1", 310, nil},
+		{".25", 25, nil},
+		{"7.", 700, nil},
+		{" 1.00 ", 100, nil},
+		{"1.230", 123, nil},
+		{"1.5e3", 150000, nil},
+		{"-25E-2", -25, nil},
+		{"1.234e1", 1234, nil},
+		{"0.1", 10, nil},
+		{"0.29", 29, nil},
+		{"", 0, ErrInvalidAmount},
+		{".", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{"1.x", 0, ErrInvalidAmount},
+		{"1-2", 0, ErrInvalidAmount},
+		{"1e", 0, ErrInvalidAmount},
+		{"1e100", 0, ErrInvalidAmount},
+		{"1.234", 0, ErrTooPrecise},
+		{"1e-3", 0, ErrTooPrecise},
+		{"92233720368547758", 0, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) 错误 = %v，期望 %v", tt.input, err, tt.err)
+			continue
+		}
+		if err == nil && got.Minor() != tt.minor {
+			t.Errorf("Parse(%q) = %d，期望 %d", tt.input, got.Minor(), tt.minor)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		major float64
+		minor int64
+	}{
+		{1, 100},
+		{0.1 + 0.2, 30},
+		{1.005, 100}, // 1.005 的二进制近似值略小于 1.005
+		{0.125, 13},  // 恰好一半时远离零取整
+		{2.675, 268},
+		{-0.125, -13},
+		{0.004, 0},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.major); got.Minor() != tt.minor {
+			t.Errorf("FromFloat(%v) = %d，期望 %d", tt.major, got.Minor(), tt.minor)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		minor    int64
+		quantity int64
+		want     int64
+		err      error
+	}{
+		{150, 3, 450, nil},
+		{-150, 3, -450, nil},
+		{0, math.MaxInt64, 0, nil},
+		{math.MaxInt64, 1, math.MaxInt64, nil},
+		{math.MaxInt64, 2, 0, ErrOverflow},
+		{math.MaxInt64/2 + 1, 2, 0, ErrOverflow},
+		{-1, math.MinInt64, 0, ErrOverflow},
+		{math.MinInt64, -1, 0, ErrOverflow},
+	}
+	for _, tt := range tests {
+		got, err := New(tt.minor).Mul(tt.quantity)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d × %d 错误 = %v，期望 %v", tt.minor, tt.quantity, err, tt.err)
+			continue
+		}
+		if err == nil && got.Minor() != tt.want {
+			t.Errorf("%d × %d = %d，期望 %d", tt.minor, tt.quantity, got.Minor(), tt.want)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	usd := func(minor int64) Money { return FromMinor(minor, "USD") }
+	tests := []struct {
+		a, b     Money
+		sum, dif int64
+		sumErr   error
+		difErr   error
+	}{
+		{New(150), New(25), 175, 125, nil, nil},
+		{New(-150), New(25), -125, -175, nil, nil},
+		{Money{}, New(5), 5, -5, nil, nil}, // 零值为默认货币
+		{New(math.MaxInt64), New(1), 0, math.MaxInt64 - 1, ErrOverflow, nil},
+		{New(math.MinInt64), New(1), math.MinInt64 + 1, 0, nil, ErrOverflow},
+		{New(math.MaxInt64), New(-1), math.MaxInt64 - 1, 0, nil, ErrOverflow},
+		{New(-2), New(math.MaxInt64), math.MaxInt64 - 2, 0, nil, ErrOverflow},
+		{usd(100), usd(1), 101, 99, nil, nil},
+		{New(100), usd(1), 0, 0, ErrCurrency, ErrCurrency},
+	}
+	for _, tt := range tests {
+		sum, err := tt.a.Add(tt.b)
+		if !errors.Is(err, tt.sumErr) {
+			t.Errorf("%s + %s 错误 = %v，期望 %v", tt.a, tt.b, err, tt.sumErr)
+		} else if err == nil && (sum.Minor() != tt.sum || sum.Currency() != tt.a.Currency()) {
+			t.Errorf("%s + %s = %s，期望 %d %s", tt.a, tt.b, sum, tt.sum, tt.a.Currency())
+		}
+		dif, err := tt.a.Sub(tt.b)
+		if !errors.Is(err, tt.difErr) {
+			t.Errorf("%s - %s 错误 = %v，期望 %v", tt.a, tt.b, err, tt.difErr)
+		} else if err == nil && (dif.Minor() != tt.dif || dif.Currency() != tt.a.Currency()) {
+			t.Errorf("%s - %s = %s，期望 %d %s", tt.a, tt.b, dif, tt.dif, tt.a.Currency())
+		}
+	}
+}
+
+// 不同货币的金额不能比较
+func TestCmpCurrency(t *testing.T) {
+	if !New(100).Equal(FromMinor(100, CNY)) || !Zero.Equal(Money{}) {
+		t.Error("默认货币的金额比较结果错误")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("比较不同货币的金额没有 panic")
+		}
+	}()
+	New(100).LessThan(FromMinor(100, "USD"))
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(0), "0.00"},
+		{New(5), "0.05"},
+		{New(1234), "12.34"},
+		{New(-50), "-0.50"},
+		{New(-1234), "-12.34"},
+		{FromMinor(1234, "USD"), "12.34 USD"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.String(); got != tt.want {
+			t.Errorf("String() = %q，期望 %q", got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		minor    int64
+		currency Currency
+		ok       bool
+	}{
+		{`12.34`, 1234, CNY, true},
+		{`"12.34"`, 1234, CNY, true},
+		{`1e2`, 10000, CNY, true},
+		{`null`, 0, CNY, true},
+		{`{"amount":12.34,"currency":"CNY"}`, 1234, CNY, true},
+		{`{"amount":"-0.5","currency":"USD"}`, -50, "USD", true},
+		{`{"amount":3}`, 300, CNY, true},
+		{`{"currency":"CNY"}`, 0, "", false},
+		{`{"amount":1.001,"currency":"CNY"}`, 0, "", false},
+		{`1.001`, 0, "", false},
+		{`"x"`, 0, "", false},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.input), &m)
+		if (err == nil) != tt.ok {
+			t.Errorf("解析 %s 错误 = %v，期望成功 %v", tt.input, err, tt.ok)
+			continue
+		}
+		if tt.ok && (m.Minor() != tt.minor || m.Currency() != tt.currency) {
+			t.Errorf("解析 %s = %d %s，期望 %d %s", tt.input, m.Minor(), m.Currency(), tt.minor, tt.currency)
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+		Fee   Money `json:"fee"`
+	}{New(-705), FromMinor(1200, "USD")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"price":{"amount":-7.05,"currency":"CNY"},"fee":{"amount":12.00,"currency":"USD"}}`; string(data) != want {
+		t.Errorf("序列化结果 = %s，期望 %s", data, want)
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src      interface{}
+		minor    int64
+		currency Currency
+		ok       bool
+	}{
+		{int64(1234), 1234, CNY, true},
+		{float64(99.6), 100, CNY, true},
+		{"250", 250, CNY, true},
+		{[]byte("-3"), -3, CNY, true},
+		{"USD 1234", 1234, "USD", true},
+		{nil, 0, CNY, true},
+		{"1.5", 0, "", false},
+		{"USD x", 0, "", false},
+		{true, 0, "", false},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := m.Scan(tt.src)
+		if (err == nil) != tt.ok {
+			t.Errorf("Scan(%#v) 错误 = %v，期望成功 %v", tt.src, err, tt.ok)
+			continue
+		}
+		if tt.ok && (m.Minor() != tt.minor || m.Currency() != tt.currency) {
+			t.Errorf("Scan(%#v) = %d %s，期望 %d %s", tt.src, m.Minor(), m.Currency(), tt.minor, tt.currency)
+		}
+	}
+}
+
+// 写入数据库的值再读出后金额和货币不变，默认货币保存为整数
+func TestValueRoundTrip(t *testing.T) {
+	for _, m := range []Money{New(1234), New(-5), FromMinor(1234, "USD"), Money{}} {
+		value, err := m.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, isInt := value.(int64); isInt != (m.Currency() == DefaultCurrency) {
+			t.Errorf("%s 写入的值 = %#v", m, value)
+		}
+		var scanned Money
+		if err = scanned.Scan(value); err != nil {
+			t.Fatal(err)
+		}
+		if scanned.Minor() != m.Minor() || scanned.Currency() != m.Currency() {
+			t.Errorf("%s 写入后读出 = %s", m, scanned)
+		}
+	}
+}
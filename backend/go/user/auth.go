@@ -0,0 +1,361 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 会话Cookie名称
+const SessionCookieName = "own1pixel_session"
+
+// 密码哈希格式前缀
+const passwordHashScheme = "pbkdf2-sha256"
+
+// 请求上下文中保存玩家ID的键
+type contextKey string
+
+const userIDContextKey contextKey = "userID"
+
+// 会话相关错误
+var (
+	ErrNoSession      = errors.New("未携带会话")
+	ErrInvalidSession = errors.New("会话无效")
+	ErrSessionExpired = errors.New("会话已过期")
+)
+
+var sessionSecret []byte
+var sessionSecretOnce sync.Once
+
+// 获取会话签名密钥，未配置时随机生成（重启后旧会话失效）
+func getSessionSecret() []byte {
+	sessionSecretOnce.Do(func() {
+		secret := config.GetConfig().Auth.SessionSecret
+		if secret != "" {
+			sessionSecret = []byte(secret)
+			return
+		}
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("生成会话签名密钥失败: %v", err))
+		}
+		sessionSecret = buf
+		logger.Info("user", "未配置会话签名密钥，已随机生成，重启后需重新登录\n")
+	})
+	return sessionSecret
+}
+
+// 生成URL安全的随机字符串
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashPassword 计算密码哈希，格式为 pbkdf2-sha256$迭代次数$盐$哈希
+func HashPassword(password string) (string, error) {
+	iterations := config.GetConfig().Auth.PasswordIterations
+	if iterations <= 0 {
+		iterations = 100000
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, iterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword 校验密码是否与哈希匹配
+func VerifyPassword(passwordHash string, password string) bool {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// 计算会话ID的签名
+func signSessionID(sessionID string) string {
+	mac := hmac.New(sha256.New, getSessionSecret())
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 校验Cookie签名并取出会话ID
+func parseSessionCookie(value string) (string, bool) {
+	sessionID, signature, found := strings.Cut(value, ".")
+	if !found || sessionID == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(signSessionID(sessionID))) {
+		return "", false
+	}
+	return sessionID, true
+}
+
+// 创建会话并写入Cookie
+func startSession(db *sql.DB, w http.ResponseWriter, r *http.Request, userID int) error {
+	sessionID, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	currentTime := timeservice.SyncNow()
+	expiresAt := currentTime.Add(config.GetConfig().Auth.SessionTTL)
+	_, err = db.Exec("INSERT INTO sessions (id, user_id, created_at, expires_at) VALUES (?, ?, ?, ?)",
+		sessionID, userID, currentTime, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    sessionID + "." + signSessionID(sessionID),
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// 清除浏览器中的会话Cookie
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Authenticate 根据请求中的会话Cookie识别玩家
+func Authenticate(db *sql.DB, r *http.Request) (int, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil {
+		return 0, ErrNoSession
+	}
+	sessionID, ok := parseSessionCookie(cookie.Value)
+	if !ok {
+		return 0, ErrInvalidSession
+	}
+
+	var userID int
+	var expiresAt time.Time
+	err = db.QueryRow("SELECT user_id, expires_at FROM sessions WHERE id = ?", sessionID).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidSession
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !timeservice.SyncNow().Before(expiresAt) {
+		db.Exec("DELETE FROM sessions WHERE id = ?", sessionID)
+		return 0, ErrSessionExpired
+	}
+	return userID, nil
+}
+
+// RequireAuth 认证中间件，未登录的请求返回401，已登录时把玩家ID写入请求上下文
+func RequireAuth(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := Authenticate(db, r)
+		if err != nil {
+			if err != ErrNoSession {
+				logger.Info("user", fmt.Sprintf("会话校验失败 %s: %v\n", r.URL.Path, err))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "未登录或会话已过期",
+			})
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userIDContextKey, userID)))
+	}
+}
+
+// RequireAdmin 管理员中间件，未登录的请求返回401，不是管理员的玩家返回403
+func RequireAdmin(db *sql.DB, next http.HandlerFunc) http.HandlerFunc {
+	return RequireAuth(db, func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := UserIDFromContext(r.Context())
+		var isAdmin bool
+		err := db.QueryRow("SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin)
+		if err != nil {
+			logger.Info("user", fmt.Sprintf("获取玩家 %d 的管理员标记失败: %v\n", userID, err))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "获取玩家失败",
+			})
+			return
+		}
+		if !isAdmin {
+			logger.Info("user", fmt.Sprintf("玩家 %d 没有管理员权限，拒绝访问 %s\n", userID, r.URL.Path))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "需要管理员权限",
+			})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// UserIDFromContext 获取认证中间件写入的玩家ID
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(int)
+	return userID, ok
+}
+
+// 登录
+func Login(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		logger.Info("user", fmt.Sprintf("登录请求失败，不支持的请求方法: %s\n", r.Method))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "不支持的请求方法",
+		})
+		return
+	}
+
+	var data struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		logger.Info("user", fmt.Sprintf("解析登录JSON失败: %v\n", err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "请求数据解析失败",
+		})
+		return
+	}
+
+	var userID int
+	var passwordHash sql.NullString
+	err := db.QueryRow("SELECT id, password_hash FROM users WHERE username = ?", strings.TrimSpace(data.Username)).Scan(
+		&userID, &passwordHash)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Info("user", fmt.Sprintf("查询登录玩家失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "登录失败",
+		})
+		return
+	}
+	if err == sql.ErrNoRows || !VerifyPassword(passwordHash.String, data.Password) {
+		logger.Info("user", fmt.Sprintf("玩家 %s 登录失败，登录名或密码错误\n", data.Username))
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "登录名或密码错误",
+		})
+		return
+	}
+
+	if err = startSession(db, w, r, userID); err != nil {
+		logger.Info("user", fmt.Sprintf("为玩家 %d 创建会话失败: %v\n", userID, err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "创建会话失败",
+		})
+		return
+	}
+
+	u, err := GetUserByID(db, userID)
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("获取玩家 %d 失败: %v\n", userID, err))
+	}
+
+	logger.Info("user", fmt.Sprintf("玩家 %d 登录成功\n", userID))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "登录成功",
+		"user":    u,
+	})
+}
+
+// 退出登录
+func Logout(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		logger.Info("user", fmt.Sprintf("退出登录请求失败，不支持的请求方法: %s\n", r.Method))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "不支持的请求方法",
+		})
+		return
+	}
+
+	if cookie, err := r.Cookie(SessionCookieName); err == nil {
+		if sessionID, ok := parseSessionCookie(cookie.Value); ok {
+			if _, err := db.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+				logger.Info("user", fmt.Sprintf("删除会话失败: %v\n", err))
+			}
+		}
+	}
+	clearSessionCookie(w, r)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "已退出登录",
+	})
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"database/sql"
+
+	"own-1Pixel/backend/go/migrate"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// Migrations 玩家模块的数据库迁移
+func Migrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 1, Package: "user", Name: "创建玩家表和默认玩家", Up: createUsersTable},
+		{Version: 2, Package: "user", Name: "创建会话表", Up: createSessionsTable},
+		{Version: 26, Package: "user", Name: "玩家表增加管理员标记", Up: addAdminColumn},
+	}
+}
+
+// 创建玩家表，单玩家时代的数据归属默认玩家
+func createUsersTable(tx *sql.Tx) error {
+	err := migrate.Exec(tx, `
+		CREATE TABLE IF NOT EXISTS users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			nickname TEXT,
+			password_hash TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// 旧版玩家表没有密码列
+	if err = migrate.AddColumn(tx, "users", "password_hash", "TEXT"); err != nil {
+		return err
+	}
+
+	// 没有玩家时创建默认玩家，初始密码在启动时生成
+	var count int
+	if err = tx.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		currentTime := timeservice.SyncNow()
+		_, err = tx.Exec("INSERT INTO users (id, username, nickname, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			DefaultUserID, "player", "玩家", currentTime, currentTime)
+	}
+	return err
+}
+
+// 创建会话表
+func createSessionsTable(tx *sql.Tx) error {
+	return migrate.Exec(tx, `
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME,
+			expires_at DATETIME
+		)
+	`,
+		"CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)",
+	)
+}
+
+// 玩家表增加管理员标记，默认玩家（单玩家时代的服务器所有者）成为管理员
+func addAdminColumn(tx *sql.Tx) error {
+	if err := migrate.AddColumn(tx, "users", "is_admin", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE users SET is_admin = 1, updated_at = ? WHERE id = ?", timeservice.SyncNow(), DefaultUserID)
+	return err
+}
@@ -0,0 +1,380 @@
+package user
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/logger"
+	"own-1Pixel/backend/go/timeservice"
+)
+
+// 默认玩家ID，兼容单玩家时代的数据
+const DefaultUserID = 1
+
+// 密码最小长度
+const MinPasswordLength = 6
+
+// 玩家结构
+type User struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`   // 登录名
+	Nickname  string    `json:"nickname"`   // 昵称
+	IsAdmin   bool      `json:"is_admin"`   // 是否为管理员
+	CreatedAt time.Time `json:"created_at"` // 创建时间
+	UpdatedAt time.Time `json:"updated_at"` // 更新时间
+}
+
+// 玩家初始化函数，在创建玩家的事务中为其准备余额、背包等数据
+type UserInitializer func(tx *sql.Tx, userID int) error
+
+var userInitializers []UserInitializer
+var initializersMutex sync.Mutex
+
+// RegisterUserInitializer 注册玩家初始化函数
+func RegisterUserInitializer(initializer UserInitializer) {
+	initializersMutex.Lock()
+	defer initializersMutex.Unlock()
+	userInitializers = append(userInitializers, initializer)
+}
+
+// 获取所有玩家ID（事务版本）
+func GetUserIDs(tx *sql.Tx) ([]int, error) {
+	rows, err := tx.Query("SELECT id FROM users ORDER BY id ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
+
+// 根据ID获取玩家
+func GetUserByID(db *sql.DB, userID int) (*User, error) {
+	var u User
+	var nickname sql.NullString
+	err := db.QueryRow("SELECT id, username, nickname, is_admin, created_at, updated_at FROM users WHERE id = ?", userID).Scan(
+		&u.ID, &u.Username, &nickname, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.Nickname = nickname.String
+	return &u, nil
+}
+
+// InitMissingPasswords 为没有密码的玩家（默认玩家和旧版数据）生成随机初始密码，
+// 明文密码只追加写入仅所有者可读的初始密码文件，不输出到控制台和日志
+func InitMissingPasswords(dbConn *sql.DB) error {
+	rows, err := dbConn.Query("SELECT id, username FROM users WHERE password_hash IS NULL OR password_hash = ''")
+	if err != nil {
+		return err
+	}
+	type pendingUser struct {
+		id       int
+		username string
+	}
+	var pending []pendingUser
+	for rows.Next() {
+		var p pendingUser
+		if err := rows.Scan(&p.id, &p.username); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	passwordPath := config.GetConfig().Auth.InitialPasswordPath
+	if err := os.MkdirAll(filepath.Dir(passwordPath), 0700); err != nil {
+		return err
+	}
+	passwordFile, err := os.OpenFile(passwordPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer passwordFile.Close()
+	// 文件已存在时 OpenFile 不会修改权限
+	if err := passwordFile.Chmod(0600); err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		password, err := randomToken(9)
+		if err != nil {
+			return err
+		}
+		passwordHash, err := HashPassword(password)
+		if err != nil {
+			return err
+		}
+		// 先写入密码文件再更新数据库，避免密码已生效却没有留存
+		if _, err := fmt.Fprintf(passwordFile, "%s\t%s\t%s\n",
+			timeservice.SyncNow().Format(time.RFC3339), p.username, password); err != nil {
+			return err
+		}
+		if err := passwordFile.Sync(); err != nil {
+			return err
+		}
+		_, err = dbConn.Exec("UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?",
+			passwordHash, timeservice.SyncNow(), p.id)
+		if err != nil {
+			return err
+		}
+		logger.Info("user", fmt.Sprintf("已为玩家 %s 生成初始密码，写入 %s\n", p.username, passwordPath))
+		fmt.Printf("已为玩家 %s 生成初始密码，请查看 %s\n", p.username, passwordPath)
+	}
+	return nil
+}
+
+// 获取当前玩家
+func GetCurrentUser(db *sql.DB, w http.ResponseWriter, r *http.Request, userID int) {
+	w.Header().Set("Content-Type", "application/json")
+
+	u, err := GetUserByID(db, userID)
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("获取玩家 %d 失败: %v\n", userID, err))
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "获取玩家失败",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"user":    u,
+	})
+}
+
+// 获取玩家列表
+func GetUsers(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rows, err := db.Query("SELECT id, username, nickname, is_admin, created_at, updated_at FROM users ORDER BY id ASC")
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("获取玩家列表失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "获取玩家列表失败",
+		})
+		return
+	}
+	defer rows.Close()
+
+	users := make([]User, 0)
+	for rows.Next() {
+		var u User
+		var nickname sql.NullString
+		if err := rows.Scan(&u.ID, &u.Username, &nickname, &u.IsAdmin, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			logger.Info("user", fmt.Sprintf("扫描玩家记录失败: %v\n", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "扫描玩家记录失败",
+			})
+			return
+		}
+		u.Nickname = nickname.String
+		users = append(users, u)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"users":   users,
+	})
+}
+
+// 注册玩家，注册成功后自动登录
+func Register(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		logger.Info("user", fmt.Sprintf("注册玩家请求失败，不支持的请求方法: %s\n", r.Method))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "不支持的请求方法",
+		})
+		return
+	}
+
+	var data struct {
+		Username string `json:"username"`
+		Nickname string `json:"nickname"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		logger.Info("user", fmt.Sprintf("解析玩家JSON失败: %v\n", err))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "请求数据解析失败",
+		})
+		return
+	}
+
+	data.Username = strings.TrimSpace(data.Username)
+	if data.Username == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "登录名不能为空",
+		})
+		return
+	}
+	if len(data.Password) < MinPasswordLength {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": fmt.Sprintf("密码长度不能少于 %d 位", MinPasswordLength),
+		})
+		return
+	}
+	if data.Nickname == "" {
+		data.Nickname = data.Username
+	}
+
+	passwordHash, err := HashPassword(data.Password)
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("计算密码哈希失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "注册玩家失败",
+		})
+		return
+	}
+
+	// 检查登录名是否已存在
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ?", data.Username).Scan(&count)
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("查询玩家登录名失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "查询玩家失败",
+		})
+		return
+	}
+	if count > 0 {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "登录名已存在",
+		})
+		return
+	}
+
+	// 开始事务
+	tx, err := db.Begin()
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("开始事务失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "开始事务失败",
+		})
+		return
+	}
+
+	// 插入玩家记录
+	currentTime := timeservice.SyncNow()
+	result, err := tx.Exec("INSERT INTO users (username, nickname, password_hash, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		data.Username, data.Nickname, passwordHash, currentTime, currentTime)
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("插入玩家记录失败: %v\n", err))
+		tx.Rollback()
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "插入玩家记录失败",
+		})
+		return
+	}
+
+	userID, err := result.LastInsertId()
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("获取玩家ID失败: %v\n", err))
+		tx.Rollback()
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "获取玩家ID失败",
+		})
+		return
+	}
+
+	// 为玩家准备余额、背包等数据
+	initializersMutex.Lock()
+	initializers := append([]UserInitializer(nil), userInitializers...)
+	initializersMutex.Unlock()
+	for _, initializer := range initializers {
+		if err = initializer(tx, int(userID)); err != nil {
+			logger.Info("user", fmt.Sprintf("初始化玩家 %d 数据失败: %v\n", userID, err))
+			tx.Rollback()
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "初始化玩家数据失败",
+			})
+			return
+		}
+	}
+
+	// 提交事务
+	err = tx.Commit()
+	if err != nil {
+		logger.Info("user", fmt.Sprintf("提交事务失败: %v\n", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "提交事务失败",
+		})
+		return
+	}
+
+	logger.Info("user", fmt.Sprintf("注册玩家成功，ID: %d，登录名: %s\n", userID, data.Username))
+
+	// 注册成功后直接建立会话
+	if err = startSession(db, w, r, int(userID)); err != nil {
+		logger.Info("user", fmt.Sprintf("为玩家 %d 创建会话失败: %v\n", userID, err))
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "注册成功",
+		"user": User{
+			ID:        int(userID),
+			Username:  data.Username,
+			Nickname:  data.Nickname,
+			CreatedAt: currentTime,
+			UpdatedAt: currentTime,
+		},
+	})
+}
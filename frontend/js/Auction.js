@@ -1,11 +1,16 @@
 /**
  * 拍卖页 - 荷兰钟拍卖系统前端脚本
  */
+// 物品目录，用于显示物品名称和创建拍卖时选择物品
+let itemCatalog = [];
+
 document.addEventListener('DOMContentLoaded', () => {
-    // 初始化页面
+    // 初始化页面，拍卖列表按物品目录显示物品名称
     loadBalance();
-    loadAuctions();
-    loadSellerAuctions();
+    loadItemCatalog().then(() => {
+        loadAuctions();
+        loadSellerAuctions();
+    });
 
     // 设置WebSocket消息处理器
     function setupWebSocketHandlers() {
@@ -27,12 +32,44 @@ document.addEventListener('DOMContentLoaded', () => {
             handleAuctionPriceUpdate(data);
         });
 
+        // 注册批量价格更新消息处理器（拍卖时钟同一次处理的所有价格变化）
+        window.wsManager.onMessage('auction_price_batch', (data) => {
+            console.log('收到批量价格更新:', data);
+            (data.updates || []).forEach(handleAuctionPriceUpdate);
+        });
+
         // 注册拍卖状态更新消息处理器
         window.wsManager.onMessage('auction_status', (data) => {
             console.log('收到拍卖状态更新:', data);
             handleAuctionStatusUpdate(data);
         });
 
+        // 注册出价被超越消息处理器（只发送给被超越的玩家）
+        window.wsManager.onMessage('auction_outbid', (data) => {
+            console.log('收到出价被超越通知:', data);
+            showNotification(`你在拍卖 #${data.auctionId} 的出价 ¥${data.price.toFixed(2)} 已被超越，最新出价 ¥${data.newPrice.toFixed(2)}，冻结资金已退还`, 'error');
+            loadBalance();
+        });
+
+        // 注册密封拍卖开标结果消息处理器
+        window.wsManager.onMessage('auction_sealed_result', (data) => {
+            console.log('收到密封拍卖开标结果:', data);
+            if (data.sold) {
+                showNotification(`拍卖 #${data.auctionId} 已开标：玩家 ${data.winnerId} 以 ¥${data.clearingPrice.toFixed(2)} 中标，共 ${data.bids.length} 个出价`);
+            } else {
+                showNotification(`拍卖 #${data.auctionId} 已开标：流拍，冻结资金已退还`);
+            }
+            loadBalance();
+            loadAuctions();
+            loadSellerAuctions();
+        });
+
+        // 通知丢失时重新加载拍卖数据
+        window.wsManager.onGap(() => {
+            loadAuctions();
+            loadSellerAuctions();
+        });
+
         // 注册连接状态变化处理器
         window.wsManager.onConnectionChange((isConnected) => {
             console.log(`WebSocket连接状态: ${isConnected ? '已连接' : '已断开'}`);
@@ -65,7 +102,9 @@ document.addEventListener('DOMContentLoaded', () => {
             showNotification(`拍卖 #${auction.id} 已取消`);
         } else if (data.action === 'paused') {
             showNotification(`拍卖 #${auction.id} 已暂停`);
-        } else if (data.action === 'ended') {
+        } else if (data.action === 'resumed') {
+            showNotification(`拍卖 #${auction.id} 已恢复`);
+        } else if (data.action === 'ended' || data.action === 'completed') {
             showNotification(`拍卖 #${auction.id} 已结束`);
         }
     }
@@ -234,6 +273,24 @@ document.addEventListener('DOMContentLoaded', () => {
             priceElement.textContent = `¥ ${(auction.currentPrice || 0).toFixed(2)}`;
         }
 
+        // 英式拍卖更新最高出价者和结束时间（防狙击可能延长）
+        if (auction.auctionType === 'english') {
+            const leaderElement = card.querySelector('.auction-leader');
+            if (leaderElement) {
+                leaderElement.textContent = auction.winnerId ? `玩家 ${auction.winnerId}` : '暂无出价';
+            }
+            const endTimeElement = card.querySelector('.auction-end-time');
+            if (endTimeElement) {
+                endTimeElement.textContent = auction.endTime ? new Date(auction.endTime).toLocaleString() : '-';
+            }
+        }
+
+        // 更新竞价按钮携带的最新价格
+        const bidButtonElement = card.querySelector('.bid-button');
+        if (bidButtonElement) {
+            bidButtonElement.setAttribute('onclick', auctionBidOnclick(auction));
+        }
+
         // 更新拍卖卡片内的可视化器
         if (window.auctionVisualizers && window.auctionVisualizers[auction.id]) {
             try {
@@ -260,11 +317,13 @@ document.addEventListener('DOMContentLoaded', () => {
         if (statusElement) {
             const statusClass = auction.status === 'active' ? 'bg-green-100 text-green-800' :
                 auction.status === 'pending' ? 'bg-yellow-100 text-yellow-800' :
+                auction.status === 'paused' ? 'bg-orange-100 text-orange-800' :
                     auction.status === 'completed' ? 'bg-blue-100 text-blue-800' :
                         'bg-gray-100 text-gray-800';
 
             const statusText = auction.status === 'active' ? '进行中' :
                 auction.status === 'pending' ? '待开始' :
+                auction.status === 'paused' ? '已暂停' :
                     auction.status === 'completed' ? '已完成' : '已取消';
 
             statusElement.className = `px-2 py-1 text-xs rounded-full ${statusClass} auction-status`;
@@ -286,13 +345,14 @@ document.addEventListener('DOMContentLoaded', () => {
         }
 
         if (cancelButton) {
-            cancelButton.style.display = (auction.status === 'pending' || auction.status === 'active') ? 'inline-block' : 'none';
+            cancelButton.style.display = (auction.status === 'pending' || auction.status === 'active' || auction.status === 'paused') ? 'inline-block' : 'none';
         }
 
         if (bidButton) {
             bidButton.disabled = auction.status !== 'active';
             bidButton.textContent = auction.status === 'active' ? '立即竞拍' :
                 auction.status === 'pending' ? '尚未开始' :
+                auction.status === 'paused' ? '已暂停' :
                     auction.status === 'completed' ? '已结束' : '已取消';
         }
     }
@@ -303,6 +363,11 @@ document.addEventListener('DOMContentLoaded', () => {
     // 设置WebSocket消息处理器
     setupWebSocketHandlers();
 
+    // 切换拍卖类型时显示对应的参数
+    document.getElementById('auctionType').addEventListener('change', toggleAuctionTypeFields);
+    document.getElementById('decayCurve').addEventListener('change', toggleAuctionTypeFields);
+    toggleAuctionTypeFields();
+
     // 创建拍卖表单提交
     document.getElementById('createAuctionForm').addEventListener('submit', async (e) => {
         e.preventDefault();
@@ -446,6 +511,7 @@ function updateAuctionCardStatus(element, status) {
         // 移除所有状态类
         statusElement.classList.remove('bg-green-100', 'text-green-800',
             'bg-yellow-100', 'text-yellow-800',
+            'bg-orange-100', 'text-orange-800',
             'bg-blue-100', 'text-blue-800',
             'bg-gray-100', 'text-gray-800');
 
@@ -456,6 +522,9 @@ function updateAuctionCardStatus(element, status) {
         } else if (status === 'pending') {
             statusElement.classList.add('bg-yellow-100', 'text-yellow-800');
             statusElement.textContent = '待开始';
+        } else if (status === 'paused') {
+            statusElement.classList.add('bg-orange-100', 'text-orange-800');
+            statusElement.textContent = '已暂停';
         } else if (status === 'completed') {
             statusElement.classList.add('bg-blue-100', 'text-blue-800');
             statusElement.textContent = '已完成';
@@ -524,40 +593,37 @@ function createSellerAuctionCard(auction) {
 
     const statusClass = auction.status === 'active' ? 'bg-green-100 text-green-800' :
         auction.status === 'pending' ? 'bg-yellow-100 text-yellow-800' :
+        auction.status === 'paused' ? 'bg-orange-100 text-orange-800' :
             auction.status === 'completed' ? 'bg-blue-100 text-blue-800' :
                 'bg-gray-100 text-gray-800';
 
     const statusText = auction.status === 'active' ? '进行中' :
         auction.status === 'pending' ? '待开始' :
+        auction.status === 'paused' ? '已暂停' :
             auction.status === 'completed' ? '已完成' : '已取消';
 
     card.innerHTML = `
         <div class="p-4">
             <div class="flex justify-between items-start mb-2">
-                <h3 class="text-lg font-semibold">${auction.itemType === 'apple' ? '苹果' : '木材'}</h3>
+                <h3 class="text-lg font-semibold">${escapeItemName(auction.itemType)} <span class="text-xs text-gray-500">${auctionTypeText(auction)}</span></h3>
                 <span class="px-2 py-1 text-xs rounded-full ${statusClass}">${statusText}</span>
             </div>
             <div class="space-y-2">
                 <div class="flex justify-between">
-                    <span class="text-gray-600">数量:</span>
-                    <span class="font-medium">${auction.quantity}</span>
+                    <span class="text-gray-600">剩余/数量:</span>
+                    <span class="font-medium">${auction.remainingQuantity} / ${auction.quantity}</span>
                 </div>
                 <div class="flex justify-between">
                     <span class="text-gray-600">当前价格:</span>
                     <span class="price-countdown font-bold text-lg text-indigo-600">¥ ${(auction.currentPrice || 0).toFixed(2)}</span>
                 </div>
+                ${auction.reservePrice ? `
                 <div class="flex justify-between">
-                    <span class="text-gray-600">最低价格:</span>
-                    <span class="font-medium">¥ ${(auction.minPrice || 0).toFixed(2)}</span>
-                </div>
-                <div class="flex justify-between">
-                    <span class="text-gray-600">递减价格:</span>
-                    <span class="font-medium">¥ ${(auction.priceDecrement || 0).toFixed(2)}</span>
-                </div>
-                <div class="flex justify-between">
-                    <span class="text-gray-600">递减间隔:</span>
-                    <span class="font-medium">${auction.decrementInterval}秒</span>
-                </div>
+                    <span class="text-gray-600">保留价（仅自己可见）:</span>
+                    <span class="font-medium">¥ ${auction.reservePrice.toFixed(2)}</span>
+                </div>` : ''}
+                ${auctionRuleRows(auction)}
+                ${auctionScheduleRows(auction)}
             </div>
             <div class="mt-4 flex flex-col space-y-2">
                 ${auction.status === 'pending' ?
@@ -569,11 +635,25 @@ function createSellerAuctionCard(auction) {
                             onclick="cancelAuction(${auction.id})">
                         取消拍卖
                     </button>` : ''}
-                ${auction.status === 'active' ?
+                ${auction.status === 'active' && !isTimedAuction(auction) ?
             `<button class="w-full bg-yellow-600 text-white py-2 px-4 rounded-md hover:bg-yellow-700 transition" 
                             onclick="pauseAuction(${auction.id})">
                         下架拍卖
                     </button>` : ''}
+                ${auction.status === 'paused' ?
+            `<button class="w-full bg-green-600 text-white py-2 px-4 rounded-md hover:bg-green-700 transition" 
+                            onclick="resumeAuction(${auction.id})">
+                        恢复拍卖
+                    </button>
+                    <button class="w-full bg-red-600 text-white py-2 px-4 rounded-md hover:bg-red-700 transition" 
+                            onclick="cancelAuction(${auction.id})">
+                        取消拍卖
+                    </button>` : ''}
+                ${auction.status === 'active' && isTimedAuction(auction) ?
+            `<button class="w-full bg-red-600 text-white py-2 px-4 rounded-md hover:bg-red-700 transition" 
+                            onclick="cancelAuction(${auction.id})">
+                        取消拍卖（退还冻结的出价）
+                    </button>` : ''}
                 ${auction.status === 'completed' || auction.status === 'cancelled' ?
             `<div class="w-full text-center text-gray-500 py-2">
                         拍卖已结束
@@ -626,6 +706,159 @@ async function loadAuctions() {
     }
 }
 
+// 拍卖类型名称
+function auctionTypeText(auction) {
+    switch (auction.auctionType) {
+        case 'english':
+            return '英式拍卖';
+        case 'sealed_first':
+            return '密封一价拍卖';
+        case 'vickrey':
+            return '维克里拍卖';
+        default:
+            return '荷兰钟拍卖';
+    }
+}
+
+// 是否为密封拍卖（一价或二价）
+function isSealedAuction(auction) {
+    return auction.auctionType === 'sealed_first' || auction.auctionType === 'vickrey';
+}
+
+// 是否为按结束时间结算的拍卖（英式拍卖和密封拍卖）
+function isTimedAuction(auction) {
+    return auction.auctionType === 'english' || isSealedAuction(auction);
+}
+
+// 卡片上价格的名称
+function auctionPriceLabel(auction) {
+    if (auction.auctionType === 'english') {
+        return '当前出价';
+    }
+    if (isSealedAuction(auction)) {
+        return auction.status === 'completed' ? '成交价' : '起拍价';
+    }
+    return '当前价格';
+}
+
+// 拍卖规则信息行：荷兰钟拍卖显示递减规则，英式拍卖显示加价规则、最高出价者和结束时间，密封拍卖显示成交规则和开标时间
+// 拍卖的预定开始和结束时间，没有预定时不显示
+function auctionScheduleRows(auction) {
+    let rows = '';
+    if (auction.scheduled_start && auction.status === 'pending') {
+        rows += `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">预定开始:</span>
+                    <span class="font-medium">${new Date(auction.scheduled_start).toLocaleString()}</span>
+                </div>`;
+    }
+    if (auction.scheduled_end && (auction.status === 'pending' || auction.status === 'active' || auction.status === 'paused')) {
+        rows += `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">预定结束:</span>
+                    <span class="font-medium">${new Date(auction.scheduled_end).toLocaleString()}</span>
+                </div>`;
+    }
+    return rows;
+}
+
+// 读取预定时间输入框，转换为 ISO 时间字符串，未填写时返回 undefined（请求中省略）
+function scheduledTimeValue(id) {
+    const element = document.getElementById(id);
+    return element && element.value ? new Date(element.value).toISOString() : undefined;
+}
+
+function auctionRuleRows(auction) {
+    if (isSealedAuction(auction)) {
+        return `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">成交规则:</span>
+                    <span class="font-medium">${auction.auctionType === 'vickrey' ? '最高出价者按第二高出价成交' : '最高出价者按自己的出价成交'}</span>
+                </div>
+                <div class="flex justify-between">
+                    <span class="text-gray-600">开标时间:</span>
+                    <span class="auction-end-time font-medium">${auction.endTime ? new Date(auction.endTime).toLocaleString() : '-'}</span>
+                </div>`;
+    }
+    if (auction.auctionType === 'english') {
+        return `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">最低加价:</span>
+                    <span class="font-medium">¥ ${(auction.minIncrement || 0).toFixed(2)}</span>
+                </div>
+                <div class="flex justify-between">
+                    <span class="text-gray-600">最高出价者:</span>
+                    <span class="auction-leader font-medium">${auction.winnerId ? `玩家 ${auction.winnerId}` : '暂无出价'}</span>
+                </div>
+                <div class="flex justify-between">
+                    <span class="text-gray-600">结束时间:</span>
+                    <span class="auction-end-time font-medium">${auction.endTime ? new Date(auction.endTime).toLocaleString() : '-'}</span>
+                </div>`;
+    }
+    return `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">价格曲线:</span>
+                    <span class="font-medium">${decayCurveText(auction)}</span>
+                </div>
+                <div class="flex justify-between">
+                    <span class="text-gray-600">最低价格:</span>
+                    <span class="font-medium">¥ ${(auction.minPrice || 0).toFixed(2)}</span>
+                </div>
+                ${auction.priceDecrement ? `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">递减价格:</span>
+                    <span class="font-medium">¥ ${auction.priceDecrement.toFixed(2)}</span>
+                </div>` : ''}
+                ${auction.decrementInterval ? `
+                <div class="flex justify-between">
+                    <span class="text-gray-600">递减间隔:</span>
+                    <span class="font-medium">${auction.decrementInterval}秒</span>
+                </div>` : ''}`;
+}
+
+// 竞价按钮的点击处理，携带拍卖的最新价格
+function auctionBidOnclick(auction) {
+    return `openAuctionBidModal(${auction.id}, '${auction.itemType}', ${auction.currentPrice}, ${auction.minPrice}, ${auction.remainingQuantity}, '${auction.auctionType}', ${auction.minIncrement || 0}, ${auction.winnerId ? 'true' : 'false'})`;
+}
+
+// 按拍卖类型显示创建表单中的参数
+function toggleAuctionTypeFields() {
+    const auctionType = document.getElementById('auctionType').value;
+    const isDutch = auctionType === 'dutch';
+    document.querySelectorAll('.dutch-field').forEach(element => element.classList.toggle('hidden', !isDutch));
+    document.querySelectorAll('.english-field').forEach(element => element.classList.toggle('hidden', auctionType !== 'english'));
+    document.querySelectorAll('.timed-field').forEach(element => element.classList.toggle('hidden', isDutch));
+
+    // 荷兰钟拍卖按价格曲线显示对应的参数
+    const decayCurve = document.getElementById('decayCurve').value;
+    document.querySelectorAll('[data-curves]').forEach(element =>
+        element.classList.toggle('hidden', !isDutch || !element.dataset.curves.split(' ').includes(decayCurve)));
+}
+
+// 读取阶梯曲线点位，每行“秒数:价格”
+function parseDecaySteps() {
+    const element = document.getElementById('decaySteps');
+    if (!element || !element.value.trim()) return [];
+    return element.value.trim().split('\n').filter(line => line.trim()).map(line => {
+        const [offset, price] = line.split(/[:：]/);
+        return { offset: parseInt(offset), price: parseFloat(price) };
+    });
+}
+
+// 价格曲线的中文说明
+function decayCurveText(auction) {
+    switch (auction.decayCurve) {
+        case 'exponential':
+            return `指数，每 ${auction.decrementInterval} 秒降低 ${auction.decayRate}%`;
+        case 'accelerating':
+            return `加速，降幅每次增加 ${auction.decayRate}%`;
+        case 'stepwise':
+            return (auction.decaySteps || []).map(step => `${step.offset}秒 ¥${step.price.toFixed(2)}`).join(' → ');
+        default:
+            return '线性';
+    }
+}
+
 // 创建拍卖卡片
 function createAuctionCard(auction) {
     const card = document.createElement('div');
@@ -635,60 +868,58 @@ function createAuctionCard(auction) {
 
     const statusClass = auction.status === 'active' ? 'bg-green-100 text-green-800' :
         auction.status === 'pending' ? 'bg-yellow-100 text-yellow-800' :
+        auction.status === 'paused' ? 'bg-orange-100 text-orange-800' :
             'bg-gray-100 text-gray-800';
 
     const statusText = auction.status === 'active' ? '进行中' :
         auction.status === 'pending' ? '待开始' :
+        auction.status === 'paused' ? '已暂停' :
             auction.status === 'completed' ? '已完成' : '已取消';
 
-    // 为每个拍卖卡片创建唯一的canvas ID
+    // 为每个拍卖卡片创建唯一的canvas ID，英式拍卖和密封拍卖没有钟面
     const canvasId = `dutch-clock-canvas-${auction.id}`;
+    const isTimed = isTimedAuction(auction);
 
     card.innerHTML = `
         <div class="p-4">
             <div class="flex justify-between items-start mb-2">
-                <h3 class="text-lg font-semibold">${auction.itemType === 'apple' ? '苹果' : '木材'}</h3>
+                <h3 class="text-lg font-semibold">${escapeItemName(auction.itemType)} <span class="text-xs text-gray-500">${auctionTypeText(auction)}</span></h3>
                 <span class="px-2 py-1 text-xs rounded-full ${statusClass}">${statusText}</span>
             </div>
+            ${isTimed ? '' : `
             <!-- 荷兰钟可视化区域 -->
             <div class="mb-4 flex flex-col items-center">
                 <span class="mb-2">荷兰钟可视化</span>
                 <div class="bg-gray-50 rounded-lg p-2">
                     <canvas id="${canvasId}" width="200" height="200" class="border border-gray-300 rounded-lg shadow-inner"></canvas>
                 </div>
-            </div>
+            </div>`}
             <div class="space-y-2">
                 <div class="flex justify-between">
-                    <span class="text-gray-600">数量:</span>
-                    <span class="font-medium">${auction.quantity}</span>
+                    <span class="text-gray-600">剩余/数量:</span>
+                    <span class="font-medium">${auction.remainingQuantity} / ${auction.quantity}</span>
                 </div>
                 <div class="flex justify-between">
-                    <span class="text-gray-600">当前价格:</span>
+                    <span class="text-gray-600">${auctionPriceLabel(auction)}:</span>
                     <span class="price-countdown font-bold text-lg text-indigo-600">¥ ${(auction.currentPrice || 0).toFixed(2)}</span>
                 </div>
-                <div class="flex justify-between">
-                    <span class="text-gray-600">最低价格:</span>
-                    <span class="font-medium">¥ ${(auction.minPrice || 0).toFixed(2)}</span>
-                </div>
-                <div class="flex justify-between">
-                    <span class="text-gray-600">递减价格:</span>
-                    <span class="font-medium">¥ ${(auction.priceDecrement || 0).toFixed(2)}</span>
-                </div>
-                <div class="flex justify-between">
-                    <span class="text-gray-600">递减间隔:</span>
-                    <span class="font-medium">${auction.decrementInterval}秒</span>
-                </div>
+                ${auctionRuleRows(auction)}
+                ${auctionScheduleRows(auction)}
             </div>
             <div class="mt-4 flex space-x-2">
                 ${auction.status === 'active' ?
             `<button class="bid-button flex-1 bg-indigo-600 text-white py-2 px-4 rounded-md hover:bg-indigo-700 transition" 
-                            onclick="openAuctionBidModal(${auction.id}, '${auction.itemType}', ${auction.currentPrice}, ${auction.minPrice}, ${auction.quantity})">
+                            onclick="${auctionBidOnclick(auction)}">
                         竞价
                     </button>` : ''}
                 ${auction.status === 'pending' ?
             `<div class="flex-1 text-center text-gray-500 py-2">
                         拍卖尚未开始
                     </div>` : ''}
+                ${auction.status === 'paused' ?
+            `<div class="flex-1 text-center text-gray-500 py-2">
+                        拍卖已暂停
+                    </div>` : ''}
                 ${auction.status === 'completed' || auction.status === 'cancelled' ?
             `<div class="flex-1 text-center text-gray-500 py-2">
                         拍卖已结束
@@ -697,6 +928,10 @@ function createAuctionCard(auction) {
         </div>
     `;
 
+    if (isTimed) {
+        return card;
+    }
+
     // 在卡片添加到DOM后初始化荷兰钟可视化
     setTimeout(() => {
         try {
@@ -757,12 +992,18 @@ async function createAuction() {
         return;
     }
 
+    const auctionType = document.getElementById('auctionType').value;
     const itemType = itemTypeElement.value;
     const startPrice = parseInt(startPriceElement.value);
     const minPrice = parseInt(minPriceElement.value);
+    const reservePriceElement = document.getElementById('reservePrice');
+    const reservePrice = reservePriceElement && reservePriceElement.value ? parseFloat(reservePriceElement.value) : 0;
     const quantity = parseInt(quantityElement.value);
     const priceDecrementInterval = parseInt(priceDecrementIntervalElement.value);
     const priceDecrementAmount = parseInt(priceDecrementAmountElement.value);
+    const minIncrement = parseFloat(document.getElementById('minIncrement').value);
+    const duration = parseInt(document.getElementById('auctionDuration').value);
+    const extensionSeconds = parseInt(document.getElementById('extensionSeconds').value) || 0;
 
     try {
         const response = await fetch('/api/auction/create', {
@@ -771,12 +1012,22 @@ async function createAuction() {
                 'Content-Type': 'application/json'
             },
             body: JSON.stringify({
+                auctionType: auctionType,
                 itemType: itemType,
                 initialPrice: startPrice,
                 minPrice: minPrice,
+                reservePrice: reservePrice,
                 quantity: quantity,
                 decrementInterval: priceDecrementInterval,
-                priceDecrement: priceDecrementAmount
+                priceDecrement: priceDecrementAmount,
+                minIncrement: minIncrement,
+                decayCurve: document.getElementById('decayCurve').value,
+                decayRate: parseFloat(document.getElementById('decayRate').value) || 0,
+                decaySteps: parseDecaySteps(),
+                duration: duration,
+                extensionSeconds: extensionSeconds,
+                scheduled_start: scheduledTimeValue('scheduledStart'),
+                scheduled_end: scheduledTimeValue('scheduledEnd')
             })
         });
 
@@ -787,6 +1038,7 @@ async function createAuction() {
             const createAuctionForm = document.getElementById('createAuctionForm');
             if (createAuctionForm) {
                 createAuctionForm.reset();
+                toggleAuctionTypeFields();
             }
             loadAuctions();
             loadSellerAuctions();
@@ -921,13 +1173,15 @@ async function cancelAuction(auctionId) {
 }
 
 // 打开竞价模态框
-function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, quantity) {
+function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, remainingQuantity, auctionType, minIncrement, hasBids) {
+    const isSealed = isSealedAuction({ auctionType: auctionType });
     const bidModal = document.getElementById('bidModal');
     const bidInfo = document.getElementById('bidInfo');
     const bidAmount = document.getElementById('bidAmount');
+    const bidQuantity = document.getElementById('bidQuantity');
 
     // 检查元素是否存在
-    if (!bidModal || !bidInfo || !bidAmount) {
+    if (!bidModal || !bidInfo || !bidAmount || !bidQuantity) {
         console.error('竞价模态框元素未找到');
         return;
     }
@@ -936,26 +1190,51 @@ function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, quanti
         <div class="space-y-2">
             <div class="flex justify-between">
                 <span class="text-gray-600">物品:</span>
-                <span class="font-medium">${itemType === 'apple' ? '苹果' : '木材'}</span>
+                <span class="font-medium">${escapeItemName(itemType)}</span>
             </div>
             <div class="flex justify-between">
-                <span class="text-gray-600">数量:</span>
-                <span class="font-medium">${quantity}</span>
+                <span class="text-gray-600">剩余数量:</span>
+                <span class="font-medium">${remainingQuantity}</span>
             </div>
             <div class="flex justify-between">
-                <span class="text-gray-600">当前价格:</span>
+                <span class="text-gray-600">${auctionPriceLabel({ auctionType: auctionType, status: 'active' })}:</span>
                 <span class="font-bold text-indigo-600">¥ ${(currentPrice || 0).toFixed(2)}</span>
             </div>
+            ${isSealed ? `
+            <div class="text-sm text-gray-500">出价不公开，每人只能出价一次，开标前资金冻结</div>` : auctionType === 'english' ? `
+            <div class="flex justify-between">
+                <span class="text-gray-600">最低加价:</span>
+                <span class="font-medium">¥ ${(minIncrement || 0).toFixed(2)}</span>
+            </div>` : `
             <div class="flex justify-between">
                 <span class="text-gray-600">最低价格:</span>
                 <span class="font-medium">¥ ${(minPrice || 0).toFixed(2)}</span>
-            </div>
+            </div>`}
         </div>
     `;
 
-    bidAmount.min = minPrice;
-    bidAmount.max = currentPrice;
-    bidAmount.value = currentPrice;
+    const bidQuantityField = document.getElementById('bidQuantityField');
+    if (auctionType === 'english' || isSealed) {
+        // 英式拍卖和密封拍卖整批竞拍，出价至少为起拍价，英式拍卖已有出价时至少比最高出价高一个最低加价
+        const minimumBid = auctionType === 'english' && hasBids ? Math.round((currentPrice + minIncrement) * 100) / 100 : currentPrice;
+        bidAmount.min = minimumBid;
+        bidAmount.value = minimumBid;
+        bidQuantity.value = remainingQuantity;
+        if (bidQuantityField) {
+            bidQuantityField.classList.add('hidden');
+        }
+    } else {
+        // 竞价金额是愿意支付的最高单价，按成交时的钟面价格结算
+        bidAmount.min = currentPrice;
+        bidAmount.value = currentPrice;
+        bidQuantity.min = 1;
+        bidQuantity.max = remainingQuantity;
+        bidQuantity.value = remainingQuantity;
+        if (bidQuantityField) {
+            bidQuantityField.classList.remove('hidden');
+        }
+    }
+    bidAmount.removeAttribute('max');
 
     bidModal.dataset.auctionId = auctionId;
     bidModal.classList.remove('hidden');
@@ -972,7 +1251,8 @@ async function handleAuctionBid() {
     }
 
     const auctionId = parseInt(bidModal.dataset.auctionId);
-    const bidAmount = parseInt(document.getElementById('bidAmount').value);
+    const bidAmount = parseFloat(document.getElementById('bidAmount').value);
+    const bidQuantity = parseInt(document.getElementById('bidQuantity').value);
 
     try {
         const response = await fetch('/api/auction/bid', {
@@ -982,14 +1262,15 @@ async function handleAuctionBid() {
             },
             body: JSON.stringify({
                 auction_id: auctionId,
-                bid_amount: bidAmount
+                bid_amount: bidAmount,
+                quantity: bidQuantity
             })
         });
 
         const data = await response.json();
 
         if (data.success) {
-            showNotification('竞价成功');
+            showNotification(data.message || '竞价成功');
             bidModal.classList.add('hidden');
 
             // 清除可视化递减价格计时器
@@ -1034,6 +1315,10 @@ function startAuctionPriceDecrementTimer(auction) {
 
 // 计算剩余时间
 function calculateAuctionRemainingSeconds(auction) {
+    // 非线性曲线按服务器给出的降到最低价的时刻计算
+    if (auction.decayCurve && auction.decayCurve !== 'linear' && auction.endTime) {
+        return Math.max(0, Math.ceil((new Date(auction.endTime) - Date.now()) / 1000));
+    }
     const currentPriceOffset = (auction.currentPrice || 0) - (auction.minPrice || 0);
     const remainingDecrementSteps = Math.ceil(currentPriceOffset / (auction.priceDecrement || 1));
     return remainingDecrementSteps * (auction.decrementInterval || 1);
@@ -1193,12 +1478,18 @@ async function loadAuctions() {
 
 // 创建拍卖
 async function createAuction() {
+    const auctionType = document.getElementById('auctionType').value;
     const itemType = document.getElementById('itemType').value;
     const startPrice = parseInt(document.getElementById('startPrice').value);
     const minPrice = parseInt(document.getElementById('minPrice').value);
+    const reservePriceValue = document.getElementById('reservePrice').value;
+    const reservePrice = reservePriceValue ? parseFloat(reservePriceValue) : 0;
     const quantity = parseInt(document.getElementById('quantity').value);
     const priceDecrementInterval = parseInt(document.getElementById('priceDecrementInterval').value);
     const priceDecrementAmount = parseInt(document.getElementById('priceDecrementAmount').value);
+    const minIncrement = parseFloat(document.getElementById('minIncrement').value);
+    const duration = parseInt(document.getElementById('auctionDuration').value);
+    const extensionSeconds = parseInt(document.getElementById('extensionSeconds').value) || 0;
 
     try {
         const response = await fetch('/api/auction/create', {
@@ -1207,12 +1498,22 @@ async function createAuction() {
                 'Content-Type': 'application/json'
             },
             body: JSON.stringify({
+                auctionType: auctionType,
                 itemType: itemType,
                 initialPrice: startPrice,
                 minPrice: minPrice,
+                reservePrice: reservePrice,
                 quantity: quantity,
                 decrementInterval: priceDecrementInterval,
-                priceDecrement: priceDecrementAmount
+                priceDecrement: priceDecrementAmount,
+                minIncrement: minIncrement,
+                decayCurve: document.getElementById('decayCurve').value,
+                decayRate: parseFloat(document.getElementById('decayRate').value) || 0,
+                decaySteps: parseDecaySteps(),
+                duration: duration,
+                extensionSeconds: extensionSeconds,
+                scheduled_start: scheduledTimeValue('scheduledStart'),
+                scheduled_end: scheduledTimeValue('scheduledEnd')
             })
         });
 
@@ -1221,6 +1522,7 @@ async function createAuction() {
         if (data.success) {
             showNotification('拍卖创建成功');
             document.getElementById('createAuctionForm').reset();
+            toggleAuctionTypeFields();
             loadAuctions();
             loadSellerAuctions();
         } else {
@@ -1262,6 +1564,34 @@ async function pauseAuction(auctionId) {
     }
 }
 
+// 恢复已暂停的拍卖，价格从暂停时继续递减
+async function resumeAuction(auctionId) {
+    try {
+        const response = await fetch('/api/auction/resume', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({
+                auction_id: auctionId
+            })
+        });
+
+        const data = await response.json();
+
+        if (data.success) {
+            showNotification(data.message || '拍卖已恢复');
+            loadAuctions();
+            loadSellerAuctions();
+        } else {
+            showNotification(data.message || '恢复拍卖失败', 'error');
+        }
+    } catch (error) {
+        console.error('恢复拍卖失败:', error);
+        showNotification('恢复拍卖失败', 'error');
+    }
+}
+
 // 开始拍卖
 async function startAuction(auctionId) {
     try {
@@ -1320,13 +1650,15 @@ async function cancelAuction(auctionId) {
 }
 
 // 打开竞价模态框
-function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, quantity) {
+function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, remainingQuantity, auctionType, minIncrement, hasBids) {
+    const isSealed = isSealedAuction({ auctionType: auctionType });
     const bidModal = document.getElementById('bidModal');
     const bidInfo = document.getElementById('bidInfo');
     const bidAmount = document.getElementById('bidAmount');
+    const bidQuantity = document.getElementById('bidQuantity');
 
     // 检查元素是否存在
-    if (!bidModal || !bidInfo || !bidAmount) {
+    if (!bidModal || !bidInfo || !bidAmount || !bidQuantity) {
         console.error('竞价模态框元素未找到');
         return;
     }
@@ -1335,26 +1667,51 @@ function openAuctionBidModal(auctionId, itemType, currentPrice, minPrice, quanti
         <div class="space-y-2">
             <div class="flex justify-between">
                 <span class="text-gray-600">物品:</span>
-                <span class="font-medium">${itemType === 'apple' ? '苹果' : '木材'}</span>
+                <span class="font-medium">${escapeItemName(itemType)}</span>
             </div>
             <div class="flex justify-between">
-                <span class="text-gray-600">数量:</span>
-                <span class="font-medium">${quantity}</span>
+                <span class="text-gray-600">剩余数量:</span>
+                <span class="font-medium">${remainingQuantity}</span>
             </div>
             <div class="flex justify-between">
-                <span class="text-gray-600">当前价格:</span>
+                <span class="text-gray-600">${auctionPriceLabel({ auctionType: auctionType, status: 'active' })}:</span>
                 <span class="font-bold text-indigo-600">¥ ${(currentPrice || 0).toFixed(2)}</span>
             </div>
+            ${isSealed ? `
+            <div class="text-sm text-gray-500">出价不公开，每人只能出价一次，开标前资金冻结</div>` : auctionType === 'english' ? `
+            <div class="flex justify-between">
+                <span class="text-gray-600">最低加价:</span>
+                <span class="font-medium">¥ ${(minIncrement || 0).toFixed(2)}</span>
+            </div>` : `
             <div class="flex justify-between">
                 <span class="text-gray-600">最低价格:</span>
                 <span class="font-medium">¥ ${(minPrice || 0).toFixed(2)}</span>
-            </div>
+            </div>`}
         </div>
     `;
 
-    bidAmount.min = minPrice;
-    bidAmount.max = currentPrice;
-    bidAmount.value = currentPrice;
+    const bidQuantityField = document.getElementById('bidQuantityField');
+    if (auctionType === 'english' || isSealed) {
+        // 英式拍卖和密封拍卖整批竞拍，出价至少为起拍价，英式拍卖已有出价时至少比最高出价高一个最低加价
+        const minimumBid = auctionType === 'english' && hasBids ? Math.round((currentPrice + minIncrement) * 100) / 100 : currentPrice;
+        bidAmount.min = minimumBid;
+        bidAmount.value = minimumBid;
+        bidQuantity.value = remainingQuantity;
+        if (bidQuantityField) {
+            bidQuantityField.classList.add('hidden');
+        }
+    } else {
+        // 竞价金额是愿意支付的最高单价，按成交时的钟面价格结算
+        bidAmount.min = currentPrice;
+        bidAmount.value = currentPrice;
+        bidQuantity.min = 1;
+        bidQuantity.max = remainingQuantity;
+        bidQuantity.value = remainingQuantity;
+        if (bidQuantityField) {
+            bidQuantityField.classList.remove('hidden');
+        }
+    }
+    bidAmount.removeAttribute('max');
 
     bidModal.dataset.auctionId = auctionId;
     bidModal.classList.remove('hidden');
@@ -1535,3 +1892,43 @@ function validateAuctionTimeRemaining(auction, timeRemaining) {
 
     return true;
 }
+
+// 加载物品目录，填充创建拍卖的物品选择框
+async function loadItemCatalog() {
+    try {
+        const response = await fetch('/api/market/catalog');
+        const data = await response.json();
+        if (!response.ok || !data.success) {
+            console.error('加载物品目录失败:', data.message);
+            return;
+        }
+        itemCatalog = data.items || [];
+
+        const itemTypeSelect = document.getElementById('itemType');
+        if (itemTypeSelect) {
+            itemTypeSelect.innerHTML = '';
+            itemCatalog.forEach(item => {
+                const option = document.createElement('option');
+                option.value = item.code;
+                option.textContent = itemDisplayName(item.code);
+                itemTypeSelect.appendChild(option);
+            });
+        }
+    } catch (error) {
+        console.error('加载物品目录失败:', error);
+    }
+}
+
+// 物品的中文名称，目录中没有的物品显示物品代码
+function itemDisplayName(itemCode) {
+    const item = itemCatalog.find(entry => entry.code === itemCode);
+    if (!item || !item.names) return itemCode;
+    return item.names.zh || item.names.en || itemCode;
+}
+
+// 转义后的物品名称，用于拼接到页面中
+function escapeItemName(itemCode) {
+    const div = document.createElement('div');
+    div.textContent = itemDisplayName(itemCode);
+    return div.innerHTML;
+}
@@ -16,6 +16,8 @@ class AuctionWebSocketManager {
         this.connectionCheckIntervalTime = 60000; // 60秒检查一次连接健康状态
         this.messageHandlers = new Map();
         this.connectionCallbacks = [];
+        this.gapCallbacks = [];
+        this.lastSeq = 0; // 最近收到的广播通知序号，用于去重和发现丢失的通知
         this.isPageVisible = true;
         this.manualDisconnect = false;
         this.connectionInitDelay = 1000; // 延迟1秒初始化连接
@@ -55,7 +57,9 @@ class AuctionWebSocketManager {
     _doConnect() {
         // 确定WebSocket协议
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/ws/auction`;
+        // 重连时带上最近收到的通知序号，服务器先补发断线期间的通知
+        const since = this.lastSeq > 0 ? `?since=${this.lastSeq}` : '';
+        const wsUrl = `${protocol}//${window.location.host}/ws/auction${since}`;
 
         console.log(`正在连接到WebSocket服务器: ${wsUrl}`);
         
@@ -162,6 +166,13 @@ class AuctionWebSocketManager {
         this.connectionCallbacks.push(callback);
     }
 
+    /**
+     * 添加通知丢失回调，收到的广播通知序号不连续或重连后无法补发时调用
+     */
+    onGap(callback) {
+        this.gapCallbacks.push(callback);
+    }
+
     /**
      * 移除连接状态变化回调
      */
@@ -199,7 +210,7 @@ class AuctionWebSocketManager {
             // 记录接收开始时间
             const receiveStartTime = performance.now();
             
-            const message = JSON.parse(event.data);
+            const message = parseMoneyJSON(event.data);
             console.log('收到WebSocket消息:', message);
             
             // 计算并记录接收时间差（仅包含JSON解析时间）
@@ -230,6 +241,30 @@ class AuctionWebSocketManager {
                 return;
             }
 
+            // 重连补发的结果，断线太久无法补发时按通知丢失处理
+            if (message.type === 'resume') {
+                if (!message.data.complete) {
+                    console.warn(`无法从序号 ${message.data.since} 补发通知`);
+                    this._notifyGap(message.data.since, this.lastSeq);
+                }
+                return;
+            }
+
+            // 广播通知按序号去重，序号不连续说明中间有通知丢失
+            if (message.seq) {
+                if (message.seq <= this.lastSeq) {
+                    console.log(`忽略重复的通知: 序号 ${message.seq}`);
+                    return;
+                }
+                const missed = this.lastSeq > 0 && message.seq > this.lastSeq + 1;
+                const lastSeq = this.lastSeq;
+                this.lastSeq = message.seq;
+                if (missed) {
+                    console.warn(`通知序号不连续: ${lastSeq} -> ${message.seq}`);
+                    this._notifyGap(lastSeq, message.seq);
+                }
+            }
+
             // 调用注册的消息处理器
             if (this.messageHandlers.has(message.type)) {
                 const handlers = this.messageHandlers.get(message.type);
@@ -246,6 +281,19 @@ class AuctionWebSocketManager {
         }
     }
 
+    /**
+     * 通知丢失回调
+     */
+    _notifyGap(fromSeq, toSeq) {
+        this.gapCallbacks.forEach(callback => {
+            try {
+                callback(fromSeq, toSeq);
+            } catch (error) {
+                console.error('处理通知丢失回调时出错:', error);
+            }
+        });
+    }
+
     /**
      * WebSocket连接关闭事件处理
      */
@@ -0,0 +1,62 @@
+/**
+ * 登录认证 - 会话过期时跳转登录页，并在页眉提供退出登录按钮
+ */
+(function() {
+    const loginPage = '/html/login.html';
+
+    // 跳转到登录页，登录后返回当前页面
+    function redirectToLogin() {
+        const redirect = encodeURIComponent(window.location.pathname + window.location.search);
+        window.location.href = `${loginPage}?redirect=${redirect}`;
+    }
+
+    // 包装 fetch，接口返回 401 时跳转登录页
+    const originalFetch = window.fetch.bind(window);
+    window.fetch = async function(input, init) {
+        const response = await originalFetch(input, init);
+        const url = typeof input === 'string' ? input : input.url;
+        if (response.status === 401 && !url.startsWith('/api/auth/')) {
+            redirectToLogin();
+        }
+        return response;
+    };
+
+    // 退出登录
+    async function logout() {
+        try {
+            await originalFetch('/api/auth/logout', { method: 'POST' });
+        } catch (error) {
+            console.error('退出登录失败:', error);
+        }
+        window.location.href = loginPage;
+    }
+
+    // 在页眉导航中加入当前玩家和退出按钮
+    document.addEventListener('DOMContentLoaded', async function() {
+        const nav = document.querySelector('header .container > div:last-child');
+        if (!nav) {
+            return;
+        }
+
+        const logoutLink = document.createElement('a');
+        logoutLink.href = '#';
+        logoutLink.className = 'bg-white hover:bg-gray-300 p-2 rounded-full transition-colors duration-200';
+        logoutLink.title = '退出登录';
+        logoutLink.innerHTML = '<i class="fa fa-sign-out text-gray-600"></i><span class="ml-1 hidden sm:inline" id="currentUserName">退出</span>';
+        logoutLink.addEventListener('click', function(event) {
+            event.preventDefault();
+            logout();
+        });
+        nav.appendChild(logoutLink);
+
+        try {
+            const response = await fetch('/api/user/current');
+            const data = await response.json();
+            if (data.success && data.user) {
+                document.getElementById('currentUserName').textContent = `${data.user.nickname || data.user.username} 退出`;
+            }
+        } catch (error) {
+            console.error('获取当前玩家失败:', error);
+        }
+    });
+})();
@@ -0,0 +1,68 @@
+/**
+ * 登录 - 玩家登录与注册前端脚本
+ */
+document.addEventListener('DOMContentLoaded', function() {
+    const loginTab = document.getElementById('loginTab');
+    const registerTab = document.getElementById('registerTab');
+    const nicknameField = document.getElementById('nicknameField');
+    const submitBtn = document.getElementById('submitBtn');
+    const authForm = document.getElementById('authForm');
+    const authMessage = document.getElementById('authMessage');
+    let mode = 'login';
+
+    // 切换登录/注册模式
+    function switchMode(newMode) {
+        mode = newMode;
+        const isLogin = mode === 'login';
+        loginTab.className = isLogin ? 'flex-1 py-2 text-primary border-b-2 border-primary font-semibold' : 'flex-1 py-2 text-gray-500';
+        registerTab.className = isLogin ? 'flex-1 py-2 text-gray-500' : 'flex-1 py-2 text-primary border-b-2 border-primary font-semibold';
+        nicknameField.classList.toggle('hidden', isLogin);
+        submitBtn.textContent = isLogin ? '登录' : '注册';
+        authMessage.classList.add('hidden');
+    }
+
+    loginTab.addEventListener('click', () => switchMode('login'));
+    registerTab.addEventListener('click', () => switchMode('register'));
+
+    // 登录成功后跳转回原页面
+    function redirectBack() {
+        const redirect = new URLSearchParams(window.location.search).get('redirect');
+        // 只允许站内跳转
+        if (redirect && redirect.startsWith('/') && !redirect.startsWith('//')) {
+            window.location.href = redirect;
+        } else {
+            window.location.href = '/html/index.html';
+        }
+    }
+
+    authForm.addEventListener('submit', async function(event) {
+        event.preventDefault();
+        authMessage.classList.add('hidden');
+
+        const payload = {
+            username: document.getElementById('username').value.trim(),
+            password: document.getElementById('password').value
+        };
+        if (mode === 'register') {
+            payload.nickname = document.getElementById('nickname').value.trim();
+        }
+
+        try {
+            const response = await fetch(mode === 'login' ? '/api/auth/login' : '/api/auth/register', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(payload)
+            });
+            const data = await response.json();
+            if (data.success) {
+                redirectBack();
+                return;
+            }
+            authMessage.textContent = data.message || '操作失败';
+        } catch (error) {
+            console.error('登录请求失败:', error);
+            authMessage.textContent = '网络错误，请稍后重试';
+        }
+        authMessage.classList.remove('hidden');
+    });
+});
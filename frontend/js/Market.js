@@ -3,45 +3,61 @@
  */
 // 全局变量
 let marketParams = {
+    priceModel: 'linear', // 定价模型
     balanceRange: 1,      // 平衡区间系数
     priceFluctuation: 1,  // 价格波动系数
-    maxPriceChange: 1     // 最大价格变动系数
+    maxPriceChange: 1,    // 最大价格变动系数
+    liquidity: 10,        // 流动性参数
+    smoothing: 0.3,       // 平滑系数
+    minPriceRatio: 0.5,   // 价格下限比例
+    maxPriceRatio: 2      // 价格上限比例
 };
 
+// 单独设置了市场参数的物品，key 为物品代码
+let itemMarketParams = {};
+
+// 物品目录，物品的制作、背包和货架卡片都按目录生成
+let catalog = [];
+
+// 制作中的任务
+let craftingJobs = [];
+
+// 制作任务倒计时定时器
+let craftingTimer = null;
+
+// 背包中各物品的数量，key 为物品代码
 let backpack = {
-    apple: 0,
-    wood: 0
+    items: {}
 };
 
-let marketItems = {
-    apple: {
-        price: 1.0,
-        stock: 0,
-        basePrice: 1.0
-    },
-    wood: {
-        price: 5.0,
-        stock: 0,
-        basePrice: 5.0
-    }
-};
+// 市场货架，key 为物品代码
+let marketItems = {};
+
+// 订单簿当前显示的物品代码
+let orderBookItem = '';
+
+// 订单簿当前显示的最近成交，最新的在前
+let orderBookTrades = [];
 
 // 当页面加载完成时执行
 document.addEventListener('DOMContentLoaded', function() {
     // 加载市场参数
     loadMarketParams();
     
-    // 加载背包状态
-    loadBackpack();
+    // 只有管理员可以保存市场参数
+    checkParamsPermission();
     
-    // 加载市场货架
-    loadMarketItems();
+    // 加载物品目录，随后加载背包状态和市场货架
+    loadCatalog();
     
     // 加载现金余额
     loadBalance();
     
     // 绑定事件监听器
     bindEventListeners();
+    
+    // 订阅订单簿推送
+    setupOrderBookWebSocket();
 });
 
 // 绑定事件监听器
@@ -52,47 +68,66 @@ function bindEventListeners() {
         saveMarketParamsBtn.addEventListener('click', saveMarketParams);
     }
     
-    // 制作苹果按钮
-    const makeAppleBtn = document.getElementById('makeApple');
-    if (makeAppleBtn) {
-        makeAppleBtn.addEventListener('click', makeApple);
-    }
-    
-    // 制作木材按钮
-    const makeWoodBtn = document.getElementById('makeWood');
-    if (makeWoodBtn) {
-        makeWoodBtn.addEventListener('click', makeWood);
-    }
-    
-    // 卖出苹果按钮
-    const sellAppleBtn = document.getElementById('sellApple');
-    if (sellAppleBtn) {
-        sellAppleBtn.addEventListener('click', () => sellItem('apple'));
+    // 切换适用物品时显示该物品的市场参数
+    const paramsItemSelect = document.getElementById('paramsItem');
+    if (paramsItemSelect) {
+        paramsItemSelect.addEventListener('change', showMarketParams);
     }
     
-    // 卖出木材按钮
-    const sellWoodBtn = document.getElementById('sellWood');
-    if (sellWoodBtn) {
-        sellWoodBtn.addEventListener('click', () => sellItem('wood'));
-    }
-    
-    // 买入苹果按钮
-    const buyAppleBtn = document.getElementById('buyApple');
-    if (buyAppleBtn) {
-        buyAppleBtn.addEventListener('click', () => buyItem('apple'));
-    }
-    
-    // 买入木材按钮
-    const buyWoodBtn = document.getElementById('buyWood');
-    if (buyWoodBtn) {
-        buyWoodBtn.addEventListener('click', () => buyItem('wood'));
-    }
+    // 制作、卖出、买入按钮由目录动态生成，通过 data-action 和 data-item 委托处理
+    document.addEventListener('click', function(event) {
+        const button = event.target.closest('button[data-action]');
+        if (!button) return;
+        
+        const itemCode = button.dataset.item;
+        if (button.dataset.action === 'make') {
+            makeItem(itemCode, actionQuantity(button));
+        } else if (button.dataset.action === 'sell') {
+            sellItem(itemCode, actionQuantity(button));
+        } else if (button.dataset.action === 'buy') {
+            buyItem(itemCode, actionQuantity(button));
+        } else if (button.dataset.action === 'cancel-order') {
+            cancelOrder(Number(button.dataset.order));
+        }
+    });
     
     // 刷新市场按钮
     const refreshMarketBtn = document.getElementById('refreshMarket');
     if (refreshMarketBtn) {
         refreshMarketBtn.addEventListener('click', refreshMarket);
     }
+    
+    // 订单簿物品切换和下单
+    const orderBookItemSelect = document.getElementById('orderBookItem');
+    if (orderBookItemSelect) {
+        orderBookItemSelect.addEventListener('change', function() {
+            orderBookItem = this.value;
+            loadOrderBook();
+        });
+    }
+    const orderTypeSelect = document.getElementById('orderType');
+    if (orderTypeSelect) {
+        orderTypeSelect.addEventListener('change', function() {
+            // 市价单不需要限价
+            document.getElementById('orderPrice').disabled = this.value === 'market';
+        });
+    }
+    const placeOrderBtn = document.getElementById('placeOrder');
+    if (placeOrderBtn) {
+        placeOrderBtn.addEventListener('click', placeOrder);
+    }
+}
+
+// 按钮旁数量输入框中的数量，未填写或无效时为1个
+function actionQuantity(button) {
+    const input = button.parentElement.querySelector('input[data-quantity]');
+    const quantity = input ? parseInt(input.value, 10) : 1;
+    return quantity > 0 ? quantity : 1;
+}
+
+// 数量输入框，放在制作、卖出、买入按钮旁
+function quantityInput() {
+    return `<input type="number" data-quantity min="1" step="1" value="1" class="w-24 px-2 py-1 border border-gray-300 rounded-md focus:outline-none focus:ring-2 focus:ring-primary">`;
 }
 
 // 加载市场参数
@@ -103,15 +138,14 @@ async function loadMarketParams() {
             const data = await response.json();
             if (data.success && data.params) {
                 marketParams = data.params;
+                itemMarketParams = {};
+                (data.itemParams || []).forEach(params => {
+                    itemMarketParams[params.itemCode] = params;
+                });
                 
                 // 更新UI
-                const balanceRangeInput = document.getElementById('balanceRange');
-                const priceFluctuationInput = document.getElementById('priceFluctuation');
-                const maxPriceChangeInput = document.getElementById('maxPriceChange');
-                
-                if (balanceRangeInput) balanceRangeInput.value = marketParams.balanceRange;
-                if (priceFluctuationInput) priceFluctuationInput.value = marketParams.priceFluctuation;
-                if (maxPriceChangeInput) maxPriceChangeInput.value = marketParams.maxPriceChange;
+                renderParamsItems();
+                showMarketParams();
             } else {
                 console.error('Invalid market params data structure:', data);
             }
@@ -121,25 +155,83 @@ async function loadMarketParams() {
     }
 }
 
-// 保存市场参数
+// 显示所选物品适用的市场参数，没有单独设置的物品显示默认参数
+function showMarketParams() {
+    const paramsItemSelect = document.getElementById('paramsItem');
+    const itemCode = paramsItemSelect ? paramsItemSelect.value : '';
+    const params = itemMarketParams[itemCode] || marketParams;
+    
+    const fields = ['priceModel', 'balanceRange', 'priceFluctuation', 'maxPriceChange', 'liquidity', 'smoothing',
+        'minPriceRatio', 'maxPriceRatio'];
+    fields.forEach(field => {
+        const input = document.getElementById(field);
+        if (input && params[field] !== undefined) input.value = params[field];
+    });
+}
+
+// 生成市场参数的物品选项，保留当前选择的物品
+function renderParamsItems() {
+    const select = document.getElementById('paramsItem');
+    if (!select) return;
+    
+    const selected = select.value;
+    select.innerHTML = `
+                        <option value="">全部物品（默认参数）</option>
+                        ${catalog.map(entry => `
+                        <option value="${escapeHtml(entry.code)}">${escapeHtml(itemName(entry.code))}${itemMarketParams[entry.code] ? '（已单独设置）' : ''}</option>`).join('')}`;
+    select.value = catalog.some(entry => entry.code === selected) ? selected : '';
+}
+
+// 不是管理员时禁用保存市场参数按钮
+async function checkParamsPermission() {
+    const saveMarketParamsBtn = document.getElementById('saveMarketParams');
+    if (!saveMarketParamsBtn) return;
+    
+    try {
+        const response = await fetch('/api/user/current');
+        const data = await response.json();
+        if (data.success && data.user && !data.user.is_admin) {
+            saveMarketParamsBtn.disabled = true;
+            saveMarketParamsBtn.title = '只有管理员可以保存市场参数';
+            saveMarketParamsBtn.classList.add('opacity-50', 'cursor-not-allowed');
+        }
+    } catch (error) {
+        console.error('Error checking params permission:', error);
+    }
+}
+
+// 保存市场参数，选择了物品时只保存该物品的参数
 async function saveMarketParams() {
+    const paramsItemSelect = document.getElementById('paramsItem');
+    const priceModelSelect = document.getElementById('priceModel');
     const balanceRangeInput = document.getElementById('balanceRange');
     const priceFluctuationInput = document.getElementById('priceFluctuation');
     const maxPriceChangeInput = document.getElementById('maxPriceChange');
+    const liquidityInput = document.getElementById('liquidity');
+    const smoothingInput = document.getElementById('smoothing');
+    const minPriceRatioInput = document.getElementById('minPriceRatio');
+    const maxPriceRatioInput = document.getElementById('maxPriceRatio');
     
-    if (!balanceRangeInput || !priceFluctuationInput || !maxPriceChangeInput) {
+    if (!paramsItemSelect || !priceModelSelect || !balanceRangeInput || !priceFluctuationInput ||
+        !maxPriceChangeInput || !liquidityInput || !smoothingInput || !minPriceRatioInput || !maxPriceRatioInput) {
         showToast('无法获取参数输入框', 'error');
         return;
     }
     
     const params = {
+        itemCode: paramsItemSelect.value,
+        priceModel: priceModelSelect.value,
         balanceRange: parseFloat(balanceRangeInput.value),
         priceFluctuation: parseFloat(priceFluctuationInput.value),
-        maxPriceChange: parseFloat(maxPriceChangeInput.value)
+        maxPriceChange: parseFloat(maxPriceChangeInput.value),
+        liquidity: parseFloat(liquidityInput.value),
+        smoothing: parseFloat(smoothingInput.value),
+        minPriceRatio: parseFloat(minPriceRatioInput.value),
+        maxPriceRatio: parseFloat(maxPriceRatioInput.value)
     };
     
     try {
-        const response = await fetch('/api/market/params', {
+        const response = await fetch('/api/market/save-params', {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'
@@ -147,11 +239,17 @@ async function saveMarketParams() {
             body: JSON.stringify(params)
         });
         
-        if (response.ok) {
-            marketParams = params;
+        const result = await response.json();
+        if (response.ok && result.success) {
+            if (result.params.itemCode) {
+                itemMarketParams[result.params.itemCode] = result.params;
+                renderParamsItems();
+            } else {
+                marketParams = result.params;
+            }
             showToast('市场参数保存成功', 'success');
         } else {
-            showToast('保存市场参数失败', 'error');
+            showToast(result.message || '保存市场参数失败', 'error');
         }
     } catch (error) {
         console.error('Error saving market params:', error);
@@ -159,6 +257,82 @@ async function saveMarketParams() {
     }
 }
 
+// 加载物品目录
+async function loadCatalog() {
+    try {
+        const response = await fetch('/api/market/catalog');
+        if (response.ok) {
+            const data = await response.json();
+            if (data.success && data.items) {
+                catalog = data.items;
+                renderCraftCards();
+                renderOrderBookItems();
+                renderParamsItems();
+            } else {
+                console.error('Invalid catalog data structure:', data);
+            }
+        }
+    } catch (error) {
+        console.error('Error loading catalog:', error);
+    }
+    
+    // 背包、货架和制作任务按目录显示物品名称
+    loadBackpack();
+    loadMarketItems();
+    loadCraftingJobs();
+    loadOrderBook();
+    loadUserOrders();
+}
+
+// 物品的中文名称，目录中没有的物品显示物品代码
+function itemName(itemCode) {
+    const item = catalog.find(entry => entry.code === itemCode);
+    if (!item || !item.names) return itemCode;
+    return item.names.zh || item.names.en || itemCode;
+}
+
+// 转义插入到页面中的文本
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// 生成园区制作卡片，只显示有配方的物品
+function renderCraftCards() {
+    const container = document.getElementById('craftItems');
+    if (!container) return;
+    
+    const craftable = catalog.filter(item => item.recipe && item.recipe.output > 0);
+    if (craftable.length === 0) {
+        container.innerHTML = '<p class="text-sm text-gray-500">暂无可制作的物品</p>';
+        return;
+    }
+    
+    container.innerHTML = craftable.map(item => {
+        const name = escapeHtml(itemName(item.code));
+        const inputs = (item.recipe.inputs || [])
+            .map(input => `${escapeHtml(itemName(input.item))} x${input.quantity}`)
+            .join('，') || '无';
+        return `
+                <div class="border border-gray-200 rounded-lg p-4">
+                    <h3 class="text-lg font-medium text-gray-800 mb-3">制作${name}</h3>
+                    <div class="space-y-2 mb-4">
+                        <p class="text-sm text-gray-600">消耗原料: <span class="font-medium">${inputs}</span></p>
+                        <p class="text-sm text-gray-600">产出数量: <span class="font-medium">${item.recipe.output}</span></p>
+                        <p class="text-sm text-gray-600">制作费用: <span class="font-medium">${formatCurrency(item.recipe.cost || 0)}</span></p>
+                        <p class="text-sm text-gray-600">制作时长: <span class="font-medium">${item.recipe.duration ? formatSeconds(item.recipe.duration) : '立即完成'}</span></p>
+                    </div>
+                    <div class="flex space-x-2">
+                        ${quantityInput()}
+                        <button data-action="make" data-item="${escapeHtml(item.code)}" class="w-full px-3 py-1 bg-success text-white rounded-md hover:bg-green-600 focus:outline-none focus:ring-2 focus:ring-success focus:ring-offset-2 transition-colors duration-200">
+                            制作${name}
+                        </button>
+                    </div>
+                </div>`;
+    }).join('');
+}
+
 // 加载背包状态
 async function loadBackpack() {
     try {
@@ -167,13 +341,7 @@ async function loadBackpack() {
             const data = await response.json();
             if (data.success && data.backpack) {
                 backpack = data.backpack;
-                
-                // 更新UI
-                const backpackAppleCount = document.getElementById('backpackAppleCount');
-                const backpackWoodCount = document.getElementById('backpackWoodCount');
-                
-                if (backpackAppleCount) backpackAppleCount.textContent = backpack.apple;
-                if (backpackWoodCount) backpackWoodCount.textContent = backpack.wood;
+                updateBackpackUI();
             } else {
                 console.error('Invalid backpack data structure:', data);
             }
@@ -190,13 +358,7 @@ async function loadMarketItems() {
         if (response.ok) {
             const data = await response.json();
             if (data.success && data.items) {
-                // 转换后端返回的数据结构为前端期望的格式
-                marketItems = {
-                    apple: data.items.apple,
-                    wood: data.items.wood
-                };
-                
-                // 更新UI
+                marketItems = data.items;
                 updateMarketUI();
             } else {
                 console.error('Invalid market items data structure:', data);
@@ -207,89 +369,52 @@ async function loadMarketItems() {
     }
 }
 
-// 更新市场UI
-function updateMarketUI() {
-    // 更新苹果信息
-    const applePrice = document.getElementById('applePrice');
-    const appleStock = document.getElementById('appleStock');
-    const appleStockBar = document.getElementById('appleStockBar');
-    const appleMarketStatus = document.getElementById('appleMarketStatus');
-    
-    if (applePrice) applePrice.textContent = (marketItems.apple.price || 0).toFixed(2);
-    if (appleStock) appleStock.textContent = marketItems.apple.stock;
-    
-    // 更新苹果库存条
-    if (appleStockBar) {
-        const stockPercentage = Math.min(100, marketItems.apple.stock * 10); // 假设10个库存为100%
-        appleStockBar.style.width = `${stockPercentage}%`;
-        
-        // 根据库存量设置颜色
-        if (marketItems.apple.stock > 10) {
-            appleStockBar.className = 'bg-danger h-2.5 rounded-full'; // 供过于求，红色
-        } else if (marketItems.apple.stock >= 5) {
-            appleStockBar.className = 'bg-success h-2.5 rounded-full'; // 供需平衡，绿色
-        } else {
-            appleStockBar.className = 'bg-warning h-2.5 rounded-full'; // 供不应求，黄色
-        }
+// 根据库存量判断市场状态
+function marketStatus(stock) {
+    if (stock > 10) {
+        return { status: '供过于求', statusClass: 'text-danger', barClass: 'bg-danger' };
     }
-    
-    // 更新苹果市场状态
-    if (appleMarketStatus) {
-        let status = '供求平衡';
-        let statusClass = 'text-success';
-        
-        if (marketItems.apple.stock > 10) {
-            status = '供过于求';
-            statusClass = 'text-danger';
-        } else if (marketItems.apple.stock < 5 && marketItems.apple.stock > 0) {
-            status = '供不应求';
-            statusClass = 'text-warning';
-        }
-        
-        appleMarketStatus.textContent = status;
-        appleMarketStatus.className = `font-medium ${statusClass}`;
-    }
-    
-    // 更新木材信息
-    const woodPrice = document.getElementById('woodPrice');
-    const woodStock = document.getElementById('woodStock');
-    const woodStockBar = document.getElementById('woodStockBar');
-    const woodMarketStatus = document.getElementById('woodMarketStatus');
-    
-    if (woodPrice) woodPrice.textContent = (marketItems.wood.price || 0).toFixed(2);
-    if (woodStock) woodStock.textContent = marketItems.wood.stock;
-    
-    // 更新木材库存条
-    if (woodStockBar) {
-        const stockPercentage = Math.min(100, marketItems.wood.stock * 10); // 假设10个库存为100%
-        woodStockBar.style.width = `${stockPercentage}%`;
-        
-        // 根据库存量设置颜色
-        if (marketItems.wood.stock > 10) {
-            woodStockBar.className = 'bg-danger h-2.5 rounded-full'; // 供过于求，红色
-        } else if (marketItems.wood.stock >= 5) {
-            woodStockBar.className = 'bg-success h-2.5 rounded-full'; // 供需平衡，绿色
-        } else {
-            woodStockBar.className = 'bg-warning h-2.5 rounded-full'; // 供不应求，黄色
-        }
+    if (stock < 5 && stock > 0) {
+        return { status: '供不应求', statusClass: 'text-warning', barClass: 'bg-warning' };
     }
+    return { status: '供求平衡', statusClass: 'text-success', barClass: stock >= 5 ? 'bg-success' : 'bg-warning' };
+}
+
+// 更新市场UI，按目录顺序生成货架卡片
+function updateMarketUI() {
+    const container = document.getElementById('marketItemCards');
+    if (!container) return;
     
-    // 更新木材市场状态
-    if (woodMarketStatus) {
-        let status = '供求平衡';
-        let statusClass = 'text-success';
-        
-        if (marketItems.wood.stock > 10) {
-            status = '供过于求';
-            statusClass = 'text-danger';
-        } else if (marketItems.wood.stock < 5 && marketItems.wood.stock > 0) {
-            status = '供不应求';
-            statusClass = 'text-warning';
-        }
-        
-        woodMarketStatus.textContent = status;
-        woodMarketStatus.className = `font-medium ${statusClass}`;
-    }
+    container.innerHTML = catalog.filter(entry => marketItems[entry.code]).map(entry => {
+        const item = marketItems[entry.code];
+        const name = escapeHtml(itemName(entry.code));
+        const state = marketStatus(item.stock);
+        const stockPercentage = Math.min(100, item.stock * 10); // 假设10个库存为100%
+        return `
+                <div class="border border-gray-200 rounded-lg p-4">
+                    <div class="flex justify-between items-center mb-2">
+                        <h3 class="text-lg font-medium text-gray-800">${name}</h3>
+                        <div class="text-right">
+                            <div class="text-lg font-bold text-primary">¥ <span>${(item.price || 0).toFixed(2)}</span></div>
+                            <div class="text-sm text-gray-500">库存: <span>${item.stock}</span></div>
+                        </div>
+                    </div>
+                    <div class="flex items-center mb-2">
+                        <div class="w-full bg-gray-200 rounded-full h-2.5">
+                            <div class="${state.barClass} h-2.5 rounded-full" style="width: ${stockPercentage}%"></div>
+                        </div>
+                    </div>
+                    <div class="text-sm text-gray-500 mb-3">
+                        市场状态: <span class="font-medium ${state.statusClass}">${state.status}</span>
+                    </div>
+                    <div class="flex space-x-2">
+                        ${quantityInput()}
+                        <button data-action="buy" data-item="${escapeHtml(entry.code)}" class="w-full px-3 py-1 bg-primary text-white rounded-md hover:bg-blue-600 focus:outline-none focus:ring-2 focus:ring-primary focus:ring-offset-2 transition-colors duration-200">
+                            买入
+                        </button>
+                    </div>
+                </div>`;
+    }).join('');
 }
 
 // 加载现金余额
@@ -324,168 +449,405 @@ async function loadBalance() {
     }
 }
 
-// 制作苹果
-async function makeApple() {
+// 制作 quantity 份物品
+async function makeItem(itemCode, quantity = 1) {
+    const name = itemName(itemCode);
     try {
-        const response = await fetch('/api/market/make-apple', {
-            method: 'POST'
+        const response = await fetch('/api/market/make', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ item_code: itemCode, quantity: quantity })
         });
         
-        if (response.ok) {
-            const result = await response.json();
+        const result = await response.json();
+        if (response.ok && result.success && result.backpack) {
+            // 更新背包，原料已扣除
+            backpack = result.backpack;
+            updateBackpackUI();
+            loadBalance(); // 制作费用已扣除
             
-            if (result.success && result.backpack) {
-                // 更新背包
-                backpack = result.backpack;
-                
-                // 更新UI
-                const backpackAppleCount = document.getElementById('backpackAppleCount');
-                if (backpackAppleCount) backpackAppleCount.textContent = backpack.apple;
-                
-                showToast('制作苹果成功', 'success');
+            if (result.job) {
+                craftingJobs.push(result.job);
+                updateCraftingJobsUI();
+                showToast(`开始制作${name} x${result.job.quantity}，${formatSeconds(secondsUntil(result.job.completes_at))}后完成`, 'success');
             } else {
-                showToast('制作苹果失败', 'error');
+                showToast(`制作${name} x${quantity} 份成功`, 'success');
             }
         } else {
-            showToast('制作苹果失败', 'error');
+            showToast(result.message || `制作${name}失败`, 'error');
         }
     } catch (error) {
-        console.error('Error making apple:', error);
-        showToast('制作苹果失败', 'error');
+        console.error(`Error making ${itemCode}:`, error);
+        showToast(`制作${name}失败`, 'error');
     }
 }
 
-// 制作木材
-async function makeWood() {
+// 加载制作中的任务，已到完成时间的任务由后端放入背包
+async function loadCraftingJobs() {
     try {
-        const response = await fetch('/api/market/make-wood', {
-            method: 'POST'
-        });
-        
+        const response = await fetch('/api/market/jobs');
         if (response.ok) {
-            const result = await response.json();
-            
-            if (result.success && result.backpack) {
-                // 更新背包
-                backpack = result.backpack;
-                
-                // 更新UI
-                const backpackWoodCount = document.getElementById('backpackWoodCount');
-                if (backpackWoodCount) backpackWoodCount.textContent = backpack.wood;
-                
-                showToast('制作木材成功', 'success');
+            const data = await response.json();
+            if (data.success) {
+                craftingJobs = data.jobs || [];
+                updateCraftingJobsUI();
             } else {
-                showToast('制作木材失败', 'error');
+                console.error('Invalid crafting jobs data structure:', data);
             }
-        } else {
-            showToast('制作木材失败', 'error');
         }
     } catch (error) {
-        console.error('Error making wood:', error);
-        showToast('制作木材失败', 'error');
+        console.error('Error loading crafting jobs:', error);
+    }
+}
+
+// 距离指定时间的秒数，已过去时为0
+function secondsUntil(time) {
+    return Math.max(0, Math.ceil((new Date(time) - Date.now()) / 1000));
+}
+
+// 格式化时长（秒）
+function formatSeconds(seconds) {
+    if (seconds < 60) return `${seconds}秒`;
+    const minutes = Math.floor(seconds / 60);
+    const rest = seconds % 60;
+    return rest > 0 ? `${minutes}分${rest}秒` : `${minutes}分钟`;
+}
+
+// 更新制作任务UI，有任务时每秒刷新倒计时，任务到期后重新加载背包和任务
+function updateCraftingJobsUI() {
+    const container = document.getElementById('craftingJobs');
+    if (!container) return;
+    
+    if (craftingJobs.length === 0) {
+        container.innerHTML = '';
+        clearInterval(craftingTimer);
+        craftingTimer = null;
+        return;
+    }
+    
+    container.innerHTML = `
+                <h3 class="text-lg font-medium text-gray-800">制作中</h3>
+                ${craftingJobs.map(job => `
+                <div class="flex justify-between items-center border border-gray-200 rounded-lg px-4 py-2">
+                    <span class="text-sm text-gray-700">${escapeHtml(itemName(job.item_code))} x${job.quantity}</span>
+                    <span class="text-sm font-medium text-primary">${secondsUntil(job.completes_at) > 0 ? `剩余 ${formatSeconds(secondsUntil(job.completes_at))}` : '即将完成'}</span>
+                </div>`).join('')}`;
+    
+    if (!craftingTimer) {
+        craftingTimer = setInterval(() => {
+            if (craftingJobs.some(job => secondsUntil(job.completes_at) === 0)) {
+                // 有任务到期，由后端完成任务后刷新背包
+                craftingJobs = craftingJobs.filter(job => secondsUntil(job.completes_at) > 0);
+                loadBackpack();
+                loadCraftingJobs();
+            }
+            updateCraftingJobsUI();
+        }, 1000);
     }
 }
 
 // 卖出物品
-async function sellItem(itemType) {
+async function sellItem(itemCode, quantity = 1) {
+    await tradeItem('sell', itemCode, '卖出', quantity);
+}
+
+// 买入物品
+async function buyItem(itemCode, quantity = 1) {
+    await tradeItem('buy', itemCode, '买入', quantity);
+}
+
+// 向市场卖出或买入 quantity 个物品，整批沿价格曲线成交，成功后更新背包、货架和余额
+async function tradeItem(action, itemCode, actionName, quantity = 1) {
+    const name = itemName(itemCode);
     try {
-        const response = await fetch(`/api/market/sell-${itemType}`, {
-            method: 'POST'
+        const response = await fetch(`/api/market/${action}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ item_code: itemCode, quantity: quantity })
         });
         
-        if (response.ok) {
-            const result = await response.json();
-            
-            if (result.success) {
-                // 更新背包
-                if (result.backpack) {
-                    backpack = result.backpack;
-                }
-                
-                // 更新市场物品 - 转换后端返回的数据结构为前端期望的格式
-                if (result.marketItems) {
-                    marketItems = {
-                        apple: result.marketItems.apple,
-                        wood: result.marketItems.wood
-                    };
-                }
-                
-                // 更新UI
-                updateBackpackUI();
-                updateMarketUI();
-                loadBalance(); // 更新余额
-                
-                showToast(`卖出${itemType === 'apple' ? '苹果' : '木材'}成功`, 'success');
-            } else {
-                showToast(result.message || `卖出${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
+        const result = await response.json();
+        if (response.ok && result.success) {
+            if (result.backpack) {
+                backpack = result.backpack;
+            }
+            if (result.marketItems) {
+                marketItems = result.marketItems;
             }
+            
+            // 更新UI
+            updateBackpackUI();
+            updateMarketUI();
+            loadBalance(); // 更新余额
+            
+            showToast(`${actionName}${name} x${result.quantity}，平均价格 ${formatCurrency(result.averagePrice)}，当前价格 ${formatCurrency(result.price)}`, 'success');
         } else {
-            const error = await response.json();
-            showToast(error.message || `卖出${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
+            showToast(result.message || `${actionName}${name}失败`, 'error');
         }
     } catch (error) {
-        console.error(`Error selling ${itemType}:`, error);
-        showToast(`卖出${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
+        console.error(`Error ${action} ${itemCode}:`, error);
+        showToast(`${actionName}${name}失败`, 'error');
     }
 }
 
-// 买入物品
-async function buyItem(itemType) {
+// 更新背包UI，按目录顺序显示背包中有的物品
+function updateBackpackUI() {
+    const container = document.getElementById('backpackItems');
+    if (!container) return;
+    
+    const items = backpack.items || {};
+    const owned = catalog.filter(entry => items[entry.code] > 0);
+    if (owned.length === 0) {
+        container.innerHTML = '<p class="text-sm text-gray-500">背包中还没有物品</p>';
+        return;
+    }
+    
+    container.innerHTML = owned.map(entry => `
+                <div class="border border-gray-200 rounded-lg p-4">
+                    <div class="flex justify-between items-center mb-2">
+                        <h3 class="text-lg font-medium text-gray-800">${escapeHtml(itemName(entry.code))}</h3>
+                        <span class="text-lg font-bold text-primary">${items[entry.code]}</span>
+                    </div>
+                    <div class="flex space-x-2">
+                        ${quantityInput()}
+                        <button data-action="sell" data-item="${escapeHtml(entry.code)}" class="w-full px-3 py-1 bg-success text-white rounded-md hover:bg-green-600 focus:outline-none focus:ring-2 focus:ring-success focus:ring-offset-2 transition-colors duration-200">
+                            卖出
+                        </button>
+                    </div>
+                </div>`).join('');
+}
+
+// 生成订单簿的物品选项，保留当前选择的物品
+function renderOrderBookItems() {
+    const select = document.getElementById('orderBookItem');
+    if (!select) return;
+    
+    if (!catalog.some(entry => entry.code === orderBookItem)) {
+        orderBookItem = catalog.length > 0 ? catalog[0].code : '';
+    }
+    select.innerHTML = catalog.map(entry => `
+                    <option value="${escapeHtml(entry.code)}">${escapeHtml(itemName(entry.code))}</option>`).join('');
+    select.value = orderBookItem;
+}
+
+// 通过WebSocket接收订单簿深度、成交和挂单成交通知
+function setupOrderBookWebSocket() {
+    if (!window.wsManager) {
+        console.error('WebSocket管理器未找到');
+        return;
+    }
+    
+    window.wsManager.onMessage('order_book_snapshot', (data) => {
+        if (!data || !data.depth || data.depth.itemCode !== orderBookItem) return;
+        orderBookTrades = data.trades || [];
+        updateOrderBookDepthUI(data.depth);
+        updateOrderBookTradesUI();
+    });
+    
+    window.wsManager.onMessage('order_book_depth', (data) => {
+        if (!data || data.itemCode !== orderBookItem) return;
+        updateOrderBookDepthUI(data);
+    });
+    
+    window.wsManager.onMessage('market_trade', (data) => {
+        if (!data || data.itemCode !== orderBookItem) return;
+        orderBookTrades = [data, ...orderBookTrades].slice(0, 50);
+        updateOrderBookTradesUI();
+    });
+    
+    // 只发送给挂单的玩家：挂单被成交，货款或物品已到账
+    window.wsManager.onMessage('order_update', (data) => {
+        if (!data) return;
+        const filled = data.status === 'filled' ? '全部成交' : `部分成交，剩余 ${data.remaining} 个`;
+        showToast(`${data.side === 'buy' ? '买单' : '卖单'} #${data.id} ${itemName(data.itemCode)} ${filled}`, 'success');
+        loadUserOrders();
+        loadBackpack();
+        loadBalance();
+    });
+    
+    // 通知丢失或重新连接时重新获取订单簿
+    window.wsManager.onGap(() => {
+        loadOrderBook();
+        loadUserOrders();
+    });
+    window.wsManager.onConnectionChange((isConnected) => {
+        if (isConnected && orderBookItem) {
+            window.wsManager.send({ type: 'get_order_book', data: { item_code: orderBookItem } });
+        }
+    });
+}
+
+// 加载当前物品的订单簿深度和最近成交
+async function loadOrderBook() {
+    if (!orderBookItem) return;
     try {
-        const response = await fetch(`/api/market/buy-${itemType}`, {
-            method: 'POST'
+        const response = await fetch('/api/market/orderbook', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ item_code: orderBookItem })
         });
-        
         if (response.ok) {
-            const result = await response.json();
-            
-            if (result.success) {
-                // 更新背包
-                if (result.backpack) {
-                    backpack = result.backpack;
-                }
-                
-                // 更新市场物品 - 转换后端返回的数据结构为前端期望的格式
-                if (result.marketItems) {
-                    marketItems = {
-                        apple: result.marketItems.apple,
-                        wood: result.marketItems.wood
-                    };
-                }
-                
-                // 更新UI
-                updateBackpackUI();
-                updateMarketUI();
-                loadBalance(); // 更新余额
-                
-                showToast(`买入${itemType === 'apple' ? '苹果' : '木材'}成功`, 'success');
+            const data = await response.json();
+            if (data.success && data.depth) {
+                orderBookTrades = data.trades || [];
+                updateOrderBookDepthUI(data.depth);
+                updateOrderBookTradesUI();
             } else {
-                showToast(result.message || `买入${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
+                console.error('Invalid order book data structure:', data);
             }
-        } else {
-            const error = await response.json();
-            showToast(error.message || `买入${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
         }
     } catch (error) {
-        console.error(`Error buying ${itemType}:`, error);
-        showToast(`买入${itemType === 'apple' ? '苹果' : '木材'}失败`, 'error');
+        console.error('Error loading order book:', error);
     }
 }
 
-// 更新背包UI
-function updateBackpackUI() {
-    const backpackAppleCount = document.getElementById('backpackAppleCount');
-    const backpackWoodCount = document.getElementById('backpackWoodCount');
+// 加载玩家挂单中的订单
+async function loadUserOrders() {
+    try {
+        const response = await fetch('/api/market/orders');
+        if (response.ok) {
+            const data = await response.json();
+            if (data.success) {
+                updateUserOrdersUI(data.orders || []);
+            } else {
+                console.error('Invalid orders data structure:', data);
+            }
+        }
+    } catch (error) {
+        console.error('Error loading orders:', error);
+    }
+}
+
+// 更新盘口UI，卖盘价格从高到低显示在上方，买盘价格从高到低显示在下方
+function updateOrderBookDepthUI(depth) {
+    const container = document.getElementById('orderBookDepth');
+    if (!container) return;
+    
+    const asks = (depth.asks || []).slice().reverse();
+    const bids = depth.bids || [];
+    const level = (entry, color) => `
+                        <div class="flex justify-between px-2 py-0.5">
+                            <span class="${color} font-medium">${formatCurrency(entry.price)}</span>
+                            <span class="text-gray-700">${entry.quantity}</span>
+                            <span class="text-gray-400">${entry.orders}单</span>
+                        </div>`;
     
-    if (backpackAppleCount) backpackAppleCount.textContent = backpack.apple;
-    if (backpackWoodCount) backpackWoodCount.textContent = backpack.wood;
+    container.innerHTML = `
+                        ${asks.length ? asks.map(entry => level(entry, 'text-danger')).join('') : '<p class="px-2 text-gray-400">暂无卖单</p>'}
+                        <div class="border-t border-gray-200 my-1"></div>
+                        ${bids.length ? bids.map(entry => level(entry, 'text-success')).join('') : '<p class="px-2 text-gray-400">暂无买单</p>'}`;
+}
+
+// 更新最近成交UI
+function updateOrderBookTradesUI() {
+    const container = document.getElementById('orderBookTrades');
+    if (!container) return;
+    
+    if (orderBookTrades.length === 0) {
+        container.innerHTML = '<p class="text-gray-400">暂无成交</p>';
+        return;
+    }
+    container.innerHTML = orderBookTrades.map(trade => `
+                        <div class="flex justify-between">
+                            <span class="${trade.takerSide === 'buy' ? 'text-success' : 'text-danger'} font-medium">${formatCurrency(trade.price)}</span>
+                            <span class="text-gray-700">x${trade.quantity}</span>
+                            <span class="text-gray-400">${formatDateTime(new Date(trade.created_at))}</span>
+                        </div>`).join('');
+}
+
+// 更新我的挂单UI
+function updateUserOrdersUI(orders) {
+    const container = document.getElementById('userOrders');
+    if (!container) return;
+    
+    if (orders.length === 0) {
+        container.innerHTML = '<p class="text-gray-400">没有挂单中的订单</p>';
+        return;
+    }
+    container.innerHTML = orders.map(order => `
+                        <div class="flex justify-between items-center border border-gray-200 rounded-lg px-3 py-2">
+                            <span class="text-gray-700">${order.side === 'buy' ? '买' : '卖'} ${escapeHtml(itemName(order.itemCode))} ${order.remaining}/${order.quantity} @ ${formatCurrency(order.price)}</span>
+                            <button data-action="cancel-order" data-order="${order.id}" class="px-2 py-0.5 bg-gray-200 text-gray-700 rounded-md hover:bg-gray-300 transition-colors duration-200">
+                                撤单
+                            </button>
+                        </div>`).join('');
+}
+
+// 在订单簿下单，成交结果通过返回值和WebSocket推送更新
+async function placeOrder() {
+    if (!orderBookItem) return;
+    
+    const type = document.getElementById('orderType').value;
+    const order = {
+        item_code: orderBookItem,
+        side: document.getElementById('orderSide').value,
+        type: type,
+        price: type === 'limit' ? parseFloat(document.getElementById('orderPrice').value) : 0,
+        quantity: parseInt(document.getElementById('orderQuantity').value, 10)
+    };
+    
+    try {
+        const response = await fetch('/api/market/orders/place', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(order)
+        });
+        
+        const result = await response.json();
+        if (response.ok && result.success) {
+            showToast(result.message, 'success');
+            loadOrderBook();
+            loadUserOrders();
+            loadBackpack();
+            loadBalance();
+        } else {
+            showToast(result.message || '下单失败', 'error');
+        }
+    } catch (error) {
+        console.error('Error placing order:', error);
+        showToast('下单失败', 'error');
+    }
+}
+
+// 取消挂单，未成交的资金或物品退还
+async function cancelOrder(orderId) {
+    try {
+        const response = await fetch('/api/market/orders/cancel', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ order_id: orderId })
+        });
+        
+        const result = await response.json();
+        if (response.ok && result.success) {
+            showToast(result.message, 'success');
+            loadOrderBook();
+            loadUserOrders();
+            loadBackpack();
+            loadBalance();
+        } else {
+            showToast(result.message || '撤单失败', 'error');
+        }
+    } catch (error) {
+        console.error('Error cancelling order:', error);
+        showToast('撤单失败', 'error');
+    }
 }
 
 // 刷新市场
 function refreshMarket() {
     loadMarketParams();
-    loadBackpack();
-    loadMarketItems();
+    loadCatalog();
     loadBalance();
     showToast('市场数据已刷新', 'success');
 }
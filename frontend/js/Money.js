@@ -0,0 +1,23 @@
+/**
+ * 金额 - 后端以 {"amount": 12.34, "currency": "CNY"} 返回金额，页面中的金额按以元为单位的数字使用
+ */
+(function() {
+    // JSON解析时把金额对象换成金额数字
+    function moneyReviver(key, value) {
+        if (value !== null && typeof value === 'object' && !Array.isArray(value) &&
+            typeof value.currency === 'string' && 'amount' in value && Object.keys(value).length === 2) {
+            return Number(value.amount);
+        }
+        return value;
+    }
+
+    // 解析包含金额的JSON文本（WebSocket消息等）
+    window.parseMoneyJSON = function(text) {
+        return JSON.parse(text, moneyReviver);
+    };
+
+    // 接口响应的 response.json() 同样换成金额数字
+    Response.prototype.json = async function() {
+        return window.parseMoneyJSON(await this.text());
+    };
+})();
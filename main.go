@@ -1,20 +1,23 @@
 package main
 
 import (
-	"bytes"
 	"database/sql"
 	"embed"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/fs"
 	"net/http"
+	"os"
 	"own-1Pixel/backend/go/cash"
 	"own-1Pixel/backend/go/config"
+	"own-1Pixel/backend/go/events"
 	"own-1Pixel/backend/go/logger"
 	"own-1Pixel/backend/go/market"
+	"own-1Pixel/backend/go/migrate"
 	"own-1Pixel/backend/go/timeservice"
 	"own-1Pixel/backend/go/timeservice/clock"
+	"own-1Pixel/backend/go/user"
+	"path/filepath"
 	"time"
 
 	_ "github.com/tursodatabase/turso-go"
@@ -23,254 +26,270 @@ import (
 //go:embed frontend/*
 var frontendFS embed.FS                       // 静态资源二进制化
 var dbConn *sql.DB                            // 数据库对象
+var storage market.Storage                    // 账本、市场、背包和拍卖的存储后端
+var marketService *market.MarketService       // 市场业务
+var auctionService *market.AuctionService     // 拍卖业务
+var orderBookService *market.OrderBookService // 订单簿业务
 var auctionWSManager *market.AuctionWSManager // 拍卖WebSocket管理器
+var outboxDispatcher *market.OutboxDispatcher // 发件箱投递器
+
+// 注册各模块的数据库迁移
+func registerMigrations() {
+	migrate.Register(user.Migrations()...)
+	migrate.Register(cash.Migrations()...)
+	migrate.Register(market.Migrations()...)
+}
 
 // 初始化数据库
 func initDatabase() error {
-	err := cash.InitDatabase(dbConn)
+	// 执行未完成的数据库迁移
+	count, err := migrate.Up(dbConn)
 	if err != nil {
-		logger.Info("initDatabase", fmt.Sprintf("初始化现金数据库失败 -> %v\n", err))
+		logger.Info("initDatabase", fmt.Sprintf("执行数据库迁移失败 -> %v\n", err))
 		return err
 	}
-
-	// 初始化市场数据库
-	err = market.InitMarketDatabase(dbConn)
-	if err != nil {
-		logger.Info("initDatabase", fmt.Sprintf("初始化市场数据库失败 -> %v\n", err))
-		return err
+	if count > 0 {
+		fmt.Printf("已执行 %d 个数据库迁移\n", count)
 	}
 
-	// 初始化荷兰钟拍卖数据库
-	err = market.InitAuctionDatabase(dbConn)
+	// 为没有密码的玩家生成初始密码
+	err = user.InitMissingPasswords(dbConn)
 	if err != nil {
-		logger.Info("initDatabase", fmt.Sprintf("初始化荷兰钟拍卖数据库失败 -> %v\n", err))
+		logger.Info("initDatabase", fmt.Sprintf("生成玩家初始密码失败 -> %v\n", err))
 		return err
 	}
 
+	// 新玩家创建时初始化余额，背包在玩家第一次获得物品时建立
+	user.RegisterUserInitializer(cash.InitUserAccount)
+
+	// 启动拍卖时钟，恢复进行中的拍卖
+	market.StartAuctionScheduler(storage)
+	market.RecoverActiveAuctions(storage)
+
 	return nil
 }
 
+// 数据库迁移命令: migrate status | migrate up
+func runMigrateCommand(args []string) error {
+	action := "status"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		count, err := migrate.Up(dbConn)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已执行 %d 个数据库迁移\n", count)
+		return nil
+	case "status":
+		statuses, err := migrate.GetStatus(dbConn)
+		if err != nil {
+			return err
+		}
+		pending := 0
+		for _, status := range statuses {
+			mark, appliedAt := "[ ]", "-"
+			if status.Applied {
+				mark, appliedAt = "[x]", status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			fmt.Printf("%s %4d  %-19s  %-8s %s\n", mark, status.Version, appliedAt, status.Package, status.Name)
+		}
+		fmt.Printf("共 %d 个迁移，%d 个未执行\n", len(statuses), pending)
+		return nil
+	default:
+		return fmt.Errorf("未知的迁移命令: %s（可用命令: status, up）", action)
+	}
+}
+
+// 获取发起请求的玩家ID（由认证中间件写入请求上下文）
+func currentUserID(r *http.Request) int {
+	userID, _ := user.UserIDFromContext(r.Context())
+	return userID
+}
+
+// 要求请求已登录
+func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return user.RequireAuth(dbConn, handler)
+}
+
+// 要求请求由管理员发起
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return user.RequireAdmin(dbConn, handler)
+}
+
+// 登录
+func login(w http.ResponseWriter, r *http.Request) {
+	user.Login(dbConn, w, r)
+}
+
+// 退出登录
+func logout(w http.ResponseWriter, r *http.Request) {
+	user.Logout(dbConn, w, r)
+}
+
+// 注册玩家
+func register(w http.ResponseWriter, r *http.Request) {
+	user.Register(dbConn, w, r)
+}
+
+// 获取当前玩家
+func getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user.GetCurrentUser(dbConn, w, r, currentUserID(r))
+}
+
+// 获取玩家列表
+func getUsers(w http.ResponseWriter, r *http.Request) {
+	user.GetUsers(dbConn, w, r)
+}
+
 // 获取当前余额
 func getBalance(w http.ResponseWriter, r *http.Request) {
-	cash.GetBalance(dbConn, w, r)
+	cash.GetBalance(market.LedgerStorage(storage), w, r, currentUserID(r))
 }
 
 // 获取所有交易记录
 func getTransactions(w http.ResponseWriter, r *http.Request) {
-	cash.GetTransactions(dbConn, w, r)
+	cash.GetTransactions(market.LedgerStorage(storage), w, r, currentUserID(r))
 }
 
 // 添加交易记录
 func addTransaction(w http.ResponseWriter, r *http.Request) {
-	cash.AddTransaction(dbConn, w, r)
+	cash.AddTransaction(market.LedgerStorage(storage), w, r, currentUserID(r))
 }
 
 // 获取市场参数
 func getMarketParams(w http.ResponseWriter, r *http.Request) {
-	market.GetMarketParams(dbConn, w, r)
+	market.GetMarketParams(marketService, w, r)
 }
 
 // 保存市场参数
 func saveMarketParams(w http.ResponseWriter, r *http.Request) {
-	market.SaveMarketParams(dbConn, w, r)
+	market.SaveMarketParams(marketService, w, r)
 }
 
 // 获取背包状态
 func getBackpack(w http.ResponseWriter, r *http.Request) {
-	market.GetBackpack(dbConn, w, r)
+	market.GetBackpack(marketService, w, r, currentUserID(r))
 }
 
 // 获取市场物品
 func getMarketItems(w http.ResponseWriter, r *http.Request) {
-	market.GetMarketItems(dbConn, w, r)
+	market.GetMarketItems(marketService, w, r)
+}
+
+// 获取物品目录
+func getCatalog(w http.ResponseWriter, r *http.Request) {
+	market.GetCatalog(marketService, w, r)
+}
+
+// 制作物品
+func makeItem(w http.ResponseWriter, r *http.Request) {
+	market.MakeItem(marketService, w, r, currentUserID(r))
+}
+
+// 获取制作中的任务
+func getCraftingJobs(w http.ResponseWriter, r *http.Request) {
+	market.GetCraftingJobs(marketService, w, r, currentUserID(r))
 }
 
-// 制作苹果
-func makeApple(w http.ResponseWriter, r *http.Request) {
-	market.MakeItem(dbConn, w, r, market.ItemTypeApple)
+// 卖出物品
+func sellItem(w http.ResponseWriter, r *http.Request) {
+	market.SellItem(marketService, w, r, currentUserID(r))
 }
 
-// 制作木材
-func makeWood(w http.ResponseWriter, r *http.Request) {
-	market.MakeItem(dbConn, w, r, market.ItemTypeWood)
+// 买入物品
+func buyItem(w http.ResponseWriter, r *http.Request) {
+	market.BuyItem(marketService, w, r, currentUserID(r))
 }
 
-// 卖出苹果
-func sellApple(w http.ResponseWriter, r *http.Request) {
-	market.SellItem(dbConn, w, r, market.ItemTypeApple)
+// 订单簿下单
+func placeOrder(w http.ResponseWriter, r *http.Request) {
+	market.PlaceOrder(orderBookService, w, r, currentUserID(r))
 }
 
-// 卖出木材
-func sellWood(w http.ResponseWriter, r *http.Request) {
-	market.SellItem(dbConn, w, r, market.ItemTypeWood)
+// 取消订单簿订单
+func cancelOrder(w http.ResponseWriter, r *http.Request) {
+	market.CancelOrder(orderBookService, w, r, currentUserID(r))
 }
 
-// 买入苹果
-func buyApple(w http.ResponseWriter, r *http.Request) {
-	market.BuyItem(dbConn, w, r, market.ItemTypeApple)
+// 获取玩家挂单中的订单
+func getUserOrders(w http.ResponseWriter, r *http.Request) {
+	market.GetUserOrders(orderBookService, w, r, currentUserID(r))
 }
 
-// 买入木材
-func buyWood(w http.ResponseWriter, r *http.Request) {
-	market.BuyItem(dbConn, w, r, market.ItemTypeWood)
+// 获取物品的订单簿
+func getOrderBook(w http.ResponseWriter, r *http.Request) {
+	market.GetOrderBook(orderBookService, w, r)
 }
 
 // 创建荷兰钟拍卖
 func createAuction(w http.ResponseWriter, r *http.Request) {
-	market.CreateAuction(dbConn, w, r)
-
-	// 通过WebSocket广播拍卖列表更新
-	if auctionWSManager != nil {
-		auctions, err := market.GetActiveAuctions(dbConn)
-		if err == nil && len(auctions) > 0 {
-			// 广播最新创建的拍卖
-			auctionWSManager.BroadcastAuctionWSUpdate(&auctions[0], "created")
-		}
-	}
+	market.CreateAuction(auctionService, w, r, currentUserID(r))
 }
 
 // 获取所有荷兰钟拍卖
 func getAuctions(w http.ResponseWriter, r *http.Request) {
-	market.GetAuctions(dbConn, w, r)
+	market.GetAuctions(auctionService, w, r)
 }
 
 // 获取单个荷兰钟拍卖
 func getAuction(w http.ResponseWriter, r *http.Request) {
-	market.GetAuction(dbConn, w, r)
+	market.GetAuction(auctionService, w, r, currentUserID(r))
+}
+
+// 获取拍卖状态变化记录
+func getAuctionHistory(w http.ResponseWriter, r *http.Request) {
+	market.GetAuctionHistory(auctionService, w, r)
 }
 
 // 开始荷兰钟拍卖
 func startAuction(w http.ResponseWriter, r *http.Request) {
-	// 先从请求中获取拍卖ID
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	var auctionID int
-
-	// 尝试解析请求体获取拍卖ID
-	body, err := io.ReadAll(r.Body)
-	if err == nil {
-		if err := json.Unmarshal(body, &data); err == nil {
-			auctionID = data.AuctionID
-		}
-	}
-
-	// 重置请求体，以便market.StartAuction可以读取
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-	// 调用market.StartAuction
-	market.StartAuction(dbConn, w, r)
-
-	// 通过WebSocket广播拍卖更新
-	if auctionWSManager != nil && auctionID > 0 {
-		auction, err := market.GetAuctionID(dbConn, auctionID)
-		if err == nil {
-			auctionWSManager.BroadcastAuctionWSUpdate(auction, "started")
-		}
-	}
+	market.StartAuction(auctionService, w, r, currentUserID(r))
 }
 
 // 提交荷兰钟竞价
 func CommitAuctionBid(w http.ResponseWriter, r *http.Request) {
-	// 先从请求中获取拍卖ID
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	var auctionID int
-
-	// 尝试解析请求体获取拍卖ID
-	body, err := io.ReadAll(r.Body)
-	if err == nil {
-		if err := json.Unmarshal(body, &data); err == nil {
-			auctionID = data.AuctionID
-		}
-	}
-
-	// 重置请求体，以便market.CommitAuctionBid可以读取
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-	// 调用market.CommitAuctionBid
-	market.CommitAuctionBid(dbConn, w, r)
-
-	// 通过WebSocket广播拍卖更新
-	if auctionWSManager != nil && auctionID > 0 {
-		auction, err := market.GetAuctionID(dbConn, auctionID)
-		if err == nil {
-			auctionWSManager.BroadcastAuctionWSUpdate(auction, "bid_placed")
-		}
-	}
+	market.CommitAuctionBid(auctionService, w, r, currentUserID(r))
 }
 
 // 取消荷兰钟拍卖
 func cancelAuction(w http.ResponseWriter, r *http.Request) {
-	// 先从请求中获取拍卖ID
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	var auctionID int
-
-	// 尝试解析请求体获取拍卖ID
-	body, err := io.ReadAll(r.Body)
-	if err == nil {
-		if err := json.Unmarshal(body, &data); err == nil {
-			auctionID = data.AuctionID
-		}
-	}
-
-	// 重置请求体，以便market.CancelAuction可以读取
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-	// 调用market.CancelAuction
-	market.CancelAuction(dbConn, w, r)
-
-	// 通过WebSocket广播拍卖更新
-	if auctionWSManager != nil && auctionID > 0 {
-		auction, err := market.GetAuctionID(dbConn, auctionID)
-		if err == nil {
-			auctionWSManager.BroadcastAuctionWSUpdate(auction, "cancelled")
-		}
-	}
+	market.CancelAuction(auctionService, w, r, currentUserID(r))
 }
 
 // 暂停荷兰钟拍卖
 func pauseAuction(w http.ResponseWriter, r *http.Request) {
-	// 先从请求中获取拍卖ID
-	var data struct {
-		AuctionID int `json:"auction_id"`
-	}
-	var auctionID int
-
-	// 尝试解析请求体获取拍卖ID
-	body, err := io.ReadAll(r.Body)
-	if err == nil {
-		if err := json.Unmarshal(body, &data); err == nil {
-			auctionID = data.AuctionID
-		}
-	}
-
-	// 重置请求体，以便market.PauseAuction可以读取
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-
-	// 调用market.PauseAuction
-	market.PauseAuction(dbConn, w, r)
+	market.PauseAuction(auctionService, w, r, currentUserID(r))
+}
 
-	// 通过WebSocket广播拍卖更新
-	if auctionWSManager != nil && auctionID > 0 {
-		auction, err := market.GetAuctionID(dbConn, auctionID)
-		if err == nil {
-			auctionWSManager.BroadcastAuctionWSUpdate(auction, "paused")
-		}
-	}
+// 恢复荷兰钟拍卖
+func resumeAuction(w http.ResponseWriter, r *http.Request) {
+	market.ResumeAuction(auctionService, w, r, currentUserID(r))
 }
 
 // 获取卖家荷兰钟拍卖列表
 func getSellerAuctions(w http.ResponseWriter, r *http.Request) {
-	market.GetSellerAuctions(dbConn, w, r)
+	market.GetSellerAuctions(auctionService, w, r, currentUserID(r))
 }
 
 // 重新激活荷兰钟拍卖
 func reactivateAuction(w http.ResponseWriter, r *http.Request) {
-	market.ReactivateAuction(dbConn, w, r)
+	market.ReactivateAuction(auctionService, w, r, currentUserID(r))
+}
+
+// 记录领域事件日志
+func logEvent(e events.Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Info("events", fmt.Sprintf("%s: %v\n", e.EventName(), err))
+		return
+	}
+	logger.Info("events", fmt.Sprintf("%s: %s\n", e.EventName(), data))
 }
 
 func main() {
@@ -295,6 +314,14 @@ func main() {
 		fmt.Printf("初始化时间服务系统失败 -> %v\n", err)
 	}
 
+	// 确保数据库目录存在
+	err = os.MkdirAll(filepath.Dir(_config.Cash.DbPath), 0755)
+	if err != nil {
+		logger.Info("main", fmt.Sprintf("创建数据库目录失败 -> %v\n", err))
+		fmt.Printf("创建数据库目录失败 -> %v\n", err)
+		return
+	}
+
 	// 打开数据库连接
 	dbConn, err = sql.Open("turso", _config.Cash.DbPath) // Turso 基于 Rust 重构 sqlite3，提高并发性能
 	if err != nil {
@@ -308,6 +335,27 @@ func main() {
 	dbConn.SetMaxIdleConns(1)                  // 设置最大空闲连接数
 	dbConn.SetConnMaxLifetime(1 * time.Minute) // 设置连接最大生存时间
 
+	// 业务数据通过存储接口读写，生产环境使用数据库实现
+	storage = market.NewSQLStorage(dbConn)
+	marketService = market.NewMarketService(storage)
+	auctionService = market.NewAuctionService(storage)
+	orderBookService = market.NewOrderBookService(storage)
+
+	// 注册数据库迁移
+	registerMigrations()
+
+	// 命令行: own-1Pixel migrate [status|up]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrateCommand(os.Args[2:])
+		dbConn.Close()
+		logger.Close()
+		if err != nil {
+			fmt.Printf("数据库迁移失败 -> %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 初始化数据库
 	err = initDatabase()
 	if err != nil {
@@ -319,8 +367,15 @@ func main() {
 	fmt.Printf("初始化数据库配置文件...[%s]\n", _config.Cash.DbPath)
 
 	// 初始化WebSocket管理器
-	auctionWSManager = market.InitAuctionWSManager(dbConn)
-	market.SetGlobalAuctionWSManager(auctionWSManager)
+	auctionWSManager = market.InitAuctionWSManager(auctionService, orderBookService)
+
+	// 发件箱通知按序号广播给WebSocket连接，领域事件发布时唤醒投递器
+	outboxDispatcher = market.NewOutboxDispatcher(storage, auctionWSManager.DeliverOutboxMessage)
+	events.SubscribeAll(func(events.Event) { outboxDispatcher.Notify() })
+	outboxDispatcher.Start()
+
+	// 日志记录所有领域事件
+	events.SubscribeAll(logEvent)
 
 	// 处理静态资源二进制化
 	staticFS, err := fs.Sub(frontendFS, "frontend")
@@ -341,9 +396,18 @@ func main() {
 		http.FileServer(http.FS(staticFS)).ServeHTTP(w, r)
 	})
 
+	// 登录认证相关路由
+	http.HandleFunc("/api/auth/login", login)
+	http.HandleFunc("/api/auth/logout", logout)
+	http.HandleFunc("/api/auth/register", register)
+
+	// 玩家相关路由
+	http.HandleFunc("/api/user/current", requireAuth(getCurrentUser))
+	http.HandleFunc("/api/user/list", requireAuth(getUsers))
+
 	// api:cash: 交易记录
-	http.HandleFunc("/api/cash/balance", getBalance)
-	http.HandleFunc("/api/cash/transactions", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/cash/balance", requireAuth(getBalance))
+	http.HandleFunc("/api/cash/transactions", requireAuth(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
 			getTransactions(w, r)
@@ -352,34 +416,39 @@ func main() {
 		default:
 			http.Error(w, "不允许的请求方法", http.StatusMethodNotAllowed)
 		}
-	})
+	}))
 
 	// 市场相关路由
-	http.HandleFunc("/api/market/balance", getBalance)
-	http.HandleFunc("/api/market/params", getMarketParams)
-	http.HandleFunc("/api/market/save-params", saveMarketParams)
-	http.HandleFunc("/api/market/backpack", getBackpack)
-	http.HandleFunc("/api/market/items", getMarketItems)
-	http.HandleFunc("/api/market/make-apple", makeApple)
-	http.HandleFunc("/api/market/make-wood", makeWood)
-	http.HandleFunc("/api/market/sell-apple", sellApple)
-	http.HandleFunc("/api/market/sell-wood", sellWood)
-	http.HandleFunc("/api/market/buy-apple", buyApple)
-	http.HandleFunc("/api/market/buy-wood", buyWood)
+	http.HandleFunc("/api/market/balance", requireAuth(getBalance))
+	http.HandleFunc("/api/market/params", requireAuth(getMarketParams))
+	http.HandleFunc("/api/market/save-params", requireAdmin(saveMarketParams))
+	http.HandleFunc("/api/market/backpack", requireAuth(getBackpack))
+	http.HandleFunc("/api/market/items", requireAuth(getMarketItems))
+	http.HandleFunc("/api/market/catalog", requireAuth(getCatalog))
+	http.HandleFunc("/api/market/make", requireAuth(makeItem))
+	http.HandleFunc("/api/market/jobs", requireAuth(getCraftingJobs))
+	http.HandleFunc("/api/market/sell", requireAuth(sellItem))
+	http.HandleFunc("/api/market/buy", requireAuth(buyItem))
+	http.HandleFunc("/api/market/orders", requireAuth(getUserOrders))
+	http.HandleFunc("/api/market/orders/place", requireAuth(placeOrder))
+	http.HandleFunc("/api/market/orders/cancel", requireAuth(cancelOrder))
+	http.HandleFunc("/api/market/orderbook", requireAuth(getOrderBook))
 
 	// 荷兰钟拍卖相关路由
-	http.HandleFunc("/api/auction/create", createAuction)
-	http.HandleFunc("/api/auction/list", getAuctions)
-	http.HandleFunc("/api/auction/seller-list", getSellerAuctions)
-	http.HandleFunc("/api/auction/get", getAuction)
-	http.HandleFunc("/api/auction/start", startAuction)
-	http.HandleFunc("/api/auction/bid", CommitAuctionBid)
-	http.HandleFunc("/api/auction/cancel", cancelAuction)
-	http.HandleFunc("/api/auction/pause", pauseAuction)
-	http.HandleFunc("/api/auction/reactivate", reactivateAuction)
+	http.HandleFunc("/api/auction/create", requireAuth(createAuction))
+	http.HandleFunc("/api/auction/list", requireAuth(getAuctions))
+	http.HandleFunc("/api/auction/seller-list", requireAuth(getSellerAuctions))
+	http.HandleFunc("/api/auction/get", requireAuth(getAuction))
+	http.HandleFunc("/api/auction/history", requireAuth(getAuctionHistory))
+	http.HandleFunc("/api/auction/start", requireAuth(startAuction))
+	http.HandleFunc("/api/auction/bid", requireAuth(CommitAuctionBid))
+	http.HandleFunc("/api/auction/cancel", requireAuth(cancelAuction))
+	http.HandleFunc("/api/auction/pause", requireAuth(pauseAuction))
+	http.HandleFunc("/api/auction/resume", requireAuth(resumeAuction))
+	http.HandleFunc("/api/auction/reactivate", requireAuth(reactivateAuction))
 
 	// 荷兰钟拍卖WebSocket端点
-	http.HandleFunc("/ws/auction", auctionWSManager.HandleAuctionWebSocket)
+	http.HandleFunc("/ws/auction", requireAuth(auctionWSManager.HandleAuctionWebSocket))
 
 	// 时间服务系统API端点
 	http.HandleFunc("/api/timeservice/sync-time", timeservice.GetSyncTime)